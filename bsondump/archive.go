@@ -0,0 +1,430 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongorestore/ns"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// archive.go implements --archive, which dumps the documents of the
+// namespaces of a mongodump archive instead of a single BSON file.
+
+var errArchiveClosed = errors.New("archive closed")
+
+// archiveDocument is a document of an archive and the namespace it belongs to.
+type archiveDocument struct {
+	namespace string
+	doc       []byte
+}
+
+// archiveSource demultiplexes the documents of the namespaces of an archive
+// that match --nsInclude. An archive.Parser runs in its own goroutine and
+// passes the documents to next one at a time.
+type archiveSource struct {
+	prelude *archive.Prelude
+	in      io.Closer
+	docs    chan archiveDocument
+	done    chan struct{}
+	err     error
+	// report describes what was lost with --salvage. It is only complete
+	// once next has returned a nil document.
+	report archive.SalvageReport
+}
+
+// openArchive opens the archive at path, or standard input if path is "-",
+// and reads its prelude. With a verification key, the whole archive is
+// verified first and its verified copy is read instead. It returns the reader
+// of the rest of the archive and the underlying file.
+func openArchive(
+	path string,
+	verifyKey ed25519.PublicKey,
+) (io.Reader, io.ReadCloser, *archive.Prelude, error) {
+	var in io.ReadCloser
+	if path == "-" {
+		in = ReadNopCloser{os.Stdin}
+	} else {
+		file, err := os.Open(util.ToUniversalPath(path))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("couldn't open archive: %v", err)
+		}
+		in = file
+	}
+
+	buffered := bufio.NewReader(in)
+	var reader io.Reader = buffered
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		log.Logvf(log.DebugLow, "archive %v is compressed with gzip", path)
+		zipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			_ = in.Close()
+			return nil, nil, nil, fmt.Errorf("error opening gzip archive: %v", err)
+		}
+		reader = zipReader
+	}
+	if verifyKey != nil {
+		verified, err := archive.VerifiedCopy(reader, verifyKey)
+		_ = in.Close()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("refusing to dump %v: %w", path, err)
+		}
+		in = verified
+		reader = bufio.NewReader(verified)
+	}
+
+	prelude := &archive.Prelude{}
+	err = prelude.Read(reader)
+	if err != nil {
+		_ = in.Close()
+		return nil, nil, nil, fmt.Errorf("error reading archive prelude: %v", err)
+	}
+	if err = archive.ValidateCompression(prelude.Header.Compression); err != nil {
+		_ = in.Close()
+		return nil, nil, nil, err
+	}
+	return reader, in, prelude, nil
+}
+
+// indexedSections returns a reader of only the blocks of the namespaces that
+// match includer, found with the namespace index of the archive. It returns
+// nil if the archive isn't a seekable file with an index.
+func indexedSections(in io.ReadCloser, prelude *archive.Prelude, includer *ns.Matcher) io.Reader {
+	file, ok := in.(*os.File)
+	if !ok || !prelude.Header.MayHaveIndex() {
+		return nil
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	index, err := archive.ReadIndex(file, info.Size())
+	if err != nil {
+		if err != archive.ErrNoIndex {
+			log.Logvf(log.Always, "unable to use the archive index, reading the whole archive: %v", err)
+		}
+		return nil
+	}
+	var namespaces []string
+	for _, namespace := range index.Namespaces() {
+		if includer.Has(namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sections, err := index.Sections(namespaces)
+	if err != nil {
+		log.Logvf(log.Always, "unable to use the archive index, reading the whole archive: %v", err)
+		return nil
+	}
+	log.Logvf(log.DebugLow, "reading %v namespaces using the archive index", len(namespaces))
+	return archive.NewSectionsReader(file, sections)
+}
+
+// newArchiveSource opens the archive of the options and starts reading the
+// documents of the namespaces that match includer, which may be nil to read
+// all of them. With a verification key, nothing is read until the signature of
+// the archive has been checked.
+func newArchiveSource(
+	opts *OutputOptions,
+	includer *ns.Matcher,
+	verifyKey ed25519.PublicKey,
+) (*archiveSource, error) {
+	reader, in, prelude, err := openArchive(opts.Archive, verifyKey)
+	if err != nil {
+		return nil, err
+	}
+	source := &archiveSource{
+		prelude: prelude,
+		in:      in,
+		docs:    make(chan archiveDocument),
+		done:    make(chan struct{}),
+	}
+	consumer := &archiveConsumer{
+		source:      source,
+		includer:    includer,
+		compression: prelude.Header.Compression,
+		salvage:     opts.Salvage,
+		frames:      map[string]*archive.FrameDecoder{},
+		hashes:      map[string]hash.Hash64{},
+		seen:        map[string]bool{},
+	}
+	// the index isn't covered by the signature, so a verified archive is
+	// read from start to end, as is a damaged archive
+	if includer != nil && verifyKey == nil && !opts.Salvage {
+		if sections := indexedSections(in, prelude, includer); sections != nil {
+			reader = sections
+		}
+	}
+
+	parser := &archive.Parser{In: reader, Salvage: opts.Salvage}
+	go func() {
+		defer close(source.docs)
+		err := parser.ReadAllBlocks(consumer)
+		if err == nil && opts.Salvage {
+			consumer.endSalvage()
+		}
+		if err != nil && !errors.Is(err, errArchiveClosed) {
+			source.err = fmt.Errorf("error reading archive: %v", err)
+		}
+	}()
+	return source, nil
+}
+
+// next returns the next document of the archive and its namespace. It returns
+// a nil document once all of the archive has been read.
+func (source *archiveSource) next() (string, []byte) {
+	doc, ok := <-source.docs
+	if !ok {
+		return "", nil
+	}
+	return doc.namespace, doc.doc
+}
+
+// Err returns the error that stopped the reading of the archive, if any.
+// It is only set once next has returned a nil document.
+func (source *archiveSource) Err() error {
+	return source.err
+}
+
+// Close stops reading the archive and closes it.
+func (source *archiveSource) Close() error {
+	close(source.done)
+	err := source.in.Close()
+	// wait for the parser to stop
+	for range source.docs {
+	}
+	return err
+}
+
+// archiveConsumer implements archive.ParserConsumer and passes the documents
+// of the included namespaces to an archiveSource, decompressing compressed
+// segments as needed. Like the archive.Demultiplexer, it checks the data of
+// each included namespace against the CRC in its EOF block.
+type archiveConsumer struct {
+	source      *archiveSource
+	includer    *ns.Matcher
+	compression string
+	salvage     bool
+	frames      map[string]*archive.FrameDecoder
+	// hashes holds the CRC of the documents read so far of each included
+	// namespace whose EOF block hasn't been read yet.
+	hashes map[string]hash.Hash64
+	// seen holds the included namespaces whose data has been found.
+	seen map[string]bool
+	// current is the namespace of the current block, and namespace is the
+	// same or "" if the documents of the current block aren't dumped.
+	current   string
+	namespace string
+}
+
+// HeaderBSON is part of the ParserConsumer interface.
+func (consumer *archiveConsumer) HeaderBSON(data []byte) error {
+	if archive.IsIndexHeader(data) {
+		return archive.ErrIndexReached
+	}
+	consumer.resetFrame()
+	consumer.current = ""
+	consumer.namespace = ""
+	if archive.IsSignatureHeader(data) {
+		return nil
+	}
+	header := archive.NamespaceHeader{}
+	err := bson.Unmarshal(data, &header)
+	if err != nil {
+		return fmt.Errorf("header bson doesn't unmarshal as a namespace header: %v", err)
+	}
+	namespace := header.Namespace()
+	if consumer.includer != nil && !consumer.includer.Has(namespace) {
+		return nil
+	}
+	if header.EOF {
+		return consumer.checkCRC(namespace, header.CRC)
+	}
+	consumer.current = namespace
+	consumer.namespace = namespace
+	consumer.seen[namespace] = true
+	if _, ok := consumer.hashes[namespace]; !ok {
+		consumer.hashes[namespace] = archive.NewCRC()
+	}
+	return nil
+}
+
+// checkCRC compares the CRC of the documents read of namespace with the CRC
+// of its EOF block. A mismatch is an error, or is reported with --salvage.
+func (consumer *archiveConsumer) checkCRC(namespace string, expected int64) error {
+	h, ok := consumer.hashes[namespace]
+	if !ok {
+		// a namespace without documents
+		h = archive.NewCRC()
+		consumer.seen[namespace] = true
+	}
+	delete(consumer.hashes, namespace)
+	crc := int64(h.Sum64())
+	if crc == expected {
+		return nil
+	}
+	if !consumer.salvage {
+		return fmt.Errorf("CRC mismatch for namespace %v, %v!=%v", namespace, crc, expected)
+	}
+	log.Logvf(log.Always, "salvage: CRC mismatch for namespace %v, %v!=%v", namespace, crc, expected)
+	report := &consumer.source.report
+	report.CRCMismatches = append(report.CRCMismatches, namespace)
+	return nil
+}
+
+// resetFrame drops the incomplete compressed frame of the current block, if
+// any, since a frame never spans blocks.
+func (consumer *archiveConsumer) resetFrame() {
+	if frames, ok := consumer.frames[consumer.namespace]; ok {
+		frames.Reset()
+	}
+}
+
+// Skipped is part of the archive.SalvageConsumer interface. The damaged data
+// is counted against the namespace that was being read.
+func (consumer *archiveConsumer) Skipped(skipped archive.SkippedRange) {
+	consumer.resetFrame()
+	skipped.Namespace = consumer.current
+	report := &consumer.source.report
+	report.Skipped = append(report.Skipped, skipped)
+	consumer.current = ""
+	consumer.namespace = ""
+}
+
+// endSalvage records the included namespaces whose EOF block was never
+// found, and those in the prelude whose data was never found.
+func (consumer *archiveConsumer) endSalvage() {
+	report := &consumer.source.report
+	for namespace := range consumer.hashes {
+		report.Unfinished = append(report.Unfinished, namespace)
+	}
+	for _, cm := range consumer.source.prelude.NamespaceMetadatas {
+		namespace := cm.DataNamespace()
+		if consumer.includer != nil && !consumer.includer.Has(namespace) {
+			continue
+		}
+		if !consumer.seen[namespace] {
+			report.Missing = append(report.Missing, namespace)
+		}
+	}
+	sort.Strings(report.Unfinished)
+	sort.Strings(report.Missing)
+}
+
+// BodyBSON is part of the ParserConsumer interface.
+func (consumer *archiveConsumer) BodyBSON(data []byte) error {
+	if consumer.namespace == "" {
+		return nil
+	}
+	if consumer.compression == archive.CompressionNone {
+		// Writes to the hash never return an error.
+		consumer.hashes[consumer.namespace].Write(data)
+		// the parser reuses data for the next document
+		return consumer.send(bytes.Clone(data))
+	}
+	frames, ok := consumer.frames[consumer.namespace]
+	if !ok {
+		var err error
+		frames, err = archive.NewFrameDecoder(consumer.compression)
+		if err != nil {
+			return err
+		}
+		consumer.frames[consumer.namespace] = frames
+	}
+	docs, complete, err := frames.AddChunk(data)
+	if err != nil || !complete {
+		return err
+	}
+	// Writes to the hash never return an error.
+	consumer.hashes[consumer.namespace].Write(docs)
+	return archive.SplitDocuments(consumer.namespace, docs, consumer.send)
+}
+
+func (consumer *archiveConsumer) send(doc []byte) error {
+	select {
+	case consumer.source.docs <- archiveDocument{consumer.namespace, doc}:
+		return nil
+	case <-consumer.source.done:
+		return errArchiveClosed
+	}
+}
+
+// End is part of the ParserConsumer interface.
+func (consumer *archiveConsumer) End() error {
+	return nil
+}
+
+// labelDocument returns a document that holds doc under "doc" and the
+// namespace it came from under "ns", which is how documents read from an
+// archive are output as JSON.
+func labelDocument(namespace string, doc bson.Raw) (bson.Raw, error) {
+	return bson.Marshal(bson.D{{Key: "ns", Value: namespace}, {Key: "doc", Value: doc}})
+}
+
+// ArchiveInfo writes the header of the archive and the metadata of each of its
+// namespaces in its prelude as Extended JSON documents.
+func (bd *BSONDump) ArchiveInfo() error {
+	if bd.archive == nil {
+		return fmt.Errorf("--archiveInfo requires --archive")
+	}
+	prelude := bd.archive.prelude
+	infos := []bson.D{{{Key: "header", Value: prelude.Header}}}
+	for _, cm := range prelude.NamespaceMetadatas {
+		namespace := cm.Database + "." + cm.Collection
+		if bd.includer != nil && !bd.includer.Has(namespace) {
+			continue
+		}
+		info := bson.D{
+			{Key: "ns", Value: namespace},
+			{Key: "type", Value: cm.Type},
+			{Key: "size", Value: cm.Size},
+		}
+		if cm.Metadata != "" {
+			var metadata bson.D
+			err := bson.UnmarshalExtJSON([]byte(cm.Metadata), true, &metadata)
+			if err != nil {
+				return fmt.Errorf("error parsing metadata for %v: %v", namespace, err)
+			}
+			info = append(info, bson.E{Key: "metadata", Value: metadata})
+		}
+		infos = append(infos, info)
+	}
+
+	for _, info := range infos {
+		out, err := bsonutil.MarshalExtJSONReversible(info, false, false)
+		if err != nil {
+			return fmt.Errorf("error converting archive metadata to extended JSON: %v", err)
+		}
+		if bd.OutputOptions.Pretty {
+			var formatted bytes.Buffer
+			if err = json.Indent(&formatted, out, "", "\t"); err != nil {
+				return fmt.Errorf("error prettifying extended JSON: %v", err)
+			}
+			out = formatted.Bytes()
+		}
+		if _, err = bd.OutputWriter.Write(append(out, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/mongoarchive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func writeTestArchive(t *testing.T, dir string) string {
+	simple := archive.SimpleArchive{
+		Header: archive.Header{ServerVersion: "7.0.0", ToolVersion: "100.0.0"},
+		CollectionMetadata: []archive.CollectionMetadata{
+			{Database: "db1", Collection: "c1", Metadata: `{"collectionName":"c1"}`},
+			{Database: "db1", Collection: "c2", Metadata: `{"collectionName":"c2"}`},
+			{Database: "db2", Collection: "c3", Metadata: `{"collectionName":"c3"}`},
+		},
+		Namespaces: []archive.SimpleNamespace{
+			{Database: "db1", Collection: "c1", Documents: []bson.D{{{"_id", 1}}, {{"_id", 2}}}},
+			{Database: "db1", Collection: "c2", Documents: []bson.D{{{"_id", "a"}}}},
+			{Database: "db2", Collection: "c3", Documents: []bson.D{{{"_id", 3}}}},
+		},
+	}
+	data, err := simple.Marshal()
+	require.NoError(t, err)
+	path := filepath.Join(dir, "test.archive")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// packTestArchive repacks the archive at path with mongoarchive and the given
+// pack options.
+func packTestArchive(t *testing.T, path string, args ...string) string {
+	dir := t.TempDir()
+	dumpDir := filepath.Join(dir, "dump")
+	packed := filepath.Join(dir, "packed.archive")
+	for _, args := range [][]string{
+		{"extract", path, "--out", dumpDir},
+		append([]string{"pack", dumpDir, "--archive=" + packed}, args...),
+	} {
+		opts, err := mongoarchive.ParseOptions(args, "", "")
+		require.NoError(t, err)
+		ma, err := mongoarchive.New(opts)
+		require.NoError(t, err)
+		require.NoError(t, ma.Run())
+	}
+	return packed
+}
+
+func runArchiveDump(t *testing.T, args ...string) (string, error) {
+	outPath := filepath.Join(t.TempDir(), "out")
+	opts, err := ParseOptions(append(args, "--outFile", outPath), "", "")
+	require.NoError(t, err)
+	dumper, err := New(opts)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case opts.ArchiveInfo:
+		err = dumper.ArchiveInfo()
+	case opts.Type == DebugOutputType:
+		_, err = dumper.Debug()
+	case opts.Type == BSONOutputType:
+		_, err = dumper.BSON()
+	default:
+		_, err = dumper.JSON()
+	}
+	require.NoError(t, dumper.Close())
+	out, readErr := os.ReadFile(outPath)
+	require.NoError(t, readErr)
+	return string(out), err
+}
+
+func TestBsondumpArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	path := writeTestArchive(t, t.TempDir())
+
+	t.Run("all namespaces", func(t *testing.T) {
+		out, err := runArchiveDump(t, "--archive="+path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			`{"ns":"db1.c1","doc":{"_id":{"$numberInt":"1"}}}`,
+			`{"ns":"db1.c1","doc":{"_id":{"$numberInt":"2"}}}`,
+			`{"ns":"db1.c2","doc":{"_id":"a"}}`,
+			`{"ns":"db2.c3","doc":{"_id":{"$numberInt":"3"}}}`,
+		}, strings.Split(strings.TrimSpace(out), "\n"))
+	})
+
+	t.Run("nsInclude", func(t *testing.T) {
+		out, err := runArchiveDump(t, "--archive="+path, "--nsInclude", "db1.c2", "--nsInclude", "db2.*")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			`{"ns":"db1.c2","doc":{"_id":"a"}}`,
+			`{"ns":"db2.c3","doc":{"_id":{"$numberInt":"3"}}}`,
+		}, strings.Split(strings.TrimSpace(out), "\n"))
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		out, err := runArchiveDump(t, "--archive="+path, "--nsInclude", "db2.c3", "--type", "debug")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out, "--- namespace: db2.c3 ---\n--- new object ---\n"), out)
+	})
+
+	t.Run("bson", func(t *testing.T) {
+		out, err := runArchiveDump(t, "--archive="+path, "--nsInclude", "db1.c1", "--type", "bson")
+		require.NoError(t, err)
+		first, err := bson.Marshal(bson.D{{"_id", 1}})
+		require.NoError(t, err)
+		second, err := bson.Marshal(bson.D{{"_id", 2}})
+		require.NoError(t, err)
+		assert.Equal(t, string(first)+string(second), out)
+	})
+
+	t.Run("archiveInfo", func(t *testing.T) {
+		out, err := runArchiveDump(t, "--archive="+path, "--archiveInfo", "--nsInclude", "db1.*")
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 3)
+		assert.Contains(t, lines[0], `"server_version":"7.0.0"`)
+		assert.Equal(t, `{"ns":"db1.c1","type":"","size":0,"metadata":{"collectionName":"c1"}}`, lines[1])
+		assert.Contains(t, lines[2], `"ns":"db1.c2"`)
+	})
+
+	t.Run("indexed and compressed", func(t *testing.T) {
+		packed := packTestArchive(t, path, "--archiveIndex", "--archiveCompression", "zstd")
+		out, err := runArchiveDump(t, "--archive="+packed, "--nsInclude", "db1.c1", "--limit", "1")
+		require.NoError(t, err)
+		assert.Equal(t, `{"ns":"db1.c1","doc":{"_id":{"$numberInt":"1"}}}`+"\n", out)
+		out, err = runArchiveDump(t, "--archive="+packed, "--nsInclude", "db2.*")
+		require.NoError(t, err)
+		assert.Equal(t, `{"ns":"db2.c3","doc":{"_id":{"$numberInt":"3"}}}`+"\n", out)
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		dir := t.TempDir()
+		public, private, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+		require.NoError(t, err)
+		publicDER, err := x509.MarshalPKIXPublicKey(public)
+		require.NoError(t, err)
+		privatePath := filepath.Join(dir, "key.pem")
+		publicPath := filepath.Join(dir, "key.pub.pem")
+		require.NoError(t, os.WriteFile(
+			privatePath,
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+			0600,
+		))
+		require.NoError(t, os.WriteFile(
+			publicPath,
+			pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+			0644,
+		))
+
+		signed := packTestArchive(t, path, "--signingKey", privatePath)
+		out, err := runArchiveDump(t, "--archive="+signed, "--nsInclude", "db1.c2", "--verifySignatureKey", publicPath)
+		require.NoError(t, err)
+		assert.Equal(t, `{"ns":"db1.c2","doc":{"_id":"a"}}`+"\n", out)
+
+		data, err := os.ReadFile(signed)
+		require.NoError(t, err)
+		// the string "a", with its length and terminating null
+		i := strings.Index(string(data), "\x02\x00\x00\x00a\x00")
+		require.Positive(t, i)
+		data[i+4] = 'b'
+		require.NoError(t, os.WriteFile(signed, data, 0644))
+		// the archive is refused before any of it is dumped
+		_, err = runArchiveDump(t, "--archive="+signed, "--verifySignatureKey", publicPath)
+		assert.ErrorContains(t, err, "refusing to dump")
+		assert.ErrorContains(t, err, "data of archive namespace db1.c2 does not match its signature")
+
+		_, err = runArchiveDump(t, "--archive="+path, "--verifySignatureKey", publicPath)
+		assert.ErrorIs(t, err, archive.ErrNotSigned)
+	})
+
+	_, err := ParseOptions([]string{"--nsInclude", "db1.*", path}, "", "")
+	assert.Error(t, err)
+	_, err = ParseOptions([]string{"--archive=" + path, path}, "", "")
+	assert.Error(t, err)
+}
+
+// dumpDamagedArchive dumps the archive at path as JSON and returns the output,
+// the salvage report and the error of the dump.
+func dumpDamagedArchive(t *testing.T, path string, args ...string) (string, *archive.SalvageReport, error) {
+	outPath := filepath.Join(t.TempDir(), "out")
+	opts, err := ParseOptions(append([]string{"--archive=" + path, "--outFile", outPath}, args...), "", "")
+	require.NoError(t, err)
+	dumper, err := New(opts)
+	require.NoError(t, err)
+	_, err = dumper.JSON()
+	require.NoError(t, dumper.Close())
+	out, readErr := os.ReadFile(outPath)
+	require.NoError(t, readErr)
+	return string(out), dumper.ArchiveSalvageReport(), err
+}
+
+func TestBsondumpDamagedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	path := writeTestArchive(t, t.TempDir())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	t.Run("changed data", func(t *testing.T) {
+		// the string "a", with its length and terminating null
+		changed := bytes.Clone(data)
+		i := bytes.Index(changed, []byte("\x02\x00\x00\x00a\x00"))
+		require.Positive(t, i)
+		changed[i+4] = 'b'
+		damaged := filepath.Join(t.TempDir(), "changed.archive")
+		require.NoError(t, os.WriteFile(damaged, changed, 0644))
+
+		_, _, err := dumpDamagedArchive(t, damaged)
+		assert.ErrorContains(t, err, "CRC mismatch for namespace db1.c2")
+
+		// a namespace that isn't dumped isn't checked
+		_, _, err = dumpDamagedArchive(t, damaged, "--nsInclude", "db1.c1")
+		assert.NoError(t, err)
+
+		out, report, err := dumpDamagedArchive(t, damaged, "--salvage")
+		require.NoError(t, err)
+		assert.Contains(t, out, `{"ns":"db1.c2","doc":{"_id":"b"}}`)
+		assert.Equal(t, []string{"db1.c2"}, report.CRCMismatches)
+		assert.Empty(t, report.Skipped)
+	})
+
+	t.Run("damaged document", func(t *testing.T) {
+		// make the length of the second document of db1.c1 invalid
+		damaged := bytes.Clone(data)
+		doc, err := bson.Marshal(bson.D{{"_id", 2}})
+		require.NoError(t, err)
+		i := bytes.Index(damaged, doc)
+		require.Positive(t, i)
+		binary.LittleEndian.PutUint32(damaged[i:], 3)
+		damagedPath := filepath.Join(t.TempDir(), "damaged.archive")
+		require.NoError(t, os.WriteFile(damagedPath, damaged, 0644))
+
+		_, _, err = dumpDamagedArchive(t, damagedPath)
+		assert.Error(t, err)
+
+		out, report, err := dumpDamagedArchive(t, damagedPath, "--salvage")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			`{"ns":"db1.c1","doc":{"_id":{"$numberInt":"1"}}}`,
+			`{"ns":"db1.c2","doc":{"_id":"a"}}`,
+			`{"ns":"db2.c3","doc":{"_id":{"$numberInt":"3"}}}`,
+		}, strings.Split(strings.TrimSpace(out), "\n"))
+		require.Len(t, report.Skipped, 1)
+		assert.Equal(t, "db1.c1", report.Skipped[0].Namespace)
+		// the EOF block of db1.c1 is found after its second document
+		assert.Equal(t, []string{"db1.c1"}, report.CRCMismatches)
+		assert.Empty(t, report.Unfinished)
+		assert.Empty(t, report.Missing)
+		assert.Equal(t, map[string]int64{"db1.c1": report.Skipped[0].Length}, report.LostBytes())
+	})
+}
@@ -9,23 +9,31 @@ package bsondump
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/failpoint"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/signing"
 	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongoexport"
+	"github.com/mongodb/mongo-tools/mongorestore/ns"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// maxBSONSize is 16kb + 16mb - This is the maximum size we would get when
+// dumping the oplog itself. See https://jira.mongodb.org/browse/TOOLS-3001.
+const maxBSONSize = (16 * 1024) + (16 * 1024 * 1024)
+
 // BSONDump is a container for the user-specified options and
 // internal state used for running bsondump.
 type BSONDump struct {
@@ -39,6 +47,25 @@ type BSONDump struct {
 	OutputWriter io.WriteCloser
 
 	InputSource *db.BSONSource
+
+	// archive is read instead of InputSource with --archive, and includer
+	// selects its namespaces with --nsInclude. namespace is the namespace of
+	// the last document read from the archive.
+	archive   *archiveSource
+	includer  *ns.Matcher
+	namespace string
+
+	// jsonInput is read instead of InputSource with --reverse.
+	jsonInput io.ReadCloser
+
+	// salvage skips the damaged parts of the input with --salvage.
+	salvage *salvageReader
+
+	// filter and projection evaluate --query and --fields.
+	filter     predicate
+	projection projection
+	numSkipped int64
+	numOutput  int64
 }
 
 type ReadNopCloser struct {
@@ -88,20 +115,69 @@ func New(opts Options) (*BSONDump, error) {
 		OutputOptions: opts.OutputOptions,
 	}
 
-	reader, err := opts.GetBSONReader()
-	if err != nil {
-		return nil, fmt.Errorf("getting BSON reader failed: %v", err)
+	var verifyKey ed25519.PublicKey
+	if opts.VerifySignatureKey != "" {
+		var err error
+		verifyKey, err = signing.LoadPublicKey(opts.VerifySignatureKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading --verifySignatureKey: %v", err)
+		}
+		// an archive's signature is checked when the archive is opened
+		if opts.Archive == "" {
+			err = signing.VerifyPath(util.ToUniversalPath(opts.BSONFileName), verifyKey)
+			if err != nil {
+				return nil, fmt.Errorf("refusing to dump %v: %v", opts.BSONFileName, err)
+			}
+		}
 	}
-	dumper.InputSource = db.NewBSONSource(reader)
 
-	// 16kb + 16mb - This is the maximum size we would get when dumping the
-	// oplog itself. See https://jira.mongodb.org/browse/TOOLS-3001.
-	maxBSONSize := (16 * 1024) + (16 * math.Pow(1024, 2))
-	dumper.InputSource.SetMaxBSONSize(int32(maxBSONSize))
+	if opts.Query != "" {
+		filter, err := parseQuery(opts.Query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --query: %v", err)
+		}
+		dumper.filter = filter
+	}
+	// with --type=csv, the fields are the columns of the output instead
+	if opts.Fields != "" && opts.Type != CSVOutputType {
+		dumper.projection = parseFields(opts.Fields)
+	}
+
+	if opts.Archive != "" {
+		if len(opts.NSInclude) > 0 {
+			var err error
+			dumper.includer, err = ns.NewMatcher(opts.NSInclude)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --nsInclude: %v", err)
+			}
+		}
+		var err error
+		dumper.archive, err = newArchiveSource(opts.OutputOptions, dumper.includer, verifyKey)
+		if err != nil {
+			return nil, err
+		}
+	} else if opts.Reverse {
+		var err error
+		dumper.jsonInput, err = opts.GetBSONReader()
+		if err != nil {
+			return nil, fmt.Errorf("getting JSON reader failed: %v", err)
+		}
+	} else {
+		reader, err := opts.GetBSONReader()
+		if err != nil {
+			return nil, fmt.Errorf("getting BSON reader failed: %v", err)
+		}
+		if opts.Salvage {
+			dumper.salvage = newSalvageReader(reader, maxBSONSize)
+			reader = dumper.salvage
+		}
+		dumper.InputSource = db.NewBSONSource(reader)
+		dumper.InputSource.SetMaxBSONSize(maxBSONSize)
+	}
 
 	writer, err := opts.GetWriter()
 	if err != nil {
-		_ = dumper.InputSource.Close()
+		_ = dumper.closeInput()
 		return nil, fmt.Errorf("getting Writer failed: %v", err)
 	}
 	dumper.OutputWriter = writer
@@ -112,12 +188,47 @@ func New(opts Options) (*BSONDump, error) {
 // Close cleans up the internal state of the given BSONDump instance. The instance should not be used again
 // after Close is called.
 func (bd *BSONDump) Close() error {
-	_ = bd.InputSource.Close()
+	_ = bd.closeInput()
 	return bd.OutputWriter.Close()
 }
 
-func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
-	extendedJSON, err := bsonutil.MarshalExtJSONReversible(doc, true, false)
+func (bd *BSONDump) closeInput() error {
+	if bd.archive != nil {
+		return bd.archive.Close()
+	}
+	if bd.jsonInput != nil {
+		return bd.jsonInput.Close()
+	}
+	return bd.InputSource.Close()
+}
+
+// hasInput reports whether the BSON file or archive has been opened.
+func (bd *BSONDump) hasInput() bool {
+	return bd.InputSource != nil || bd.archive != nil || bd.jsonInput != nil
+}
+
+// inputErr returns the error that stopped the reading of the BSON file or
+// archive, if any.
+func (bd *BSONDump) inputErr() error {
+	if bd.archive != nil {
+		return bd.archive.Err()
+	}
+	return bd.InputSource.Err()
+}
+
+// nextInput returns the next document of the BSON file or archive, or nil at
+// the end of the input.
+func (bd *BSONDump) nextInput() bson.Raw {
+	if bd.archive != nil {
+		var doc []byte
+		bd.namespace, doc = bd.archive.next()
+		return doc
+	}
+	return bd.InputSource.LoadNext()
+}
+
+func formatJSON(doc *bson.Raw, pretty, canonical bool) ([]byte, error) {
+	extendedJSON, err := bsonutil.MarshalExtJSONReversible(doc, canonical, false)
 	if err != nil {
 		return nil, fmt.Errorf("error converting BSON to extended JSON: %v", err)
 	}
@@ -132,6 +243,37 @@ func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
 	return extendedJSON, nil
 }
 
+// loadNext returns the next document of the BSON file to output, after
+// applying --query, --skip, --limit and --fields. It returns nil at the end of
+// the file or once the limit is reached.
+func (bd *BSONDump) loadNext() (bson.Raw, error) {
+	for {
+		if bd.OutputOptions.Limit > 0 && bd.numOutput >= bd.OutputOptions.Limit {
+			return nil, nil
+		}
+		doc := bd.nextInput()
+		if doc == nil {
+			return nil, nil
+		}
+		if bd.filter != nil && !bd.filter(doc) {
+			continue
+		}
+		if bd.numSkipped < bd.OutputOptions.Skip {
+			bd.numSkipped++
+			continue
+		}
+		bd.numOutput++
+		if bd.projection != nil {
+			projected, err := bd.projection.apply(doc)
+			if err != nil {
+				return doc, fmt.Errorf("error selecting --fields: %v", err)
+			}
+			return projected, nil
+		}
+		return doc, nil
+	}
+}
+
 // JSON iterates through the BSON file and for each document it finds,
 // recursively descends into objects and arrays and prints the human readable
 // JSON representation.
@@ -140,17 +282,28 @@ func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
 func (bd *BSONDump) JSON() (int, error) {
 	numFound := 0
 
-	if bd.InputSource == nil {
+	if !bd.hasInput() {
 		panic("Tried to call JSON() before opening file")
 	}
 
 	for {
-		result := bson.Raw(bd.InputSource.LoadNext())
+		result, err := bd.loadNext()
 		if result == nil {
 			break
 		}
 
-		if bytes, err := formatJSON(&result, bd.OutputOptions.Pretty); err != nil {
+		if err == nil && bd.archive != nil {
+			result, err = labelDocument(bd.namespace, result)
+		}
+		var bytes []byte
+		if err == nil {
+			bytes, err = formatJSON(
+				&result,
+				bd.OutputOptions.Pretty,
+				bd.OutputOptions.JSONFormat != mongoexport.Relaxed,
+			)
+		}
+		if err != nil {
 			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
 
 			//if objcheck is turned on, stop now. otherwise keep on dumpin'
@@ -169,13 +322,152 @@ func (bd *BSONDump) JSON() (int, error) {
 			time.Sleep(2 * time.Second)
 		}
 	}
-	if err := bd.InputSource.Err(); err != nil {
+	if err := bd.inputErr(); err != nil {
+		return numFound, err
+	}
+
+	return numFound, nil
+}
+
+// JSONArray iterates through the BSON file and prints the Extended JSON
+// representation of the documents it finds as the elements of a single JSON
+// array.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) JSONArray() (int, error) {
+	jsonFormat := bd.OutputOptions.JSONFormat
+	if jsonFormat == "" {
+		jsonFormat = mongoexport.Canonical
+	}
+	return bd.export(mongoexport.NewJSONExportOutput(
+		true,
+		bd.OutputOptions.Pretty,
+		bd.OutputWriter,
+		jsonFormat,
+	), true)
+}
+
+// CSV iterates through the BSON file and prints the values of the --fields of
+// the documents it finds as CSV rows, the same way mongoexport does.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) CSV() (int, error) {
+	if bd.OutputOptions.Fields == "" {
+		return 0, fmt.Errorf("CSV output requires a field list")
+	}
+	return bd.export(mongoexport.NewCSVExportOutput(
+		strings.Split(bd.OutputOptions.Fields, ","),
+		bd.OutputOptions.NoHeaderLine,
+		bd.OutputWriter,
+	), false)
+}
+
+// export writes the documents of the BSON file with a mongoexport output.
+// If label is set, documents read from an archive are labeled with their
+// namespace.
+func (bd *BSONDump) export(output mongoexport.ExportOutput, label bool) (int, error) {
+	numFound := 0
+
+	if !bd.hasInput() {
+		panic("Tried to export before opening file")
+	}
+
+	if err := output.WriteHeader(); err != nil {
+		return numFound, err
+	}
+	for {
+		result, err := bd.loadNext()
+		if result == nil {
+			break
+		}
+
+		if err == nil && label && bd.archive != nil {
+			result, err = labelDocument(bd.namespace, result)
+		}
+		var doc bson.D
+		if err == nil {
+			err = bson.Unmarshal(result, &doc)
+		}
+		if err == nil {
+			err = output.ExportDocument(doc)
+		}
+		if err != nil {
+			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
+
+			//if objcheck is turned on, stop now. otherwise keep on dumpin'
+			if bd.OutputOptions.ObjCheck {
+				return numFound, err
+			}
+		}
+		numFound++
+	}
+	if err := bd.inputErr(); err != nil {
 		return numFound, err
 	}
 
+	if err := output.WriteFooter(); err != nil {
+		return numFound, err
+	}
+	return numFound, output.Flush()
+}
+
+// BSON iterates through the BSON file and writes each document it finds to the
+// output unchanged. With --salvage, this writes a repaired copy of the file
+// that holds only its valid documents.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) BSON() (int, error) {
+	numFound := 0
+
+	if !bd.hasInput() {
+		panic("Tried to call BSON() before opening file")
+	}
+
+	for {
+		result, err := bd.loadNext()
+		if err != nil {
+			return numFound, err
+		}
+		if result == nil {
+			break
+		}
+
+		if bd.OutputOptions.ObjCheck {
+			if err := result.Validate(); err != nil {
+				return numFound, fmt.Errorf("failed to validate bson during objcheck: %v", err)
+			}
+		}
+		_, err = bd.OutputWriter.Write(result)
+		if err != nil {
+			return numFound, err
+		}
+		numFound++
+	}
+	if err := bd.inputErr(); err != nil {
+		return numFound, err
+	}
 	return numFound, nil
 }
 
+// SkippedRanges returns the ranges of the input that --salvage skipped
+// because they were damaged.
+func (bd *BSONDump) SkippedRanges() []SkippedRange {
+	if bd.salvage == nil {
+		return nil
+	}
+	return bd.salvage.skipped
+}
+
+// ArchiveSalvageReport returns what --salvage lost of the archive, or nil if
+// the input isn't an archive. It is only complete once all of the archive has
+// been read.
+func (bd *BSONDump) ArchiveSalvageReport() *archive.SalvageReport {
+	if bd.archive == nil {
+		return nil
+	}
+	return &bd.archive.report
+}
+
 // Debug iterates through the BSON file and for each document it finds,
 // recursively descends into objects and arrays and prints a human readable
 // BSON representation containing the type and size of each field.
@@ -184,12 +476,15 @@ func (bd *BSONDump) JSON() (int, error) {
 func (bd *BSONDump) Debug() (int, error) {
 	numFound := 0
 
-	if bd.InputSource == nil {
+	if !bd.hasInput() {
 		panic("Tried to call Debug() before opening file")
 	}
 
 	for {
-		result := bson.Raw(bd.InputSource.LoadNext())
+		result, err := bd.loadNext()
+		if err != nil {
+			return numFound, err
+		}
 		if result == nil {
 			break
 		}
@@ -202,14 +497,17 @@ func (bd *BSONDump) Debug() (int, error) {
 				return numFound, fmt.Errorf("failed to validate bson during objcheck: %v", err)
 			}
 		}
-		err := printBSON(result, 0, bd.OutputWriter)
+		if bd.archive != nil {
+			fmt.Fprintf(bd.OutputWriter, "--- namespace: %v ---\n", bd.namespace)
+		}
+		err = printBSON(result, 0, bd.OutputWriter)
 		if err != nil {
 			log.Logvf(log.Always, "encountered error debugging BSON data: %v", err)
 		}
 		numFound++
 	}
 
-	if err := bd.InputSource.Err(); err != nil {
+	if err := bd.inputErr(); err != nil {
 		// This error indicates the BSON document header is corrupted;
 		// either the 4-byte header couldn't be read in full, or
 		// the size in the header would require reading more bytes
@@ -8,7 +8,11 @@ package bsondump
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"math"
 	"os"
 	"os/exec"
@@ -16,6 +20,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/mongodb/mongo-tools/common/signing"
 	"github.com/mongodb/mongo-tools/common/testtype"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/stretchr/testify/require"
@@ -356,3 +361,212 @@ func runBsondump(args ...string) (string, error) {
 	out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
 	return string(out), err
 }
+
+func TestBsondumpVerifySignature(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "key.pub.pem")
+	require.NoError(t, os.WriteFile(
+		keyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		0644,
+	))
+
+	dumpDir := t.TempDir()
+	sample, err := os.ReadFile("testdata/sample.bson")
+	require.NoError(t, err)
+	bsonPath := filepath.Join(dumpDir, "db", "sample.bson")
+	require.NoError(t, os.MkdirAll(filepath.Dir(bsonPath), 0755))
+	require.NoError(t, os.WriteFile(bsonPath, sample, 0644))
+	require.NoError(t, signing.SignDirectory(dumpDir, private))
+
+	newDumper := func() error {
+		opts, err := ParseOptions(
+			[]string{"--verifySignatureKey", keyPath, "--outFile", os.DevNull, bsonPath},
+			"",
+			"",
+		)
+		require.NoError(t, err)
+		dumper, err := New(opts)
+		if err == nil {
+			require.NoError(t, dumper.Close())
+		}
+		return err
+	}
+	require.NoError(t, newDumper())
+
+	sample[len(sample)-2] ^= 0x01
+	require.NoError(t, os.WriteFile(bsonPath, sample, 0644))
+	require.ErrorContains(t, newDumper(), "does not match its digest")
+
+	_, err = ParseOptions([]string{"--verifySignatureKey", keyPath}, "", "")
+	require.Error(t, err, "stdin can't be verified")
+}
+
+func TestBsondumpSalvage(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var docs [][]byte
+	for i := 0; i < 10; i++ {
+		doc, err := bson.Marshal(bson.D{{"_id", i}, {"sub", bson.D{{"a", i}, {"b", "x"}}}})
+		require.NoError(t, err)
+		docs = append(docs, doc)
+	}
+
+	// Garbage before the third document, a damaged length for the sixth and a
+	// truncated document at the end.
+	var damaged []byte
+	var expected []byte
+	var ranges []SkippedRange
+	for i, doc := range docs {
+		switch i {
+		case 2:
+			ranges = append(ranges, SkippedRange{Offset: int64(len(damaged)), Length: 7})
+			damaged = append(damaged, "garbage"...)
+		case 5:
+			ranges = append(ranges, SkippedRange{Offset: int64(len(damaged)), Length: int64(len(doc))})
+			doc = bytes.Clone(doc)
+			doc[3] = 0x7f
+			damaged = append(damaged, doc...)
+			continue
+		}
+		damaged = append(damaged, doc...)
+		expected = append(expected, doc...)
+	}
+	ranges = append(ranges, SkippedRange{Offset: int64(len(damaged)), Length: 10})
+	damaged = append(damaged, docs[0][:10]...)
+
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "damaged.bson")
+	require.NoError(t, os.WriteFile(inPath, damaged, 0644))
+
+	salvage := func(t *testing.T, outputType string) ([]byte, []SkippedRange) {
+		outPath := filepath.Join(dir, "out."+outputType)
+		opts, err := ParseOptions(
+			[]string{"--salvage", "--type", outputType, "--outFile", outPath, inPath},
+			"",
+			"",
+		)
+		require.NoError(t, err)
+		dumper, err := New(opts)
+		require.NoError(t, err)
+		var numFound int
+		if outputType == BSONOutputType {
+			numFound, err = dumper.BSON()
+		} else {
+			numFound, err = dumper.JSON()
+		}
+		require.NoError(t, err)
+		require.Equal(t, len(docs)-1, numFound)
+		skipped := dumper.SkippedRanges()
+		require.NoError(t, dumper.Close())
+		out, err := os.ReadFile(outPath)
+		require.NoError(t, err)
+		return out, skipped
+	}
+
+	t.Run("bson", func(t *testing.T) {
+		out, skipped := salvage(t, BSONOutputType)
+		require.Equal(t, expected, out)
+		require.Equal(t, ranges, skipped)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, skipped := salvage(t, JSONOutputType)
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		require.Len(t, lines, len(docs)-1)
+		require.Contains(t, lines[0], `"_id":{"$numberInt":"0"}`)
+		require.Contains(t, lines[5], `"_id":{"$numberInt":"6"}`)
+		require.Equal(t, ranges, skipped)
+	})
+
+	t.Run("without salvage", func(t *testing.T) {
+		opts, err := ParseOptions([]string{"--type", "bson", "--outFile", os.DevNull, inPath}, "", "")
+		require.NoError(t, err)
+		dumper, err := New(opts)
+		require.NoError(t, err)
+		defer dumper.Close()
+		_, err = dumper.BSON()
+		require.Error(t, err)
+	})
+}
+
+func TestBsondumpExportFormats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.bson")
+	var data []byte
+	for i := 0; i < 3; i++ {
+		doc, err := bson.Marshal(bson.D{
+			{"_id", i},
+			{"name", fmt.Sprintf("doc, %v", i)},
+			{"address", bson.D{{"city", "Paris"}}},
+			{"tags", bson.A{"a", "b"}},
+		})
+		require.NoError(t, err)
+		data = append(data, doc...)
+	}
+	require.NoError(t, os.WriteFile(inPath, data, 0644))
+
+	dump := func(t *testing.T, args ...string) (string, int) {
+		outPath := filepath.Join(t.TempDir(), "out")
+		opts, err := ParseOptions(append(args, "--outFile", outPath, inPath), "", "")
+		require.NoError(t, err)
+		dumper, err := New(opts)
+		require.NoError(t, err)
+		var numFound int
+		switch opts.Type {
+		case CSVOutputType:
+			numFound, err = dumper.CSV()
+		case JSONArrayOutputType:
+			numFound, err = dumper.JSONArray()
+		default:
+			numFound, err = dumper.JSON()
+		}
+		require.NoError(t, err)
+		require.NoError(t, dumper.Close())
+		out, err := os.ReadFile(outPath)
+		require.NoError(t, err)
+		return string(out), numFound
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		out, numFound := dump(t, "--type", "csv", "--fields", "name,address.city,tags.1,missing", "--limit", "2")
+		require.Equal(t, 2, numFound)
+		require.Equal(t, "name,address.city,tags.1,missing\n\"doc, 0\",Paris,b,\n\"doc, 1\",Paris,b,\n", out)
+	})
+
+	t.Run("csv without header", func(t *testing.T) {
+		out, _ := dump(t, "--type", "csv", "--fields", "_id,tags", "--noHeaderLine")
+		require.Equal(t, "0,\"[\"\"a\"\",\"\"b\"\"]\"\n1,\"[\"\"a\"\",\"\"b\"\"]\"\n2,\"[\"\"a\"\",\"\"b\"\"]\"\n", out)
+	})
+
+	t.Run("jsonArray", func(t *testing.T) {
+		out, numFound := dump(t, "--type", "jsonArray", "--fields", "name")
+		require.Equal(t, 3, numFound)
+		require.Equal(
+			t,
+			`[{"_id":{"$numberInt":"0"},"name":"doc, 0"},{"_id":{"$numberInt":"1"},"name":"doc, 1"},{"_id":{"$numberInt":"2"},"name":"doc, 2"}]`+"\n",
+			out,
+		)
+	})
+
+	t.Run("relaxed", func(t *testing.T) {
+		out, _ := dump(t, "--jsonFormat", "relaxed", "--fields", "name", "--limit", "1")
+		require.Equal(t, `{"_id":0,"name":"doc, 0"}`+"\n", out)
+		out, _ = dump(t, "--type", "jsonArray", "--jsonFormat", "relaxed", "--fields", "name", "--limit", "1")
+		require.Equal(t, `[{"_id":0,"name":"doc, 0"}]`+"\n", out)
+	})
+
+	_, err := ParseOptions([]string{"--type", "csv", inPath}, "", "")
+	require.ErrorContains(t, err, "requires a field list")
+	_, err = ParseOptions([]string{"--noHeaderLine", inPath}, "", "")
+	require.Error(t, err)
+	_, err = ParseOptions([]string{"--jsonFormat", "legacy", inPath}, "", "")
+	require.Error(t, err)
+}
@@ -57,14 +57,50 @@ func main() {
 
 	log.Logvf(log.DebugLow, "running bsondump with --objcheck: %v", opts.ObjCheck)
 
+	if opts.ArchiveInfo {
+		err = dumper.ArchiveInfo()
+		if err != nil {
+			log.Logv(log.Always, err.Error())
+			os.Exit(util.ExitFailure)
+		}
+		return
+	}
+
 	var numFound int
-	if opts.Type == bsondump.DebugOutputType {
+	switch {
+	case opts.Reverse:
+		numFound, err = dumper.Reverse()
+	case opts.Type == bsondump.DebugOutputType:
 		numFound, err = dumper.Debug()
-	} else {
+	case opts.Type == bsondump.JSONArrayOutputType:
+		numFound, err = dumper.JSONArray()
+	case opts.Type == bsondump.CSVOutputType:
+		numFound, err = dumper.CSV()
+	case opts.Type == bsondump.BSONOutputType:
+		numFound, err = dumper.BSON()
+	case opts.Type == bsondump.SchemaOutputType:
+		numFound, err = dumper.Schema()
+	case opts.Type == bsondump.OplogOutputType:
+		numFound, err = dumper.Oplog()
+	default:
 		numFound, err = dumper.JSON()
 	}
 
 	log.Logvf(log.Always, "%v objects found", numFound)
+	if report := dumper.ArchiveSalvageReport(); opts.Salvage && report != nil {
+		report.Log()
+	} else if opts.Salvage {
+		var skippedBytes int64
+		for _, skipped := range dumper.SkippedRanges() {
+			skippedBytes += skipped.Length
+		}
+		log.Logvf(
+			log.Always,
+			"salvage: skipped %v damaged bytes in %v ranges",
+			skippedBytes,
+			len(dumper.SkippedRanges()),
+		)
+	}
 	if err != nil {
 		log.Logv(log.Always, err.Error())
 		os.Exit(util.ExitFailure)
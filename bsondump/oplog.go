@@ -0,0 +1,444 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/common/txn"
+	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongorestore/ns"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// oplog.go implements --type=oplog, which prints the entries of an oplog.bson
+// file as one summary line each.
+
+// opNames are the names of the oplog operation types, in the order of the
+// columns of the summary.
+var opNames = []struct{ op, name string }{
+	{"i", "insert"},
+	{"u", "update"},
+	{"d", "delete"},
+	{"c", "command"},
+	{"n", "noop"},
+}
+
+func opName(op string) string {
+	for _, name := range opNames {
+		if name.op == op {
+			return name.name
+		}
+	}
+	return op
+}
+
+// oplogFilter selects the operations printed by --type=oplog.
+type oplogFilter struct {
+	namespaces *ns.Matcher
+	ops        map[string]bool
+	start, end *primitive.Timestamp
+}
+
+// newOplogFilter parses --oplogNs, --oplogOps, --oplogStart and --oplogEnd.
+func newOplogFilter(opts *OutputOptions) (*oplogFilter, error) {
+	filter := &oplogFilter{}
+	var err error
+	if len(opts.OplogNS) > 0 {
+		filter.namespaces, err = ns.NewMatcher(opts.OplogNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --oplogNs: %v", err)
+		}
+	}
+	if opts.OplogOps != "" {
+		filter.ops = map[string]bool{}
+	Ops:
+		for _, op := range strings.Split(opts.OplogOps, ",") {
+			op = strings.TrimSpace(op)
+			for _, name := range opNames {
+				if op == name.op || op == name.name {
+					filter.ops[name.op] = true
+					continue Ops
+				}
+			}
+			return nil, fmt.Errorf("invalid --oplogOps: unknown operation type %q", op)
+		}
+	}
+	if opts.OplogStart != "" {
+		filter.start, err = parseOplogTime(opts.OplogStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --oplogStart: %v", err)
+		}
+	}
+	if opts.OplogEnd != "" {
+		filter.end, err = parseOplogTime(opts.OplogEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --oplogEnd: %v", err)
+		}
+	}
+	return filter, nil
+}
+
+// parseOplogTime parses a timestamp given as <seconds>[:ordinal], like
+// mongorestore's --oplogLimit, or as an RFC 3339 date.
+func parseOplogTime(value string) (*primitive.Timestamp, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return &primitive.Timestamp{T: uint32(date.Unix())}, nil
+	}
+	ts, err := util.ParseTimestampFlag(value)
+	if err != nil {
+		return nil, fmt.Errorf("%v is neither <seconds>[:ordinal] nor an RFC 3339 date: %v", value, err)
+	}
+	return &ts, nil
+}
+
+func (filter *oplogFilter) matches(op *db.Oplog) bool {
+	if filter.namespaces != nil && !filter.namespaces.Has(op.Namespace) {
+		return false
+	}
+	if filter.ops != nil && !filter.ops[op.Operation] {
+		return false
+	}
+	if filter.start != nil && util.TimestampGreaterThan(*filter.start, op.Timestamp) {
+		return false
+	}
+	return filter.end == nil || util.TimestampGreaterThan(*filter.end, op.Timestamp)
+}
+
+// pendingTxn holds the operations of a transaction that spans several oplog
+// entries until its last entry is read.
+type pendingTxn struct {
+	number int64
+	ops    []db.Oplog
+}
+
+// oplogPrinter prints oplog entries, grouping the operations of transactions
+// and of applyOps commands, and counts the printed operations by namespace.
+type oplogPrinter struct {
+	out    io.Writer
+	filter *oplogFilter
+	txns   map[txn.ID]*pendingTxn
+	// txnOrder is the order in which the pending transactions started.
+	txnOrder []txn.ID
+	counts   map[string]map[string]int64
+}
+
+func newOplogPrinter(out io.Writer, filter *oplogFilter) *oplogPrinter {
+	return &oplogPrinter{
+		out:    out,
+		filter: filter,
+		txns:   map[txn.ID]*pendingTxn{},
+		counts: map[string]map[string]int64{},
+	}
+}
+
+// add prints an oplog entry, or holds it until the end of its transaction.
+func (p *oplogPrinter) add(op db.Oplog) error {
+	meta, err := txn.NewMeta(op)
+	if err != nil {
+		return err
+	}
+	if !meta.IsTxn() {
+		if op.Operation == "c" && len(op.Object) > 0 && op.Object[0].Key == "applyOps" {
+			inner, err := innerOps(op)
+			if err != nil {
+				return err
+			}
+			return p.printGroup(op, "applyOps", inner)
+		}
+		return p.printOps(op)
+	}
+
+	if !meta.IsMultiOp() {
+		inner, err := innerOps(op)
+		if err != nil {
+			return err
+		}
+		return p.printGroup(op, fmt.Sprintf("txn %v committed", *op.TxnNumber), inner)
+	}
+
+	id := meta.ID()
+	pending, ok := p.txns[id]
+	if !ok {
+		pending = &pendingTxn{number: *op.TxnNumber}
+		p.txns[id] = pending
+		p.txnOrder = append(p.txnOrder, id)
+	}
+	if meta.IsData() {
+		inner, err := innerOps(op)
+		if err != nil {
+			return err
+		}
+		pending.ops = append(pending.ops, inner...)
+	}
+	if !meta.IsFinal() {
+		return nil
+	}
+	delete(p.txns, id)
+	status := "committed"
+	if meta.IsAbort() {
+		status = "aborted"
+	}
+	return p.printGroup(op, fmt.Sprintf("txn %v %v", pending.number, status), pending.ops)
+}
+
+// printGroup prints the header line of a transaction or applyOps command
+// followed by the operations in it that match the filter, if there are any.
+func (p *oplogPrinter) printGroup(op db.Oplog, header string, inner []db.Oplog) error {
+	var matching []db.Oplog
+	for i := range inner {
+		if p.filter.matches(&inner[i]) {
+			matching = append(matching, inner[i])
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(
+		p.out,
+		"%v %v (%v of %v operations)\n",
+		formatOplogTime(op.Timestamp),
+		header,
+		len(matching),
+		len(inner),
+	)
+	if err != nil {
+		return err
+	}
+	for i := range matching {
+		if err = p.printOp(&matching[i], "    "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printOps prints an oplog entry that isn't part of a group if it matches the filter.
+func (p *oplogPrinter) printOps(op db.Oplog) error {
+	if !p.filter.matches(&op) {
+		return nil
+	}
+	return p.printOp(&op, "")
+}
+
+func (p *oplogPrinter) printOp(op *db.Oplog, indent string) error {
+	counts, ok := p.counts[op.Namespace]
+	if !ok {
+		counts = map[string]int64{}
+		p.counts[op.Namespace] = counts
+	}
+	counts[op.Operation]++
+
+	line := fmt.Sprintf(
+		"%v%v %-7v %v",
+		indent,
+		formatOplogTime(op.Timestamp),
+		opName(op.Operation),
+		op.Namespace,
+	)
+	if detail := opDetail(op); detail != "" {
+		line += " " + detail
+	}
+	if op.TxnNumber != nil && indent == "" {
+		line += fmt.Sprintf(" txn: %v", *op.TxnNumber)
+	}
+	_, err := fmt.Fprintln(p.out, line)
+	return err
+}
+
+// end prints the transactions that were never committed or aborted and the
+// number of operations printed for each namespace.
+func (p *oplogPrinter) end() error {
+	for _, id := range p.txnOrder {
+		pending, ok := p.txns[id]
+		if !ok {
+			continue
+		}
+		_, err := fmt.Fprintf(
+			p.out,
+			"txn %v incomplete: %v operations without a commit or abort\n",
+			pending.number,
+			len(pending.ops),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(p.out)
+	gw := &text.GridWriter{ColumnPadding: 2}
+	gw.WriteCell("namespace")
+	for _, name := range opNames {
+		gw.WriteCell(name.name)
+	}
+	gw.WriteCell("total")
+	gw.EndRow()
+	namespaces := make([]string, 0, len(p.counts))
+	for namespace := range p.counts {
+		namespaces = append(namespaces, namespace)
+	}
+	slices.Sort(namespaces)
+	for _, namespace := range namespaces {
+		gw.WriteCell(namespace)
+		var total int64
+		for _, name := range opNames {
+			count := p.counts[namespace][name.op]
+			total += count
+			gw.WriteCell(strconv.FormatInt(count, 10))
+		}
+		gw.WriteCell(strconv.FormatInt(total, 10))
+		gw.EndRow()
+	}
+	gw.Flush(p.out)
+	return nil
+}
+
+// innerOps returns the operations of an applyOps command, unwrapping nested
+// applyOps commands. The operations get the timestamp of the command.
+func innerOps(op db.Oplog) ([]db.Oplog, error) {
+	value, err := bsonutil.FindValueByKey("applyOps", &op.Object)
+	if err != nil {
+		return nil, fmt.Errorf("applyOps command at %v has no applyOps field", formatOplogTime(op.Timestamp))
+	}
+	entries, ok := value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("applyOps field at %v is not an array", formatOplogTime(op.Timestamp))
+	}
+	var ops []db.Oplog
+	for _, entry := range entries {
+		raw, err := bson.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("applyOps entry at %v is not a document: %v", formatOplogTime(op.Timestamp), err)
+		}
+		inner := db.Oplog{}
+		if err = bson.Unmarshal(raw, &inner); err != nil {
+			return nil, fmt.Errorf("error reading applyOps entry at %v: %v", formatOplogTime(op.Timestamp), err)
+		}
+		inner.Timestamp = op.Timestamp
+		if inner.Operation == "c" && len(inner.Object) > 0 && inner.Object[0].Key == "applyOps" {
+			nested, err := innerOps(inner)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, nested...)
+			continue
+		}
+		ops = append(ops, inner)
+	}
+	return ops, nil
+}
+
+func formatOplogTime(ts primitive.Timestamp) string {
+	return fmt.Sprintf(
+		"%v %v:%v",
+		time.Unix(int64(ts.T), 0).UTC().Format(time.RFC3339),
+		ts.T,
+		ts.I,
+	)
+}
+
+// opDetail describes what an operation applies to: the _id of the document
+// of a CRUD operation, the name and target of a command or the message of a
+// no-op.
+func opDetail(op *db.Oplog) string {
+	switch op.Operation {
+	case "i", "d":
+		return idDetail(op.Object)
+	case "u":
+		if detail := idDetail(op.Query); detail != "" {
+			return detail
+		}
+		return idDetail(op.Object)
+	case "c":
+		if len(op.Object) == 0 {
+			return ""
+		}
+		command := op.Object[0]
+		if target, ok := command.Value.(string); ok {
+			return fmt.Sprintf("cmd: %v %v", command.Key, target)
+		}
+		return "cmd: " + command.Key
+	case "n":
+		if msg, err := bsonutil.FindValueByKey("msg", &op.Object); err == nil {
+			return fmt.Sprintf("msg: %v", msg)
+		}
+	}
+	return ""
+}
+
+func idDetail(doc bson.D) string {
+	for _, elem := range doc {
+		if elem.Key != "_id" {
+			continue
+		}
+		out, err := bsonutil.MarshalExtJSONReversible(bson.D{elem}, false, false)
+		if err != nil {
+			return fmt.Sprintf("_id: %v", elem.Value)
+		}
+		return "_id: " + strings.TrimSuffix(strings.TrimPrefix(string(out), `{"_id":`), "}")
+	}
+	return ""
+}
+
+// Oplog iterates through an oplog BSON file, such as the oplog.bson written by
+// mongodump --oplog, and prints a summary line for each operation that matches
+// the --oplog* filters, followed by the number of operations for each
+// namespace. Operations of transactions and applyOps commands are printed
+// together, under a line for the transaction or command.
+// It returns the number of oplog entries processed and a non-nil error if one
+// is encountered before the end of the file is reached.
+func (bd *BSONDump) Oplog() (int, error) {
+	numFound := 0
+
+	if !bd.hasInput() {
+		panic("Tried to call Oplog() before opening file")
+	}
+
+	filter, err := newOplogFilter(bd.OutputOptions)
+	if err != nil {
+		return numFound, err
+	}
+	printer := newOplogPrinter(bd.OutputWriter, filter)
+	for {
+		result, err := bd.loadNext()
+		if err != nil {
+			return numFound, err
+		}
+		if result == nil {
+			break
+		}
+
+		op := db.Oplog{}
+		err = bson.Unmarshal(result, &op)
+		if err == nil {
+			err = printer.add(op)
+		}
+		if err != nil {
+			log.Logvf(log.Always, "unable to dump oplog entry %v: %v", numFound+1, err)
+
+			//if objcheck is turned on, stop now. otherwise keep on dumpin'
+			if bd.OutputOptions.ObjCheck {
+				return numFound, err
+			}
+		}
+		numFound++
+	}
+	if err := bd.inputErr(); err != nil {
+		return numFound, err
+	}
+	return numFound, printer.end()
+}
@@ -0,0 +1,199 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func writeOplogTestFile(t *testing.T) string {
+	lsid, err := bson.Marshal(bson.D{{Key: "id", Value: "session"}})
+	require.NoError(t, err)
+	prevOpTime, err := bson.Marshal(bson.D{
+		{Key: "ts", Value: primitive.Timestamp{T: 1700000004, I: 1}},
+		{Key: "t", Value: int64(1)},
+	})
+	require.NoError(t, err)
+	txnNumber := func(n int64) *int64 { return &n }
+	inner := func(op, namespace string, id interface{}) bson.D {
+		return bson.D{
+			{Key: "op", Value: op},
+			{Key: "ns", Value: namespace},
+			{Key: "o", Value: bson.D{{Key: "_id", Value: id}}},
+		}
+	}
+
+	ops := []db.Oplog{
+		{
+			Timestamp: primitive.Timestamp{T: 1700000000, I: 1},
+			Operation: "i",
+			Namespace: "test.a",
+			Object:    bson.D{{Key: "_id", Value: 1}, {Key: "x", Value: "y"}},
+		},
+		{
+			Timestamp: primitive.Timestamp{T: 1700000001, I: 1},
+			Operation: "u",
+			Namespace: "test.a",
+			Object:    bson.D{{Key: "$v", Value: 2}, {Key: "diff", Value: bson.D{}}},
+			Query:     bson.D{{Key: "_id", Value: 1}},
+		},
+		{
+			Timestamp: primitive.Timestamp{T: 1700000002, I: 1},
+			Operation: "c",
+			Namespace: "test.$cmd",
+			Object:    bson.D{{Key: "create", Value: "b"}},
+		},
+		{
+			Timestamp: primitive.Timestamp{T: 1700000003, I: 1},
+			Operation: "n",
+			Object:    bson.D{{Key: "msg", Value: "periodic noop"}},
+		},
+		// a transaction in two entries
+		{
+			Timestamp: primitive.Timestamp{T: 1700000004, I: 1},
+			Operation: "c",
+			Namespace: "admin.$cmd",
+			Object: bson.D{
+				{Key: "applyOps", Value: bson.A{inner("i", "test.b", 2)}},
+				{Key: "partialTxn", Value: true},
+			},
+			LSID:      lsid,
+			TxnNumber: txnNumber(7),
+		},
+		{
+			Timestamp: primitive.Timestamp{T: 1700000005, I: 1},
+			Operation: "c",
+			Namespace: "admin.$cmd",
+			Object: bson.D{
+				{Key: "applyOps", Value: bson.A{inner("d", "test.a", 1)}},
+			},
+			LSID:       lsid,
+			TxnNumber:  txnNumber(7),
+			PrevOpTime: prevOpTime,
+		},
+		// nested applyOps
+		{
+			Timestamp: primitive.Timestamp{T: 1700000006, I: 1},
+			Operation: "c",
+			Namespace: "admin.$cmd",
+			Object: bson.D{{Key: "applyOps", Value: bson.A{
+				inner("i", "test.b", 3),
+				bson.D{
+					{Key: "op", Value: "c"},
+					{Key: "ns", Value: "admin.$cmd"},
+					{Key: "o", Value: bson.D{{Key: "applyOps", Value: bson.A{inner("i", "test.c", 4)}}}},
+				},
+			}}},
+		},
+		// a transaction that never ends
+		{
+			Timestamp: primitive.Timestamp{T: 1700000007, I: 1},
+			Operation: "c",
+			Namespace: "admin.$cmd",
+			Object: bson.D{
+				{Key: "applyOps", Value: bson.A{inner("i", "test.c", 5)}},
+				{Key: "partialTxn", Value: true},
+			},
+			LSID:      lsid,
+			TxnNumber: txnNumber(8),
+		},
+	}
+
+	inPath := filepath.Join(t.TempDir(), "oplog.bson")
+	var data []byte
+	for _, op := range ops {
+		raw, err := bson.Marshal(op)
+		require.NoError(t, err)
+		data = append(data, raw...)
+	}
+	require.NoError(t, os.WriteFile(inPath, data, 0644))
+	return inPath
+}
+
+func runOplog(t *testing.T, args ...string) []string {
+	outPath := filepath.Join(t.TempDir(), "out")
+	opts, err := ParseOptions(append([]string{"--type", "oplog", "--outFile", outPath}, args...), "", "")
+	require.NoError(t, err)
+	dumper, err := New(opts)
+	require.NoError(t, err)
+	numFound, err := dumper.Oplog()
+	require.NoError(t, err)
+	assert.Equal(t, 8, numFound)
+	require.NoError(t, dumper.Close())
+	out, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+}
+
+func TestBsondumpOplog(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	inPath := writeOplogTestFile(t)
+
+	t.Run("all operations", func(t *testing.T) {
+		lines := runOplog(t, inPath)
+		assert.Equal(t, []string{
+			`2023-11-14T22:13:20Z 1700000000:1 insert  test.a _id: 1`,
+			`2023-11-14T22:13:21Z 1700000001:1 update  test.a _id: 1`,
+			`2023-11-14T22:13:22Z 1700000002:1 command test.$cmd cmd: create b`,
+			`2023-11-14T22:13:23Z 1700000003:1 noop     msg: periodic noop`,
+			`2023-11-14T22:13:25Z 1700000005:1 txn 7 committed (2 of 2 operations)`,
+			`    2023-11-14T22:13:24Z 1700000004:1 insert  test.b _id: 2`,
+			`    2023-11-14T22:13:25Z 1700000005:1 delete  test.a _id: 1`,
+			`2023-11-14T22:13:26Z 1700000006:1 applyOps (2 of 2 operations)`,
+			`    2023-11-14T22:13:26Z 1700000006:1 insert  test.b _id: 3`,
+			`    2023-11-14T22:13:26Z 1700000006:1 insert  test.c _id: 4`,
+			`txn 8 incomplete: 1 operations without a commit or abort`,
+			``,
+			`namespace  insert  update  delete  command  noop  total`,
+			`                0       0       0        0     1      1`,
+			`test.$cmd       0       0       0        1     0      1`,
+			`   test.a       1       1       1        0     0      3`,
+			`   test.b       2       0       0        0     0      2`,
+			`   test.c       1       0       0        0     0      1`,
+		}, lines)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		lines := runOplog(
+			t,
+			inPath,
+			"--oplogNs", "test.b",
+			"--oplogOps", "i,delete",
+			"--oplogStart", "1700000001",
+			"--oplogEnd", "2023-11-14T22:13:26Z",
+		)
+		assert.Equal(t, []string{
+			`2023-11-14T22:13:25Z 1700000005:1 txn 7 committed (1 of 2 operations)`,
+			`    2023-11-14T22:13:24Z 1700000004:1 insert  test.b _id: 2`,
+			`txn 8 incomplete: 1 operations without a commit or abort`,
+			``,
+			`namespace  insert  update  delete  command  noop  total`,
+			`   test.b       1       0       0        0     0      1`,
+		}, lines)
+	})
+
+	_, err := ParseOptions([]string{"--oplogOps", "i", inPath}, "", "")
+	assert.Error(t, err)
+	opts, err := ParseOptions([]string{"--type", "oplog", "--oplogOps", "x", inPath}, "", "")
+	require.NoError(t, err)
+	dumper, err := New(opts)
+	require.NoError(t, err)
+	_, err = dumper.Oplog()
+	assert.ErrorContains(t, err, `unknown operation type "x"`)
+	require.NoError(t, dumper.Close())
+}
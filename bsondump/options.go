@@ -8,9 +8,11 @@ package bsondump
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/mongoexport"
 )
 
 var Usage = `<options> <file>
@@ -27,13 +29,43 @@ type Options struct {
 
 // Types out output supported by the --type option.
 const (
-	DebugOutputType = "debug"
-	JSONOutputType  = "json"
+	DebugOutputType     = "debug"
+	JSONOutputType      = "json"
+	JSONArrayOutputType = "jsonArray"
+	CSVOutputType       = "csv"
+	BSONOutputType      = "bson"
+	SchemaOutputType    = "schema"
+	OplogOutputType     = "oplog"
 )
 
 type OutputOptions struct {
 	// Format to display the BSON data file
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json"`
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json, jsonArray, csv, bson, schema, oplog"`
+
+	// Extended JSON format of --type=json and --type=jsonArray
+	JSONFormat mongoexport.JSONFormat `long:"jsonFormat" value-name:"<type>" default:"canonical" description:"the extended JSON format to output, either canonical or relaxed (defaults to 'canonical')"`
+
+	// Omit the CSV header line
+	NoHeaderLine bool `long:"noHeaderLine" description:"with --type=csv, output CSV data without a list of field names at the first line"`
+
+	// Format of the --type=schema report
+	SchemaFormat string `long:"schemaFormat" value-name:"<format>" default:"json" default-mask:"-" description:"format of the --type=schema report: json or grid (default: json)"`
+
+	// Fraction of the documents analyzed by --type=schema
+	SampleRate float64 `long:"sampleRate" value-name:"<rate>" description:"with --type=schema, analyze only a random sample of the documents, e.g., 0.1 for one in ten; by default all documents are analyzed"`
+
+	// Namespaces of the --type=oplog operations to output
+	OplogNS []string `long:"oplogNs" value-name:"<namespace-pattern>" description:"with --type=oplog, only output the operations on namespaces that match the pattern; may be repeated"`
+
+	// Types of the --type=oplog operations to output
+	OplogOps string `long:"oplogOps" value-name:"<op>[,<op>]*" description:"with --type=oplog, comma separated list of the types of operations to output: insert, update, delete, command and noop, or i, u, d, c and n"`
+
+	// Time range of the --type=oplog operations to output
+	OplogStart string `long:"oplogStart" value-name:"<timestamp>" description:"with --type=oplog, only output the operations at or after the timestamp, given as <seconds>[:ordinal] or as an RFC 3339 date"`
+	OplogEnd   string `long:"oplogEnd" value-name:"<timestamp>" description:"with --type=oplog, only output the operations before the timestamp, given as <seconds>[:ordinal] or as an RFC 3339 date"`
+
+	// Skip damaged bytes and carry on with the next valid document
+	Salvage bool `long:"salvage" description:"skip over damaged parts of the BSON file, scanning forward byte by byte for the next valid document, and report the byte ranges that were skipped. Use with --type=bson to write a repaired BSON file. With --archive, also report the namespaces that lost data or don't match their CRC"`
 
 	// Validate each BSON document before displaying
 	ObjCheck bool `long:"objcheck" description:"validate BSON during processing"`
@@ -41,11 +73,41 @@ type OutputOptions struct {
 	// Display JSON data with indents
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 
+	// Query filter, as an Extended JSON string
+	Query string `long:"query" short:"q" value-name:"<json>" description:"only output documents that match the query filter, as a v2 Extended JSON string, e.g., '{\"x\":{\"$gt\":1}}'"`
+
+	// Fields to include in the output
+	Fields string `long:"fields" short:"f" value-name:"<field>[,<field>]*" description:"comma separated list of the fields to output, which may be dotted paths into subdocuments; _id is always output, except with --type=csv where the fields are the columns of the output, in order (required for --type=csv)"`
+
+	// Number of matching documents to output
+	Limit int64 `long:"limit" value-name:"<count>" description:"limit the number of documents to output"`
+
+	// Number of matching documents to skip
+	Skip int64 `long:"skip" value-name:"<count>" description:"number of matching documents to skip"`
+
 	// Path to input BSON file
-	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON; default is stdin"`
+	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON, or with --reverse the JSON file to convert to BSON; default is stdin"`
+
+	// Path to an archive to read instead of a BSON file
+	Archive string `long:"archive" value-name:"<file-path>" optional:"true" optional-value:"-" description:"dump the documents of a mongodump archive instead of a BSON file, labeled with their namespace in JSON output. If flag is specified without a value, the archive is read from stdin"`
+
+	// Namespaces of the archive to dump
+	NSInclude []string `long:"nsInclude" value-name:"<namespace-pattern>" description:"with --archive, only dump the namespaces that match the pattern; uses the archive's index to skip the other namespaces when possible"`
+
+	// Print the archive's header and prelude
+	ArchiveInfo bool `long:"archiveInfo" description:"with --archive, output the archive header and the metadata of its namespaces instead of their documents"`
+
+	// Convert Extended JSON to BSON
+	Reverse bool `long:"reverse" description:"convert Extended JSON documents, one after the other or in a JSON array, in canonical, relaxed or legacy shell form, to a BSON file"`
+
+	// Write a .metadata.json file for the BSON file written by --reverse
+	WriteMetadata bool `long:"writeMetadata" description:"with --reverse and an --outFile ending in .bson, also write a matching .metadata.json file so that mongorestore can restore the BSON file"`
 
 	// Path to output file
 	OutFileName string `long:"outFile" description:"path to output file to dump BSON to; default is stdout"`
+
+	// Path to the public key used to verify the signed manifest of the BSON file's dump, or the signed archive
+	VerifySignatureKey string `long:"verifySignatureKey" value-name:"<filename>" description:"refuse to dump a BSON file that isn't listed in a manifest of its dump directory signed with the private key matching the Ed25519 public key in the given PEM file, or an archive that isn't signed with it, or that was changed after it was signed; an archive is first copied in full to the directory for temporary files, which needs as much free space as the archive, and verified; it's then dumped from the copy from start to end, without using its namespace index to skip namespaces"`
 }
 
 func (*OutputOptions) Name() string {
@@ -85,15 +147,98 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		outputOpts.BSONFileName = args[0]
 	}
 
+	if outputOpts.Archive != "" {
+		if outputOpts.BSONFileName != "" {
+			return Options{}, fmt.Errorf("cannot dump both a BSON file and --archive")
+		}
+	} else if len(outputOpts.NSInclude) > 0 || outputOpts.ArchiveInfo {
+		return Options{}, fmt.Errorf("--nsInclude and --archiveInfo can only be used with --archive")
+	}
+
+	if outputOpts.Reverse {
+		if outputOpts.Archive != "" || outputOpts.Salvage || outputOpts.VerifySignatureKey != "" {
+			return Options{}, fmt.Errorf(
+				"--reverse can't be used with --archive, --salvage or --verifySignatureKey",
+			)
+		}
+		if outputOpts.Query != "" || outputOpts.Fields != "" || outputOpts.Limit != 0 || outputOpts.Skip != 0 {
+			return Options{}, fmt.Errorf("--reverse can't be used with --query, --fields, --limit or --skip")
+		}
+	}
+	if outputOpts.WriteMetadata {
+		if !outputOpts.Reverse {
+			return Options{}, fmt.Errorf("--writeMetadata can only be used with --reverse")
+		}
+		if !strings.HasSuffix(outputOpts.OutFileName, ".bson") {
+			return Options{}, fmt.Errorf("--writeMetadata requires an --outFile ending in .bson")
+		}
+	}
+
+	if outputOpts.VerifySignatureKey != "" && outputOpts.BSONFileName == "" && outputOpts.Archive == "" {
+		return Options{}, fmt.Errorf("cannot use --verifySignatureKey when reading from standard input")
+	}
+
+	if outputOpts.Limit < 0 {
+		return Options{}, fmt.Errorf("--limit must not be negative")
+	}
+	if outputOpts.Skip < 0 {
+		return Options{}, fmt.Errorf("--skip must not be negative")
+	}
+
+	if outputOpts.SampleRate < 0 || outputOpts.SampleRate > 1 {
+		return Options{}, fmt.Errorf("--sampleRate must be between 0 and 1")
+	}
+	if outputOpts.SampleRate != 0 && outputOpts.Type != SchemaOutputType {
+		return Options{}, fmt.Errorf("--sampleRate can only be used with --type=%v", SchemaOutputType)
+	}
+	if outputOpts.Type != OplogOutputType &&
+		(len(outputOpts.OplogNS) > 0 || outputOpts.OplogOps != "" || outputOpts.OplogStart != "" || outputOpts.OplogEnd != "") {
+		return Options{}, fmt.Errorf(
+			"--oplogNs, --oplogOps, --oplogStart and --oplogEnd can only be used with --type=%v",
+			OplogOutputType,
+		)
+	}
+	if outputOpts.JSONFormat != mongoexport.Canonical && outputOpts.JSONFormat != mongoexport.Relaxed {
+		return Options{}, fmt.Errorf(
+			"unsupported JSON format '%v'. Must be one of '%v' or '%v'",
+			outputOpts.JSONFormat,
+			mongoexport.Canonical,
+			mongoexport.Relaxed,
+		)
+	}
+	if outputOpts.Type == CSVOutputType && outputOpts.Fields == "" {
+		return Options{}, fmt.Errorf("--type=%v requires a field list with --fields", CSVOutputType)
+	}
+	if outputOpts.NoHeaderLine && outputOpts.Type != CSVOutputType {
+		return Options{}, fmt.Errorf("--noHeaderLine can only be used with --type=%v", CSVOutputType)
+	}
+
+	switch outputOpts.SchemaFormat {
+	case "", SchemaJSONFormat, SchemaGridFormat:
+	default:
+		return Options{}, fmt.Errorf(
+			"unsupported schema format '%v'. Must be one of '%v' or '%v'",
+			outputOpts.SchemaFormat,
+			SchemaJSONFormat,
+			SchemaGridFormat,
+		)
+	}
+
 	switch outputOpts.Type {
-	case "", DebugOutputType, JSONOutputType:
+	case "", DebugOutputType, JSONOutputType, JSONArrayOutputType, CSVOutputType, BSONOutputType, SchemaOutputType,
+		OplogOutputType:
 		return Options{toolOpts, outputOpts}, nil
 	default:
 		return Options{}, fmt.Errorf(
-			"unsupported output type '%v'. Must be either '%v' or '%v'",
+			"unsupported output type '%v'. Must be one of '%v', '%v', '%v', '%v', '%v', '%v' or '%v'",
+			outputOpts.Type,
 			DebugOutputType,
 			JSONOutputType,
-			outputOpts.Type,
+			JSONArrayOutputType,
+			CSVOutputType,
+			BSONOutputType,
+			SchemaOutputType,
+			OplogOutputType,
 		)
 	}
 }
@@ -0,0 +1,521 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// query.go evaluates --query and --fields against the documents of the BSON
+// file. It implements the common subset of the MongoDB query language:
+// equality, $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $regex, $and,
+// $or and $nor, with dotted paths that descend into subdocuments and arrays.
+
+// predicate reports whether a document matches a query.
+type predicate func(doc bson.Raw) bool
+
+// parseQuery parses a query filter in Extended JSON.
+func parseQuery(query string) (predicate, error) {
+	var filter bson.D
+	err := bson.UnmarshalExtJSON([]byte(query), false, &filter)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing query as Extended JSON: %v", err)
+	}
+	return compileFilter(filter)
+}
+
+func compileFilter(filter bson.D) (predicate, error) {
+	var predicates []predicate
+	for _, elem := range filter {
+		var p predicate
+		var err error
+		switch elem.Key {
+		case "$and", "$or", "$nor":
+			p, err = compileLogical(elem.Key, elem.Value)
+		default:
+			if strings.HasPrefix(elem.Key, "$") {
+				return nil, fmt.Errorf("unsupported query operator %v", elem.Key)
+			}
+			p, err = compileField(strings.Split(elem.Key, "."), elem.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+	return allOf(predicates), nil
+}
+
+func allOf(predicates []predicate) predicate {
+	return func(doc bson.Raw) bool {
+		for _, p := range predicates {
+			if !p(doc) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func compileLogical(operator string, value interface{}) (predicate, error) {
+	clauses, ok := value.(bson.A)
+	if !ok || len(clauses) == 0 {
+		return nil, fmt.Errorf("%v must be a nonempty array", operator)
+	}
+	var predicates []predicate
+	for _, clause := range clauses {
+		filter, ok := clause.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%v must be an array of documents", operator)
+		}
+		p, err := compileFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+	if operator == "$and" {
+		return allOf(predicates), nil
+	}
+	anyOf := func(doc bson.Raw) bool {
+		for _, p := range predicates {
+			if p(doc) {
+				return true
+			}
+		}
+		return false
+	}
+	if operator == "$nor" {
+		return func(doc bson.Raw) bool { return !anyOf(doc) }, nil
+	}
+	return anyOf, nil
+}
+
+// compileField compiles the condition on the field at path, which is either a
+// document of operators or a value that the field must equal.
+func compileField(path []string, condition interface{}) (predicate, error) {
+	operators, ok := condition.(bson.D)
+	if !ok || len(operators) == 0 || !strings.HasPrefix(operators[0].Key, "$") {
+		match, err := compileEquals(condition)
+		if err != nil {
+			return nil, err
+		}
+		return func(doc bson.Raw) bool { return match(valuesAt(doc, path)) }, nil
+	}
+
+	var predicates []predicate
+	regexOptions := ""
+	for _, op := range operators {
+		if op.Key == "$options" {
+			regexOptions, ok = op.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("$options must be a string")
+			}
+		}
+	}
+	for _, op := range operators {
+		var match func([]bson.RawValue) bool
+		var err error
+		switch op.Key {
+		case "$eq":
+			match, err = compileEquals(op.Value)
+		case "$ne":
+			match, err = compileEquals(op.Value)
+			match = not(match)
+		case "$gt", "$gte", "$lt", "$lte":
+			match, err = compileComparison(op.Key, op.Value)
+		case "$in":
+			match, err = compileIn(op.Value)
+		case "$nin":
+			match, err = compileIn(op.Value)
+			match = not(match)
+		case "$exists":
+			exists := isTruthy(op.Value)
+			match = func(values []bson.RawValue) bool { return (len(values) > 0) == exists }
+		case "$regex":
+			match, err = compileRegex(op.Value, regexOptions)
+		case "$options":
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported query operator %v", op.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v for %v: %v", op.Key, strings.Join(path, "."), err)
+		}
+		predicates = append(predicates, func(doc bson.Raw) bool { return match(valuesAt(doc, path)) })
+	}
+	return allOf(predicates), nil
+}
+
+func not(match func([]bson.RawValue) bool) func([]bson.RawValue) bool {
+	if match == nil {
+		return nil
+	}
+	return func(values []bson.RawValue) bool { return !match(values) }
+}
+
+// compileEquals matches fields that equal value. A regular expression matches
+// the strings it matches, and null also matches a missing field.
+func compileEquals(value interface{}) (func([]bson.RawValue) bool, error) {
+	if regex, ok := value.(primitive.Regex); ok {
+		return compileRegex(regex.Pattern, regex.Options)
+	}
+	expected, err := toRawValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return func(values []bson.RawValue) bool {
+		if expected.Type == bsontype.Null && len(values) == 0 {
+			return true
+		}
+		for _, v := range values {
+			if equalValues(v, expected) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func compileComparison(operator string, value interface{}) (func([]bson.RawValue) bool, error) {
+	bound, err := toRawValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return func(values []bson.RawValue) bool {
+		for _, v := range values {
+			cmp, ok := compareValues(v, bound)
+			if !ok {
+				continue
+			}
+			switch {
+			case operator == "$gt" && cmp > 0,
+				operator == "$gte" && cmp >= 0,
+				operator == "$lt" && cmp < 0,
+				operator == "$lte" && cmp <= 0:
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func compileIn(value interface{}) (func([]bson.RawValue) bool, error) {
+	candidates, ok := value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("must be an array")
+	}
+	var matches []func([]bson.RawValue) bool
+	for _, candidate := range candidates {
+		match, err := compileEquals(candidate)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return func(values []bson.RawValue) bool {
+		for _, match := range matches {
+			if match(values) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func compileRegex(value interface{}, options string) (func([]bson.RawValue) bool, error) {
+	pattern, ok := value.(string)
+	if regex, isRegex := value.(primitive.Regex); isRegex {
+		pattern, ok = regex.Pattern, true
+		if options == "" {
+			options = regex.Options
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("must be a string or a regular expression")
+	}
+	flags := ""
+	for _, option := range options {
+		switch option {
+		case 'i', 'm', 's':
+			flags += string(option)
+		default:
+			return nil, fmt.Errorf("unsupported regular expression option %q", option)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return func(values []bson.RawValue) bool {
+		for _, v := range values {
+			if s, ok := v.StringValueOK(); ok && re.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func isTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int32:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case nil:
+		return false
+	}
+	return true
+}
+
+func toRawValue(value interface{}) (bson.RawValue, error) {
+	if value == nil {
+		return bson.RawValue{Type: bsontype.Null}, nil
+	}
+	t, data, err := bson.MarshalValue(value)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+	return bson.RawValue{Type: t, Value: data}, nil
+}
+
+// valuesAt returns the values of the field at path in doc. As in MongoDB
+// queries, a path descends into every document of an array, a numeric path
+// component also selects an array element, and the elements of an array at
+// the end of the path are returned along with the array.
+func valuesAt(doc bson.Raw, path []string) []bson.RawValue {
+	var values []bson.RawValue
+	appendValuesAt(bson.RawValue{Type: bsontype.EmbeddedDocument, Value: doc}, path, &values)
+	return values
+}
+
+func appendValuesAt(value bson.RawValue, path []string, values *[]bson.RawValue) {
+	if len(path) == 0 {
+		*values = append(*values, value)
+		if value.Type == bsontype.Array {
+			elements, _ := value.Array().Values()
+			*values = append(*values, elements...)
+		}
+		return
+	}
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		if v, err := value.Document().LookupErr(path[0]); err == nil {
+			appendValuesAt(v, path[1:], values)
+		}
+	case bsontype.Array:
+		array := value.Array()
+		if _, err := strconv.Atoi(path[0]); err == nil {
+			if v, err := array.LookupErr(path[0]); err == nil {
+				appendValuesAt(v, path[1:], values)
+			}
+		}
+		elements, _ := array.Values()
+		for _, element := range elements {
+			if element.Type == bsontype.EmbeddedDocument {
+				appendValuesAt(element, path, values)
+			}
+		}
+	}
+}
+
+func equalValues(a, b bson.RawValue) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	return a.Type == b.Type && bytes.Equal(a.Value, b.Value)
+}
+
+// compareValues compares values of the same kind, with all numeric types
+// comparing as numbers. ok is false if the values can't be ordered.
+func compareValues(a, b bson.RawValue) (cmp int, ok bool) {
+	if x, ok := integerValue(a); ok {
+		if y, ok := integerValue(b); ok {
+			return compareOrdered(x, y), true
+		}
+	}
+	if x, ok := numberValue(a); ok {
+		y, ok := numberValue(b)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(x, y), true
+	}
+	if a.Type != b.Type {
+		return 0, false
+	}
+	switch a.Type {
+	case bsontype.String:
+		return strings.Compare(a.StringValue(), b.StringValue()), true
+	case bsontype.ObjectID:
+		x, y := a.ObjectID(), b.ObjectID()
+		return bytes.Compare(x[:], y[:]), true
+	case bsontype.Boolean:
+		return compareOrdered(boolInt(a.Boolean()), boolInt(b.Boolean())), true
+	case bsontype.DateTime:
+		return compareOrdered(a.DateTime(), b.DateTime()), true
+	case bsontype.Timestamp:
+		xt, xi := a.Timestamp()
+		yt, yi := b.Timestamp()
+		if xt != yt {
+			return compareOrdered(xt, yt), true
+		}
+		return compareOrdered(xi, yi), true
+	case bsontype.Null, bsontype.MinKey, bsontype.MaxKey:
+		return 0, true
+	}
+	return 0, false
+}
+
+func integerValue(v bson.RawValue) (int64, bool) {
+	switch v.Type {
+	case bsontype.Int32:
+		return int64(v.Int32()), true
+	case bsontype.Int64:
+		return v.Int64(), true
+	}
+	return 0, false
+}
+
+func numberValue(v bson.RawValue) (float64, bool) {
+	switch v.Type {
+	case bsontype.Double:
+		return v.Double(), true
+	case bsontype.Int32:
+		return float64(v.Int32()), true
+	case bsontype.Int64:
+		return float64(v.Int64()), true
+	case bsontype.Decimal128:
+		f, err := strconv.ParseFloat(v.Decimal128().String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | uint32 | float64](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// projection is a tree of the fields selected by --fields. A nil subtree
+// selects the whole field.
+type projection map[string]projection
+
+// parseFields parses a comma separated list of fields to include in the
+// output. The _id field is always included.
+func parseFields(fields string) projection {
+	p := projection{"_id": nil}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		node := p
+		parts := strings.Split(field, ".")
+		for i, part := range parts {
+			child, exists := node[part]
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			if exists && child == nil {
+				// a parent field is already included in full
+				break
+			}
+			if child == nil {
+				child = projection{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return p
+}
+
+// apply returns a document with only the selected fields of doc, in the order
+// they appear in doc. Subtrees apply to subdocuments and to the documents of
+// arrays.
+func (p projection) apply(doc bson.Raw) (bson.Raw, error) {
+	projected, err := p.applyD(doc)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(projected)
+}
+
+func (p projection) applyD(doc bson.Raw) (bson.D, error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+	projected := bson.D{}
+	for _, elem := range elements {
+		sub, ok := p[elem.Key()]
+		if !ok {
+			continue
+		}
+		value := elem.Value()
+		if sub == nil {
+			projected = append(projected, bson.E{Key: elem.Key(), Value: value})
+			continue
+		}
+		switch value.Type {
+		case bsontype.EmbeddedDocument:
+			subDoc, err := sub.applyD(value.Document())
+			if err != nil {
+				return nil, err
+			}
+			projected = append(projected, bson.E{Key: elem.Key(), Value: subDoc})
+		case bsontype.Array:
+			values, err := value.Array().Values()
+			if err != nil {
+				return nil, err
+			}
+			array := bson.A{}
+			for _, v := range values {
+				if v.Type != bsontype.EmbeddedDocument {
+					continue
+				}
+				subDoc, err := sub.applyD(v.Document())
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, subDoc)
+			}
+			projected = append(projected, bson.E{Key: elem.Key(), Value: array})
+		}
+	}
+	return projected, nil
+}
@@ -0,0 +1,161 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQuery(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var raw bson.Raw
+	require.NoError(t, bson.UnmarshalExtJSON([]byte(`{
+		"_id": 1,
+		"name": "Alice",
+		"age": {"$numberLong": "42"},
+		"score": 7.5,
+		"tags": ["a", "b"],
+		"address": {"city": "Paris", "zip": "75001"},
+		"orders": [{"item": "pen", "qty": 2}, {"item": "ink", "qty": 10}],
+		"nothing": null
+	}`), false, &raw))
+
+	for query, expected := range map[string]bool{
+		`{}`:                                           true,
+		`{"name": "Alice"}`:                            true,
+		`{"name": "Bob"}`:                              false,
+		`{"age": 42}`:                                  true,
+		`{"age": 42.0}`:                                true,
+		`{"age": {"$gt": 41, "$lt": 43}}`:              true,
+		`{"age": {"$gte": 43}}`:                        false,
+		`{"score": {"$lte": 7.5}}`:                     true,
+		`{"name": {"$gt": 1}}`:                         false,
+		`{"name": {"$ne": "Bob"}}`:                     true,
+		`{"name": {"$in": ["Bob", "Alice"]}}`:          true,
+		`{"name": {"$nin": ["Bob", "Alice"]}}`:         false,
+		`{"tags": "b"}`:                                true,
+		`{"tags": ["a", "b"]}`:                         true,
+		`{"tags.1": "b"}`:                              true,
+		`{"tags.0": "b"}`:                              false,
+		`{"address.city": "Paris"}`:                    true,
+		`{"address.city": {"$exists": false}}`:         false,
+		`{"address.country": {"$exists": false}}`:      true,
+		`{"nothing": {"$exists": true}}`:               true,
+		`{"missing": null}`:                            true,
+		`{"nothing": null}`:                            true,
+		`{"name": null}`:                               false,
+		`{"orders.item": "ink"}`:                       true,
+		`{"orders.qty": {"$gt": 5}}`:                   true,
+		`{"orders.qty": {"$gt": 50}}`:                  false,
+		`{"orders.1.item": "ink"}`:                     true,
+		`{"name": {"$regex": "^al", "$options": "i"}}`: true,
+		`{"name": {"$regex": "^al"}}`:                  false,
+		`{"name": {"$regularExpression": {"pattern": "ice$", "options": ""}}}`: true,
+		`{"$or": [{"name": "Bob"}, {"age": 42}]}`:                              true,
+		`{"$and": [{"name": "Alice"}, {"age": 41}]}`:                           false,
+		`{"$nor": [{"name": "Bob"}, {"age": 41}]}`:                             true,
+		`{"address": {"city": "Paris", "zip": "75001"}}`:                       true,
+		`{"address": {"zip": "75001", "city": "Paris"}}`:                       false,
+	} {
+		match, err := parseQuery(query)
+		require.NoError(t, err, query)
+		assert.Equal(t, expected, match(raw), query)
+	}
+
+	for _, query := range []string{
+		`{"$where": "true"}`,
+		`{"a": {"$size": 1}}`,
+		`{"$or": {}}`,
+		`{"a": {"$in": 1}}`,
+		`{"a": {"$regex": "("}}`,
+		`not json`,
+	} {
+		_, err := parseQuery(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestProjection(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var raw bson.Raw
+	require.NoError(t, bson.UnmarshalExtJSON([]byte(`{
+		"_id": 1,
+		"name": "Alice",
+		"address": {"city": "Paris", "zip": "75001"},
+		"orders": [{"item": "pen", "qty": 2}, 3, {"qty": 10}]
+	}`), false, &raw))
+
+	for fields, expected := range map[string]string{
+		"name":                     `{"_id":1,"name":"Alice"}`,
+		"address.city,orders.item": `{"_id":1,"address":{"city":"Paris"},"orders":[{"item":"pen"},{}]}`,
+		"address,address.city":     `{"_id":1,"address":{"city":"Paris","zip":"75001"}}`,
+		"address.city,address":     `{"_id":1,"address":{"city":"Paris","zip":"75001"}}`,
+		"missing, name.first":      `{"_id":1}`,
+	} {
+		projected, err := parseFields(fields).apply(raw)
+		require.NoError(t, err, fields)
+		out, err := bson.MarshalExtJSON(projected, false, false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(out), fields)
+	}
+}
+
+func TestBsondumpQuery(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.bson")
+	var data []byte
+	for i := 0; i < 20; i++ {
+		doc, err := bson.Marshal(bson.D{{"_id", i}, {"even", i%2 == 0}, {"sub", bson.D{{"i", i}, {"s", "x"}}}})
+		require.NoError(t, err)
+		data = append(data, doc...)
+	}
+	require.NoError(t, os.WriteFile(inPath, data, 0644))
+
+	outPath := filepath.Join(dir, "out.json")
+	opts, err := ParseOptions([]string{
+		"--query", `{"even": true, "sub.i": {"$gte": 4}}`,
+		"--fields", "sub.i",
+		"--skip", "1",
+		"--limit", "3",
+		"--outFile", outPath,
+		inPath,
+	}, "", "")
+	require.NoError(t, err)
+	dumper, err := New(opts)
+	require.NoError(t, err)
+	numFound, err := dumper.JSON()
+	require.NoError(t, err)
+	require.NoError(t, dumper.Close())
+	assert.Equal(t, 3, numFound)
+
+	out, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"_id":{"$numberInt":"6"},"sub":{"i":{"$numberInt":"6"}}}`,
+		`{"_id":{"$numberInt":"8"},"sub":{"i":{"$numberInt":"8"}}}`,
+		`{"_id":{"$numberInt":"10"},"sub":{"i":{"$numberInt":"10"}}}`,
+	}, strings.Split(strings.TrimSpace(string(out)), "\n"))
+
+	opts.Query = `{"$where": "true"}`
+	_, err = New(opts)
+	assert.ErrorContains(t, err, "unsupported query operator $where")
+
+	_, err = ParseOptions([]string{"--limit", "-1", inPath}, "", "")
+	assert.Error(t, err)
+}
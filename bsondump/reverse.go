@@ -0,0 +1,218 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// reverse.go implements --reverse, which converts Extended JSON documents
+// back into a BSON file.
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// reverseMetadata is the .metadata.json file written with --writeMetadata. It
+// has the same layout as the metadata files written by mongodump.
+type reverseMetadata struct {
+	Options        bson.D   `bson:"options,omitempty"`
+	Indexes        []bson.D `bson:"indexes"`
+	CollectionName string   `bson:"collectionName"`
+}
+
+// jsonDocumentReader reads the JSON documents of a stream of documents or of
+// a JSON array of documents.
+type jsonDocumentReader struct {
+	decoder *json.Decoder
+	// isArray is set once the start of a JSON array has been read, and ended
+	// once its end has been read.
+	isArray bool
+	ended   bool
+	started bool
+}
+
+func newJSONDocumentReader(in io.Reader) *jsonDocumentReader {
+	return &jsonDocumentReader{decoder: json.NewDecoder(in)}
+}
+
+// nextNonSpace consumes and returns the next non-whitespace byte of the input.
+func (r *jsonDocumentReader) nextNonSpace() (byte, error) {
+	for {
+		if len(r.decoder.Buf) == 0 {
+			buf := make([]byte, 512)
+			n, err := r.decoder.R.Read(buf)
+			r.decoder.Buf = append(r.decoder.Buf, buf[:n]...)
+			if n == 0 && err != nil {
+				return 0, err
+			}
+			continue
+		}
+		c := r.decoder.Buf[0]
+		r.decoder.Buf = r.decoder.Buf[1:]
+		if !unicode.IsSpace(rune(c)) {
+			return c, nil
+		}
+	}
+}
+
+func (r *jsonDocumentReader) unread(c byte) {
+	r.decoder.Buf = append([]byte{c}, r.decoder.Buf...)
+}
+
+// next returns the JSON of the next document, or io.EOF at the end of the
+// input.
+func (r *jsonDocumentReader) next() ([]byte, error) {
+	if r.ended {
+		return nil, io.EOF
+	}
+	c, err := r.nextNonSpace()
+	if err != nil {
+		if err == io.EOF && r.isArray {
+			return nil, fmt.Errorf("bad JSON array format - found no closing bracket ']'")
+		}
+		return nil, err
+	}
+	switch {
+	case !r.started && c == json.ArrayStart:
+		r.isArray = true
+		c, err = r.nextNonSpace()
+		if err != nil {
+			return nil, fmt.Errorf("bad JSON array format - found no closing bracket ']'")
+		}
+	case r.started && r.isArray && c == json.ArraySep:
+		c, err = r.nextNonSpace()
+		if err != nil {
+			return nil, fmt.Errorf("bad JSON array format - found no closing bracket ']'")
+		}
+	case r.started && r.isArray && c != json.ArrayEnd:
+		return nil, fmt.Errorf("bad JSON array format - found '%v' between documents", string(c))
+	}
+	r.started = true
+	if r.isArray && c == json.ArrayEnd {
+		r.ended = true
+		// nothing but whitespace may follow the array
+		c, err = r.nextNonSpace()
+		if err == nil {
+			return nil, fmt.Errorf("bad JSON array format - found '%v' after ']'", string(c))
+		}
+		return nil, err
+	}
+	if c != '{' {
+		return nil, fmt.Errorf("expected a JSON document but found '%v'", string(c))
+	}
+	r.unread(c)
+	return r.decoder.ScanObject()
+}
+
+// parseExtendedJSON converts a JSON document in canonical or relaxed Extended
+// JSON v2, or in the legacy Extended JSON and shell forms understood by
+// common/json, to BSON.
+func parseExtendedJSON(data []byte) (bson.Raw, error) {
+	var doc bson.D
+	err := bson.UnmarshalExtJSON(data, false, &doc)
+	if err == nil {
+		return bson.Marshal(doc)
+	}
+	legacy, legacyErr := json.UnmarshalBsonD(data)
+	if legacyErr == nil {
+		doc, legacyErr = bsonutil.GetExtendedBsonD(legacy)
+	}
+	if legacyErr != nil {
+		return nil, fmt.Errorf("%v (as legacy extended JSON: %v)", err, legacyErr)
+	}
+	return bson.Marshal(doc)
+}
+
+// Reverse reads Extended JSON documents, either one after the other or as a
+// JSON array, and writes them to the output as BSON. With --writeMetadata, it
+// also writes a .metadata.json file next to the output so that mongorestore
+// can restore it.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the input is reached.
+func (bd *BSONDump) Reverse() (int, error) {
+	numFound := 0
+
+	if !bd.hasInput() {
+		panic("Tried to call Reverse() before opening file")
+	}
+
+	in := io.Reader(bd.jsonInput)
+	// skip a UTF-8 byte order mark
+	start := make([]byte, len(utf8BOM))
+	n, err := io.ReadFull(in, start)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return numFound, err
+	}
+	if !bytes.Equal(start[:n], utf8BOM) {
+		in = io.MultiReader(bytes.NewReader(start[:n]), in)
+	}
+
+	reader := newJSONDocumentReader(in)
+	for {
+		data, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return numFound, fmt.Errorf("error reading document #%v: %v", numFound+1, err)
+		}
+		doc, err := parseExtendedJSON(data)
+		if err == nil && bd.OutputOptions.ObjCheck {
+			err = doc.Validate()
+		}
+		if err != nil {
+			return numFound, fmt.Errorf("error converting document #%v: %v", numFound+1, err)
+		}
+		if _, err = bd.OutputWriter.Write(doc); err != nil {
+			return numFound, err
+		}
+		numFound++
+	}
+
+	if bd.OutputOptions.WriteMetadata {
+		if err := writeReverseMetadata(bd.OutputOptions.OutFileName); err != nil {
+			return numFound, err
+		}
+	}
+	return numFound, nil
+}
+
+// writeReverseMetadata writes the .metadata.json file of the BSON file at
+// bsonPath, for a collection named after the file with only an _id index.
+func writeReverseMetadata(bsonPath string) error {
+	base := strings.TrimSuffix(bsonPath, ".bson")
+	metadata := reverseMetadata{
+		Indexes: []bson.D{{
+			{Key: "v", Value: int32(2)},
+			{Key: "key", Value: bson.D{{Key: "_id", Value: int32(1)}}},
+			{Key: "name", Value: "_id_"},
+		}},
+		CollectionName: filepath.Base(base),
+	}
+	jsonBytes, err := bsonutil.MarshalExtJSONWithBSONRoundtripConsistency(metadata, true, false)
+	if err != nil {
+		return fmt.Errorf("error marshaling metadata json: %v", err)
+	}
+	metadataPath := base + ".metadata.json"
+	err = os.WriteFile(util.ToUniversalPath(metadataPath), jsonBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing metadata to %v: %v", metadataPath, err)
+	}
+	log.Logvf(log.DebugLow, "wrote metadata to %v", metadataPath)
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runReverse(t *testing.T, input string, args ...string) ([]bson.D, error) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.json")
+	require.NoError(t, os.WriteFile(inPath, []byte(input), 0644))
+	outPath := filepath.Join(dir, "out.bson")
+	opts, err := ParseOptions(append([]string{"--reverse", "--outFile", outPath, inPath}, args...), "", "")
+	require.NoError(t, err)
+	dumper, err := New(opts)
+	require.NoError(t, err)
+	numFound, err := dumper.Reverse()
+	require.NoError(t, dumper.Close())
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	var docs []bson.D
+	for len(out) > 0 {
+		size := int(binary.LittleEndian.Uint32(out))
+		var doc bson.D
+		require.NoError(t, bson.Unmarshal(out[:size], &doc))
+		docs = append(docs, doc)
+		out = out[size:]
+	}
+	require.Len(t, docs, numFound)
+	return docs, nil
+}
+
+func TestBsondumpReverse(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	oid, err := primitive.ObjectIDFromHex("5f8f1b0e2a9b0c1d2e3f4a5b")
+	require.NoError(t, err)
+	date := primitive.NewDateTimeFromTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	expected := []bson.D{
+		{{"_id", oid}, {"n", int32(1)}, {"l", int64(2)}, {"when", date}},
+		{{"_id", int32(2)}, {"s", "x"}, {"sub", bson.D{{"a", bson.A{int32(1), 2.5}}}}},
+	}
+
+	for name, input := range map[string]string{
+		"canonical lines": `{"_id":{"$oid":"5f8f1b0e2a9b0c1d2e3f4a5b"},"n":{"$numberInt":"1"},"l":{"$numberLong":"2"},"when":{"$date":{"$numberLong":"1704164645000"}}}
+{"_id":{"$numberInt":"2"},"s":"x","sub":{"a":[{"$numberInt":"1"},{"$numberDouble":"2.5"}]}}
+`,
+		"relaxed array": "\xEF\xBB\xBF" + `[
+	{"_id":{"$oid":"5f8f1b0e2a9b0c1d2e3f4a5b"},"n":1,"l":{"$numberLong":"2"},"when":{"$date":"2024-01-02T03:04:05Z"}},
+	{"_id":2,"s":"x","sub":{"a":[1,2.5]}}
+]
+`,
+		"legacy shell": `{"_id":ObjectId("5f8f1b0e2a9b0c1d2e3f4a5b"),"n":1,"l":NumberLong(2),"when":ISODate("2024-01-02T03:04:05Z")}
+{_id:2,s:"x",sub:{a:[1,2.5]}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			docs, err := runReverse(t, input)
+			require.NoError(t, err)
+			assert.Equal(t, expected, docs)
+		})
+	}
+
+	t.Run("empty array", func(t *testing.T) {
+		docs, err := runReverse(t, " [ ] \n")
+		require.NoError(t, err)
+		assert.Empty(t, docs)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := runReverse(t, `[{"a":1}{"a":2}]`)
+		assert.ErrorContains(t, err, "error reading document #2")
+		_, err = runReverse(t, `[{"a":1}`)
+		assert.ErrorContains(t, err, "no closing bracket")
+		_, err = runReverse(t, `[{"a":1}] x`)
+		assert.ErrorContains(t, err, "after ']'")
+		_, err = runReverse(t, `{"a":1} 5`)
+		assert.ErrorContains(t, err, "expected a JSON document")
+		_, err = runReverse(t, `{"a":{"$oid":"nope"}}`)
+		assert.ErrorContains(t, err, "error converting document #1")
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		dir := t.TempDir()
+		inPath := filepath.Join(dir, "in.json")
+		require.NoError(t, os.WriteFile(inPath, []byte(`{"_id":1}`), 0644))
+		outPath := filepath.Join(dir, "things.bson")
+		opts, err := ParseOptions([]string{"--reverse", "--writeMetadata", "--outFile", outPath, inPath}, "", "")
+		require.NoError(t, err)
+		dumper, err := New(opts)
+		require.NoError(t, err)
+		_, err = dumper.Reverse()
+		require.NoError(t, err)
+		require.NoError(t, dumper.Close())
+
+		metadata, err := os.ReadFile(filepath.Join(dir, "things.metadata.json"))
+		require.NoError(t, err)
+		assert.JSONEq(
+			t,
+			`{"indexes":[{"v":{"$numberInt":"2"},"key":{"_id":{"$numberInt":"1"}},"name":"_id_"}],"collectionName":"things"}`,
+			string(metadata),
+		)
+
+		_, err = ParseOptions([]string{"--reverse", "--writeMetadata", inPath}, "", "")
+		assert.Error(t, err)
+		_, err = ParseOptions([]string{"--writeMetadata", "--outFile", outPath, inPath}, "", "")
+		assert.Error(t, err)
+		_, err = ParseOptions([]string{"--reverse", "--query", "{}", inPath}, "", "")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SkippedRange is a range of damaged bytes that --salvage skipped.
+type SkippedRange struct {
+	Offset int64
+	Length int64
+}
+
+// salvageReader reads a damaged stream of BSON documents and passes on only
+// the documents that are fully valid, so that it can be read with a
+// db.BSONSource. When the document at the current offset is damaged, it scans
+// forward one byte at a time for the next offset that holds a valid document.
+type salvageReader struct {
+	source  io.ReadCloser
+	in      *bufio.Reader
+	maxSize int
+	offset  int64
+	pending []byte
+
+	// skipStart is the offset where the range being skipped started, or -1
+	// if no bytes are being skipped.
+	skipStart int64
+	skipped   []SkippedRange
+}
+
+func newSalvageReader(in io.ReadCloser, maxSize int) *salvageReader {
+	return &salvageReader{
+		source: in,
+		// a candidate document is only accepted after damage if the document
+		// after it is valid too, so two documents must fit in the buffer.
+		in:        bufio.NewReaderSize(in, 2*maxSize),
+		maxSize:   maxSize,
+		skipStart: -1,
+	}
+}
+
+// Read passes on the bytes of the valid documents of the stream.
+func (r *salvageReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		doc, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		r.pending = doc
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Close closes the damaged stream.
+func (r *salvageReader) Close() error {
+	return r.source.Close()
+}
+
+// next returns the next valid document, skipping over damaged bytes.
+func (r *salvageReader) next() ([]byte, error) {
+	for {
+		header, err := r.in.Peek(4)
+		if len(header) < 4 {
+			if len(header) > 0 && r.skipStart < 0 {
+				r.skipStart = r.offset
+			}
+			r.skip(len(header))
+			r.endSkip()
+			if err == nil || err == bufio.ErrBufferFull {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		size := int(int32(binary.LittleEndian.Uint32(header)))
+		if size >= 5 && size <= r.maxSize {
+			doc, _ := r.in.Peek(size)
+			// after damage, a valid document may just be an embedded document
+			// of a damaged one, so it must be followed by another document
+			if len(doc) == size && isValidDocument(doc) &&
+				(r.skipStart < 0 || r.followedByDocument(size)) {
+				r.endSkip()
+				out := make([]byte, size)
+				copy(out, doc)
+				r.skip(size)
+				return out, nil
+			}
+		}
+		if r.skipStart < 0 {
+			r.skipStart = r.offset
+		}
+		r.skip(1)
+	}
+}
+
+// followedByDocument reports whether the document of the given size at the
+// current offset is followed by the end of the stream or a valid document.
+func (r *salvageReader) followedByDocument(size int) bool {
+	window, err := r.in.Peek(size + 4)
+	if len(window) < size+4 {
+		return err == io.EOF
+	}
+	nextSize := int(int32(binary.LittleEndian.Uint32(window[size:])))
+	if nextSize < 5 || nextSize > r.maxSize {
+		return false
+	}
+	window, _ = r.in.Peek(size + nextSize)
+	return len(window) == size+nextSize && isValidDocument(window[size:])
+}
+
+func (r *salvageReader) skip(n int) {
+	discarded, _ := r.in.Discard(n)
+	r.offset += int64(discarded)
+}
+
+// endSkip records the range being skipped, if any.
+func (r *salvageReader) endSkip() {
+	if r.skipStart < 0 || r.offset == r.skipStart {
+		r.skipStart = -1
+		return
+	}
+	skipped := SkippedRange{Offset: r.skipStart, Length: r.offset - r.skipStart}
+	log.Logvf(
+		log.Always,
+		"salvage: skipped %v damaged bytes at offset %v",
+		skipped.Length,
+		skipped.Offset,
+	)
+	r.skipped = append(r.skipped, skipped)
+	r.skipStart = -1
+}
+
+func isValidDocument(doc []byte) bool {
+	return doc[len(doc)-1] == 0 && bson.Raw(doc).Validate() == nil
+}
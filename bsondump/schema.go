@@ -0,0 +1,391 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// schema.go implements --type=schema, which reports the shape of the
+// documents of a BSON file instead of the documents themselves.
+
+// Formats of the schema report, set with --schemaFormat.
+const (
+	SchemaJSONFormat = "json"
+	SchemaGridFormat = "grid"
+)
+
+// arrayElementsPath is appended to the path of an array to name its elements.
+// The fields of documents in an array are reported under <array>.[].<field>.
+const arrayElementsPath = "[]"
+
+// typeNames are the names of BSON types used by the $type query operator.
+var typeNames = map[bsontype.Type]string{
+	bsontype.Double:           "double",
+	bsontype.String:           "string",
+	bsontype.EmbeddedDocument: "object",
+	bsontype.Array:            "array",
+	bsontype.Binary:           "binData",
+	bsontype.Undefined:        "undefined",
+	bsontype.ObjectID:         "objectId",
+	bsontype.Boolean:          "bool",
+	bsontype.DateTime:         "date",
+	bsontype.Null:             "null",
+	bsontype.Regex:            "regex",
+	bsontype.DBPointer:        "dbPointer",
+	bsontype.JavaScript:       "javascript",
+	bsontype.Symbol:           "symbol",
+	bsontype.CodeWithScope:    "javascriptWithScope",
+	bsontype.Int32:            "int",
+	bsontype.Timestamp:        "timestamp",
+	bsontype.Int64:            "long",
+	bsontype.Decimal128:       "decimal",
+	bsontype.MinKey:           "minKey",
+	bsontype.MaxKey:           "maxKey",
+}
+
+// SchemaReport describes the documents of a BSON file.
+type SchemaReport struct {
+	// Documents is the number of documents read, and Sampled the number of
+	// them that were analyzed.
+	Documents    int64        `json:"documents"`
+	Sampled      int64        `json:"sampled"`
+	DocumentSize SizeStats    `json:"documentSize"`
+	Fields       []FieldStats `json:"fields"`
+}
+
+// SizeStats is the distribution of the sizes of the sampled documents.
+// Histogram counts the documents of each power of two size range.
+type SizeStats struct {
+	Min       int64        `json:"min"`
+	Max       int64        `json:"max"`
+	Avg       float64      `json:"avg"`
+	Histogram []SizeBucket `json:"histogram"`
+}
+
+// SizeBucket counts the documents larger than half of UpTo and at most UpTo
+// bytes long.
+type SizeBucket struct {
+	UpTo  int64 `json:"upTo"`
+	Count int64 `json:"count"`
+}
+
+// FieldStats describes the values of one dotted field path.
+type FieldStats struct {
+	Path string `json:"path"`
+	// Count is the number of sampled documents with the field, and
+	// Occurrence the percentage of sampled documents that have it.
+	Count      int64            `json:"count"`
+	Occurrence float64          `json:"occurrence"`
+	Types      map[string]int64 `json:"types"`
+
+	Number       *Range[float64] `json:"number,omitempty"`
+	Date         *Range[string]  `json:"date,omitempty"`
+	StringLength *Range[int]     `json:"stringLength,omitempty"`
+	ArrayLength  *Range[int]     `json:"arrayLength,omitempty"`
+}
+
+// Range is the smallest and largest of a set of values.
+type Range[T any] struct {
+	Min T `json:"min"`
+	Max T `json:"max"`
+}
+
+type ordered interface {
+	~int | ~int64 | ~float64
+}
+
+// valueRange accumulates the range of a set of values.
+type valueRange[T ordered] struct {
+	min, max T
+	set      bool
+}
+
+func (r *valueRange[T]) add(v T) {
+	if !r.set || v < r.min {
+		r.min = v
+	}
+	if !r.set || v > r.max {
+		r.max = v
+	}
+	r.set = true
+}
+
+func rangeOf[T ordered](r valueRange[T]) *Range[T] {
+	if !r.set {
+		return nil
+	}
+	return &Range[T]{Min: r.min, Max: r.max}
+}
+
+type fieldAccumulator struct {
+	count        int64
+	lastDoc      int64
+	types        map[string]int64
+	number       valueRange[float64]
+	date         valueRange[int64]
+	stringLength valueRange[int]
+	arrayLength  valueRange[int]
+}
+
+// schemaAccumulator builds a SchemaReport one document at a time.
+type schemaAccumulator struct {
+	documents int64
+	sampled   int64
+	sizes     valueRange[int64]
+	totalSize int64
+	buckets   map[int64]int64
+	fields    map[string]*fieldAccumulator
+}
+
+func newSchemaAccumulator() *schemaAccumulator {
+	return &schemaAccumulator{
+		buckets: map[int64]int64{},
+		fields:  map[string]*fieldAccumulator{},
+	}
+}
+
+func (s *schemaAccumulator) addDocument(doc bson.Raw) error {
+	s.sampled++
+	size := int64(len(doc))
+	s.sizes.add(size)
+	s.totalSize += size
+	s.buckets[int64(1)<<bits.Len64(uint64(size-1))]++
+	return s.addFields("", doc)
+}
+
+func (s *schemaAccumulator) addFields(prefix string, doc bson.Raw) error {
+	elements, err := doc.Elements()
+	if err != nil {
+		return err
+	}
+	for _, elem := range elements {
+		err = s.addValue(prefix+elem.Key(), elem.Value())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *schemaAccumulator) addValue(path string, value bson.RawValue) error {
+	field, ok := s.fields[path]
+	if !ok {
+		field = &fieldAccumulator{types: map[string]int64{}}
+		s.fields[path] = field
+	}
+	// a field counts once per document, even if it's in several array elements
+	if field.lastDoc != s.sampled {
+		field.lastDoc = s.sampled
+		field.count++
+	}
+	typeName, ok := typeNames[value.Type]
+	if !ok {
+		typeName = value.Type.String()
+	}
+	field.types[typeName]++
+
+	switch value.Type {
+	case bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.Decimal128:
+		if n, ok := numberValue(value); ok {
+			field.number.add(n)
+		}
+	case bsontype.DateTime:
+		field.date.add(value.DateTime())
+	case bsontype.String:
+		field.stringLength.add(utf8.RuneCountInString(value.StringValue()))
+	case bsontype.EmbeddedDocument:
+		return s.addFields(path+".", value.Document())
+	case bsontype.Array:
+		elements, err := value.Array().Values()
+		if err != nil {
+			return err
+		}
+		field.arrayLength.add(len(elements))
+		for _, element := range elements {
+			err = s.addValue(path+"."+arrayElementsPath, element)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *schemaAccumulator) report() *SchemaReport {
+	report := &SchemaReport{
+		Documents: s.documents,
+		Sampled:   s.sampled,
+		Fields:    []FieldStats{},
+	}
+	if s.sampled > 0 {
+		report.DocumentSize = SizeStats{
+			Min: s.sizes.min,
+			Max: s.sizes.max,
+			Avg: float64(s.totalSize) / float64(s.sampled),
+		}
+	}
+	report.DocumentSize.Histogram = []SizeBucket{}
+	for _, upTo := range slices.Sorted(maps.Keys(s.buckets)) {
+		report.DocumentSize.Histogram = append(
+			report.DocumentSize.Histogram,
+			SizeBucket{UpTo: upTo, Count: s.buckets[upTo]},
+		)
+	}
+	for _, path := range slices.Sorted(maps.Keys(s.fields)) {
+		field := s.fields[path]
+		stats := FieldStats{
+			Path:         path,
+			Count:        field.count,
+			Occurrence:   100 * float64(field.count) / float64(s.sampled),
+			Types:        field.types,
+			Number:       rangeOf(field.number),
+			StringLength: rangeOf(field.stringLength),
+			ArrayLength:  rangeOf(field.arrayLength),
+		}
+		if field.date.set {
+			stats.Date = &Range[string]{
+				Min: formatDate(field.date.min),
+				Max: formatDate(field.date.max),
+			}
+		}
+		report.Fields = append(report.Fields, stats)
+	}
+	return report
+}
+
+func formatDate(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+}
+
+// Schema reads the documents of the BSON file and writes a report of the
+// fields they have, the types of their values and the sizes of the documents,
+// as JSON or as a grid depending on --schemaFormat. With --sampleRate, only a
+// random sample of the documents is analyzed.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) Schema() (int, error) {
+	if !bd.hasInput() {
+		panic("Tried to call Schema() before opening file")
+	}
+
+	schema := newSchemaAccumulator()
+	sampleRate := bd.OutputOptions.SampleRate
+	for {
+		result, err := bd.loadNext()
+		if err != nil {
+			return int(schema.documents), err
+		}
+		if result == nil {
+			break
+		}
+		schema.documents++
+		if sampleRate > 0 && sampleRate < 1 && rand.Float64() >= sampleRate {
+			continue
+		}
+		err = schema.addDocument(result)
+		if err != nil {
+			if bd.OutputOptions.ObjCheck {
+				return int(schema.documents), fmt.Errorf("failed to validate bson during objcheck: %v", err)
+			}
+			log.Logvf(log.Always, "unable to analyze document %v: %v", schema.documents, err)
+		}
+	}
+	if err := bd.inputErr(); err != nil {
+		return int(schema.documents), err
+	}
+
+	report := schema.report()
+	if bd.OutputOptions.SchemaFormat == SchemaGridFormat {
+		writeSchemaGrid(bd.OutputWriter, report)
+		return int(schema.documents), nil
+	}
+	var out []byte
+	var err error
+	if bd.OutputOptions.Pretty {
+		out, err = json.MarshalIndent(report, "", "\t")
+	} else {
+		out, err = json.Marshal(report)
+	}
+	if err != nil {
+		return int(schema.documents), fmt.Errorf("error converting schema report to JSON: %v", err)
+	}
+	_, err = bd.OutputWriter.Write(append(out, '\n'))
+	return int(schema.documents), err
+}
+
+// writeSchemaGrid writes a schema report as a table of fields followed by the
+// distribution of document sizes.
+func writeSchemaGrid(w io.Writer, report *SchemaReport) {
+	gw := &text.GridWriter{ColumnPadding: 2}
+	gw.WriteCells("field", "occurrence", "types", "min", "max", "string length", "array length")
+	gw.EndRow()
+	for _, field := range report.Fields {
+		var types []string
+		for _, name := range slices.Sorted(maps.Keys(field.Types)) {
+			types = append(types, fmt.Sprintf("%v:%v", name, field.Types[name]))
+		}
+		minValue, maxValue := "", ""
+		if field.Number != nil {
+			minValue, maxValue = fmt.Sprint(field.Number.Min), fmt.Sprint(field.Number.Max)
+		} else if field.Date != nil {
+			minValue, maxValue = field.Date.Min, field.Date.Max
+		}
+		gw.WriteCells(
+			field.Path,
+			fmt.Sprintf("%.1f%%", field.Occurrence),
+			strings.Join(types, " "),
+			minValue,
+			maxValue,
+			formatRange(field.StringLength),
+			formatRange(field.ArrayLength),
+		)
+		gw.EndRow()
+	}
+	gw.Flush(w)
+
+	fmt.Fprintf(w, "\n%v documents, %v sampled\n", report.Documents, report.Sampled)
+	if report.Sampled == 0 {
+		return
+	}
+	fmt.Fprintf(
+		w,
+		"document size: min %v, max %v, avg %v\n",
+		text.FormatByteAmount(report.DocumentSize.Min),
+		text.FormatByteAmount(report.DocumentSize.Max),
+		text.FormatByteAmount(int64(report.DocumentSize.Avg)),
+	)
+	gw = &text.GridWriter{ColumnPadding: 2}
+	gw.WriteCells("size up to", "documents")
+	gw.EndRow()
+	for _, bucket := range report.DocumentSize.Histogram {
+		gw.WriteCells(text.FormatByteAmount(bucket.UpTo), fmt.Sprint(bucket.Count))
+		gw.EndRow()
+	}
+	gw.Flush(w)
+}
+
+func formatRange(r *Range[int]) string {
+	if r == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v-%v", r.Min, r.Max)
+}
@@ -0,0 +1,134 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func writeSchemaTestFile(t *testing.T) string {
+	inPath := filepath.Join(t.TempDir(), "in.bson")
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var data []byte
+	for i := 0; i < 4; i++ {
+		doc := bson.D{
+			{Key: "_id", Value: i},
+			{Key: "created", Value: date.AddDate(0, 0, i)},
+			{Key: "tags", Value: bson.A{"a", strings.Repeat("b", i+1)}[:i%2+1]},
+		}
+		if i%2 == 0 {
+			doc = append(doc, bson.E{Key: "score", Value: float64(i) / 2})
+		} else {
+			doc = append(doc, bson.E{Key: "score", Value: "n/a"})
+			doc = append(doc, bson.E{
+				Key:   "orders",
+				Value: bson.A{bson.D{{Key: "qty", Value: int64(i)}}},
+			})
+		}
+		raw, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		data = append(data, raw...)
+	}
+	require.NoError(t, os.WriteFile(inPath, data, 0644))
+	return inPath
+}
+
+func runSchema(t *testing.T, args ...string) string {
+	outPath := filepath.Join(t.TempDir(), "out")
+	opts, err := ParseOptions(append([]string{"--type", "schema", "--outFile", outPath}, args...), "", "")
+	require.NoError(t, err)
+	dumper, err := New(opts)
+	require.NoError(t, err)
+	_, err = dumper.Schema()
+	require.NoError(t, err)
+	require.NoError(t, dumper.Close())
+	out, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestSchema(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	inPath := writeSchemaTestFile(t)
+
+	var report SchemaReport
+	require.NoError(t, json.Unmarshal([]byte(runSchema(t, inPath)), &report))
+	assert.EqualValues(t, 4, report.Documents)
+	assert.EqualValues(t, 4, report.Sampled)
+
+	fields := map[string]FieldStats{}
+	for _, field := range report.Fields {
+		fields[field.Path] = field
+	}
+	assert.Equal(
+		t,
+		[]string{"_id", "created", "orders", "orders.[]", "orders.[].qty", "score", "tags", "tags.[]"},
+		func() []string {
+			var paths []string
+			for _, field := range report.Fields {
+				paths = append(paths, field.Path)
+			}
+			return paths
+		}(),
+	)
+
+	assert.Equal(t, 100.0, fields["_id"].Occurrence)
+	assert.Equal(t, &Range[float64]{Min: 0, Max: 3}, fields["_id"].Number)
+	assert.Equal(t, map[string]int64{"int": 4}, fields["_id"].Types)
+
+	assert.Equal(t, &Range[string]{
+		Min: "2024-01-01T00:00:00Z",
+		Max: "2024-01-04T00:00:00Z",
+	}, fields["created"].Date)
+
+	assert.Equal(t, map[string]int64{"double": 2, "string": 2}, fields["score"].Types)
+	assert.Equal(t, &Range[float64]{Min: 0, Max: 1}, fields["score"].Number)
+	assert.Equal(t, &Range[int]{Min: 3, Max: 3}, fields["score"].StringLength)
+
+	assert.Equal(t, &Range[int]{Min: 1, Max: 2}, fields["tags"].ArrayLength)
+	assert.Equal(t, map[string]int64{"string": 6}, fields["tags.[]"].Types)
+	assert.EqualValues(t, 4, fields["tags.[]"].Count)
+	assert.Equal(t, &Range[int]{Min: 1, Max: 4}, fields["tags.[]"].StringLength)
+
+	assert.Equal(t, 50.0, fields["orders.[].qty"].Occurrence)
+	assert.Equal(t, map[string]int64{"long": 2}, fields["orders.[].qty"].Types)
+
+	var sized int64
+	for _, bucket := range report.DocumentSize.Histogram {
+		sized += bucket.Count
+		assert.LessOrEqual(t, report.DocumentSize.Min, bucket.UpTo)
+	}
+	assert.EqualValues(t, 4, sized)
+	assert.LessOrEqual(t, report.DocumentSize.Max, report.DocumentSize.Histogram[len(report.DocumentSize.Histogram)-1].UpTo)
+
+	require.NoError(t, json.Unmarshal([]byte(runSchema(t, "--query", `{"orders": {"$exists": true}}`, inPath)), &report))
+	assert.EqualValues(t, 2, report.Sampled)
+	assert.Equal(t, 100.0, report.Fields[2].Occurrence)
+
+	grid := runSchema(t, "--schemaFormat", "grid", inPath)
+	assert.Contains(t, grid, "orders.[].qty")
+	assert.Contains(t, grid, "double:2 string:2")
+	assert.Contains(t, grid, "4 documents, 4 sampled")
+
+	_, err := ParseOptions([]string{"--sampleRate", "0.5", inPath}, "", "")
+	assert.ErrorContains(t, err, "--sampleRate can only be used with --type=schema")
+	_, err = ParseOptions([]string{"--type", "schema", "--sampleRate", "2", inPath}, "", "")
+	assert.Error(t, err)
+	_, err = ParseOptions([]string{"--type", "schema", "--schemaFormat", "xml", inPath}, "", "")
+	assert.Error(t, err)
+}
@@ -21,7 +21,7 @@ import (
 
 // pkgNames is a list of the names of all the packages to test or build.
 var pkgNames = []string{
-	"bsondump",
+	"bsondump", "mongoarchive",
 	"mongodump", "mongorestore",
 	"mongoimport", "mongoexport",
 	"mongostat", "mongotop",
@@ -6,7 +6,13 @@
 
 package archive
 
-import "io"
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+)
 
 // NamespaceHeader is a data structure that, as BSON, is found in archives where it indicates
 // that either the subsequent stream of BSON belongs to this new namespace, or that the
@@ -18,6 +24,11 @@ type NamespaceHeader struct {
 	CRC        int64  `bson:"CRC"`
 }
 
+// Namespace returns the namespace of the header.
+func (header *NamespaceHeader) Namespace() string {
+	return header.Database + "." + header.Collection
+}
+
 // CollectionMetadata is a data structure that, as BSON, is found in the prelude of the archive.
 // There is one CollectionMetadata per collection that will be in the archive.
 // For a CollectionMetadata for collection X with Type == "timeseries",
@@ -31,13 +42,73 @@ type CollectionMetadata struct {
 	Type       string `bson:"type"`
 }
 
+// DataNamespace returns the namespace under which the documents of the
+// collection are found in the archive, which is the system.buckets collection
+// of a timeseries collection.
+func (cm *CollectionMetadata) DataNamespace() string {
+	if cm.Type == "timeseries" {
+		return cm.Database + ".system.buckets." + cm.Collection
+	}
+	return cm.Database + "." + cm.Collection
+}
+
+// NewCRC returns a hash of the data of a namespace, whose sum is the CRC in the
+// namespace's EOF header.
+func NewCRC() hash.Hash64 {
+	return crc64.New(crc64.MakeTable(crc64.ECMA))
+}
+
+// SplitDocuments calls fn with each of the BSON documents of data, which must
+// hold whole documents of namespace, as a decompressed frame does. It returns
+// an error if the documents are truncated, or the first error returned by fn.
+func SplitDocuments(namespace string, data []byte, fn func(doc []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return fmt.Errorf("truncated document in namespace %v", namespace)
+		}
+		size := int(binary.LittleEndian.Uint32(data))
+		if size < 5 || size > len(data) {
+			return fmt.Errorf("invalid document size %v in namespace %v", size, namespace)
+		}
+		if err := fn(data[:size:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
 // Header is a data structure that, as BSON, is found immediately after the magic
 // number in the archive, before any CollectionMetadatas. It is the home of any archive level information.
+// The optional features of the archive, its namespace index, compression and
+// signature, are each declared by their own field; FormatVersion only tells
+// readers the newest of them they must understand.
 type Header struct {
 	ConcurrentCollections int32  `bson:"concurrent_collections"`
 	FormatVersion         string `bson:"version"`
 	ServerVersion         string `bson:"server_version"`
 	ToolVersion           string `bson:"tool_version"`
+	Indexed               bool   `bson:"indexed,omitempty"`
+	Compression           string `bson:"compression,omitempty"`
+	Signed                bool   `bson:"signed,omitempty"`
+}
+
+// SetFeatures declares which optional features the archive uses and sets
+// FormatVersion to the version that introduced the newest of them.
+func (header *Header) SetFeatures(indexed bool, compression string, signed bool) {
+	header.Indexed = indexed
+	header.Compression = compression
+	header.Signed = signed
+	switch {
+	case signed:
+		header.FormatVersion = SignedFormatVersion
+	case compression != CompressionNone:
+		header.FormatVersion = CompressedFormatVersion
+	case indexed:
+		header.FormatVersion = IndexedFormatVersion
+	default:
+		header.FormatVersion = BaseFormatVersion
+	}
 }
 
 const minBSONSize = 4 + 1 // an empty BSON document should be exactly five bytes long
@@ -48,7 +119,10 @@ var terminatorBytes = []byte{0xFF, 0xFF, 0xFF, 0xFF} // TODO, rectify this with
 // MagicNumber is four bytes that are found at the beginning of the archive that indicate that
 // the byte stream is an archive, as opposed to anything else, including a stream of BSON documents.
 const MagicNumber uint32 = 0x8199e26d
-const archiveFormatVersion = "0.1"
+
+// BaseFormatVersion is the archive format version of archives without any
+// of the optional features declared in the Header.
+const BaseFormatVersion = "0.1"
 
 // Writer is the top level object to contain information about archives in mongodump.
 type Writer struct {
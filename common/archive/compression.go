@@ -0,0 +1,196 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// compression.go implements per-segment compression of archive data. When the
+// archive header declares a compression codec, the documents written by each
+// MuxIn are compressed in frames, and every frame is stored as one or more
+// CompressedChunk documents in place of the documents themselves. Frames can be
+// decompressed independently, so each namespace is decompressed by its own consumer.
+
+// The compression codecs supported for archive segments.
+const (
+	CompressionNone = ""
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+)
+
+// CompressedFormatVersion is the archive format version that introduced
+// segments compressed with the codec declared in the header.
+const CompressedFormatVersion = "0.3"
+
+// compressedChunkSize is the largest amount of compressed data stored in a
+// single CompressedChunk, which keeps chunks well under the maximum BSON size.
+const compressedChunkSize = 4 * 1024 * 1024
+
+// CompressedChunk is a data structure that, as BSON, replaces the documents in
+// the namespace-data of archives with compressed segments. A compressed frame is
+// split across consecutive chunks, all but the last of which have Continued set.
+type CompressedChunk struct {
+	Data      []byte `bson:"data"`
+	Continued bool   `bson:"continued,omitempty"`
+}
+
+// ValidateCompression returns an error if the codec is not a supported archive compression codec.
+func ValidateCompression(codec string) error {
+	switch codec {
+	case CompressionNone, CompressionZstd, CompressionGzip:
+		return nil
+	}
+	return fmt.Errorf(
+		"unsupported archive compression %#q, must be one of %#q or %#q",
+		codec,
+		CompressionZstd,
+		CompressionGzip,
+	)
+}
+
+// segmentCodec compresses and decompresses whole frames of archive data.
+type segmentCodec interface {
+	compress(src []byte) ([]byte, error)
+	decompress(src []byte) ([]byte, error)
+}
+
+func newSegmentCodec(codec string) (segmentCodec, error) {
+	switch codec {
+	case CompressionZstd:
+		return &zstdCodec{}, nil
+	case CompressionGzip:
+		return &gzipCodec{}, nil
+	}
+	return nil, ValidateCompression(codec)
+}
+
+// zstdCodec lazily creates its encoder and decoder, since a codec is usually
+// only used in one direction.
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func (c *zstdCodec) compress(src []byte) ([]byte, error) {
+	if c.encoder == nil {
+		var err error
+		c.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.encoder.EncodeAll(src, nil), nil
+}
+
+func (c *zstdCodec) decompress(src []byte) ([]byte, error) {
+	if c.decoder == nil {
+		var err error
+		c.decoder, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.decoder.DecodeAll(src, nil)
+}
+
+type gzipCodec struct{}
+
+func (*gzipCodec) compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (*gzipCodec) decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compressFrame compresses a buffer of BSON documents and returns the
+// CompressedChunk documents that hold it, concatenated.
+func compressFrame(codec segmentCodec, frame []byte) ([]byte, error) {
+	compressed, err := codec.compress(frame)
+	if err != nil {
+		return nil, fmt.Errorf("error compressing archive segment: %v", err)
+	}
+	var out []byte
+	for {
+		chunk := CompressedChunk{Data: compressed}
+		if len(compressed) > compressedChunkSize {
+			chunk.Data = compressed[:compressedChunkSize]
+			chunk.Continued = true
+		}
+		out, err = bson.MarshalAppend(out, chunk)
+		if err != nil {
+			return nil, err
+		}
+		compressed = compressed[len(chunk.Data):]
+		if !chunk.Continued {
+			return out, nil
+		}
+	}
+}
+
+// FrameDecoder reassembles compressed frames from the CompressedChunk documents
+// of a single namespace and decompresses them.
+type FrameDecoder struct {
+	codec segmentCodec
+	frame []byte
+}
+
+// NewFrameDecoder creates a FrameDecoder for the given compression codec.
+func NewFrameDecoder(codec string) (*FrameDecoder, error) {
+	c, err := newSegmentCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	return &FrameDecoder{codec: c}, nil
+}
+
+// AddChunk adds a CompressedChunk document to the current frame. Once the frame
+// is complete, it returns the decompressed documents and true.
+func (fd *FrameDecoder) AddChunk(chunkBSON []byte) ([]byte, bool, error) {
+	var chunk CompressedChunk
+	err := bson.Unmarshal(chunkBSON, &chunk)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid compressed archive chunk: %v", err)
+	}
+	fd.frame = append(fd.frame, chunk.Data...)
+	if chunk.Continued {
+		return nil, false, nil
+	}
+	docs, err := fd.codec.decompress(fd.frame)
+	fd.frame = fd.frame[:0]
+	if err != nil {
+		return nil, false, fmt.Errorf("error decompressing archive segment: %v", err)
+	}
+	return docs, true, nil
+}
+
+// Reset drops the chunks of the current frame. The chunks of a frame are
+// always written in a single block, so a frame that is not complete at the
+// end of its block, or when damaged data is skipped, can never be completed.
+func (fd *FrameDecoder) Reset() {
+	fd.frame = fd.frame[:0]
+}
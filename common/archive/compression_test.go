@@ -0,0 +1,172 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"math/rand"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCompressedMuxRoundtrip(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	for _, codec := range []string{CompressionZstd, CompressionGzip} {
+		Convey("multiplexing and demultiplexing with "+codec+" compression", t, func() {
+			buf := &closingBuffer{bytes.Buffer{}}
+			mux := NewMultiplexer(buf, new(testNotifier))
+			require.NoError(t, mux.EnableCompression(codec))
+
+			inChecksum := map[string]hash.Hash{}
+			inLengths := map[string]*int{}
+			errChan := make(chan error)
+			makeIns(testIntents, mux, inChecksum, map[string]*MuxIn{}, inLengths, errChan)
+
+			go mux.Run()
+			for range testIntents {
+				require.NoError(t, <-errChan)
+			}
+			close(mux.Control)
+			require.NoError(t, <-mux.Completed)
+
+			var uncompressed int
+			for _, length := range inLengths {
+				uncompressed += *length
+			}
+			assert.Less(t, buf.Len(), uncompressed, "the archive is compressed")
+
+			demux := &Demultiplexer{
+				In:              buf,
+				NamespaceStatus: make(map[string]int),
+				Compression:     codec,
+			}
+			outChecksum := map[string]hash.Hash{}
+			outLengths := map[string]*int{}
+			receivers := map[string]*RegularCollectionReceiver{}
+			makeOuts(testIntents, demux, outChecksum, receivers, outLengths, errChan)
+
+			require.NoError(t, demux.Run())
+			for range testIntents {
+				require.NoError(t, <-errChan)
+			}
+			for _, intent := range testIntents {
+				ns := intent.Namespace()
+				assert.Equal(t, *inLengths[ns], *outLengths[ns])
+				assert.Equal(t, inChecksum[ns].Sum(nil), outChecksum[ns].Sum(nil))
+				// chunks are received in a buffer of their own size
+				assert.Less(t, cap(receivers[ns].chunkBuf), db.MaxBSONSize)
+			}
+		})
+	}
+}
+
+func TestCompressedSpecialCollection(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	codec, err := newSegmentCodec(CompressionZstd)
+	require.NoError(t, err)
+
+	var docs []byte
+	for i := 0; i < 100; i++ {
+		docs, err = bson.MarshalAppend(docs, testDoc{Bar: i, Baz: "users"})
+		require.NoError(t, err)
+	}
+	chunk, err := compressFrame(codec, docs)
+	require.NoError(t, err)
+
+	demux := &Demultiplexer{Compression: CompressionZstd}
+	cache := NewSpecialCollectionCache(&intents.Intent{DB: "admin", C: "system.users"}, demux)
+	n, err := cache.Write(chunk)
+	require.NoError(t, err)
+	assert.Equal(t, len(chunk), n)
+	cache.End()
+
+	assert.Equal(t, int64(len(docs)), cache.Intent.Size)
+	assert.Equal(t, docs, cache.buf.Bytes())
+}
+
+func TestFrameSpanningChunks(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	codec, err := newSegmentCodec(CompressionGzip)
+	require.NoError(t, err)
+
+	// Random data doesn't compress, so the frame is split across several chunks.
+	frame := make([]byte, compressedChunkSize*2)
+	rand.New(rand.NewSource(1)).Read(frame)
+
+	chunks, err := compressFrame(codec, frame)
+	require.NoError(t, err)
+
+	decoder, err := NewFrameDecoder(CompressionGzip)
+	require.NoError(t, err)
+
+	var numChunks int
+	for len(chunks) > 0 {
+		size := int(binary.LittleEndian.Uint32(chunks))
+		docs, complete, err := decoder.AddChunk(chunks[:size])
+		require.NoError(t, err)
+		numChunks++
+		chunks = chunks[size:]
+		if len(chunks) > 0 {
+			assert.False(t, complete)
+			continue
+		}
+		assert.True(t, complete)
+		assert.Equal(t, frame, docs)
+	}
+	assert.Greater(t, numChunks, 1)
+}
+
+func TestSplitDocuments(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var data []byte
+	for i := 0; i < 3; i++ {
+		doc, err := bson.Marshal(bson.D{{"_id", i}})
+		require.NoError(t, err)
+		data = append(data, doc...)
+	}
+
+	var docs []bson.Raw
+	require.NoError(t, SplitDocuments("db.c", data, func(doc []byte) error {
+		docs = append(docs, doc)
+		return nil
+	}))
+	require.Len(t, docs, 3)
+	assert.EqualValues(t, 2, docs[2].Lookup("_id").Int32())
+
+	assert.EqualError(
+		t,
+		SplitDocuments("db.c", data[:len(data)-1], func([]byte) error { return nil }),
+		"invalid document size 14 in namespace db.c",
+	)
+	assert.EqualError(
+		t,
+		SplitDocuments("db.c", data[:2], func([]byte) error { return nil }),
+		"truncated document in namespace db.c",
+	)
+}
+
+func TestDataNamespace(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	cm := &CollectionMetadata{Database: "db", Collection: "c"}
+	assert.Equal(t, "db.c", cm.DataNamespace())
+	cm.Type = "timeseries"
+	assert.Equal(t, "db.system.buckets.c", cm.DataNamespace())
+}
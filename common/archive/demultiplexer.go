@@ -10,8 +10,8 @@ import (
 	"bytes"
 	"fmt"
 	"hash"
-	"hash/crc64"
 	"io"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -54,6 +54,27 @@ type Demultiplexer struct {
 
 	NamespaceStatus map[string]int
 	IsAtlasProxy    bool
+
+	// Compression is the codec the archive's segments are compressed with, as
+	// declared in its header. Each consumer decompresses its own namespace.
+	Compression string
+
+	// Salvage makes the demultiplexer skip the damaged parts of the archive and
+	// carry on instead of failing. CRC mismatches and namespaces that were cut
+	// short are recorded in SalvageReport rather than returned as errors.
+	Salvage       bool
+	SalvageReport SalvageReport
+	// pendingChunks holds the chunks of the compressed frame of the current
+	// block that is not complete yet in salvage mode, so that a frame cut
+	// short by damage to the archive is dropped instead of being handed to its
+	// consumer. A frame never spans blocks, so it's reset at every block
+	// header and whenever damaged data is skipped.
+	pendingChunks [][]byte
+
+	// inSignature is set while the signature block of a signed archive, which
+	// is checked with VerifiedCopy before the archive is demultiplexed, is
+	// skipped.
+	inSignature bool
 }
 
 func CreateDemux(
@@ -72,20 +93,14 @@ func CreateDemux(
 			continue
 		}
 
-		var ns string
-		if cm.Type == "timeseries" {
-			ns = cm.Database + ".system.buckets." + cm.Collection
-		} else {
-			ns = cm.Database + "." + cm.Collection
-		}
-		demux.NamespaceStatus[ns] = NamespaceUnopened
+		demux.NamespaceStatus[cm.DataNamespace()] = NamespaceUnopened
 	}
 	return demux
 }
 
 // Run creates and runs a parser with the Demultiplexer as a consumer.
 func (demux *Demultiplexer) Run() error {
-	parser := Parser{In: demux.In}
+	parser := Parser{In: demux.In, Salvage: demux.Salvage}
 	err := parser.ReadAllBlocks(demux)
 	if len(demux.outs) > 0 {
 		log.Logvf(log.Always, "demux finishing when there are still outs (%v)", len(demux.outs))
@@ -127,6 +142,21 @@ func newWrappedError(msg string, err error) error {
 // HeaderBSON is part of the ParserConsumer interface and receives headers from parser.
 // Its main role is to implement opens and EOFs of the embedded stream.
 func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
+	if IsIndexHeader(buf) {
+		log.Logv(log.DebugHigh, "demux reached the archive index")
+		return ErrIndexReached
+	}
+	if len(demux.pendingChunks) > 0 {
+		log.Logvf(log.Always, "salvage: dropping an incomplete compressed frame of namespace %v",
+			demux.currentNamespace)
+		demux.pendingChunks = nil
+	}
+	demux.inSignature = IsSignatureHeader(buf)
+	if demux.inSignature {
+		log.Logv(log.DebugHigh, "demux reached the archive signature")
+		demux.currentNamespace = ""
+		return nil
+	}
 	colHeader := NamespaceHeader{}
 	err := bson.Unmarshal(buf, &colHeader)
 	if err != nil {
@@ -136,12 +166,18 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 	if colHeader.Collection == "" {
 		return newError("collection header is missing a Collection")
 	}
-	demux.currentNamespace = colHeader.Database + "." + colHeader.Collection
+	demux.currentNamespace = colHeader.Namespace()
 
 	// For atlas proxy archive restores, ignore collections from the admin DB.
 	if demux.IsAtlasProxy && colHeader.Database == "admin" {
 		return nil
 	}
+	if _, ok := demux.NamespaceStatus[demux.currentNamespace]; demux.Salvage && !ok {
+		// the namespace was probably damaged, so let the parser skip its data
+		namespace := demux.currentNamespace
+		demux.currentNamespace = ""
+		return newError(fmt.Sprintf("namespace header for unknown namespace %v", namespace))
+	}
 
 	if _, ok := demux.outs[demux.currentNamespace]; !ok {
 		if demux.NamespaceStatus[demux.currentNamespace] != NamespaceUnopened {
@@ -162,6 +198,9 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 				return newWrappedError("failed arranging a consumer for new namespace", err)
 			}
 		}
+	} else if demux.NamespaceStatus[demux.currentNamespace] == NamespaceUnopened {
+		// the consumer was opened before the namespace was reached
+		demux.NamespaceStatus[demux.currentNamespace] = NamespaceOpened
 	}
 	if colHeader.EOF {
 		if rcr, ok := demux.outs[demux.currentNamespace].(*RegularCollectionReceiver); ok {
@@ -173,16 +212,27 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 		crcUInt64, ok := demux.outs[demux.currentNamespace].Sum64()
 		if ok {
 			crc := int64(crcUInt64)
-			if crc != colHeader.CRC {
+			if crc != colHeader.CRC && !demux.Salvage {
 				return fmt.Errorf("CRC mismatch for namespace %v, %v!=%v",
 					demux.currentNamespace,
 					crc,
 					colHeader.CRC,
 				)
+			} else if crc != colHeader.CRC {
+				log.Logvf(log.Always, "salvage: CRC mismatch for namespace %v, %v!=%v",
+					demux.currentNamespace,
+					crc,
+					colHeader.CRC,
+				)
+				demux.SalvageReport.CRCMismatches = append(
+					demux.SalvageReport.CRCMismatches,
+					demux.currentNamespace,
+				)
+			} else {
+				log.Logvf(log.DebugHigh,
+					"demux checksum for namespace %v is correct (%v), %v bytes",
+					demux.currentNamespace, crc, length)
 			}
-			log.Logvf(log.DebugHigh,
-				"demux checksum for namespace %v is correct (%v), %v bytes",
-				demux.currentNamespace, crc, length)
 		} else {
 			log.Logvf(log.DebugHigh,
 				"demux checksum for namespace %v was not calculated.",
@@ -201,7 +251,9 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 func (demux *Demultiplexer) End() error {
 	log.Logvf(log.DebugHigh, "demux End")
 	var err error
-	if len(demux.outs) != 0 {
+	if demux.Salvage {
+		demux.endSalvage()
+	} else if len(demux.outs) != 0 {
 		openNss := []string{}
 		for ns := range demux.outs {
 			openNss = append(openNss, ns)
@@ -231,6 +283,9 @@ func (demux *Demultiplexer) End() error {
 // BodyBSON is part of the ParserConsumer interface and receives BSON bodies from the parser.
 // Its main role is to dispatch the body to the Read() function of the current DemuxOut.
 func (demux *Demultiplexer) BodyBSON(buf []byte) error {
+	if demux.inSignature {
+		return nil
+	}
 	if demux.currentNamespace == "" {
 		return newError("collection data without a collection header")
 	}
@@ -246,10 +301,66 @@ func (demux *Demultiplexer) BodyBSON(buf []byte) error {
 	if !ok {
 		return newError("no demux consumer currently consuming namespace " + demux.currentNamespace)
 	}
+	if demux.Salvage && demux.Compression != CompressionNone {
+		return demux.writeChunk(out, buf)
+	}
 	_, err := out.Write(buf)
 	return err
 }
 
+// writeChunk writes a chunk of a compressed frame to out once the whole frame
+// has been read, in salvage mode.
+func (demux *Demultiplexer) writeChunk(out DemuxOut, buf []byte) error {
+	var chunk CompressedChunk
+	if err := bson.Unmarshal(buf, &chunk); err != nil {
+		return newWrappedError("invalid compressed archive chunk", err)
+	}
+	demux.pendingChunks = append(demux.pendingChunks, bytes.Clone(buf))
+	if chunk.Continued {
+		return nil
+	}
+	pending := demux.pendingChunks
+	demux.pendingChunks = nil
+	for _, chunk := range pending {
+		if _, err := out.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Skipped is part of the SalvageConsumer interface. The damaged data is
+// counted against the namespace that was being read.
+func (demux *Demultiplexer) Skipped(skipped SkippedRange) {
+	skipped.Namespace = demux.currentNamespace
+	demux.SalvageReport.Skipped = append(demux.SalvageReport.Skipped, skipped)
+	demux.pendingChunks = nil
+	demux.currentNamespace = ""
+}
+
+// endSalvage ends the namespaces that are still open when the archive ends in
+// salvage mode, so that their consumers keep what was recovered, and records
+// them along with the namespaces that were never found.
+func (demux *Demultiplexer) endSalvage() {
+	for _, out := range demux.outs {
+		if rcr, ok := out.(*RegularCollectionReceiver); ok {
+			rcr.err = io.EOF
+		}
+		out.End()
+	}
+	for ns, status := range demux.NamespaceStatus {
+		switch status {
+		case NamespaceUnopened:
+			demux.SalvageReport.Missing = append(demux.SalvageReport.Missing, ns)
+		case NamespaceOpened:
+			demux.SalvageReport.Unfinished = append(demux.SalvageReport.Unfinished, ns)
+		}
+	}
+	sort.Strings(demux.SalvageReport.Missing)
+	sort.Strings(demux.SalvageReport.Unfinished)
+	demux.outs = nil
+}
+
 // Open installs the DemuxOut as the handler for data for the namespace ns.
 func (demux *Demultiplexer) Open(ns string, out DemuxOut) {
 	// In the current implementation where this is either called before the demultiplexing is running
@@ -265,6 +376,35 @@ func (demux *Demultiplexer) Open(ns string, out DemuxOut) {
 	demux.lengths[ns] = 0
 }
 
+// SeekWithIndex makes the demultiplexer read only the namespaces that have a
+// consumer which is not a MutedCollection, jumping directly to their segments
+// in the archive by using its namespace index. Namespaces that are muted are
+// dropped from NamespaceStatus since they will never be seen.
+func (demux *Demultiplexer) SeekWithIndex(in io.ReaderAt, index *Index) error {
+	var namespaces []string
+	for ns := range demux.NamespaceStatus {
+		if _, isMuted := demux.outs[ns].(*MutedCollection); isMuted {
+			delete(demux.NamespaceStatus, ns)
+			delete(demux.outs, ns)
+			delete(demux.lengths, ns)
+			continue
+		}
+		namespaces = append(namespaces, ns)
+	}
+	sections, err := index.Sections(namespaces)
+	if err != nil {
+		return newWrappedError("cannot seek using the archive index", err)
+	}
+	log.Logvf(
+		log.DebugLow,
+		"demux reading %v namespaces from %v sections of the archive using its index",
+		len(namespaces),
+		len(sections),
+	)
+	demux.In = NewSectionsReader(in, sections)
+	return nil
+}
+
 // RegularCollectionReceiver implements the intents.file interface.
 type RegularCollectionReceiver struct {
 	pos              int64 // updated atomically, aligned at the beginning of the struct
@@ -276,18 +416,83 @@ type RegularCollectionReceiver struct {
 	partialReadArray []byte
 	partialReadBuf   []byte
 	hash             hash.Hash64
-	closeOnce        sync.Once
-	endOnce          sync.Once
-	openOnce         sync.Once
-	err              error
+	// for compressed archives, the decoder and the decompressed documents
+	// that haven't been read yet
+	frames       *FrameDecoder
+	chunkBuf     []byte
+	decompressed []byte
+	closeOnce    sync.Once
+	endOnce      sync.Once
+	openOnce     sync.Once
+	err          error
 }
 
 func (receiver *RegularCollectionReceiver) Sum64() (uint64, bool) {
 	return receiver.hash.Sum64(), true
 }
 
-// Read() runs in the restoring goroutine.
+// Read() runs in the restoring goroutine. For compressed archives, this is also
+// where the namespace's data gets decompressed.
 func (receiver *RegularCollectionReceiver) Read(r []byte) (int, error) {
+	var n int
+	var err error
+	if receiver.frames != nil {
+		n, err = receiver.readDecompressed(r)
+	} else {
+		n, err = receiver.readRaw(r)
+	}
+	// Writes to the hash never return an error.
+	receiver.hash.Write(r[:n])
+	return n, err
+}
+
+// readDecompressed fills r with decompressed documents, receiving and
+// decompressing more frames from the demultiplexer as needed.
+func (receiver *RegularCollectionReceiver) readDecompressed(r []byte) (int, error) {
+	for len(receiver.decompressed) == 0 {
+		chunk, err := receiver.readChunk()
+		if err != nil {
+			return 0, err
+		}
+		docs, complete, err := receiver.frames.AddChunk(chunk)
+		if err != nil {
+			return 0, err
+		}
+		if complete {
+			receiver.decompressed = docs
+		}
+	}
+	n := copy(r, receiver.decompressed)
+	receiver.decompressed = receiver.decompressed[n:]
+	return n, nil
+}
+
+// readChunk receives the next compressed chunk of the namespace, which the
+// demultiplexer writes in one piece. The chunk buffer only grows to the size of
+// the largest chunk received, so that namespaces with small chunks don't each
+// hold a buffer of the maximum BSON size.
+func (receiver *RegularCollectionReceiver) readChunk() ([]byte, error) {
+	wLen, ok := <-receiver.readLenChan
+	if !ok {
+		return nil, receiver.err
+	}
+	if wLen > db.MaxBSONSize {
+		return nil, fmt.Errorf("incoming buffer size is too big %v", wLen)
+	}
+	if cap(receiver.chunkBuf) < wLen {
+		receiver.chunkBuf = make([]byte, wLen)
+	}
+	chunk := receiver.chunkBuf[:wLen]
+	receiver.readBufChan <- chunk
+	if writtenLength := <-receiver.readLenChan; writtenLength != wLen {
+		return nil, fmt.Errorf("regularCollectionReceiver didn't send what it said it would")
+	}
+	atomic.AddInt64(&receiver.pos, int64(wLen))
+	return chunk, nil
+}
+
+// readRaw reads the bytes that the demultiplexer received for this namespace.
+func (receiver *RegularCollectionReceiver) readRaw(r []byte) (int, error) {
 	if receiver.partialReadBuf != nil && len(receiver.partialReadBuf) > 0 {
 		wLen := len(receiver.partialReadBuf)
 		copyLen := copy(r, receiver.partialReadBuf)
@@ -317,7 +522,6 @@ func (receiver *RegularCollectionReceiver) Read(r []byte) (int, error) {
 		if wLen != writtenLength {
 			return 0, fmt.Errorf("regularCollectionReceiver didn't send what it said it would")
 		}
-		receiver.hash.Write(receiver.partialReadBuf)
 		copy(r, receiver.partialReadBuf)
 		receiver.partialReadBuf = receiver.partialReadBuf[rLen:]
 		atomic.AddInt64(&receiver.pos, int64(rLen))
@@ -327,7 +531,6 @@ func (receiver *RegularCollectionReceiver) Read(r []byte) (int, error) {
 	receiver.readBufChan <- r
 	// Receiver the wLen of data written
 	wLen = <-receiver.readLenChan
-	receiver.hash.Write(r[:wLen])
 	atomic.AddInt64(&receiver.pos, int64(wLen))
 	return wLen, nil
 }
@@ -339,7 +542,7 @@ func (receiver *RegularCollectionReceiver) Pos() int64 {
 // Open is part of the intents.file interface.  It creates the chan's in the
 // RegularCollectionReceiver and adds the RegularCollectionReceiver to the set of
 // RegularCollectionReceivers in the demultiplexer.
-func (receiver *RegularCollectionReceiver) Open() error {
+func (receiver *RegularCollectionReceiver) Open() (err error) {
 	// TODO move this implementation to some non intents.file method, to be called from prioritizer.Get
 	// So that we don't have to enable this double open stuff.
 	// Currently the open needs to finish before the prioritizer.Get finishes, so we open the intents.file
@@ -347,10 +550,16 @@ func (receiver *RegularCollectionReceiver) Open() error {
 	receiver.openOnce.Do(func() {
 		receiver.readLenChan = make(chan int)
 		receiver.readBufChan = make(chan []byte)
-		receiver.hash = crc64.New(crc64.MakeTable(crc64.ECMA))
+		receiver.hash = NewCRC()
+		if receiver.Demux.Compression != CompressionNone {
+			receiver.frames, err = NewFrameDecoder(receiver.Demux.Compression)
+			if err != nil {
+				return
+			}
+		}
 		receiver.Demux.Open(receiver.Origin, receiver)
 	})
-	return nil
+	return err
 }
 
 func (receiver *RegularCollectionReceiver) TakeIOBuffer(ioBuf []byte) {
@@ -418,6 +627,7 @@ type SpecialCollectionCache struct {
 	Demux  *Demultiplexer
 	buf    bytes.Buffer
 	hash   hash.Hash64
+	frames *FrameDecoder
 }
 
 func NewSpecialCollectionCache(
@@ -427,7 +637,7 @@ func NewSpecialCollectionCache(
 	return &SpecialCollectionCache{
 		Intent: intent,
 		Demux:  demux,
-		hash:   crc64.New(crc64.MakeTable(crc64.ECMA)),
+		hash:   NewCRC(),
 	}
 }
 
@@ -457,7 +667,26 @@ func (cache *SpecialCollectionCache) Pos() int64 {
 	return atomic.LoadInt64(&cache.pos)
 }
 
+// Write caches b. Special collections are small, so for compressed archives
+// they are decompressed here, on the demultiplexer's goroutine.
 func (cache *SpecialCollectionCache) Write(b []byte) (int, error) {
+	if cache.Demux != nil && cache.Demux.Compression != CompressionNone {
+		if cache.frames == nil {
+			var err error
+			cache.frames, err = NewFrameDecoder(cache.Demux.Compression)
+			if err != nil {
+				return 0, err
+			}
+		}
+		docs, _, err := cache.frames.AddChunk(b)
+		if err != nil {
+			return 0, err
+		}
+		// Writes to the hash never return an error.
+		cache.hash.Write(docs)
+		cache.buf.Write(docs)
+		return len(b), nil
+	}
 	// Writes to the hash never return an error.
 	cache.hash.Write(b)
 	return cache.buf.Write(b)
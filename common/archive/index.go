@@ -0,0 +1,375 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// index.go implements the optional namespace index found at the end of archives
+// whose header is flagged as indexed. The index maps each namespace to the byte
+// offsets of its segments so that readers with random access to the archive can skip
+// directly to the namespaces they need.
+
+// IndexedFormatVersion is the archive format version that introduced the
+// namespace index and trailer.
+const IndexedFormatVersion = "0.2"
+
+// MayHaveIndex reports whether the header declares a namespace index at the end
+// of the archive.
+func (header *Header) MayHaveIndex() bool {
+	return header.Indexed
+}
+
+// IndexTrailerMagicNumber is found in the last four bytes of an archive that
+// ends with a namespace index.
+const IndexTrailerMagicNumber uint32 = 0x8199e26e
+
+// indexTrailerSize is the size of the fixed-size trailer that follows the index:
+// an int64 offset of the index block followed by IndexTrailerMagicNumber.
+const indexTrailerSize = 8 + 4
+
+// maxIndexSegments limits the number of segments in a single IndexEntry so that
+// the entry always fits within the maximum BSON document size. Namespaces with
+// more segments are split across several entries.
+const maxIndexSegments = 100000
+
+// ErrNoIndex is returned by ReadIndex when an archive does not end with a namespace index.
+var ErrNoIndex = errors.New("archive does not contain a namespace index")
+
+// ErrIndexReached is returned by the Demultiplexer when it encounters the index
+// block, which marks the end of the namespace data in the archive. Other
+// ParserConsumers can return it from HeaderBSON so that ReadAllBlocks treats the
+// index as the end of the archive.
+var ErrIndexReached = errors.New("reached archive index")
+
+// IndexHeader is a data structure that, as BSON, starts the index block at the
+// end of an archive. It is followed by one or more IndexEntry documents.
+type IndexHeader struct {
+	Index bool `bson:"index"`
+}
+
+// IndexSegment is the location of a block of the archive. Offset is the number
+// of bytes from the start of the archive to the block's namespace header and
+// Length is the size of the block, including its terminator.
+type IndexSegment struct {
+	Offset int64 `bson:"offset"`
+	Length int64 `bson:"length"`
+}
+
+// IndexEntry is a data structure that, as BSON, is found in the index block of
+// an archive. It lists all of the namespace segments and the EOF block for a namespace.
+type IndexEntry struct {
+	Database   string         `bson:"db"`
+	Collection string         `bson:"collection"`
+	Segments   []IndexSegment `bson:"segments"`
+	EOF        IndexSegment   `bson:"eof"`
+	Size       int64          `bson:"size"`
+	CRC        int64          `bson:"CRC"`
+}
+
+// Namespace returns the namespace of the index entry.
+func (entry *IndexEntry) Namespace() string {
+	return entry.Database + "." + entry.Collection
+}
+
+// Index is the namespace index of an archive.
+type Index struct {
+	// Offset is the position of the index block, i.e. the end of the namespace data.
+	Offset  int64
+	Entries map[string]*IndexEntry
+}
+
+// Namespaces returns all of the namespaces in the index, sorted.
+func (index *Index) Namespaces() []string {
+	namespaces := make([]string, 0, len(index.Entries))
+	for ns := range index.Entries {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// Sections returns the sections of the archive that contain the given
+// namespaces in the order they appear in the archive. Adjacent blocks are merged
+// so that reading the sections back to back yields a valid stream of namespace
+// segments containing only the requested namespaces.
+func (index *Index) Sections(namespaces []string) ([]IndexSegment, error) {
+	var blocks []IndexSegment
+	for _, ns := range namespaces {
+		entry, ok := index.Entries[ns]
+		if !ok {
+			return nil, fmt.Errorf("namespace %v is not in the archive index", ns)
+		}
+		blocks = append(blocks, entry.Segments...)
+		blocks = append(blocks, entry.EOF)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Offset < blocks[j].Offset
+	})
+
+	var sections []IndexSegment
+	for _, block := range blocks {
+		last := len(sections) - 1
+		if last >= 0 && sections[last].Offset+sections[last].Length == block.Offset {
+			sections[last].Length += block.Length
+			continue
+		}
+		sections = append(sections, block)
+	}
+	return sections, nil
+}
+
+// NewSectionsReader returns a reader over the given sections of in.
+func NewSectionsReader(in io.ReaderAt, sections []IndexSegment) io.Reader {
+	readers := make([]io.Reader, len(sections))
+	for i, section := range sections {
+		readers[i] = io.NewSectionReader(in, section.Offset, section.Length)
+	}
+	return io.MultiReader(readers...)
+}
+
+// ReadIndex reads the namespace index from the end of an archive of the given size.
+// It returns ErrNoIndex if the archive does not end with an index trailer.
+func ReadIndex(in io.ReaderAt, size int64) (*Index, error) {
+	if size < indexTrailerSize {
+		return nil, ErrNoIndex
+	}
+	trailer := make([]byte, indexTrailerSize)
+	_, err := in.ReadAt(trailer, size-indexTrailerSize)
+	if err != nil {
+		return nil, fmt.Errorf("I/O failure reading archive index trailer: %v", err)
+	}
+	if binary.LittleEndian.Uint32(trailer[8:]) != IndexTrailerMagicNumber {
+		return nil, ErrNoIndex
+	}
+	offset := int64(binary.LittleEndian.Uint64(trailer[:8]))
+	if offset < 0 || offset > size-indexTrailerSize {
+		return nil, newParserError(fmt.Sprintf("archive index offset %v is out of range", offset))
+	}
+
+	consumer := &indexParserConsumer{
+		index: &Index{
+			Offset:  offset,
+			Entries: make(map[string]*IndexEntry),
+		},
+	}
+	parser := Parser{In: io.NewSectionReader(in, offset, size-indexTrailerSize-offset)}
+	err = parser.ReadBlock(consumer)
+	if err != nil {
+		return nil, err
+	}
+	if !consumer.sawHeader {
+		return nil, newParserError("archive index does not start with an index header")
+	}
+	return consumer.index, nil
+}
+
+// indexParserConsumer implements ParserConsumer and builds an Index from the index block.
+type indexParserConsumer struct {
+	index     *Index
+	sawHeader bool
+}
+
+// HeaderBSON is part of the ParserConsumer interface, it checks the index header.
+func (ipc *indexParserConsumer) HeaderBSON(data []byte) error {
+	if !IsIndexHeader(data) {
+		return fmt.Errorf("expected an archive index header")
+	}
+	ipc.sawHeader = true
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface, it unmarshals IndexEntry's.
+// Entries for namespaces that were split because of their size are merged.
+func (ipc *indexParserConsumer) BodyBSON(data []byte) error {
+	entry := &IndexEntry{}
+	err := bson.Unmarshal(data, entry)
+	if err != nil {
+		return err
+	}
+	existing, ok := ipc.index.Entries[entry.Namespace()]
+	if !ok {
+		ipc.index.Entries[entry.Namespace()] = entry
+		return nil
+	}
+	existing.Segments = append(existing.Segments, entry.Segments...)
+	if entry.EOF.Length > 0 {
+		existing.EOF = entry.EOF
+		existing.Size = entry.Size
+		existing.CRC = entry.CRC
+	}
+	return nil
+}
+
+// End is part of the ParserConsumer interface.
+func (ipc *indexParserConsumer) End() error {
+	return nil
+}
+
+// IsIndexHeader reports whether a block header is the header of the index block.
+func IsIndexHeader(data []byte) bool {
+	value, err := bson.Raw(data).LookupErr("index")
+	if err != nil {
+		return false
+	}
+	isIndex, ok := value.BooleanOK()
+	return ok && isIndex
+}
+
+// OffsetWriter wraps the output of an archive and counts the bytes written to
+// it, so that the Multiplexer can record the offsets of namespace segments.
+// The prelude and the multiplexed data must both be written through it.
+type OffsetWriter struct {
+	io.WriteCloser
+	offset int64
+}
+
+// NewOffsetWriter creates an OffsetWriter that writes to out.
+func NewOffsetWriter(out io.WriteCloser) *OffsetWriter {
+	return &OffsetWriter{WriteCloser: out}
+}
+
+// Write is part of the io.Writer interface.
+func (ow *OffsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.WriteCloser.Write(p)
+	ow.offset += int64(n)
+	return n, err
+}
+
+// Offset returns the number of bytes written so far.
+func (ow *OffsetWriter) Offset() int64 {
+	return ow.offset
+}
+
+// indexRecorder keeps track of the location of every block the Multiplexer writes.
+type indexRecorder struct {
+	out     *OffsetWriter
+	entries map[string]*IndexEntry
+	order   []string
+}
+
+func newIndexRecorder(out *OffsetWriter) *indexRecorder {
+	return &indexRecorder{
+		out:     out,
+		entries: make(map[string]*IndexEntry),
+	}
+}
+
+func (ir *indexRecorder) entry(db, collection string) *IndexEntry {
+	ns := db + "." + collection
+	entry, ok := ir.entries[ns]
+	if !ok {
+		entry = &IndexEntry{Database: db, Collection: collection}
+		ir.entries[ns] = entry
+		ir.order = append(ir.order, ns)
+	}
+	return entry
+}
+
+// startSegment records that a namespace segment for db.collection is about to be written.
+func (ir *indexRecorder) startSegment(db, collection string) {
+	entry := ir.entry(db, collection)
+	entry.Segments = append(entry.Segments, IndexSegment{Offset: ir.out.Offset()})
+}
+
+// addData records bytes of documents written to the current segment of db.collection.
+func (ir *indexRecorder) addData(db, collection string, length int) {
+	ir.entry(db, collection).Size += int64(length)
+}
+
+// endSegment records that the terminator of the current segment of ns has been written.
+func (ir *indexRecorder) endSegment(ns string) {
+	entry, ok := ir.entries[ns]
+	if !ok || len(entry.Segments) == 0 {
+		return
+	}
+	segment := &entry.Segments[len(entry.Segments)-1]
+	segment.Length = ir.out.Offset() - segment.Offset
+}
+
+// startEOF records that the EOF block for db.collection is about to be written.
+func (ir *indexRecorder) startEOF(db, collection string, crc int64) {
+	entry := ir.entry(db, collection)
+	entry.EOF = IndexSegment{Offset: ir.out.Offset()}
+	entry.CRC = crc
+}
+
+// endEOF records that the EOF block for db.collection has been written.
+func (ir *indexRecorder) endEOF(db, collection string) {
+	entry := ir.entry(db, collection)
+	entry.EOF.Length = ir.out.Offset() - entry.EOF.Offset
+}
+
+// write writes the index block and the trailer to the archive.
+func (ir *indexRecorder) write() error {
+	indexOffset := ir.out.Offset()
+	header, err := bson.Marshal(IndexHeader{Index: true})
+	if err != nil {
+		return err
+	}
+	if err = writeFull(ir.out, header); err != nil {
+		return err
+	}
+	for _, ns := range ir.order {
+		entry := *ir.entries[ns]
+		segments := entry.Segments
+		// Namespaces with an enormous number of segments are split across
+		// multiple entries, the last of which has the EOF block.
+		for len(segments) > maxIndexSegments {
+			partial := IndexEntry{
+				Database:   entry.Database,
+				Collection: entry.Collection,
+				Segments:   segments[:maxIndexSegments],
+			}
+			if err = ir.writeEntry(&partial); err != nil {
+				return err
+			}
+			segments = segments[maxIndexSegments:]
+		}
+		entry.Segments = segments
+		if err = ir.writeEntry(&entry); err != nil {
+			return err
+		}
+	}
+	if err = writeFull(ir.out, terminatorBytes); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, indexTrailerSize)
+	binary.LittleEndian.PutUint64(trailer[:8], uint64(indexOffset))
+	binary.LittleEndian.PutUint32(trailer[8:], IndexTrailerMagicNumber)
+	return writeFull(ir.out, trailer)
+}
+
+func (ir *indexRecorder) writeEntry(entry *IndexEntry) error {
+	if entry.Segments == nil {
+		entry.Segments = []IndexSegment{}
+	}
+	buf, err := bson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFull(ir.out, buf)
+}
+
+func writeFull(out io.Writer, buf []byte) error {
+	l, err := out.Write(buf)
+	if err != nil {
+		return err
+	}
+	if l != len(buf) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
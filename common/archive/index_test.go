@@ -0,0 +1,147 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"hash"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildIndexedArchive multiplexes testIntents into an archive with a namespace index.
+func buildIndexedArchive(t *testing.T) ([]byte, map[string]hash.Hash, map[string]*int) {
+	buf := &closingBuffer{bytes.Buffer{}}
+	out := NewOffsetWriter(buf)
+
+	prelude := &Prelude{Header: &Header{}}
+	prelude.Header.SetFeatures(true, CompressionNone, false)
+	for _, intent := range testIntents {
+		prelude.AddMetadata(&CollectionMetadata{Database: intent.DB, Collection: intent.C})
+	}
+	require.NoError(t, prelude.Write(out))
+
+	mux := NewMultiplexer(out, new(testNotifier))
+	require.NoError(t, mux.EnableIndex())
+
+	inChecksum := map[string]hash.Hash{}
+	inLengths := map[string]*int{}
+	errChan := make(chan error)
+	makeIns(testIntents, mux, inChecksum, map[string]*MuxIn{}, inLengths, errChan)
+
+	go mux.Run()
+	for range testIntents {
+		require.NoError(t, <-errChan)
+	}
+	close(mux.Control)
+	require.NoError(t, <-mux.Completed)
+
+	return buf.Bytes(), inChecksum, inLengths
+}
+
+func TestReadIndex(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("reading the index of an indexed archive", t, func() {
+		archiveBytes, _, inLengths := buildIndexedArchive(t)
+
+		index, err := ReadIndex(bytes.NewReader(archiveBytes), int64(len(archiveBytes)))
+		require.NoError(t, err)
+		require.Len(t, index.Entries, len(testIntents))
+
+		for _, intent := range testIntents {
+			entry := index.Entries[intent.Namespace()]
+			require.NotNil(t, entry, "index has an entry for %v", intent.Namespace())
+			assert.NotEmpty(t, entry.Segments, "%v has segments", intent.Namespace())
+			assert.Greater(t, entry.EOF.Length, int64(0), "%v has an EOF block", intent.Namespace())
+			assert.Equal(t, int64(*inLengths[intent.Namespace()]), entry.Size)
+			for _, segment := range entry.Segments {
+				assert.Less(t, segment.Offset+segment.Length, index.Offset)
+			}
+		}
+
+		_, err = ReadIndex(bytes.NewReader(archiveBytes[:len(archiveBytes)-1]), int64(len(archiveBytes)-1))
+		assert.ErrorIs(t, err, ErrNoIndex)
+	})
+}
+
+func TestSeekWithIndex(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("demultiplexing only some namespaces using the index", t, func() {
+		archiveBytes, inChecksum, inLengths := buildIndexedArchive(t)
+		reader := bytes.NewReader(archiveBytes)
+
+		index, err := ReadIndex(reader, int64(len(archiveBytes)))
+		require.NoError(t, err)
+
+		prelude := &Prelude{}
+		require.NoError(t, prelude.Read(bytes.NewReader(archiveBytes)))
+		assert.Equal(t, IndexedFormatVersion, prelude.Header.FormatVersion)
+		assert.True(t, prelude.Header.MayHaveIndex())
+
+		demux := CreateDemux(prelude.NamespaceMetadatas, nil, false)
+
+		wanted := []*intents.Intent{testIntents[1], testIntents[3]}
+		for _, intent := range []*intents.Intent{testIntents[0], testIntents[2]} {
+			demux.Open(intent.Namespace(), &MutedCollection{Intent: intent, Demux: demux})
+		}
+
+		outChecksum := map[string]hash.Hash{}
+		outLengths := map[string]*int{}
+		errChan := make(chan error)
+		makeOuts(wanted, demux, outChecksum, map[string]*RegularCollectionReceiver{}, outLengths, errChan)
+
+		require.NoError(t, demux.SeekWithIndex(reader, index))
+		assert.Len(t, demux.NamespaceStatus, len(wanted))
+
+		require.NoError(t, demux.Run())
+		for range wanted {
+			require.NoError(t, <-errChan)
+		}
+		for _, intent := range wanted {
+			ns := intent.Namespace()
+			assert.Equal(t, *inLengths[ns], *outLengths[ns])
+			assert.Equal(t, inChecksum[ns].Sum(nil), outChecksum[ns].Sum(nil))
+		}
+	})
+}
+
+func TestStreamingIndexedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("demultiplexing an indexed archive as a stream", t, func() {
+		archiveBytes, inChecksum, inLengths := buildIndexedArchive(t)
+		in := bytes.NewReader(archiveBytes)
+
+		prelude := &Prelude{}
+		require.NoError(t, prelude.Read(in))
+
+		// The demultiplexer should stop at the index when reading the archive as a stream.
+		demux := CreateDemux(prelude.NamespaceMetadatas, in, false)
+		outChecksum := map[string]hash.Hash{}
+		outLengths := map[string]*int{}
+		errChan := make(chan error)
+		makeOuts(testIntents, demux, outChecksum, map[string]*RegularCollectionReceiver{}, outLengths, errChan)
+
+		require.NoError(t, demux.Run())
+		for range testIntents {
+			require.NoError(t, <-errChan)
+		}
+		for _, intent := range testIntents {
+			ns := intent.Namespace()
+			assert.Equal(t, *inLengths[ns], *outLengths[ns])
+			assert.Equal(t, inChecksum[ns].Sum(nil), outChecksum[ns].Sum(nil))
+		}
+		assert.Zero(t, in.Len(), "the index was drained")
+	})
+}
@@ -7,9 +7,9 @@
 package archive
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"hash"
-	"hash/crc64"
 	"io"
 	"reflect"
 
@@ -36,6 +36,14 @@ type Multiplexer struct {
 	ins              []*MuxIn
 	selectCases      []reflect.SelectCase
 	currentNamespace string
+	// index records the location of each block when the archive is written
+	// with a trailing namespace index; it is nil otherwise.
+	index *indexRecorder
+	// compression is the codec used to compress the data of each MuxIn.
+	compression string
+	// signer records the digests of the namespaces when the archive is
+	// signed; it is nil otherwise.
+	signer *signatureRecorder
 }
 
 type notifier interface {
@@ -66,6 +74,50 @@ func NewMultiplexer(out io.WriteCloser, shutdownInputs notifier) *Multiplexer {
 	return mux
 }
 
+// EnableIndex makes the Multiplexer append a namespace index and trailer to the
+// archive once all namespaces are written. The Multiplexer's Out must be the
+// OffsetWriter that the prelude was written to, and the prelude should declare
+// the archive indexed.
+func (mux *Multiplexer) EnableIndex() error {
+	out, ok := mux.Out.(*OffsetWriter)
+	if !ok {
+		return fmt.Errorf("archive index requires the multiplexer to write to an OffsetWriter")
+	}
+	mux.index = newIndexRecorder(out)
+	return nil
+}
+
+// EnableCompression makes every MuxIn compress its data with the given codec
+// before handing it to the Multiplexer. The prelude should declare the codec
+// with Header.SetFeatures. It must be called before any MuxIn is opened.
+func (mux *Multiplexer) EnableCompression(codec string) error {
+	if err := ValidateCompression(codec); err != nil {
+		return err
+	}
+	mux.compression = codec
+	return nil
+}
+
+// EnableSigning makes the Multiplexer end the namespace data of the archive
+// with a signature block signed with key. The prelude must already be written
+// and must declare that the archive is signed. It must be called before any
+// MuxIn is opened.
+func (mux *Multiplexer) EnableSigning(key ed25519.PrivateKey, prelude *Prelude) error {
+	if !prelude.Header.Signed {
+		return fmt.Errorf("archive signing requires a prelude that declares the archive signed")
+	}
+	digest, err := PreludeDigest(prelude)
+	if err != nil {
+		return fmt.Errorf("error computing the digest of the archive prelude: %v", err)
+	}
+	mux.signer = &signatureRecorder{
+		key:              key,
+		prelude:          digest,
+		namespaceDigests: newNamespaceDigests(),
+	}
+	return nil
+}
+
 // Run multiplexes until its Control chan closes.
 func (mux *Multiplexer) Run() {
 	var err, completionErr error
@@ -75,6 +127,14 @@ func (mux *Multiplexer) Run() {
 		if index == 0 { //Control index
 			if EOF {
 				log.Logvf(log.DebugLow, "Mux finish")
+				if mux.signer != nil && completionErr == nil && len(mux.selectCases) == 1 {
+					log.Logvf(log.DebugLow, "Mux writing archive signature")
+					completionErr = mux.signer.write(mux.Out)
+				}
+				if mux.index != nil && completionErr == nil && len(mux.selectCases) == 1 {
+					log.Logvf(log.DebugLow, "Mux writing archive index")
+					completionErr = mux.index.write()
+				}
 				mux.Out.Close()
 				if completionErr != nil {
 					mux.Completed <- completionErr
@@ -159,6 +219,12 @@ func (mux *Multiplexer) formatBody(in *MuxIn, bsonBytes []byte) error {
 			if l != len(terminatorBytes) {
 				return io.ErrShortWrite
 			}
+			if mux.index != nil {
+				mux.index.endSegment(mux.currentNamespace)
+			}
+		}
+		if mux.index != nil {
+			mux.index.startSegment(in.Intent.DB, in.Intent.DataCollection())
 		}
 		header, err := bson.Marshal(NamespaceHeader{
 			Database:   in.Intent.DB,
@@ -180,6 +246,12 @@ func (mux *Multiplexer) formatBody(in *MuxIn, bsonBytes []byte) error {
 	if err != nil {
 		return err
 	}
+	if mux.index != nil {
+		mux.index.addData(in.Intent.DB, in.Intent.DataCollection(), length)
+	}
+	if mux.signer != nil {
+		mux.signer.addData(mux.currentNamespace, bsonBytes)
+	}
 	return nil
 }
 
@@ -194,6 +266,9 @@ func (mux *Multiplexer) formatEOF(in *MuxIn) error {
 		if l != len(terminatorBytes) {
 			return io.ErrShortWrite
 		}
+		if mux.index != nil {
+			mux.index.endSegment(mux.currentNamespace)
+		}
 	}
 	eofHeader, err := bson.Marshal(NamespaceHeader{
 		Database:   in.Intent.DB,
@@ -204,6 +279,12 @@ func (mux *Multiplexer) formatEOF(in *MuxIn) error {
 	if err != nil {
 		return err
 	}
+	if mux.index != nil {
+		mux.index.startEOF(in.Intent.DB, in.Intent.DataCollection(), int64(in.hash.Sum64()))
+	}
+	if mux.signer != nil {
+		mux.signer.end(in.Intent.DB, in.Intent.DataCollection(), int64(in.hash.Sum64()))
+	}
 	l, err := mux.Out.Write(eofHeader)
 	if err != nil {
 		return err
@@ -218,6 +299,9 @@ func (mux *Multiplexer) formatEOF(in *MuxIn) error {
 	if l != len(terminatorBytes) {
 		return io.ErrShortWrite
 	}
+	if mux.index != nil {
+		mux.index.endEOF(in.Intent.DB, in.Intent.DataCollection())
+	}
 	return nil
 }
 
@@ -231,6 +315,7 @@ type MuxIn struct {
 	writeCloseFinishedChan chan struct{}
 	buf                    []byte
 	hash                   hash.Hash64
+	codec                  segmentCodec
 	Intent                 *intents.Intent
 	Mux                    *Multiplexer
 }
@@ -251,10 +336,8 @@ func (muxIn *MuxIn) Close() error {
 	// the mux side of this gets closed in the mux when it gets an eof on the read
 	log.Logvf(log.DebugHigh, "MuxIn close %v", muxIn.Intent.DataNamespace())
 	if bufferWrites {
-		muxIn.writeChan <- muxIn.buf
-		length := <-muxIn.writeLenChan
-		if length != len(muxIn.buf) {
-			return io.ErrShortWrite
+		if err := muxIn.flush(); err != nil {
+			return err
 		}
 		muxIn.buf = nil
 	}
@@ -275,14 +358,40 @@ func (muxIn *MuxIn) Open() error {
 	muxIn.writeLenChan = make(chan int)
 	muxIn.writeCloseFinishedChan = make(chan struct{})
 	muxIn.buf = make([]byte, 0, bufferSize)
-	muxIn.hash = crc64.New(crc64.MakeTable(crc64.ECMA))
+	muxIn.hash = NewCRC()
 	if bufferWrites {
 		muxIn.buf = make([]byte, 0, db.MaxBSONSize)
 	}
+	if muxIn.Mux.compression != CompressionNone {
+		var err error
+		muxIn.codec, err = newSegmentCodec(muxIn.Mux.compression)
+		if err != nil {
+			return err
+		}
+	}
 	muxIn.Mux.Control <- muxIn
 	return nil
 }
 
+// flush hands the buffered documents to the Multiplexer, compressing them
+// first on this goroutine if the archive is compressed.
+func (muxIn *MuxIn) flush() error {
+	out := muxIn.buf
+	if muxIn.codec != nil && len(out) > 0 {
+		var err error
+		out, err = compressFrame(muxIn.codec, out)
+		if err != nil {
+			return err
+		}
+	}
+	muxIn.writeChan <- out
+	length := <-muxIn.writeLenChan
+	if length != len(out) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
 // Write hands a buffer to the Multiplexer and receives a written length from the multiplexer
 // after the length is received, the buffer is free to be reused.
 func (muxIn *MuxIn) Write(buf []byte) (int, error) {
@@ -308,10 +417,8 @@ func (muxIn *MuxIn) Write(buf []byte) (int, error) {
 	}
 	if bufferWrites {
 		if len(muxIn.buf)+len(buf) > cap(muxIn.buf) {
-			muxIn.writeChan <- muxIn.buf
-			length := <-muxIn.writeLenChan
-			if length != len(muxIn.buf) {
-				return 0, io.ErrShortWrite
+			if err := muxIn.flush(); err != nil {
+				return 0, err
 			}
 			muxIn.buf = muxIn.buf[:0]
 		}
@@ -32,9 +32,18 @@ type ParserConsumer interface {
 
 // Parser encapsulates the small amount of state that the parser needs to keep.
 type Parser struct {
-	In     io.Reader
-	buf    [db.MaxBSONSize]byte
-	length int
+	In io.Reader
+	// Salvage makes ReadAllBlocks skip over damaged parts of the archive
+	// instead of failing. See resync for how it finds where to continue.
+	Salvage bool
+	buf     [db.MaxBSONSize]byte
+	length  int
+	// read is the number of bytes of the current document read into buf so far.
+	read int
+	// salvageIn wraps In in salvage mode, and docStart is the offset at which
+	// the current document starts.
+	salvageIn *salvageReader
+	docStart  int64
 }
 
 type parserError struct {
@@ -78,7 +87,10 @@ func newParserWrappedError(msg string, err error) error {
 // an error is returned.
 func (parse *Parser) readBSONOrTerminator() (isTerminator bool, err error) {
 	parse.length = 0
-	_, err = io.ReadFull(parse.In, parse.buf[0:4])
+	if parse.salvageIn != nil {
+		parse.docStart = parse.salvageIn.offset
+	}
+	parse.read, err = io.ReadFull(parse.In, parse.buf[0:4])
 	if err == io.EOF {
 		return false, err
 	}
@@ -102,7 +114,8 @@ func (parse *Parser) readBSONOrTerminator() (isTerminator bool, err error) {
 	// TODO Because we're reusing this same buffer for all of our IO, we are basically guaranteeing that we'll
 	// copy the bytes twice.  At some point we should fix this. It's slightly complex, because we'll need consumer
 	// methods closing one buffer and acquiring another
-	_, err = io.ReadFull(parse.In, parse.buf[4:size])
+	n, err := io.ReadFull(parse.In, parse.buf[4:size])
+	parse.read += n
 	if err != nil {
 		// any error, including EOF is an error so we wrap it up
 		return false, newParserWrappedError("read bson", err)
@@ -122,9 +135,26 @@ func (parse *Parser) readBSONOrTerminator() (isTerminator bool, err error) {
 
 // ReadAllBlocks calls ReadBlock() until it returns an error.
 // If the error is EOF, then nil is returned, otherwise it returns the error.
+// In salvage mode, errors from damaged blocks are skipped over instead.
 func (parse *Parser) ReadAllBlocks(consumer ParserConsumer) (err error) {
+	if parse.Salvage && parse.salvageIn == nil {
+		parse.salvageIn = newSalvageReader(parse.In)
+		parse.In = parse.salvageIn
+	}
 	for err == nil {
 		err = parse.ReadBlock(consumer)
+		if parse.salvageIn != nil && isSalvageable(err) {
+			err = parse.resync(consumer, err)
+		}
+	}
+	if err == ErrIndexReached {
+		// The namespace index at the end of the archive is only used for
+		// random access. Drain it so that a writer on the other end of a pipe
+		// doesn't block, and finish as if we had reached the end of the stream.
+		_, err = io.Copy(io.Discard, parse.In)
+		if err == nil {
+			err = io.EOF
+		}
 	}
 	endError := consumer.End()
 	if err == io.EOF {
@@ -149,6 +179,9 @@ func (parse *Parser) ReadBlock(consumer ParserConsumer) (err error) {
 		return newParserError("consecutive terminators / headerless blocks are not allowed")
 	}
 	err = consumer.HeaderBSON(parse.buf[:parse.length])
+	if err == ErrIndexReached {
+		return err
+	}
 	if err != nil {
 		return newParserWrappedError("ParserConsumer.HeaderBSON()", err)
 	}
@@ -97,7 +97,7 @@ func NewPrelude(
 ) (*Prelude, error) {
 	prelude := Prelude{
 		Header: &Header{
-			FormatVersion:         archiveFormatVersion,
+			FormatVersion:         BaseFormatVersion,
 			ServerVersion:         serverVersion,
 			ToolVersion:           toolVersion,
 			ConcurrentCollections: int32(concurrentColls),
@@ -65,3 +65,24 @@ func TestPrelude(t *testing.T) {
 		So(archivePrelude2, ShouldResemble, archivePrelude)
 	})
 }
+
+func TestHeaderFeatures(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("each optional feature is declared independently of the others", t, func() {
+		header := &Header{}
+		header.SetFeatures(true, CompressionZstd, true)
+		So(header.FormatVersion, ShouldEqual, SignedFormatVersion)
+		So(header.MayHaveIndex(), ShouldBeTrue)
+		So(header.Compression, ShouldEqual, CompressionZstd)
+		So(header.Signed, ShouldBeTrue)
+
+		header.SetFeatures(false, CompressionGzip, false)
+		So(header.FormatVersion, ShouldEqual, CompressedFormatVersion)
+		So(header.MayHaveIndex(), ShouldBeFalse)
+
+		header.SetFeatures(false, CompressionNone, false)
+		So(header.FormatVersion, ShouldEqual, BaseFormatVersion)
+		So(header.MayHaveIndex(), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,313 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// salvage.go implements salvage mode, in which the Parser skips over the
+// damaged parts of an archive and carries on with the next block it can find,
+// so that one bad byte doesn't cost the data of every namespace after it.
+
+// maxHeaderSize bounds the size of the block headers that the Parser looks for
+// when resynchronizing. Namespace headers only hold a namespace and a CRC, so
+// they are much smaller than this.
+const maxHeaderSize = 1024
+
+// SkippedRange is a range of a damaged archive that was skipped in salvage mode.
+type SkippedRange struct {
+	// Offset is where the skipped bytes start, counted from the start of the
+	// archive if the Parser's input is an *OffsetReader.
+	Offset int64
+	Length int64
+	// Namespace is the namespace whose data was being read when the damage
+	// was found, or "" if it is unknown.
+	Namespace string
+	// Err is the error caused by the damaged data.
+	Err error
+}
+
+// SalvageConsumer is implemented by ParserConsumers that need to know when the
+// Parser skips damaged data in salvage mode. Skipped is called before the next
+// block after the skipped range is read.
+type SalvageConsumer interface {
+	Skipped(SkippedRange)
+}
+
+// isSalvageable reports whether err is caused by the data being read, which
+// salvage mode can skip over. End of input and interruptions are not.
+func isSalvageable(err error) bool {
+	return err != nil && err != io.EOF && err != ErrIndexReached && err != errInterrupted
+}
+
+// resync scans forward from just after the start of the document that caused
+// err for a terminator followed by a valid block header, and positions the
+// Parser at that header. The skipped range is reported to the consumer. It
+// returns io.EOF if the end of the input is reached first.
+func (parse *Parser) resync(consumer ParserConsumer, cause error) error {
+	in := parse.salvageIn
+	start := parse.docStart
+	if parse.read > 1 {
+		// If the length of the document was damaged, the bytes read for it
+		// may contain the next block, so they're scanned again.
+		in.unread(parse.buf[1:parse.read])
+	}
+	parse.read = 0
+
+	var err error
+	for {
+		var window []byte
+		window, err = in.peek(len(terminatorBytes) + maxHeaderSize)
+		if len(window) == 0 {
+			break
+		}
+		if isResyncPoint(window) {
+			in.discard(len(terminatorBytes))
+			break
+		}
+		// a terminator always starts with 0xFF, so skip straight to the next one
+		next := bytes.IndexByte(window[1:], 0xFF)
+		if next < 0 {
+			next = len(window) - 1
+		}
+		in.discard(next + 1)
+	}
+
+	skipped := SkippedRange{Offset: start, Length: in.offset - start, Err: cause}
+	log.Logvf(
+		log.Always,
+		"salvage: skipped %v damaged bytes at offset %v of the archive: %v",
+		skipped.Length,
+		skipped.Offset,
+		cause,
+	)
+	if salvager, ok := consumer.(SalvageConsumer); ok {
+		salvager.Skipped(skipped)
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(in.buf) == 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+// isResyncPoint reports whether window starts with a terminator followed by a
+// complete, valid namespace header, signature header or index header.
+func isResyncPoint(window []byte) bool {
+	if !bytes.HasPrefix(window, terminatorBytes) {
+		return false
+	}
+	header := window[len(terminatorBytes):]
+	if len(header) < minBSONSize {
+		return false
+	}
+	size := int(binary.LittleEndian.Uint32(header))
+	if size < minBSONSize || size > len(header) {
+		return false
+	}
+	header = header[:size]
+	if bson.Raw(header).Validate() != nil {
+		return false
+	}
+	return IsIndexHeader(header) || IsSignatureHeader(header) || isNamespaceHeader(header)
+}
+
+// isNamespaceHeader reports whether a document has exactly the fields of a
+// NamespaceHeader. Body documents are user data, so this is strict to avoid
+// mistaking one for a header.
+func isNamespaceHeader(doc bson.Raw) bool {
+	elements, err := doc.Elements()
+	if err != nil || len(elements) != 4 {
+		return false
+	}
+	expected := map[string]bsontype.Type{
+		"db":         bsontype.String,
+		"collection": bsontype.String,
+		"EOF":        bsontype.Boolean,
+		"CRC":        bsontype.Int64,
+	}
+	for _, elem := range elements {
+		if expected[elem.Key()] != elem.Value().Type {
+			return false
+		}
+	}
+	return doc.Lookup("collection").StringValue() != ""
+}
+
+// salvageReader is the input of a Parser in salvage mode. It keeps track of
+// the offset in the archive and can look ahead and push bytes back, which
+// resync needs to scan the input.
+type salvageReader struct {
+	in io.Reader
+	// buf holds bytes that have been read from in, or pushed back, but not
+	// yet consumed.
+	buf []byte
+	// offset is the position in the archive of the next byte to be consumed.
+	offset int64
+	err    error
+}
+
+func newSalvageReader(in io.Reader) *salvageReader {
+	sr := &salvageReader{in: in}
+	if offsetReader, ok := in.(*OffsetReader); ok {
+		sr.offset = offsetReader.Offset()
+	}
+	return sr
+}
+
+// Read is part of the io.Reader interface.
+func (sr *salvageReader) Read(p []byte) (int, error) {
+	if len(sr.buf) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		n, err := sr.in.Read(p)
+		sr.offset += int64(n)
+		return n, err
+	}
+	n := copy(p, sr.buf)
+	sr.discard(n)
+	return n, nil
+}
+
+// peek returns up to n bytes without consuming them. It only returns fewer
+// than n bytes, along with the error, if the input ends or fails.
+func (sr *salvageReader) peek(n int) ([]byte, error) {
+	for len(sr.buf) < n && sr.err == nil {
+		if cap(sr.buf)-len(sr.buf) < n {
+			grown := make([]byte, len(sr.buf), len(sr.buf)+2*n)
+			copy(grown, sr.buf)
+			sr.buf = grown
+		}
+		var read int
+		read, sr.err = sr.in.Read(sr.buf[len(sr.buf):cap(sr.buf)])
+		sr.buf = sr.buf[:len(sr.buf)+read]
+	}
+	if len(sr.buf) < n {
+		return sr.buf, sr.err
+	}
+	return sr.buf[:n], nil
+}
+
+// discard consumes n bytes that were returned by peek.
+func (sr *salvageReader) discard(n int) {
+	sr.buf = sr.buf[n:]
+	sr.offset += int64(n)
+}
+
+// unread pushes back bytes that were already consumed, so that they are read again.
+func (sr *salvageReader) unread(data []byte) {
+	buf := make([]byte, 0, len(data)+len(sr.buf))
+	buf = append(buf, data...)
+	sr.buf = append(buf, sr.buf...)
+	sr.offset -= int64(len(data))
+}
+
+// OffsetReader wraps the input of an archive and counts the bytes read from
+// it, so that salvage mode can report where damaged data is in the archive.
+// The prelude and the multiplexed data must both be read through it.
+type OffsetReader struct {
+	io.ReadCloser
+	offset int64
+}
+
+// NewOffsetReader creates an OffsetReader that reads from in.
+func NewOffsetReader(in io.ReadCloser) *OffsetReader {
+	return &OffsetReader{ReadCloser: in}
+}
+
+// Read is part of the io.Reader interface.
+func (or *OffsetReader) Read(p []byte) (int, error) {
+	n, err := or.ReadCloser.Read(p)
+	or.offset += int64(n)
+	return n, err
+}
+
+// Offset returns the number of bytes read so far.
+func (or *OffsetReader) Offset() int64 {
+	return or.offset
+}
+
+// SalvageReport describes what a Demultiplexer in salvage mode lost.
+type SalvageReport struct {
+	// Skipped are the damaged ranges of the archive, in order.
+	Skipped []SkippedRange
+	// CRCMismatches are the namespaces whose data didn't match the CRC stored
+	// in the archive.
+	CRCMismatches []string
+	// Unfinished are the namespaces whose EOF block was never found.
+	Unfinished []string
+	// Missing are the namespaces in the prelude whose data was never found.
+	Missing []string
+}
+
+// Damaged reports whether anything was lost.
+func (report *SalvageReport) Damaged() bool {
+	return len(report.Skipped) > 0 || len(report.CRCMismatches) > 0 ||
+		len(report.Unfinished) > 0 || len(report.Missing) > 0
+}
+
+// LostBytes returns the number of bytes skipped for each namespace. Bytes that
+// couldn't be attributed to a namespace are counted under "".
+func (report *SalvageReport) LostBytes() map[string]int64 {
+	lost := map[string]int64{}
+	for _, skipped := range report.Skipped {
+		lost[skipped.Namespace] += skipped.Length
+	}
+	return lost
+}
+
+// Log writes a summary of the report to the log.
+func (report *SalvageReport) Log() {
+	if !report.Damaged() {
+		log.Logv(log.Always, "salvage: the archive was not damaged")
+		return
+	}
+	var total int64
+	for _, skipped := range report.Skipped {
+		total += skipped.Length
+	}
+	log.Logvf(
+		log.Always,
+		"salvage: skipped %v damaged ranges of the archive, about %v bytes",
+		len(report.Skipped),
+		total,
+	)
+
+	lost := report.LostBytes()
+	namespaces := make([]string, 0, len(lost))
+	for ns := range lost {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		name := ns
+		if name == "" {
+			name = "(unknown namespace)"
+		}
+		log.Logvf(log.Always, "salvage: %v lost data in about %v skipped bytes", name, lost[ns])
+	}
+	for _, ns := range report.CRCMismatches {
+		log.Logvf(log.Always, "salvage: %v does not match its CRC, some of its data may be damaged", ns)
+	}
+	for _, ns := range report.Unfinished {
+		log.Logvf(log.Always, "salvage: %v has no EOF block, it may be missing data at the end", ns)
+	}
+	for _, ns := range report.Missing {
+		log.Logvf(log.Always, "salvage: %v was not found in the archive", ns)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var salvageNamespaces = []string{"db.one", "db.two", "db.three"}
+
+// buildSalvageArchive returns an archive with ten documents in each of the
+// salvage test namespaces.
+func buildSalvageArchive(t *testing.T) []byte {
+	simple := SimpleArchive{Header: Header{ServerVersion: "7.0.0"}}
+	for _, ns := range salvageNamespaces {
+		dbName, collName := ns[:2], ns[3:]
+		simple.CollectionMetadata = append(
+			simple.CollectionMetadata,
+			CollectionMetadata{Database: dbName, Collection: collName},
+		)
+		namespace := SimpleNamespace{Database: dbName, Collection: collName}
+		for i := 0; i < 10; i++ {
+			namespace.Documents = append(namespace.Documents, bson.D{{"ns", ns}, {"i", int32(i)}})
+		}
+		simple.Namespaces = append(simple.Namespaces, namespace)
+	}
+	data, err := simple.Marshal()
+	require.NoError(t, err)
+	return data
+}
+
+// documentOffset returns the offset of the i-th document of a salvage test namespace.
+func documentOffset(t *testing.T, data []byte, ns string, i int) int {
+	doc, err := bson.Marshal(bson.D{{"ns", ns}, {"i", int32(i)}})
+	require.NoError(t, err)
+	offset := bytes.Index(data, doc)
+	require.Positive(t, offset)
+	return offset
+}
+
+// salvageDemux demultiplexes an archive in salvage mode into a
+// SpecialCollectionCache for each namespace.
+func salvageDemux(
+	t *testing.T,
+	data []byte,
+	salvage bool,
+) (*Demultiplexer, map[string]*SpecialCollectionCache, error) {
+	in := NewOffsetReader(io.NopCloser(bytes.NewReader(data)))
+	prelude := &Prelude{}
+	require.NoError(t, prelude.Read(in))
+
+	demux := CreateDemux(prelude.NamespaceMetadatas, in, false)
+	demux.Compression = prelude.Header.Compression
+	demux.Salvage = salvage
+	caches := map[string]*SpecialCollectionCache{}
+	for ns := range demux.NamespaceStatus {
+		cache := NewSpecialCollectionCache(&intents.Intent{}, demux)
+		caches[ns] = cache
+		demux.Open(ns, cache)
+	}
+	return demux, caches, demux.Run()
+}
+
+// countDocuments returns the number of documents cached for a namespace.
+func countDocuments(t *testing.T, cache *SpecialCollectionCache) int {
+	data := cache.buf.Bytes()
+	count := 0
+	for len(data) > 0 {
+		size := int(binary.LittleEndian.Uint32(data))
+		require.NoError(t, bson.Raw(data[:size]).Validate())
+		data = data[size:]
+		count++
+	}
+	return count
+}
+
+func TestSalvageDamagedDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	data := buildSalvageArchive(t)
+	damagedAt := documentOffset(t, data, "db.two", 4)
+	docSize := documentOffset(t, data, "db.two", 5) - damagedAt
+	// make the length of the fifth document of db.two invalid
+	binary.LittleEndian.PutUint32(data[damagedAt:], 3)
+
+	_, _, err := salvageDemux(t, data, false)
+	require.Error(t, err, "damage is fatal without salvage")
+
+	demux, caches, err := salvageDemux(t, data, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, countDocuments(t, caches["db.one"]))
+	assert.Equal(t, 4, countDocuments(t, caches["db.two"]))
+	assert.Equal(t, 10, countDocuments(t, caches["db.three"]))
+
+	report := demux.SalvageReport
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, "db.two", report.Skipped[0].Namespace)
+	assert.Equal(t, int64(damagedAt), report.Skipped[0].Offset)
+	// the damaged document and the rest of the segment are skipped, up to and
+	// including the terminator before the EOF header of db.two
+	assert.Equal(t, int64(6*docSize+len(terminatorBytes)), report.Skipped[0].Length)
+	assert.Equal(t, []string{"db.two"}, report.CRCMismatches)
+	assert.Empty(t, report.Unfinished)
+	assert.Empty(t, report.Missing)
+	assert.True(t, report.Damaged())
+}
+
+func TestSalvageDamagedHeader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	data := buildSalvageArchive(t)
+	header, err := bson.Marshal(NamespaceHeader{Database: "db", Collection: "one"})
+	require.NoError(t, err)
+	damagedAt := bytes.Index(data, header)
+	require.Positive(t, damagedAt)
+	// damage the end of the first header of db.one
+	data[damagedAt+len(header)-1] = 0x01
+
+	demux, caches, err := salvageDemux(t, data, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, countDocuments(t, caches["db.one"]))
+	assert.Equal(t, 10, countDocuments(t, caches["db.two"]))
+	assert.Equal(t, 10, countDocuments(t, caches["db.three"]))
+
+	report := demux.SalvageReport
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, "", report.Skipped[0].Namespace, "the damaged namespace is unknown")
+	assert.Equal(t, []string{"db.one"}, report.CRCMismatches)
+}
+
+func TestSalvageTruncatedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	data := buildSalvageArchive(t)
+	data = data[:documentOffset(t, data, "db.three", 6)+3]
+
+	demux, caches, err := salvageDemux(t, data, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, countDocuments(t, caches["db.one"]))
+	assert.Equal(t, 10, countDocuments(t, caches["db.two"]))
+	assert.Equal(t, 6, countDocuments(t, caches["db.three"]))
+
+	report := demux.SalvageReport
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, "db.three", report.Skipped[0].Namespace)
+	assert.Equal(t, []string{"db.three"}, report.Unfinished)
+	assert.Empty(t, report.CRCMismatches)
+}
+
+func TestSalvageMissingNamespace(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	data := buildSalvageArchive(t)
+	header, err := bson.Marshal(NamespaceHeader{Database: "db", Collection: "three"})
+	require.NoError(t, err)
+	data = data[:bytes.Index(data, header)]
+
+	demux, _, err := salvageDemux(t, data, true)
+	require.NoError(t, err)
+	assert.Empty(t, demux.SalvageReport.Skipped)
+	assert.Equal(t, []string{"db.three"}, demux.SalvageReport.Missing)
+}
+
+func TestSalvageUndamagedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	demux, caches, err := salvageDemux(t, buildSalvageArchive(t), true)
+	require.NoError(t, err)
+	for _, ns := range salvageNamespaces {
+		assert.Equal(t, 10, countDocuments(t, caches[ns]), ns)
+	}
+	assert.False(t, demux.SalvageReport.Damaged())
+}
+
+func TestSalvageCompressedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	buf := &closingBuffer{bytes.Buffer{}}
+	prelude := &Prelude{
+		Header: &Header{FormatVersion: CompressedFormatVersion, Compression: CompressionZstd},
+	}
+	for _, intent := range testIntents {
+		prelude.AddMetadata(&CollectionMetadata{Database: intent.DB, Collection: intent.C})
+	}
+	require.NoError(t, prelude.Write(buf))
+
+	mux := NewMultiplexer(buf, new(testNotifier))
+	require.NoError(t, mux.EnableCompression(CompressionZstd))
+	errChan := make(chan error)
+	makeIns(testIntents, mux, map[string]hash.Hash{}, map[string]*MuxIn{}, map[string]*int{}, errChan)
+	go mux.Run()
+	for range testIntents {
+		require.NoError(t, <-errChan)
+	}
+	close(mux.Control)
+	require.NoError(t, <-mux.Completed)
+
+	for _, damagedAt := range []int{buf.Len() / 3, buf.Len() / 2} {
+		t.Run(fmt.Sprintf("damage at %v", damagedAt), func(t *testing.T) {
+			data := bytes.Clone(buf.Bytes())
+			for i := damagedAt; i < damagedAt+16; i++ {
+				data[i] ^= 0x5A
+			}
+			demux, _, err := salvageDemux(t, data, true)
+			require.NoError(t, err)
+			assert.True(t, demux.SalvageReport.Damaged())
+			assert.NotEmpty(t, demux.SalvageReport.Skipped)
+		})
+	}
+}
+
+func TestSalvageIncompleteFrame(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	codec, err := newSegmentCodec(CompressionZstd)
+	require.NoError(t, err)
+	var docs []byte
+	for i := 0; i < 3; i++ {
+		doc, err := bson.Marshal(bson.D{{"i", int32(i)}})
+		require.NoError(t, err)
+		docs = append(docs, doc...)
+	}
+	frame, err := compressFrame(codec, docs)
+	require.NoError(t, err)
+	// the first chunk of a frame whose other chunks were lost
+	lost, err := bson.Marshal(CompressedChunk{Data: []byte("lost"), Continued: true})
+	require.NoError(t, err)
+
+	buf := &closingBuffer{bytes.Buffer{}}
+	prelude := &Prelude{Header: &Header{}}
+	prelude.Header.SetFeatures(false, CompressionZstd, false)
+	prelude.AddMetadata(&CollectionMetadata{Database: "db", Collection: "c"})
+	require.NoError(t, prelude.Write(buf))
+	writeBlock := func(header NamespaceHeader, body []byte) {
+		headerBytes, err := bson.Marshal(header)
+		require.NoError(t, err)
+		buf.Write(headerBytes)
+		buf.Write(body)
+		buf.Write(terminatorBytes)
+	}
+	writeBlock(NamespaceHeader{Database: "db", Collection: "c"}, lost)
+	writeBlock(NamespaceHeader{Database: "db", Collection: "c"}, frame)
+	writeBlock(NamespaceHeader{Database: "db", Collection: "c", EOF: true}, nil)
+
+	// the incomplete frame is dropped at the end of its block rather than
+	// being joined to the next frame
+	demux, caches, err := salvageDemux(t, buf.Bytes(), true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, countDocuments(t, caches["db.c"]))
+	assert.Equal(t, []string{"db.c"}, demux.SalvageReport.CRCMismatches)
+
+	decoder, err := NewFrameDecoder(CompressionZstd)
+	require.NoError(t, err)
+	_, complete, err := decoder.AddChunk(lost)
+	require.NoError(t, err)
+	assert.False(t, complete)
+	decoder.Reset()
+	decompressed, complete, err := decoder.AddChunk(frame)
+	require.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, docs, decompressed)
+}
@@ -0,0 +1,357 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// signature.go implements signed archives. A signed archive ends its
+// namespace data with a signature block, which holds an Ed25519 signature of a
+// manifest of the archive: a digest of the prelude, which includes the header,
+// and the CRC and a digest of the data of every namespace.
+
+// SignedFormatVersion is the archive format version that introduced the
+// signature block at the end of the namespace data.
+const SignedFormatVersion = "0.4"
+
+// SignatureAlgorithm is the signature algorithm used for signed archives.
+const SignatureAlgorithm = "ed25519"
+
+var (
+	// ErrNotSigned is returned when verifying an archive whose header does not
+	// declare that it is signed.
+	ErrNotSigned = errors.New("archive is not signed")
+	// ErrSignatureMissing is returned when verifying a signed archive that has
+	// no signature block.
+	ErrSignatureMissing = errors.New("archive is signed but its signature block is missing")
+)
+
+// SignatureHeader is a data structure that, as BSON, starts the signature
+// block of a signed archive. It is followed by a single SignatureBlock.
+type SignatureHeader struct {
+	Signature bool `bson:"signature"`
+}
+
+// SignatureBlock holds the signature of a signed archive. Manifest is a
+// SignatureManifest kept as raw BSON, because the signature covers its bytes.
+type SignatureBlock struct {
+	Manifest  bson.Raw `bson:"manifest"`
+	Signature []byte   `bson:"signature"`
+}
+
+// SignatureManifest is what the signature of an archive covers.
+type SignatureManifest struct {
+	Algorithm string `bson:"algorithm"`
+	// Prelude is the SHA-256 digest of the prelude, see PreludeDigest.
+	Prelude []byte `bson:"prelude"`
+	// Namespaces are in the order of their EOF blocks in the archive.
+	Namespaces []NamespaceDigest `bson:"namespaces"`
+}
+
+// NamespaceDigest describes the data of one namespace in a SignatureManifest.
+type NamespaceDigest struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"collection"`
+	CRC        int64  `bson:"CRC"`
+	// Digest is the SHA-256 digest of the namespace's data as it is stored in
+	// the archive, so it covers the compressed chunks of compressed archives.
+	Digest []byte `bson:"digest"`
+}
+
+// IsSignatureHeader reports whether a block header is the header of the signature block.
+func IsSignatureHeader(data []byte) bool {
+	value, err := bson.Raw(data).LookupErr("signature")
+	if err != nil {
+		return false
+	}
+	isSignature, ok := value.BooleanOK()
+	return ok && isSignature
+}
+
+// PreludeDigest returns the SHA-256 digest of a prelude as written by Prelude.Write.
+func PreludeDigest(prelude *Prelude) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := prelude.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(buf.Bytes())
+	return digest[:], nil
+}
+
+// namespaceDigests hashes the data of each namespace of an archive, and
+// records the digests as the EOF blocks are reached. It is shared by the
+// Multiplexer, which signs the digests, and the SignatureVerifier.
+type namespaceDigests struct {
+	hashes     map[string]hash.Hash
+	namespaces []NamespaceDigest
+}
+
+func newNamespaceDigests() *namespaceDigests {
+	return &namespaceDigests{hashes: map[string]hash.Hash{}}
+}
+
+func (nd *namespaceDigests) addData(ns string, data []byte) {
+	h, ok := nd.hashes[ns]
+	if !ok {
+		h = sha256.New()
+		nd.hashes[ns] = h
+	}
+	// Writes to the hash never return an error.
+	_, _ = h.Write(data)
+}
+
+func (nd *namespaceDigests) end(db, collection string, crc int64) {
+	ns := db + "." + collection
+	digest := sha256.New()
+	if h, ok := nd.hashes[ns]; ok {
+		digest = h
+	}
+	nd.namespaces = append(nd.namespaces, NamespaceDigest{
+		Database:   db,
+		Collection: collection,
+		CRC:        crc,
+		Digest:     digest.Sum(nil),
+	})
+	delete(nd.hashes, ns)
+}
+
+// signatureRecorder builds and writes the signature block of an archive.
+type signatureRecorder struct {
+	key     ed25519.PrivateKey
+	prelude []byte
+	*namespaceDigests
+}
+
+// write writes the signature block to out.
+func (sr *signatureRecorder) write(out io.Writer) error {
+	manifest, err := bson.Marshal(SignatureManifest{
+		Algorithm:  SignatureAlgorithm,
+		Prelude:    sr.prelude,
+		Namespaces: sr.namespaces,
+	})
+	if err != nil {
+		return err
+	}
+	header, err := bson.Marshal(SignatureHeader{Signature: true})
+	if err != nil {
+		return err
+	}
+	block, err := bson.Marshal(SignatureBlock{
+		Manifest:  manifest,
+		Signature: ed25519.Sign(sr.key, manifest),
+	})
+	if err != nil {
+		return err
+	}
+	for _, buf := range [][]byte{header, block, terminatorBytes} {
+		if err = writeFull(out, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignatureVerifier implements ParserConsumer and checks the signature of a
+// signed archive as its blocks are read. VerifySignature runs one over a whole
+// archive.
+type SignatureVerifier struct {
+	key     ed25519.PublicKey
+	prelude []byte
+	*namespaceDigests
+	currentNamespace string
+	inSignature      bool
+	block            *SignatureBlock
+}
+
+// NewSignatureVerifier creates a SignatureVerifier for the archive whose
+// prelude has been read. It returns ErrNotSigned if the archive is not signed.
+func NewSignatureVerifier(key ed25519.PublicKey, prelude *Prelude) (*SignatureVerifier, error) {
+	if prelude.Header == nil || !prelude.Header.Signed {
+		return nil, ErrNotSigned
+	}
+	digest, err := PreludeDigest(prelude)
+	if err != nil {
+		return nil, fmt.Errorf("error computing the digest of the archive prelude: %v", err)
+	}
+	return &SignatureVerifier{
+		key:              key,
+		prelude:          digest,
+		namespaceDigests: newNamespaceDigests(),
+	}, nil
+}
+
+// HeaderBSON is part of the ParserConsumer interface.
+func (verifier *SignatureVerifier) HeaderBSON(data []byte) error {
+	if IsIndexHeader(data) {
+		return ErrIndexReached
+	}
+	if verifier.block != nil {
+		return fmt.Errorf("archive has data after its signature block")
+	}
+	verifier.currentNamespace = ""
+	if IsSignatureHeader(data) {
+		verifier.inSignature = true
+		return nil
+	}
+	header := NamespaceHeader{}
+	err := bson.Unmarshal(data, &header)
+	if err != nil {
+		return fmt.Errorf("header bson doesn't unmarshal as a namespace header: %v", err)
+	}
+	if header.EOF {
+		verifier.end(header.Database, header.Collection, header.CRC)
+		return nil
+	}
+	verifier.currentNamespace = header.Namespace()
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface.
+func (verifier *SignatureVerifier) BodyBSON(data []byte) error {
+	if verifier.inSignature {
+		if verifier.block != nil {
+			return fmt.Errorf("archive has more than one signature")
+		}
+		block := &SignatureBlock{}
+		err := bson.Unmarshal(data, block)
+		if err != nil {
+			return fmt.Errorf("error reading the archive signature: %v", err)
+		}
+		// data is reused by the Parser, so the manifest must be copied
+		block.Manifest = bytes.Clone(block.Manifest)
+		verifier.block = block
+		return nil
+	}
+	if verifier.currentNamespace == "" {
+		return fmt.Errorf("collection data without a collection header")
+	}
+	verifier.addData(verifier.currentNamespace, data)
+	return nil
+}
+
+// End is part of the ParserConsumer interface. It checks the signature.
+func (verifier *SignatureVerifier) End() error {
+	if verifier.block == nil {
+		return ErrSignatureMissing
+	}
+	if !ed25519.Verify(verifier.key, verifier.block.Manifest, verifier.block.Signature) {
+		return fmt.Errorf("archive signature does not match the verification key")
+	}
+	manifest := SignatureManifest{}
+	err := bson.Unmarshal(verifier.block.Manifest, &manifest)
+	if err != nil {
+		return fmt.Errorf("error reading the signed archive manifest: %v", err)
+	}
+	if manifest.Algorithm != SignatureAlgorithm {
+		return fmt.Errorf("unsupported archive signature algorithm %q", manifest.Algorithm)
+	}
+	if !bytes.Equal(manifest.Prelude, verifier.prelude) {
+		return fmt.Errorf("archive prelude does not match its signature")
+	}
+	if len(manifest.Namespaces) != len(verifier.namespaces) {
+		return fmt.Errorf(
+			"archive has %v namespaces but its signature covers %v",
+			len(verifier.namespaces),
+			len(manifest.Namespaces),
+		)
+	}
+	for i, signed := range manifest.Namespaces {
+		found := verifier.namespaces[i]
+		if signed.Database != found.Database || signed.Collection != found.Collection {
+			return fmt.Errorf(
+				"archive namespace %v.%v does not match its signature",
+				found.Database,
+				found.Collection,
+			)
+		}
+		if signed.CRC != found.CRC || !bytes.Equal(signed.Digest, found.Digest) {
+			return fmt.Errorf(
+				"data of archive namespace %v.%v does not match its signature",
+				found.Database,
+				found.Collection,
+			)
+		}
+	}
+	log.Logvf(log.DebugLow, "archive signature verified for %v namespaces", len(manifest.Namespaces))
+	return nil
+}
+
+// VerifySignature reads a whole archive and checks its signature with key.
+func VerifySignature(in io.Reader, key ed25519.PublicKey) error {
+	prelude := &Prelude{}
+	err := prelude.Read(in)
+	if err != nil {
+		return err
+	}
+	verifier, err := NewSignatureVerifier(key, prelude)
+	if err != nil {
+		return err
+	}
+	parser := Parser{In: in}
+	return parser.ReadAllBlocks(verifier)
+}
+
+// verifiedCopy is a temporary copy of an archive whose signature has been
+// verified. It is removed when it is closed.
+type verifiedCopy struct {
+	*os.File
+}
+
+// Close closes and removes the copy.
+func (vc verifiedCopy) Close() error {
+	err := vc.File.Close()
+	if removeErr := os.Remove(vc.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// VerifiedCopy reads a whole archive once, copying it to a temporary file
+// while its signature is checked with key, and returns a reader of the copy.
+// Reading the copy instead of the original means that only the bytes that were
+// verified are used, even if the original changes after it has been verified
+// or is a stream that can only be read once. The copy needs as much free space
+// as the archive in the directory for temporary files, and it is removed when
+// the reader is closed. Since the index isn't covered by the signature, the
+// copy must be read from start to end.
+func VerifiedCopy(in io.Reader, key ed25519.PublicKey) (io.ReadCloser, error) {
+	file, err := os.CreateTemp("", "archive-*.verified")
+	if err != nil {
+		return nil, fmt.Errorf("error creating a copy of the archive to verify: %v", err)
+	}
+	log.Logvf(log.Always,
+		"copying the archive to %v to verify it: this needs as much free space as the archive, "+
+			"and the archive will be read from start to end without using its index",
+		file.Name())
+	verified := verifiedCopy{file}
+	tee := io.TeeReader(in, file)
+	err = VerifySignature(tee, key)
+	if err == nil {
+		// the index after the signature block isn't read by the verifier
+		_, err = io.Copy(io.Discard, tee)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = verified.Close()
+		return nil, err
+	}
+	return verified, nil
+}
@@ -0,0 +1,168 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"hash"
+	"io"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildSignedArchive multiplexes testIntents into an archive signed with key,
+// compressed with the given codec and with a namespace index.
+func buildSignedArchive(t *testing.T, key ed25519.PrivateKey, compression string) []byte {
+	buf := &closingBuffer{bytes.Buffer{}}
+	out := NewOffsetWriter(buf)
+
+	prelude := &Prelude{Header: &Header{ServerVersion: "7.0.0"}}
+	prelude.Header.SetFeatures(true, compression, true)
+	for _, intent := range testIntents {
+		prelude.AddMetadata(&CollectionMetadata{Database: intent.DB, Collection: intent.C})
+	}
+	require.NoError(t, prelude.Write(out))
+
+	mux := NewMultiplexer(out, new(testNotifier))
+	require.NoError(t, mux.EnableIndex())
+	require.NoError(t, mux.EnableCompression(compression))
+	require.NoError(t, mux.EnableSigning(key, prelude))
+
+	errChan := make(chan error)
+	makeIns(testIntents, mux, map[string]hash.Hash{}, map[string]*MuxIn{}, map[string]*int{}, errChan)
+	go mux.Run()
+	for range testIntents {
+		require.NoError(t, <-errChan)
+	}
+	close(mux.Control)
+	require.NoError(t, <-mux.Completed)
+	return buf.Bytes()
+}
+
+func TestVerifySignature(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	for _, compression := range []string{CompressionNone, CompressionZstd} {
+		data := buildSignedArchive(t, private, compression)
+
+		t.Run("valid "+compression, func(t *testing.T) {
+			assert.NoError(t, VerifySignature(bytes.NewReader(data), public))
+		})
+		t.Run("wrong key "+compression, func(t *testing.T) {
+			assert.ErrorContains(
+				t,
+				VerifySignature(bytes.NewReader(data), otherPublic),
+				"does not match the verification key",
+			)
+		})
+
+		index, err := ReadIndex(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		t.Run("missing signature "+compression, func(t *testing.T) {
+			// cut the archive at the end of its namespace data
+			var end int64
+			for _, entry := range index.Entries {
+				end = max(end, entry.EOF.Offset+entry.EOF.Length)
+			}
+			assert.ErrorIs(t, VerifySignature(bytes.NewReader(data[:end]), public), ErrSignatureMissing)
+		})
+		t.Run("tampered data "+compression, func(t *testing.T) {
+			tampered := bytes.Clone(data)
+			segment := index.Entries["ding.bats"].Segments[0]
+			// flip a byte in the middle of the last document of the segment
+			tampered[segment.Offset+segment.Length-int64(len(terminatorBytes))-8] ^= 0x01
+			assert.Error(t, VerifySignature(bytes.NewReader(tampered), public))
+		})
+	}
+
+	t.Run("tampered prelude", func(t *testing.T) {
+		data := buildSignedArchive(t, private, CompressionNone)
+		at := bytes.Index(data, []byte("7.0.0"))
+		require.Positive(t, at)
+		data[at+4] = '1'
+		assert.ErrorContains(
+			t,
+			VerifySignature(bytes.NewReader(data), public),
+			"prelude does not match its signature",
+		)
+	})
+
+	t.Run("unsigned archive", func(t *testing.T) {
+		archiveBytes, _, _ := buildIndexedArchive(t)
+		assert.ErrorIs(t, VerifySignature(bytes.NewReader(archiveBytes), public), ErrNotSigned)
+	})
+}
+
+func TestDemuxSignedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	data := buildSignedArchive(t, private, CompressionNone)
+
+	verified, err := VerifiedCopy(bytes.NewReader(data), public)
+	require.NoError(t, err)
+	defer verified.Close()
+
+	prelude := &Prelude{}
+	require.NoError(t, prelude.Read(verified))
+	assert.True(t, prelude.Header.Signed)
+
+	// the signature block is skipped
+	demux := CreateDemux(prelude.NamespaceMetadatas, verified, false)
+	caches := map[string]*SpecialCollectionCache{}
+	for _, intent := range testIntents {
+		cache := NewSpecialCollectionCache(intent, demux)
+		caches[intent.Namespace()] = cache
+		demux.Open(intent.Namespace(), cache)
+	}
+	require.NoError(t, demux.Run())
+	for ns, cache := range caches {
+		assert.Equal(t, testDocCount, countDocuments(t, cache), ns)
+	}
+}
+
+func TestVerifiedCopy(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	data := buildSignedArchive(t, private, CompressionZstd)
+
+	t.Run("the copy has the bytes that were verified", func(t *testing.T) {
+		verified, err := VerifiedCopy(bytes.NewReader(data), public)
+		require.NoError(t, err)
+		copied, err := io.ReadAll(verified)
+		require.NoError(t, err)
+		assert.Equal(t, data, copied)
+
+		name := verified.(verifiedCopy).Name()
+		require.NoError(t, verified.Close())
+		assert.NoFileExists(t, name)
+	})
+
+	t.Run("nothing is returned for a bad signature", func(t *testing.T) {
+		other, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		verified, err := VerifiedCopy(bytes.NewReader(data), other)
+		assert.ErrorContains(t, err, "does not match the verification key")
+		assert.Nil(t, verified)
+
+		archiveBytes, _, _ := buildIndexedArchive(t)
+		_, err = VerifiedCopy(bytes.NewReader(archiveBytes), public)
+		assert.ErrorIs(t, err, ErrNotSigned)
+	})
+}
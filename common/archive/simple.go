@@ -3,7 +3,6 @@ package archive
 import (
 	"bytes"
 	"encoding/binary"
-	"hash/crc64"
 
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -31,7 +30,7 @@ func (sa SimpleArchive) Marshal() ([]byte, error) {
 	archive := bytes.NewBuffer(archiveBytes)
 
 	dupeHeader := sa.Header
-	dupeHeader.FormatVersion = archiveFormatVersion
+	dupeHeader.FormatVersion = BaseFormatVersion
 
 	headerBytes, err := bson.Marshal(dupeHeader)
 	if err != nil {
@@ -62,7 +61,7 @@ func (sa SimpleArchive) Marshal() ([]byte, error) {
 
 		archive.Write(nsBytes)
 
-		crc := crc64.New(crc64.MakeTable(crc64.ECMA))
+		crc := NewCRC()
 
 		for _, doc := range ns.Documents {
 			docBytes, err := bson.Marshal(doc)
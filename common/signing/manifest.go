@@ -0,0 +1,245 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// A signed dump directory has a manifest at its root that lists the digest of
+// every file in the directory, and a signature file that holds the Ed25519
+// signature of the manifest.
+const (
+	ManifestFileName  = "manifest.json"
+	SignatureFileName = "manifest.json.sig"
+)
+
+// Algorithm is the signature algorithm of signed dump directories.
+const Algorithm = "ed25519"
+
+// ErrNoManifest is returned when verifying a path that isn't in a signed dump directory.
+var ErrNoManifest = errors.New("no signed manifest found")
+
+// Manifest lists the files of a signed dump directory.
+type Manifest struct {
+	Algorithm string         `json:"algorithm"`
+	Files     []ManifestFile `json:"files"`
+}
+
+// ManifestFile is the digest of one file in a Manifest.
+type ManifestFile struct {
+	// Path is relative to the directory of the manifest, with forward slashes.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// IsManifestFile reports whether a file name is one of the files that sign a dump directory.
+func IsManifestFile(name string) bool {
+	return name == ManifestFileName || name == SignatureFileName
+}
+
+// SignDirectory writes a manifest of every file under root and its signature to
+// root. The directory must only hold regular files and directories.
+func SignDirectory(root string, key ed25519.PrivateKey) error {
+	manifest := Manifest{Algorithm: Algorithm, Files: []ManifestFile{}}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip, err := skipEntry(root, path, entry); skip || err != nil {
+			return err
+		}
+		file, err := digestFile(root, path)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error computing the digests of %v: %v", root, err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling manifest: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(root, ManifestFileName), data, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	err = os.WriteFile(filepath.Join(root, SignatureFileName), []byte(signature+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing manifest signature: %v", err)
+	}
+	log.Logvf(log.Info, "signed manifest of %v files written to %v", len(manifest.Files), root)
+	return nil
+}
+
+// VerifyPath checks a file or directory of a signed dump directory against the
+// manifest of the dump. The manifest is looked for in the directory of target
+// and the directories above it, and its signature is checked with key. Every
+// file under target must be in the manifest and match its digest, and every
+// file in the manifest under target must exist. Any other kind of entry, such
+// as a symbolic link, fails verification, since it can't be signed.
+func VerifyPath(target string, key ed25519.PublicKey) error {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	dir := target
+	if !info.IsDir() {
+		dir = filepath.Dir(target)
+	}
+	root, manifest, err := readManifest(dir, key)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if rel != "." {
+		prefix = filepath.ToSlash(rel)
+	}
+	expected := map[string]ManifestFile{}
+	for _, file := range manifest.Files {
+		if prefix == "" || file.Path == prefix || strings.HasPrefix(file.Path, prefix+"/") {
+			expected[file.Path] = file
+		}
+	}
+
+	err = filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip, err := skipEntry(root, path, entry); skip || err != nil {
+			return err
+		}
+		found, err := digestFile(root, path)
+		if err != nil {
+			return err
+		}
+		signed, ok := expected[found.Path]
+		if !ok {
+			return fmt.Errorf("%v is not in the signed manifest", path)
+		}
+		if signed.Size != found.Size || signed.SHA256 != found.SHA256 {
+			return fmt.Errorf("%v does not match its digest in the signed manifest", path)
+		}
+		delete(expected, found.Path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for path := range expected {
+		return fmt.Errorf("%v is in the signed manifest but is missing", filepath.Join(root, path))
+	}
+	log.Logvf(log.Info, "verified %v against the signed manifest in %v", target, root)
+	return nil
+}
+
+// skipEntry reports whether an entry found while walking a dump directory
+// isn't digested: directories and the manifest files at root. Entries that are
+// neither regular files nor directories are an error, so that a symbolic link
+// can't bring unsigned data into a signed dump.
+func skipEntry(root, path string, entry fs.DirEntry) (bool, error) {
+	if entry.IsDir() {
+		return true, nil
+	}
+	if !entry.Type().IsRegular() {
+		return true, fmt.Errorf("%v is neither a regular file nor a directory", path)
+	}
+	return filepath.Dir(path) == root && IsManifestFile(entry.Name()), nil
+}
+
+// readManifest finds the manifest in dir or the directories above it, checks
+// its signature and returns it with the directory it was found in.
+func readManifest(dir string, key ed25519.PublicKey) (string, *Manifest, error) {
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+		if err == nil {
+			manifest, err := checkManifest(dir, data, key)
+			return dir, manifest, err
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, fmt.Errorf("error reading manifest: %v", err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, ErrNoManifest
+		}
+		dir = parent
+	}
+}
+
+func checkManifest(root string, data []byte, key ed25519.PublicKey) (*Manifest, error) {
+	encoded, err := os.ReadFile(filepath.Join(root, SignatureFileName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest signature: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding manifest signature: %v", err)
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return nil, fmt.Errorf("manifest signature in %v does not match the verification key", root)
+	}
+	manifest := &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %v", err)
+	}
+	if manifest.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported manifest signature algorithm %q", manifest.Algorithm)
+	}
+	return manifest, nil
+}
+
+func digestFile(root, path string) (ManifestFile, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("error reading %v: %v", path, err)
+	}
+	return ManifestFile{
+		Path:   filepath.ToSlash(rel),
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
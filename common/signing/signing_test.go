@@ -0,0 +1,140 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeys writes a new Ed25519 key pair to dir as PEM files and returns their paths.
+func writeKeys(t *testing.T, dir string) (string, string) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	privatePath := filepath.Join(dir, "key.pem")
+	publicPath := filepath.Join(dir, "key.pub.pem")
+	require.NoError(t, os.WriteFile(
+		privatePath,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		0600,
+	))
+	require.NoError(t, os.WriteFile(
+		publicPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		0644,
+	))
+	return privatePath, publicPath
+}
+
+func TestLoadKeys(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	privatePath, publicPath := writeKeys(t, t.TempDir())
+	private, err := LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+	public, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+	assert.Equal(t, private.Public(), public)
+
+	_, err = LoadPrivateKey(publicPath)
+	assert.Error(t, err, "a public key is not a private key")
+	_, err = LoadPublicKey(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+}
+
+func TestSignDirectory(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	keys := t.TempDir()
+	privatePath, publicPath := writeKeys(t, keys)
+	private, err := LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+	public, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+	_, otherPublicPath := writeKeys(t, t.TempDir())
+	otherPublic, err := LoadPublicKey(otherPublicPath)
+	require.NoError(t, err)
+
+	makeDump := func(t *testing.T) string {
+		root := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "db1"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "db2"), 0755))
+		for _, path := range []string{"db1/c1.bson", "db1/c1.metadata.json", "db2/c2.bson", "oplog.bson"} {
+			require.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(path), 0644))
+		}
+		require.NoError(t, SignDirectory(root, private))
+		return root
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		root := makeDump(t)
+		assert.NoError(t, VerifyPath(root, public))
+		assert.NoError(t, VerifyPath(filepath.Join(root, "db1"), public))
+		assert.NoError(t, VerifyPath(filepath.Join(root, "db2", "c2.bson"), public))
+		assert.Error(t, VerifyPath(root, otherPublic))
+	})
+
+	t.Run("tampered file", func(t *testing.T) {
+		root := makeDump(t)
+		require.NoError(t, os.WriteFile(filepath.Join(root, "db1", "c1.bson"), []byte("db1/c1.bsoN"), 0644))
+		assert.ErrorContains(t, VerifyPath(root, public), "does not match its digest")
+		assert.Error(t, VerifyPath(filepath.Join(root, "db1", "c1.bson"), public))
+		assert.NoError(t, VerifyPath(filepath.Join(root, "db2"), public), "db2 is not tampered")
+	})
+
+	t.Run("added file", func(t *testing.T) {
+		root := makeDump(t)
+		require.NoError(t, os.WriteFile(filepath.Join(root, "db2", "c3.bson"), nil, 0644))
+		assert.ErrorContains(t, VerifyPath(root, public), "is not in the signed manifest")
+	})
+
+	t.Run("symbolic link", func(t *testing.T) {
+		root := makeDump(t)
+		outside := filepath.Join(t.TempDir(), "evil.bson")
+		require.NoError(t, os.WriteFile(outside, []byte("evil"), 0644))
+		if err := os.Symlink(outside, filepath.Join(root, "db1", "evil.bson")); err != nil {
+			t.Skipf("can't create symbolic links: %v", err)
+		}
+		assert.ErrorContains(t, VerifyPath(root, public), "neither a regular file nor a directory")
+		assert.Error(t, VerifyPath(filepath.Join(root, "db1"), public))
+		assert.Error(t, VerifyPath(filepath.Join(root, "db1", "evil.bson"), public))
+		assert.NoError(t, VerifyPath(filepath.Join(root, "db2"), public), "db2 has no link")
+		assert.ErrorContains(t, SignDirectory(root, private), "neither a regular file nor a directory")
+	})
+
+	t.Run("removed file", func(t *testing.T) {
+		root := makeDump(t)
+		require.NoError(t, os.Remove(filepath.Join(root, "db1", "c1.metadata.json")))
+		assert.ErrorContains(t, VerifyPath(filepath.Join(root, "db1"), public), "is missing")
+	})
+
+	t.Run("tampered manifest", func(t *testing.T) {
+		root := makeDump(t)
+		manifestPath := filepath.Join(root, ManifestFileName)
+		data, err := os.ReadFile(manifestPath)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(manifestPath, append(data, ' '), 0644))
+		assert.ErrorContains(t, VerifyPath(root, public), "does not match the verification key")
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		assert.ErrorIs(t, VerifyPath(keys, public), ErrNoManifest)
+	})
+}
@@ -9,6 +9,9 @@ package text
 import (
 	"fmt"
 	"math"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -43,6 +46,25 @@ func FormatBits(size int64) string {
 	return formatUnitAmount(decimal, size, 3, shortBitUnits)
 }
 
+// ParseByteAmount parses a size in bytes with an optional binary unit, such as
+// 1048576, 512KB, 1.5G or 100MB. Unit letters are case insensitive and the
+// trailing B is optional.
+func ParseByteAmount(s string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := 1.0
+	if number != "" {
+		if i := slices.Index(shortByteUnits[1:], number[len(number)-1:]); i >= 0 {
+			multiplier = math.Pow(binary, float64(i+1))
+			number = strings.TrimSpace(number[:len(number)-1])
+		}
+	}
+	amount, err := strconv.ParseFloat(number, 64)
+	if err != nil || amount < 0 || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(amount * multiplier), nil
+}
+
 // formatUnitAmount formats the size using the units and at least minDigits
 // numbers, unless the number is already less than the base, where no decimal
 // will be added.
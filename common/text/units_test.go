@@ -113,3 +113,28 @@ func TestBitFormatPrecision(t *testing.T) {
 		})
 	})
 }
+
+func TestParseByteAmount(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With some sample sizes", t, func() {
+		for input, expected := range map[string]int64{
+			"0":      0,
+			"1000":   1000,
+			"1000b":  1000,
+			"2KB":    2 * 1024,
+			"2k":     2 * 1024,
+			"1.5MB":  3 * 512 * 1024,
+			"800 GB": 800 * 1024 * 1024 * 1024,
+			"10g":    10 * 1024 * 1024 * 1024,
+		} {
+			amount, err := ParseByteAmount(input)
+			So(err, ShouldBeNil)
+			So(amount, ShouldEqual, expected)
+		}
+		for _, input := range []string{"", "MB", "-1MB", "10TB", "ten"} {
+			_, err := ParseByteAmount(input)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -97,6 +97,11 @@ func NewMeta(op db.Oplog) (Meta, error) {
 	return m, nil
 }
 
+// ID returns the identifier of the transaction of the oplog entry.
+func (m Meta) ID() ID {
+	return m.id
+}
+
 // IsAbort is true if the oplog entry had the abort command.
 func (m Meta) IsAbort() bool {
 	return m.abort
@@ -9,6 +9,8 @@ package util
 import (
 	"bufio"
 	"context"
+	"crypto/sha1"
+	"encoding/base64"
 	"io"
 	"net/url"
 	"os"
@@ -52,6 +54,26 @@ func UnescapeCollectionName(escapedCollName string) (string, error) {
 	return url.QueryUnescape(escapedCollName)
 }
 
+// CollectionFileName returns the escaped name, without an extension, of the
+// files for a collection in a dump directory. Collection names that would
+// result in a file name greater than 255 bytes long, including the longest
+// possible extension (.metadata.json.gz), are encoded as
+// <truncated-url-encoded-collection-name>%24<collection-name-hash-base64>
+// where %24 represents a $ symbol delimiter (e.g. aVeryVery...VeryLongName%24oPpXMQ...).
+func CollectionFileName(collName string) string {
+	escapedCollName := EscapeCollectionName(collName)
+	if len(escapedCollName) > 238 {
+		collNameTruncated := escapedCollName[:208]
+		// #nosec G401 -- we do not use this digest algorithm in a security-sensitive way.
+		collNameHashBytes := sha1.Sum([]byte(collName))
+		collNameHashBase64 := base64.RawURLEncoding.EncodeToString(collNameHashBytes[:])
+
+		// First 208 bytes of col name + 3 bytes delimiter + 27 bytes base64 hash = 238 bytes max.
+		escapedCollName = collNameTruncated + "%24" + collNameHashBase64
+	}
+	return escapedCollName
+}
+
 type WrappedReadCloser struct {
 	io.ReadCloser
 	Inner io.ReadCloser
@@ -0,0 +1,191 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Files that are split because of a maximum file size are written as numbered
+// parts. A BSON file such as coll.bson is split into coll.000.bson,
+// coll.001.bson, ..., and any other file, such as an archive, into
+// dump.archive.000, dump.archive.001, ....
+
+var bsonPartName = regexp.MustCompile(`^(.+)\.(\d{3,})(\.bson(?:\.gz)?)$`)
+
+// BSONPartPath returns the path of a part of the BSON file at path, which ends
+// in .bson or .bson.gz.
+func BSONPartPath(path string, part int) string {
+	for _, ext := range []string{".bson.gz", ".bson"} {
+		if strings.HasSuffix(path, ext) {
+			return fmt.Sprintf("%v.%03d%v", strings.TrimSuffix(path, ext), part, ext)
+		}
+	}
+	return ArchivePartPath(path, part)
+}
+
+// ParseBSONPartName returns the name of the whole BSON file and the part
+// number for the name of a part of a BSON file. ok is false if name isn't the
+// name of a part.
+func ParseBSONPartName(name string) (whole string, part int, ok bool) {
+	match := bsonPartName.FindStringSubmatch(name)
+	if match == nil {
+		return "", 0, false
+	}
+	part, err := strconv.Atoi(match[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return match[1] + match[3], part, true
+}
+
+// ArchivePartPath returns the path of a part of the file at path.
+func ArchivePartPath(path string, part int) string {
+	return fmt.Sprintf("%v.%03d", path, part)
+}
+
+// ArchiveParts returns the paths of the parts of the file at path, in order.
+// It returns nil if the file wasn't split.
+func ArchiveParts(path string) ([]string, error) {
+	var parts []string
+	for part := 0; ; part++ {
+		partPath := ArchivePartPath(path, part)
+		_, err := os.Stat(partPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, partPath)
+	}
+}
+
+// PartWriter writes a stream of bytes to numbered parts of a file, starting a
+// new part whenever the current one reaches the maximum size. Parts are split
+// at arbitrary byte offsets, so they must be concatenated to be read.
+type PartWriter struct {
+	path    string
+	maxSize int64
+	part    int
+	written int64
+	file    *os.File
+}
+
+// NewPartWriter creates the first part of the file at path, with parts of at
+// most maxSize bytes.
+func NewPartWriter(path string, maxSize int64) (*PartWriter, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("maximum part size must be positive, got %v", maxSize)
+	}
+	w := &PartWriter{path: path, maxSize: maxSize}
+	file, err := os.Create(ArchivePartPath(path, 0))
+	if err != nil {
+		return nil, err
+	}
+	w.file = file
+	return w, nil
+}
+
+// Write writes p across as many parts as needed.
+func (w *PartWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.written == w.maxSize {
+			err := w.file.Close()
+			if err != nil {
+				return total, err
+			}
+			w.part++
+			w.written = 0
+			w.file, err = os.Create(ArchivePartPath(w.path, w.part))
+			if err != nil {
+				return total, err
+			}
+		}
+		chunk := p[:min(int64(len(p)), w.maxSize-w.written)]
+		n, err := w.file.Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close closes the current part.
+func (w *PartWriter) Close() error {
+	return w.file.Close()
+}
+
+// PartsReader reads the concatenation of a list of files, opening each file
+// only once the previous one has been read.
+type PartsReader struct {
+	paths []string
+	file  *os.File
+}
+
+// NewPartsReader returns a reader of the concatenation of the files at paths.
+// The first file is opened right away so that errors are reported early.
+func NewPartsReader(paths []string) (*PartsReader, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no parts to read")
+	}
+	file, err := os.Open(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	return &PartsReader{paths: paths[1:], file: file}, nil
+}
+
+// Read reads from the current part, moving on to the next part at the end of
+// the current one.
+func (r *PartsReader) Read(p []byte) (int, error) {
+	for {
+		if r.file == nil {
+			return 0, io.EOF
+		}
+		n, err := r.file.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		err = r.file.Close()
+		r.file = nil
+		if err != nil {
+			return n, err
+		}
+		if len(r.paths) > 0 {
+			r.file, err = os.Open(r.paths[0])
+			if err != nil {
+				return n, err
+			}
+			r.paths = r.paths[1:]
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close closes the part being read.
+func (r *PartsReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
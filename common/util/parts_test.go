@@ -0,0 +1,86 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBSONPartNames(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	assert.Equal(t, "dump/db/c.000.bson", BSONPartPath("dump/db/c.bson", 0))
+	assert.Equal(t, "dump/db/c.012.bson.gz", BSONPartPath("dump/db/c.bson.gz", 12))
+	assert.Equal(t, "dump/db/c.1000.bson", BSONPartPath("dump/db/c.bson", 1000))
+	assert.Equal(t, "dump.archive.002", ArchivePartPath("dump.archive", 2))
+
+	for name, expected := range map[string]struct {
+		whole string
+		part  int
+	}{
+		"c.000.bson":        {"c.bson", 0},
+		"c.d.017.bson.gz":   {"c.d.bson.gz", 17},
+		"c.000.1234.bson":   {"c.000.bson", 1234},
+		"oplog.001.bson":    {"oplog.bson", 1},
+		"c.00.bson":         {},
+		"c.000.json":        {},
+		"c.bson":            {},
+		"c.000.bson.gz.bak": {},
+	} {
+		whole, part, ok := ParseBSONPartName(name)
+		assert.Equal(t, expected.whole != "", ok, name)
+		assert.Equal(t, expected.whole, whole, name)
+		assert.Equal(t, expected.part, part, name)
+	}
+}
+
+func TestPartWriterAndReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	path := filepath.Join(t.TempDir(), "dump.archive")
+	data := bytes.Repeat([]byte("0123456789"), 25)
+
+	w, err := NewPartWriter(path, 100)
+	require.NoError(t, err)
+	for _, chunk := range [][]byte{data[:30], data[30:170], data[170:]} {
+		n, err := w.Write(chunk)
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, w.Close())
+
+	parts, err := ArchiveParts(path)
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	for i, size := range []int64{100, 100, 50} {
+		stat, err := os.Stat(parts[i])
+		require.NoError(t, err)
+		assert.Equal(t, size, stat.Size())
+	}
+
+	r, err := NewPartsReader(parts)
+	require.NoError(t, err)
+	read, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, read)
+	require.NoError(t, r.Close())
+
+	parts, err = ArchiveParts(filepath.Join(t.TempDir(), "unsplit"))
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+
+	_, err = NewPartWriter(path, 0)
+	assert.Error(t, err)
+}
@@ -60,3 +60,32 @@ func TestTimestampComparisons(t *testing.T) {
 		}
 	})
 }
+
+func TestParseTimestampFlag(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	valid := map[string]primitive.Timestamp{
+		"123:456": {T: 123, I: 456},
+		"123":     {T: 123, I: 0},
+		"123:":    {T: 123, I: 0},
+	}
+	for input, expected := range valid {
+		ts, err := ParseTimestampFlag(input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", input, err)
+		}
+		if ts != expected {
+			t.Fatalf("%q: expected %v, got %v", input, expected, ts)
+		}
+	}
+
+	for _, input := range []string{"123.123", ":", "1:1:1", "cats", ""} {
+		ts, err := ParseTimestampFlag(input)
+		if err == nil {
+			t.Fatalf("%q: expected an error", input)
+		}
+		if ts != (primitive.Timestamp{}) {
+			t.Fatalf("%q: expected an empty timestamp, got %v", input, ts)
+		}
+	}
+}
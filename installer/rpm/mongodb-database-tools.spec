@@ -14,6 +14,7 @@ BuildRoot: %{_topdir}/BUILD/%{name}-%{version}-%{release}
 %description
 mongodb-database-tools package provides tools for working with the MongoDB server:
  *bsondump - display BSON files in a human-readable format
+ *mongoarchive - List, extract, pack, filter and verify mongodump archives
  *mongoimport - Convert data from JSON, TSV or CSV and insert them into a collection
  *mongoexport - Write an existing collection to CSV or JSON format
  *mongodump/mongorestore - Dump MongoDB backups to disk in .BSON format, 
@@ -48,6 +49,7 @@ rm -rf %{buildroot}
 
 %files
 %attr(0755,root,root) /usr/bin/bsondump
+%attr(0755,root,root) /usr/bin/mongoarchive
 %attr(0755,root,root) /usr/bin/mongodump
 %attr(0755,root,root) /usr/bin/mongoexport
 %attr(0755,root,root) /usr/bin/mongofiles
@@ -83,6 +85,7 @@ exit 0
 if test $1 = 0; then
    rm -f /usr/bin/bsondump
    rm -f /usr/bin/bsondump
+   rm -f /usr/bin/mongoarchive
    rm -f /usr/bin/mongodump
    rm -f /usr/bin/mongoexport
    rm -f /usr/bin/mongofiles
@@ -0,0 +1,235 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoarchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// preludeData is the content of the prelude.json file at the top of a dump
+// directory, as written by mongodump.
+type preludeData struct {
+	ServerVersion string `json:"ServerVersion"`
+	ToolVersion   string `json:"ToolVersion"`
+}
+
+// extractedFile implements archive.DemuxOut and writes the documents of one
+// namespace to a .bson file in the dump directory. The file is only created
+// once the namespace's data is reached so that extracting an archive with many
+// namespaces doesn't need a file handle for each of them at once.
+type extractedFile struct {
+	path   string
+	gzip   bool
+	frames *archive.FrameDecoder
+	hash   hash.Hash64
+
+	file   *os.File
+	writer io.WriteCloser
+	buf    *bufio.Writer
+	err    error
+}
+
+func (ef *extractedFile) open() error {
+	if ef.file != nil {
+		return nil
+	}
+	log.Logvf(log.DebugLow, "writing %v", ef.path)
+	file, err := os.Create(ef.path)
+	if err != nil {
+		return fmt.Errorf("error creating %v: %v", ef.path, err)
+	}
+	ef.file = file
+	ef.writer = file
+	if ef.gzip {
+		ef.writer = &util.WrappedWriteCloser{WriteCloser: gzip.NewWriter(file), Inner: file}
+	}
+	ef.buf = bufio.NewWriter(ef.writer)
+	return nil
+}
+
+// Write is part of the archive.DemuxOut interface.
+func (ef *extractedFile) Write(data []byte) (int, error) {
+	if err := ef.open(); err != nil {
+		return 0, err
+	}
+	docs := data
+	if ef.frames != nil {
+		var complete bool
+		var err error
+		docs, complete, err = ef.frames.AddChunk(data)
+		if err != nil || !complete {
+			return len(data), err
+		}
+	}
+	// Writes to the hash never return an error.
+	ef.hash.Write(docs)
+	if _, err := ef.buf.Write(docs); err != nil {
+		return 0, fmt.Errorf("error writing %v: %v", ef.path, err)
+	}
+	return len(data), nil
+}
+
+// End is part of the archive.DemuxOut interface. It creates the file if the
+// namespace is empty and closes it. Since End can't return an error, any error
+// is kept for close.
+func (ef *extractedFile) End() {
+	ef.err = ef.open()
+	if ef.err != nil {
+		return
+	}
+	ef.err = ef.close()
+}
+
+func (ef *extractedFile) close() error {
+	if ef.file == nil {
+		return nil
+	}
+	err := ef.buf.Flush()
+	closeErr := ef.writer.Close()
+	ef.file = nil
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %v: %v", ef.path, err)
+	}
+	return nil
+}
+
+// Sum64 is part of the archive.DemuxOut interface.
+func (ef *extractedFile) Sum64() (uint64, bool) {
+	return ef.hash.Sum64(), true
+}
+
+// Extract writes the contents of the archive to a dump directory with the same
+// layout as the one mongodump creates, so that it can be restored by pointing
+// mongorestore at it.
+func (ma *MongoArchive) Extract() error {
+	in, prelude, err := ma.openArchive()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	root := ma.OutputOptions.Out
+	if root == "" {
+		root = "dump"
+	}
+	root = util.ToUniversalPath(root)
+	suffix := ""
+	if ma.OutputOptions.Gzip {
+		suffix = ".gz"
+	}
+
+	demux := archive.CreateDemux(prelude.NamespaceMetadatas, in, false)
+	demux.Compression = prelude.Header.Compression
+
+	var files []*extractedFile
+	for _, cm := range prelude.NamespaceMetadatas {
+		dir := filepath.Join(root, cm.Database)
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("error creating directory %v: %v", dir, err)
+		}
+
+		if cm.Metadata != "" {
+			metadataPath := filepath.Join(
+				dir,
+				util.CollectionFileName(cm.Collection)+".metadata.json"+suffix,
+			)
+			err = ma.writeFile(metadataPath, []byte(cm.Metadata))
+			if err != nil {
+				return err
+			}
+		}
+
+		namespace := cm.DataNamespace()
+		if cm.Type == "view" {
+			// mongodump doesn't write a .bson file for views
+			intent := &intents.Intent{DB: cm.Database, C: cm.Collection, Type: cm.Type}
+			demux.Open(namespace, &archive.MutedCollection{Intent: intent, Demux: demux})
+			continue
+		}
+		_, dataCollection := util.SplitNamespace(namespace)
+		file := &extractedFile{
+			path: filepath.Join(dir, util.CollectionFileName(dataCollection)+".bson"+suffix),
+			gzip: ma.OutputOptions.Gzip,
+			hash: archive.NewCRC(),
+		}
+		if demux.Compression != archive.CompressionNone {
+			file.frames, err = archive.NewFrameDecoder(demux.Compression)
+			if err != nil {
+				return err
+			}
+		}
+		files = append(files, file)
+		demux.Open(namespace, file)
+	}
+
+	err = demux.Run()
+	for _, file := range files {
+		closeErr := file.close()
+		if file.err != nil {
+			closeErr = file.err
+		}
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error extracting archive: %v", err)
+	}
+
+	preludeJSON, err := json.Marshal(preludeData{
+		ServerVersion: prelude.Header.ServerVersion,
+		ToolVersion:   prelude.Header.ToolVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling prelude data: %v", err)
+	}
+	err = ma.writeFile(filepath.Join(root, "prelude.json"+suffix), preludeJSON)
+	if err != nil {
+		return err
+	}
+
+	log.Logvf(log.Always, "extracted %v namespaces to %v", len(prelude.NamespaceMetadatas), root)
+	return nil
+}
+
+// writeFile writes data to the file at path, compressing it with gzip if --gzip is set.
+func (ma *MongoArchive) writeFile(path string, data []byte) error {
+	log.Logvf(log.DebugLow, "writing %v", path)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %v: %v", path, err)
+	}
+	var out io.WriteCloser = file
+	if ma.OutputOptions.Gzip {
+		out = &util.WrappedWriteCloser{WriteCloser: gzip.NewWriter(file), Inner: file}
+	}
+	_, err = out.Write(data)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %v: %v", path, err)
+	}
+	return nil
+}
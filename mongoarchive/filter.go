@@ -0,0 +1,259 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoarchive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var terminatorBytes = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+
+// oplogNamespace is the namespace of the oplog in archives written with
+// mongodump --oplog.
+const oplogNamespace = ".oplog"
+
+// archiveFilter implements archive.ParserConsumer. It copies the blocks of the
+// namespaces that are kept to a new archive as they are, apart from renaming
+// their namespace headers, so compressed segments don't need to be
+// decompressed and the CRCs stay valid.
+type archiveFilter struct {
+	out io.Writer
+	// renames maps the data namespace of each kept namespace to its new name.
+	renames map[string]archive.NamespaceHeader
+	// copying is set while the body of a kept block is being copied.
+	copying bool
+	// inBlock is set when a block has been started in the output and still
+	// needs its terminator.
+	inBlock bool
+}
+
+func (filter *archiveFilter) endBlock() error {
+	if !filter.inBlock {
+		return nil
+	}
+	filter.inBlock = false
+	_, err := filter.out.Write(terminatorBytes)
+	return err
+}
+
+// HeaderBSON is part of the ParserConsumer interface.
+func (filter *archiveFilter) HeaderBSON(data []byte) error {
+	if err := filter.endBlock(); err != nil {
+		return err
+	}
+	if archive.IsIndexHeader(data) {
+		// offsets in the index would be wrong for the new archive
+		return archive.ErrIndexReached
+	}
+	if archive.IsSignatureHeader(data) {
+		// the signature would not match the new archive
+		filter.copying = false
+		return nil
+	}
+	header := archive.NamespaceHeader{}
+	err := bson.Unmarshal(data, &header)
+	if err != nil {
+		return fmt.Errorf("header bson doesn't unmarshal as a namespace header: %v", err)
+	}
+	renamed, ok := filter.renames[header.Namespace()]
+	filter.copying = ok
+	if !ok {
+		return nil
+	}
+	renamed.EOF = header.EOF
+	renamed.CRC = header.CRC
+	headerBytes, err := bson.Marshal(renamed)
+	if err != nil {
+		return err
+	}
+	if _, err = filter.out.Write(headerBytes); err != nil {
+		return err
+	}
+	filter.inBlock = true
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface.
+func (filter *archiveFilter) BodyBSON(data []byte) error {
+	if !filter.copying {
+		return nil
+	}
+	_, err := filter.out.Write(data)
+	return err
+}
+
+// End is part of the ParserConsumer interface.
+func (filter *archiveFilter) End() error {
+	return filter.endBlock()
+}
+
+// keepNamespace reports whether the namespace matches --nsInclude and --nsExclude.
+func (ma *MongoArchive) keepNamespace(namespace string) bool {
+	if ma.includer != nil && !ma.includer.Has(namespace) {
+		return false
+	}
+	return ma.excluder == nil || !ma.excluder.Has(namespace)
+}
+
+// renameMetadata returns a copy of the collection metadata renamed with --nsFrom and --nsTo.
+func (ma *MongoArchive) renameMetadata(cm *archive.CollectionMetadata) (*archive.CollectionMetadata, error) {
+	renamed := *cm
+	if ma.renamer == nil {
+		return &renamed, nil
+	}
+	namespace := cm.Database + "." + cm.Collection
+	newNamespace := ma.renamer.Get(namespace)
+	if newNamespace == namespace {
+		return &renamed, nil
+	}
+	log.Logvf(log.Info, "renaming %v to %v", namespace, newNamespace)
+	renamed.Database, renamed.Collection = util.SplitNamespace(newNamespace)
+	if renamed.Collection == "" {
+		return nil, fmt.Errorf("cannot rename %v to %v, which has no collection", namespace, newNamespace)
+	}
+
+	if cm.Metadata == "" {
+		return &renamed, nil
+	}
+	// The collection name in the metadata is used by mongorestore when the
+	// name of the collection's files is truncated, so it must match.
+	var metadata bson.D
+	err := bson.UnmarshalExtJSON([]byte(cm.Metadata), true, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing metadata for %v: %v", namespace, err)
+	}
+	for i, elem := range metadata {
+		if elem.Key == "collectionName" {
+			metadata[i].Value = renamed.Collection
+		}
+	}
+	metadataJSON, err := bsonutil.MarshalExtJSONWithBSONRoundtripConsistency(metadata, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling metadata for %v: %v", newNamespace, err)
+	}
+	renamed.Metadata = string(metadataJSON)
+	return &renamed, nil
+}
+
+// Filter writes the namespaces of the archive that match --nsInclude and
+// --nsExclude to a new archive, renaming them with --nsFrom and --nsTo.
+func (ma *MongoArchive) Filter() (err error) {
+	in, prelude, err := ma.openArchive()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	header := *prelude.Header
+	if header.Signed {
+		log.Logv(log.Always, "warning: the filtered archive will not be signed, "+
+			"since the signature of the original archive would not match it")
+	}
+	if header.MayHaveIndex() {
+		log.Logv(log.Info, "the filtered archive will not have a namespace index, "+
+			"since the offsets in the index of the original archive would not match it")
+	}
+	// the blocks are copied as they are, so only the compression is kept
+	header.SetFeatures(false, header.Compression, false)
+
+	filtered := &archive.Prelude{Header: &header}
+	renames := map[string]archive.NamespaceHeader{}
+	// The oplog is not a namespace that the namespace options can match, and
+	// it's needed to restore the kept namespaces with --oplogReplay, so it's
+	// only left out with --excludeOplog. Its data is kept even if the prelude
+	// doesn't list it.
+	if !ma.NSOptions.ExcludeOplog {
+		renames[oplogNamespace] = archive.NamespaceHeader{Collection: "oplog"}
+	}
+	kept := 0
+	for _, cm := range prelude.NamespaceMetadatas {
+		if cm.Database == "" && cm.Collection == "oplog" {
+			if ma.NSOptions.ExcludeOplog {
+				log.Logv(log.DebugLow, "skipping the oplog")
+			} else {
+				filtered.AddMetadata(cm)
+			}
+			continue
+		}
+		if !ma.keepNamespace(cm.Database + "." + cm.Collection) {
+			log.Logvf(log.DebugLow, "skipping %v.%v", cm.Database, cm.Collection)
+			continue
+		}
+		renamed, err := ma.renameMetadata(cm)
+		if err != nil {
+			return err
+		}
+		filtered.AddMetadata(renamed)
+
+		_, newDataCollection := util.SplitNamespace(renamed.DataNamespace())
+		renames[cm.DataNamespace()] = archive.NamespaceHeader{
+			Database:   renamed.Database,
+			Collection: newDataCollection,
+		}
+		kept++
+	}
+	if kept == 0 {
+		return fmt.Errorf("no namespaces in the archive match the namespace options")
+	}
+	if err = checkRenameCollisions(filtered); err != nil {
+		return err
+	}
+
+	out, err := ma.createArchive()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := out.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("error closing archive: %v", closeErr)
+		}
+	}()
+
+	err = filtered.Write(out)
+	if err != nil {
+		return fmt.Errorf("error writing archive prelude: %v", err)
+	}
+	parser := archive.Parser{In: in}
+	err = parser.ReadAllBlocks(&archiveFilter{out: out, renames: renames})
+	if err != nil {
+		return fmt.Errorf("error filtering archive: %v", err)
+	}
+
+	log.Logvf(
+		log.Always,
+		"wrote %v of %v namespaces to %v",
+		len(filtered.NamespaceMetadatas),
+		len(prelude.NamespaceMetadatas),
+		ma.OutputOptions.Archive,
+	)
+	return nil
+}
+
+// checkRenameCollisions returns an error if renaming maps two namespaces to the same name.
+func checkRenameCollisions(prelude *archive.Prelude) error {
+	seen := map[string]bool{}
+	for _, cm := range prelude.NamespaceMetadatas {
+		namespace := cm.DataNamespace()
+		if seen[namespace] {
+			return fmt.Errorf(
+				"more than one namespace would be renamed to %v",
+				strings.TrimPrefix(namespace, "."),
+			)
+		}
+		seen[namespace] = true
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Main package for the mongoarchive tool.
+package main
+
+import (
+	"os"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongoarchive"
+)
+
+var (
+	VersionStr = "built-without-version-string"
+	GitCommit  = "build-without-git-commit"
+)
+
+func main() {
+	// initialize command-line opts
+	opts, err := mongoarchive.ParseOptions(os.Args[1:], VersionStr, GitCommit)
+	if err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, util.ShortUsage("mongoarchive"))
+		os.Exit(util.ExitFailure)
+	}
+
+	// print help, if specified
+	if opts.PrintHelp(false) {
+		return
+	}
+
+	// print version, if specified
+	if opts.PrintVersion() {
+		return
+	}
+
+	signals.Handle()
+
+	ma, err := mongoarchive.New(opts)
+	if err != nil {
+		log.Logv(log.Always, err.Error())
+		os.Exit(util.ExitFailure)
+	}
+
+	err = ma.Run()
+	if err != nil {
+		log.Logvf(log.Always, "Failed: %v", err)
+		os.Exit(util.ExitFailure)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package mongoarchive lists, verifies, extracts, packs and filters mongodump
+// archives without connecting to a server.
+package mongoarchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/signing"
+	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongorestore/ns"
+)
+
+// MongoArchive is a container for the user-specified options and
+// internal state used for running mongoarchive.
+type MongoArchive struct {
+	// generic mongo tool options
+	ToolOptions *options.ToolOptions
+
+	// InputOptions control how archives are read
+	InputOptions *InputOptions
+
+	// OutputOptions control where the output of each command is written
+	OutputOptions *OutputOptions
+
+	// NSOptions choose and rename the namespaces written by filter
+	NSOptions *NSOptions
+
+	// Command is the mongoarchive command to run
+	Command string
+
+	// Target is the input archive, or the dump directory for pack
+	Target string
+
+	// Stdin and Stdout are used when the target or the output archive is '-',
+	// and Stdout is where ls and verify print their reports.
+	Stdin  io.Reader
+	Stdout io.Writer
+
+	verifyKey ed25519.PublicKey
+	includer  *ns.Matcher
+	excluder  *ns.Matcher
+	renamer   *ns.Renamer
+}
+
+// New constructs a new instance of MongoArchive configured by the provided options.
+func New(opts Options) (*MongoArchive, error) {
+	ma := &MongoArchive{
+		ToolOptions:   opts.ToolOptions,
+		InputOptions:  opts.InputOptions,
+		OutputOptions: opts.OutputOptions,
+		NSOptions:     opts.NSOptions,
+		Command:       opts.Command,
+		Target:        opts.Target,
+		Stdin:         os.Stdin,
+		Stdout:        os.Stdout,
+	}
+
+	var err error
+	if opts.VerifySignatureKey != "" {
+		ma.verifyKey, err = signing.LoadPublicKey(opts.VerifySignatureKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading --verifySignatureKey: %v", err)
+		}
+	}
+	if len(opts.NSInclude) > 0 {
+		ma.includer, err = ns.NewMatcher(opts.NSInclude)
+		if err != nil {
+			return nil, fmt.Errorf("invalid includes: %v", err)
+		}
+	}
+	if len(opts.NSExclude) > 0 {
+		ma.excluder, err = ns.NewMatcher(opts.NSExclude)
+		if err != nil {
+			return nil, fmt.Errorf("invalid excludes: %v", err)
+		}
+	}
+	if len(opts.NSFrom) > 0 {
+		ma.renamer, err = ns.NewRenamer(opts.NSFrom, opts.NSTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid renames: %v", err)
+		}
+	}
+	return ma, nil
+}
+
+// Run runs the mongoarchive command.
+func (ma *MongoArchive) Run() error {
+	log.Logvf(log.DebugLow, "running mongoarchive %v on %v", ma.Command, ma.Target)
+	switch ma.Command {
+	case List:
+		return ma.List()
+	case Extract:
+		return ma.Extract()
+	case Pack:
+		return ma.Pack()
+	case Filter:
+		return ma.Filter()
+	case Verify:
+		return ma.Verify()
+	}
+	return fmt.Errorf("'%v' is not a valid command", ma.Command)
+}
+
+// openArchive opens the target archive, decompressing it if it was compressed
+// with gzip, and reads its prelude. The returned reader is positioned at the
+// start of the namespace data. The caller is responsible for closing it.
+func (ma *MongoArchive) openArchive() (io.ReadCloser, *archive.Prelude, error) {
+	var in io.ReadCloser
+	if ma.Target == "-" {
+		in = io.NopCloser(ma.Stdin)
+	} else {
+		file, err := os.Open(util.ToUniversalPath(ma.Target))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening archive: %v", err)
+		}
+		in = file
+	}
+
+	buffered := bufio.NewReader(in)
+	var reader io.Reader = buffered
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		log.Logvf(log.DebugLow, "archive %v is compressed with gzip", ma.Target)
+		zipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			_ = in.Close()
+			return nil, nil, fmt.Errorf("error opening gzip archive: %v", err)
+		}
+		reader = zipReader
+	}
+
+	prelude := &archive.Prelude{}
+	err = prelude.Read(reader)
+	if err != nil {
+		_ = in.Close()
+		return nil, nil, fmt.Errorf("error reading archive prelude: %v", err)
+	}
+	if err = archive.ValidateCompression(prelude.Header.Compression); err != nil {
+		_ = in.Close()
+		return nil, nil, err
+	}
+	return &util.WrappedReadCloser{ReadCloser: io.NopCloser(reader), Inner: in}, prelude, nil
+}
+
+// createArchive creates the output archive given by --archive, compressing it
+// with gzip if --gzip is set. The caller is responsible for closing it.
+func (ma *MongoArchive) createArchive() (io.WriteCloser, error) {
+	var out io.WriteCloser
+	if ma.OutputOptions.Archive == "-" {
+		out = ignoreCloseWriter{ma.Stdout}
+	} else {
+		file, err := os.Create(util.ToUniversalPath(ma.OutputOptions.Archive))
+		if err != nil {
+			return nil, fmt.Errorf("error creating archive: %v", err)
+		}
+		out = file
+	}
+	if ma.OutputOptions.Gzip {
+		return &util.WrappedWriteCloser{WriteCloser: gzip.NewWriter(out), Inner: out}, nil
+	}
+	return out, nil
+}
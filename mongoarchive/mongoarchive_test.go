@@ -0,0 +1,363 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoarchive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func writeTestArchive(t *testing.T, dir string) string {
+	simple := archive.SimpleArchive{
+		Header: archive.Header{ServerVersion: "7.0.0", ToolVersion: "100.0.0"},
+		CollectionMetadata: []archive.CollectionMetadata{
+			{Database: "db1", Collection: "c1", Metadata: `{"collectionName":"c1"}`},
+			{Database: "db1", Collection: "c2", Metadata: `{"collectionName":"c2"}`},
+			{Database: "db2", Collection: "c3", Metadata: `{"collectionName":"c3"}`},
+		},
+		Namespaces: []archive.SimpleNamespace{
+			{Database: "db1", Collection: "c1", Documents: []bson.D{{{"_id", 1}}, {{"_id", 2}}}},
+			{Database: "db1", Collection: "c2", Documents: []bson.D{{{"_id", "a"}}}},
+			{Database: "db2", Collection: "c3", Documents: nil},
+		},
+	}
+	data, err := simple.Marshal()
+	require.NoError(t, err)
+	path := filepath.Join(dir, "test.archive")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func newTestMongoArchive(t *testing.T, args ...string) (*MongoArchive, *bytes.Buffer) {
+	opts, err := ParseOptions(args, "", "")
+	require.NoError(t, err)
+	ma, err := New(opts)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	ma.Stdout = out
+	return ma, out
+}
+
+func TestMongoArchiveOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	valid := [][]string{
+		{"ls", "a.archive"},
+		{"verify", "-"},
+		{"extract", "a.archive", "--out", "dir", "--gzip"},
+		{"pack", "dir", "--archive", "a.archive", "--archiveCompression", "zstd", "--archiveIndex"},
+		{"pack", "dir", "--archive", "a.archive", "--signingKey", "key.pem"},
+		{"verify", "a.archive", "--verifySignatureKey", "key.pub.pem"},
+		{"filter", "a.archive", "--archive", "-", "--nsInclude", "db.*", "--nsFrom", "db.*", "--nsTo", "other.*"},
+	}
+	for _, args := range valid {
+		_, err := ParseOptions(args, "", "")
+		assert.NoError(t, err, "%v", args)
+	}
+
+	invalid := [][]string{
+		{},
+		{"ls"},
+		{"ls", "a.archive", "b.archive"},
+		{"unpack", "a.archive"},
+		{"pack", "dir"},
+		{"filter", "a.archive"},
+		{"ls", "a.archive", "--archive", "b.archive"},
+		{"pack", "dir", "--archive", "a.archive", "--out", "dir"},
+		{"filter", "a.archive", "--archive", "b.archive", "--archiveIndex"},
+		{"pack", "dir", "--archive", "a.archive", "--archiveCompression", "lz4"},
+		{"pack", "dir", "--archive", "a.archive", "--archiveCompression", "zstd", "--gzip"},
+		{"pack", "dir", "--archive", "a.archive", "--archiveIndex", "--gzip"},
+		{"extract", "a.archive", "--nsInclude", "db.*"},
+		{"filter", "a.archive", "--archive", "b.archive", "--signingKey", "key.pem"},
+		{"ls", "a.archive", "--verifySignatureKey", "key.pub.pem"},
+		{"filter", "a.archive", "--archive", "b.archive", "--nsFrom", "db.*"},
+	}
+	for _, args := range invalid {
+		_, err := ParseOptions(args, "", "")
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func TestListAndVerify(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	path := writeTestArchive(t, t.TempDir())
+
+	ma, out := newTestMongoArchive(t, "ls", path)
+	require.NoError(t, ma.Run())
+	assert.Contains(t, out.String(), "7.0.0")
+	assert.Regexp(t, `db1\.c1\s+collection\s+2\s`, out.String())
+	assert.Regexp(t, `db1\.c2\s+collection\s+1\s`, out.String())
+	assert.Regexp(t, `db2\.c3\s+collection\s+0\s`, out.String())
+
+	ma, out = newTestMongoArchive(t, "verify", path)
+	require.NoError(t, ma.Run())
+	assert.Regexp(t, `db1\.c1\s+2\s+ok`, out.String())
+
+	// corrupt the last byte of the first document of db1.c1
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc, err := bson.Marshal(bson.D{{"_id", 1}})
+	require.NoError(t, err)
+	offset := bytes.Index(data, doc)
+	require.Positive(t, offset)
+	data[offset+len(doc)-2] ^= 0xFF
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	ma, out = newTestMongoArchive(t, "verify", path)
+	require.Error(t, ma.Run())
+	assert.Regexp(t, `db1\.c1\s+2\s+CRC mismatch`, out.String())
+	assert.Regexp(t, `db1\.c2\s+1\s+ok`, out.String())
+}
+
+func TestExtractAndPack(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	path := writeTestArchive(t, dir)
+	dumpDir := filepath.Join(dir, "dump")
+
+	ma, _ := newTestMongoArchive(t, "extract", path, "--out", dumpDir)
+	require.NoError(t, ma.Run())
+	for _, name := range []string{
+		"prelude.json",
+		"db1/c1.bson", "db1/c1.metadata.json",
+		"db1/c2.bson", "db1/c2.metadata.json",
+		"db2/c3.bson", "db2/c3.metadata.json",
+	} {
+		assert.FileExists(t, filepath.Join(dumpDir, name))
+	}
+	c1, err := os.ReadFile(filepath.Join(dumpDir, "db1", "c1.bson"))
+	require.NoError(t, err)
+	doc1, err := bson.Marshal(bson.D{{"_id", 1}})
+	require.NoError(t, err)
+	doc2, err := bson.Marshal(bson.D{{"_id", 2}})
+	require.NoError(t, err)
+	assert.Equal(t, append(doc1, doc2...), c1)
+
+	for _, extra := range [][]string{nil, {"--archiveCompression", "zstd", "--archiveIndex"}} {
+		packed := filepath.Join(dir, "packed.archive")
+		args := append([]string{"pack", dumpDir, "--archive", packed}, extra...)
+		ma, _ = newTestMongoArchive(t, args...)
+		require.NoError(t, ma.Run(), "%v", extra)
+
+		ma, out := newTestMongoArchive(t, "ls", packed)
+		require.NoError(t, ma.Run(), "%v", extra)
+		assert.Contains(t, out.String(), "7.0.0")
+		assert.Regexp(t, `db1\.c1\s+collection\s+2\s`, out.String())
+		assert.Regexp(t, `db2\.c3\s+collection\s+0\s`, out.String())
+
+		ma, _ = newTestMongoArchive(t, "verify", packed)
+		require.NoError(t, ma.Run(), "%v", extra)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	path := writeTestArchive(t, dir)
+	filtered := filepath.Join(dir, "filtered.archive")
+
+	ma, _ := newTestMongoArchive(
+		t,
+		"filter", path,
+		"--archive", filtered,
+		"--nsInclude", "db1.*",
+		"--nsExclude", "db1.c2",
+		"--nsFrom", "db1.c1",
+		"--nsTo", "db3.renamed",
+	)
+	require.NoError(t, ma.Run())
+
+	ma, out := newTestMongoArchive(t, "verify", filtered)
+	require.NoError(t, ma.Run())
+	assert.Regexp(t, `db3\.renamed\s+2\s+ok`, out.String())
+	assert.NotContains(t, out.String(), "db1.")
+	assert.NotContains(t, out.String(), "db2.")
+
+	ma, _ = newTestMongoArchive(t, "extract", filtered, "--out", filepath.Join(dir, "dump"))
+	require.NoError(t, ma.Run())
+	metadata, err := os.ReadFile(filepath.Join(dir, "dump", "db3", "renamed.metadata.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(metadata), `"renamed"`)
+
+	ma, _ = newTestMongoArchive(
+		t,
+		"filter", path,
+		"--archive", filtered,
+		"--nsFrom", "db1.c1",
+		"--nsTo", "db2.c3",
+	)
+	assert.ErrorContains(t, ma.Run(), "more than one namespace")
+}
+
+func TestFilterIndexedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	path := writeTestArchive(t, dir)
+	dumpDir := filepath.Join(dir, "dump")
+	ma, _ := newTestMongoArchive(t, "extract", path, "--out", dumpDir)
+	require.NoError(t, ma.Run())
+	indexed := filepath.Join(dir, "indexed.archive")
+	ma, _ = newTestMongoArchive(
+		t,
+		"pack", dumpDir,
+		"--archive", indexed,
+		"--archiveCompression", "zstd",
+		"--archiveIndex",
+	)
+	require.NoError(t, ma.Run())
+
+	// the index of the original archive would not match the filtered one, so
+	// the filtered archive doesn't declare one
+	filtered := filepath.Join(dir, "filtered.archive")
+	ma, _ = newTestMongoArchive(t, "filter", indexed, "--archive", filtered, "--nsInclude", "db1.c2")
+	require.NoError(t, ma.Run())
+	ma, out := newTestMongoArchive(t, "ls", filtered)
+	require.NoError(t, ma.Run())
+	assert.Regexp(t, `archive version:\s+0\.3`, out.String())
+	assert.Regexp(t, `indexed:\s+false`, out.String())
+	assert.Regexp(t, `compression:\s+zstd`, out.String())
+	assert.Regexp(t, `db1\.c2\s+collection\s+1\s`, out.String())
+
+	file, err := os.Open(filtered)
+	require.NoError(t, err)
+	defer file.Close()
+	stat, err := file.Stat()
+	require.NoError(t, err)
+	_, err = archive.ReadIndex(file, stat.Size())
+	assert.ErrorIs(t, err, archive.ErrNoIndex)
+}
+
+func TestFilterOplog(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	simple := archive.SimpleArchive{
+		Header: archive.Header{ServerVersion: "7.0.0", ToolVersion: "100.0.0"},
+		CollectionMetadata: []archive.CollectionMetadata{
+			{Database: "db1", Collection: "c1"},
+			{Database: "db2", Collection: "c2"},
+			{Collection: "oplog"},
+		},
+		Namespaces: []archive.SimpleNamespace{
+			{Database: "db1", Collection: "c1", Documents: []bson.D{{{"_id", 1}}}},
+			{Database: "db2", Collection: "c2", Documents: []bson.D{{{"_id", 2}}}},
+			{Collection: "oplog", Documents: []bson.D{{{"op", "n"}}, {{"op", "n"}}}},
+		},
+	}
+	data, err := simple.Marshal()
+	require.NoError(t, err)
+	path := filepath.Join(dir, "oplog.archive")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	filtered := filepath.Join(dir, "filtered.archive")
+	ma, _ := newTestMongoArchive(t, "filter", path, "--archive", filtered, "--nsInclude", "db1.*")
+	require.NoError(t, ma.Run())
+	ma, out := newTestMongoArchive(t, "verify", filtered)
+	require.NoError(t, ma.Run())
+	assert.Regexp(t, `db1\.c1\s+1\s+ok`, out.String())
+	assert.Regexp(t, `oplog\s+2\s+ok`, out.String())
+	assert.NotContains(t, out.String(), "db2.")
+
+	ma, _ = newTestMongoArchive(
+		t,
+		"filter", path,
+		"--archive", filtered,
+		"--nsInclude", "db1.*",
+		"--excludeOplog",
+	)
+	require.NoError(t, ma.Run())
+	ma, out = newTestMongoArchive(t, "verify", filtered)
+	require.NoError(t, ma.Run())
+	assert.Regexp(t, `db1\.c1\s+1\s+ok`, out.String())
+	assert.NotContains(t, out.String(), "oplog")
+}
+
+// writeTestKeys writes a new Ed25519 key pair to dir and returns the paths of
+// the private and public keys.
+func writeTestKeys(t *testing.T, dir string) (string, string) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, "key.pem")
+	publicPath := filepath.Join(dir, "key.pub.pem")
+	require.NoError(t, os.WriteFile(
+		privatePath,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		0o600,
+	))
+	require.NoError(t, os.WriteFile(
+		publicPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		0o644,
+	))
+	return privatePath, publicPath
+}
+
+func TestSignedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	path := writeTestArchive(t, dir)
+	dumpDir := filepath.Join(dir, "dump")
+	privateKey, publicKey := writeTestKeys(t, dir)
+	_, otherPublicKey := writeTestKeys(t, t.TempDir())
+
+	ma, _ := newTestMongoArchive(t, "extract", path, "--out", dumpDir)
+	require.NoError(t, ma.Run())
+	signed := filepath.Join(dir, "signed.archive")
+	ma, _ = newTestMongoArchive(
+		t,
+		"pack", dumpDir,
+		"--archive", signed,
+		"--archiveCompression", "zstd",
+		"--signingKey", privateKey,
+	)
+	require.NoError(t, ma.Run())
+
+	ma, out := newTestMongoArchive(t, "ls", signed)
+	require.NoError(t, ma.Run())
+	assert.Regexp(t, `signed:\s+true`, out.String())
+	assert.Regexp(t, `db1\.c1\s+collection\s+2\s`, out.String())
+
+	ma, out = newTestMongoArchive(t, "verify", signed, "--verifySignatureKey", publicKey)
+	require.NoError(t, ma.Run())
+	assert.Contains(t, out.String(), "signature: ok")
+
+	ma, _ = newTestMongoArchive(t, "verify", signed, "--verifySignatureKey", otherPublicKey)
+	assert.ErrorContains(t, ma.Run(), "does not match the verification key")
+
+	// filtering drops the signature, which would no longer match
+	filtered := filepath.Join(dir, "filtered.archive")
+	ma, _ = newTestMongoArchive(t, "filter", signed, "--archive", filtered, "--nsExclude", "db2.*")
+	require.NoError(t, ma.Run())
+	ma, out = newTestMongoArchive(t, "ls", filtered)
+	require.NoError(t, ma.Run())
+	assert.Regexp(t, `signed:\s+false`, out.String())
+	ma, _ = newTestMongoArchive(t, "verify", filtered, "--verifySignatureKey", publicKey)
+	assert.ErrorIs(t, ma.Run(), archive.ErrNotSigned)
+	ma, _ = newTestMongoArchive(t, "verify", filtered)
+	assert.NoError(t, ma.Run())
+}
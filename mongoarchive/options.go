@@ -0,0 +1,202 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoarchive
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+)
+
+// Usage string printed as part of --help.
+var Usage = `<options> <command> <archive or directory>
+
+Inspect, convert and filter mongodump archives without connecting to a server.
+
+Use '-' as the archive to read it from standard input. Archives compressed with
+gzip are detected automatically.
+
+Possible commands include:
+	ls      - list the namespaces in an archive with their document counts, sizes and CRCs
+	extract - write the contents of an archive to a dump directory given by --out
+	pack    - write a dump directory to an archive given by --archive
+	filter  - write the namespaces of an archive that match --nsInclude and --nsExclude
+	          to a new archive given by --archive, renaming them with --nsFrom and --nsTo
+	verify  - recompute the CRC of every namespace in an archive and compare it to the stored one,
+	          and check the signature of the archive with --verifySignatureKey
+
+See http://docs.mongodb.com/database-tools/ for more information.`
+
+// Commands supported by mongoarchive.
+const (
+	List    = "ls"
+	Extract = "extract"
+	Pack    = "pack"
+	Filter  = "filter"
+	Verify  = "verify"
+)
+
+// Options contains all the possible options used to configure mongoarchive.
+type Options struct {
+	*options.ToolOptions
+	*InputOptions
+	*OutputOptions
+	*NSOptions
+
+	// Command is one of the mongoarchive commands.
+	Command string
+
+	// Target is the input archive, or the dump directory for pack.
+	Target string
+}
+
+// InputOptions defines the set of options for reading archives.
+type InputOptions struct {
+	VerifySignatureKey string `long:"verifySignatureKey" value-name:"<filename>" description:"with verify, also check that the archive is signed with the private key matching the Ed25519 public key in the given PEM file"`
+}
+
+// Name returns a human-readable group name for input options.
+func (*InputOptions) Name() string {
+	return "input"
+}
+
+// OutputOptions defines the set of options for writing archives and dump directories.
+type OutputOptions struct {
+	Out                string `long:"out" value-name:"<directory-path>" short:"o" description:"output directory for extract; defaults to 'dump'"`
+	Archive            string `long:"archive" value-name:"<file-path>" description:"output archive for pack and filter; use '-' to write to stdout"`
+	Gzip               bool   `long:"gzip" description:"compress the output archive of pack and filter, or the files written by extract, with gzip"`
+	ArchiveCompression string `long:"archiveCompression" value-name:"<zstd|gzip>" description:"compress each segment of the archive written by pack with the given codec (archive format version 0.3)"`
+	ArchiveIndex       bool   `long:"archiveIndex" description:"write a namespace index at the end of the archive written by pack (archive format version 0.2)"`
+	SigningKey         string `long:"signingKey" value-name:"<filename>" description:"sign the archive written by pack with the Ed25519 private key in the given PEM file (archive format version 0.4)"`
+}
+
+// Name returns a human-readable group name for output options.
+func (*OutputOptions) Name() string {
+	return "output"
+}
+
+// NSOptions defines the set of options for choosing and renaming namespaces with filter.
+type NSOptions struct {
+	NSExclude []string `long:"nsExclude" value-name:"<namespace-pattern>" description:"exclude matching namespaces"`
+	NSInclude []string `long:"nsInclude" value-name:"<namespace-pattern>" description:"include matching namespaces"`
+	NSFrom    []string `long:"nsFrom" value-name:"<namespace-pattern>" description:"rename matching namespaces, must have matching nsTo"`
+	NSTo      []string `long:"nsTo" value-name:"<namespace-pattern>" description:"rename matched namespaces, must have matching nsFrom"`
+
+	ExcludeOplog bool `long:"excludeOplog" description:"leave out the oplog of an archive written with mongodump --oplog, which is otherwise kept whatever the other namespace options"`
+}
+
+// Name returns a human-readable group name for namespace options.
+func (*NSOptions) Name() string {
+	return "namespace"
+}
+
+// ParseOptions reads the command line arguments and converts them into options used to configure mongoarchive.
+func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, error) {
+	opts := options.New(
+		"mongoarchive",
+		versionStr,
+		gitCommit,
+		Usage,
+		false,
+		options.EnabledOptions{},
+	)
+
+	inputOpts := &InputOptions{}
+	outputOpts := &OutputOptions{}
+	nsOpts := &NSOptions{}
+	opts.AddOptions(inputOpts)
+	opts.AddOptions(outputOpts)
+	opts.AddOptions(nsOpts)
+
+	args, err := opts.ParseArgs(rawArgs)
+	if err != nil {
+		return Options{}, fmt.Errorf("error parsing command line options: %v", err)
+	}
+
+	log.SetVerbosity(opts.Verbosity)
+
+	parsed := Options{
+		ToolOptions:   opts,
+		InputOptions:  inputOpts,
+		OutputOptions: outputOpts,
+		NSOptions:     nsOpts,
+	}
+	// help and version are handled by the caller, so don't complain about
+	// missing arguments when they are requested
+	if opts.Help || opts.Version {
+		return parsed, nil
+	}
+
+	if len(args) == 0 {
+		return Options{}, fmt.Errorf("no command specified")
+	}
+	if len(args) == 1 {
+		return Options{}, fmt.Errorf("'%v' argument missing", args[0])
+	}
+	if len(args) > 2 {
+		return Options{}, fmt.Errorf("too many positional arguments: %v", args)
+	}
+	parsed.Command = args[0]
+	parsed.Target = args[1]
+
+	if err = parsed.validate(); err != nil {
+		return Options{}, err
+	}
+	return parsed, nil
+}
+
+func (opts *Options) validate() error {
+	switch opts.Command {
+	case List, Extract, Pack, Filter, Verify:
+	default:
+		return fmt.Errorf("'%v' is not a valid command", opts.Command)
+	}
+
+	if (opts.Command == Pack || opts.Command == Filter) && opts.Archive == "" {
+		return fmt.Errorf("%v requires an output archive given by --archive", opts.Command)
+	}
+	if opts.Command != Pack && opts.Command != Filter && opts.Archive != "" {
+		return fmt.Errorf("--archive can only be used with %v and %v", Pack, Filter)
+	}
+	if opts.Command != Verify && opts.VerifySignatureKey != "" {
+		return fmt.Errorf("--verifySignatureKey can only be used with %v", Verify)
+	}
+	if opts.Command != Extract && opts.Out != "" {
+		return fmt.Errorf("--out can only be used with %v", Extract)
+	}
+	if opts.Command != Pack && (opts.ArchiveCompression != "" || opts.ArchiveIndex) {
+		return fmt.Errorf("--archiveCompression and --archiveIndex can only be used with %v", Pack)
+	}
+	if opts.Command != Pack && opts.SigningKey != "" {
+		return fmt.Errorf("--signingKey can only be used with %v", Pack)
+	}
+	if opts.ArchiveCompression != "" && opts.Gzip {
+		return fmt.Errorf("--archiveCompression can't be used with --gzip")
+	}
+	if opts.ArchiveIndex && opts.Gzip {
+		return fmt.Errorf("--archiveIndex can't be used with --gzip, " +
+			"since a compressed archive can't be read at arbitrary offsets")
+	}
+	if err := archive.ValidateCompression(opts.ArchiveCompression); err != nil {
+		return fmt.Errorf("invalid --archiveCompression: %v", err)
+	}
+
+	nsOpts := opts.NSOptions
+	hasNSOptions := len(nsOpts.NSInclude) > 0 || len(nsOpts.NSExclude) > 0 ||
+		len(nsOpts.NSFrom) > 0 || len(nsOpts.NSTo) > 0 || nsOpts.ExcludeOplog
+	if opts.Command != Filter && hasNSOptions {
+		return fmt.Errorf("namespace options can only be used with %v", Filter)
+	}
+	if len(nsOpts.NSFrom) != len(nsOpts.NSTo) {
+		return fmt.Errorf(
+			"--nsFrom and --nsTo arguments must be specified an equal number of times",
+		)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoarchive
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/signing"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// packedCollection is a collection found in a dump directory.
+type packedCollection struct {
+	intent   *intents.Intent
+	bsonPath string
+	metadata string
+}
+
+// dumpMetadata holds the fields of a .metadata.json file that pack needs.
+type dumpMetadata struct {
+	CollectionName string `bson:"collectionName"`
+	Type           string `bson:"type"`
+}
+
+// trimDumpExtension returns the name of a dump file without its extension and
+// whether it has the given extension, optionally followed by .gz.
+func trimDumpExtension(name, ext string) (string, bool) {
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, ext) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, ext), true
+}
+
+// readDumpFile reads a whole file from a dump directory, decompressing it if its name ends in .gz.
+func readDumpFile(path string) ([]byte, error) {
+	in, err := openDumpFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", path, err)
+	}
+	return data, nil
+}
+
+// openDumpFile opens a file from a dump directory, decompressing it if its name ends in .gz.
+func openDumpFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v: %w", path, err)
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+	zipReader, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error opening gzip file %v: %v", path, err)
+	}
+	return &util.WrappedReadCloser{ReadCloser: zipReader, Inner: file}, nil
+}
+
+// findDatabaseCollections finds the collections in the directory of a database.
+func findDatabaseCollections(dbName, dir string) ([]*packedCollection, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %v: %v", dir, err)
+	}
+
+	// Collections are keyed by the name of their files, which may be escaped
+	// and truncated. Metadata files are read first since they hold the full
+	// name and type of the collection.
+	byFileName := map[string]*packedCollection{}
+	var collections []*packedCollection
+	for _, entry := range entries {
+		fileName, ok := trimDumpExtension(entry.Name(), ".metadata.json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := readDumpFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var meta dumpMetadata
+		err = bson.UnmarshalExtJSON(data, false, &meta)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing metadata from %v: %v", path, err)
+		}
+		collName := meta.CollectionName
+		if collName == "" {
+			collName, err = util.UnescapeCollectionName(fileName)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing collection name from %v: %v", path, err)
+			}
+		}
+		collection := &packedCollection{
+			intent:   &intents.Intent{DB: dbName, C: collName, Type: meta.Type},
+			metadata: string(data),
+		}
+		byFileName[fileName] = collection
+		collections = append(collections, collection)
+	}
+
+	for _, entry := range entries {
+		fileName, ok := trimDumpExtension(entry.Name(), ".bson")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		collection, ok := byFileName[fileName]
+		if !ok {
+			// the data of a timeseries collection is in its buckets collection
+			bucketsOf := strings.TrimPrefix(fileName, "system.buckets.")
+			if timeseries, ok := byFileName[bucketsOf]; ok && timeseries.intent.IsTimeseries() {
+				collection = timeseries
+			}
+		}
+		if collection == nil {
+			if strings.Contains(fileName, "%24") && len(fileName) == 238 {
+				return nil, fmt.Errorf(
+					"no metadata file found for %v, which has a truncated collection name", path)
+			}
+			collName, err := util.UnescapeCollectionName(fileName)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing collection name from %v: %v", path, err)
+			}
+			collection = &packedCollection{intent: &intents.Intent{DB: dbName, C: collName}}
+			byFileName[fileName] = collection
+			collections = append(collections, collection)
+		}
+		collection.bsonPath = path
+	}
+	return collections, nil
+}
+
+// findCollections finds all of the collections in a dump directory, in the
+// order they are written to the archive.
+func findCollections(root string) ([]*packedCollection, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dump directory: %v", err)
+	}
+	var collections []*packedCollection
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			if name, ok := trimDumpExtension(entry.Name(), ".bson"); ok && name == "oplog" {
+				collections = append(collections, &packedCollection{
+					intent:   &intents.Intent{C: "oplog"},
+					bsonPath: filepath.Join(root, entry.Name()),
+				})
+			}
+			continue
+		}
+		if err = util.ValidateDBName(entry.Name()); err != nil {
+			return nil, fmt.Errorf("invalid database name '%v': %v", entry.Name(), err)
+		}
+		dbCollections, err := findDatabaseCollections(entry.Name(), filepath.Join(root, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, dbCollections...)
+	}
+	sort.SliceStable(collections, func(i, j int) bool {
+		if collections[i].intent.DB != collections[j].intent.DB {
+			return collections[i].intent.DB < collections[j].intent.DB
+		}
+		return collections[i].intent.C < collections[j].intent.C
+	})
+	return collections, nil
+}
+
+// readPreludeData reads the prelude.json file of a dump directory, if there is one.
+func readPreludeData(root string) (*preludeData, error) {
+	data := &preludeData{ServerVersion: common.ServerVersionUnknown}
+	for _, name := range []string{"prelude.json", "prelude.json.gz"} {
+		contents, err := readDumpFile(filepath.Join(root, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(contents, data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %v: %v", name, err)
+		}
+		break
+	}
+	return data, nil
+}
+
+// packNotifier is given to the multiplexer to shut down its inputs when it
+// fails. pack writes one collection at a time and stops on the first error, so
+// there is nothing to notify.
+type packNotifier struct{}
+
+func (packNotifier) Notify() {}
+
+// Pack writes the contents of a dump directory to an archive, in the same
+// format as mongodump --archive.
+func (ma *MongoArchive) Pack() (err error) {
+	root := util.ToUniversalPath(ma.Target)
+	collections, err := findCollections(root)
+	if err != nil {
+		return err
+	}
+	versions, err := readPreludeData(root)
+	if err != nil {
+		return err
+	}
+	if versions.ToolVersion == "" {
+		versions.ToolVersion = ma.ToolOptions.VersionStr
+	}
+
+	prelude := &archive.Prelude{
+		Header: &archive.Header{
+			FormatVersion: archive.BaseFormatVersion,
+			ServerVersion: versions.ServerVersion,
+			ToolVersion:   versions.ToolVersion,
+			// collections are packed one at a time
+			ConcurrentCollections: 1,
+		},
+	}
+	var signingKey ed25519.PrivateKey
+	if ma.OutputOptions.SigningKey != "" {
+		signingKey, err = signing.LoadPrivateKey(ma.OutputOptions.SigningKey)
+		if err != nil {
+			return fmt.Errorf("error loading --signingKey: %v", err)
+		}
+	}
+	prelude.Header.SetFeatures(
+		ma.OutputOptions.ArchiveIndex,
+		ma.OutputOptions.ArchiveCompression,
+		signingKey != nil,
+	)
+	for _, collection := range collections {
+		prelude.AddMetadata(&archive.CollectionMetadata{
+			Database:   collection.intent.DB,
+			Collection: collection.intent.C,
+			Metadata:   collection.metadata,
+			Type:       collection.intent.Type,
+		})
+	}
+
+	out, err := ma.createArchive()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := out.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("error closing archive: %v", closeErr)
+		}
+	}()
+
+	// The multiplexer closes its output once it's done, but ignores any error,
+	// so the archive is closed above instead.
+	archiveOut := archive.NewOffsetWriter(ignoreCloseWriter{out})
+	err = prelude.Write(archiveOut)
+	if err != nil {
+		return fmt.Errorf("error writing archive prelude: %v", err)
+	}
+
+	mux := archive.NewMultiplexer(archiveOut, packNotifier{})
+	if ma.OutputOptions.ArchiveIndex {
+		err = mux.EnableIndex()
+		if err != nil {
+			return err
+		}
+	}
+	if ma.OutputOptions.ArchiveCompression != "" {
+		err = mux.EnableCompression(ma.OutputOptions.ArchiveCompression)
+		if err != nil {
+			return err
+		}
+	}
+	if signingKey != nil {
+		err = mux.EnableSigning(signingKey, prelude)
+		if err != nil {
+			return err
+		}
+	}
+	go mux.Run()
+
+	for _, collection := range collections {
+		err = packCollection(mux, collection)
+		if err != nil {
+			break
+		}
+	}
+	close(mux.Control)
+	muxErr := <-mux.Completed
+	if err != nil {
+		return err
+	}
+	if muxErr != nil {
+		return fmt.Errorf("error writing archive: %v", muxErr)
+	}
+
+	log.Logvf(log.Always, "packed %v collections into %v", len(collections), ma.OutputOptions.Archive)
+	return nil
+}
+
+// packCollection writes the documents of a collection to the archive.
+// Collections without a .bson file, such as views, still get an empty
+// namespace in the archive, just like mongodump writes them.
+func packCollection(mux *archive.Multiplexer, collection *packedCollection) error {
+	muxIn := &archive.MuxIn{Intent: collection.intent, Mux: mux}
+	err := muxIn.Open()
+	if err != nil {
+		return err
+	}
+	if collection.bsonPath != "" {
+		log.Logvf(log.DebugLow, "packing %v from %v", collection.intent.Namespace(), collection.bsonPath)
+		err = copyDocuments(muxIn, collection.bsonPath)
+	}
+	closeErr := muxIn.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func copyDocuments(out io.Writer, path string) error {
+	in, err := openDumpFile(path)
+	if err != nil {
+		return err
+	}
+	source := db.NewBSONSource(in)
+	defer source.Close()
+
+	for {
+		doc := source.LoadNext()
+		if doc == nil {
+			break
+		}
+		_, err = out.Write(doc)
+		if err != nil {
+			return err
+		}
+	}
+	if err = source.Err(); err != nil {
+		return fmt.Errorf("error reading %v: %v", path, err)
+	}
+	return nil
+}
+
+// ignoreCloseWriter is an io.WriteCloser whose Close does nothing.
+type ignoreCloseWriter struct {
+	io.Writer
+}
+
+func (ignoreCloseWriter) Close() error { return nil }
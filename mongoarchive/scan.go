@@ -0,0 +1,291 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoarchive
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// namespaceSummary is what ls and verify learn about a namespace by reading
+// all of its data.
+type namespaceSummary struct {
+	Namespace string
+	Type      string
+	Documents int64
+	// Size is the uncompressed size of the namespace's documents in bytes.
+	Size int64
+	// CRC is the CRC stored in the namespace's EOF header.
+	CRC int64
+	// Complete is set once the namespace's EOF header has been read.
+	Complete bool
+
+	hash   hash.Hash64
+	frames *archive.FrameDecoder
+}
+
+// ComputedCRC returns the CRC of the documents that were read.
+func (summary *namespaceSummary) ComputedCRC() int64 {
+	return int64(summary.hash.Sum64())
+}
+
+func (summary *namespaceSummary) addDocuments(docs []byte) error {
+	// Writes to the hash never return an error.
+	summary.hash.Write(docs)
+	summary.Size += int64(len(docs))
+	return archive.SplitDocuments(summary.Namespace, docs, func([]byte) error {
+		summary.Documents++
+		return nil
+	})
+}
+
+// archiveScanner implements archive.ParserConsumer and summarizes every
+// namespace in an archive, decompressing compressed segments as needed.
+type archiveScanner struct {
+	compression string
+	summaries   map[string]*namespaceSummary
+	order       []string
+	current     *namespaceSummary
+	// inSignature is set while the signature block of a signed archive is read.
+	inSignature bool
+	// verifier checks the signature of the archive with verify --verifySignatureKey.
+	verifier *archive.SignatureVerifier
+}
+
+func newArchiveScanner(prelude *archive.Prelude) *archiveScanner {
+	scanner := &archiveScanner{
+		compression: prelude.Header.Compression,
+		summaries:   make(map[string]*namespaceSummary),
+	}
+	for _, cm := range prelude.NamespaceMetadatas {
+		summary := scanner.summary(cm.DataNamespace())
+		summary.Type = cm.Type
+	}
+	return scanner
+}
+
+func (scanner *archiveScanner) summary(namespace string) *namespaceSummary {
+	summary, ok := scanner.summaries[namespace]
+	if !ok {
+		summary = &namespaceSummary{
+			Namespace: namespace,
+			hash:      archive.NewCRC(),
+		}
+		scanner.summaries[namespace] = summary
+		scanner.order = append(scanner.order, namespace)
+	}
+	return summary
+}
+
+// HeaderBSON is part of the ParserConsumer interface.
+func (scanner *archiveScanner) HeaderBSON(data []byte) error {
+	if archive.IsIndexHeader(data) {
+		return archive.ErrIndexReached
+	}
+	if scanner.verifier != nil {
+		if err := scanner.verifier.HeaderBSON(data); err != nil {
+			return err
+		}
+	}
+	scanner.inSignature = archive.IsSignatureHeader(data)
+	if scanner.inSignature {
+		scanner.current = nil
+		return nil
+	}
+	header := archive.NamespaceHeader{}
+	err := bson.Unmarshal(data, &header)
+	if err != nil {
+		return fmt.Errorf("header bson doesn't unmarshal as a namespace header: %v", err)
+	}
+	summary := scanner.summary(header.Namespace())
+	if summary.Complete {
+		return fmt.Errorf("namespace header for already finished namespace %v", summary.Namespace)
+	}
+	if header.EOF {
+		summary.CRC = header.CRC
+		summary.Complete = true
+		scanner.current = nil
+		return nil
+	}
+	scanner.current = summary
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface.
+func (scanner *archiveScanner) BodyBSON(data []byte) error {
+	if scanner.verifier != nil {
+		if err := scanner.verifier.BodyBSON(data); err != nil {
+			return err
+		}
+	}
+	if scanner.inSignature {
+		return nil
+	}
+	summary := scanner.current
+	if summary == nil {
+		return fmt.Errorf("namespace data without a namespace header")
+	}
+	if scanner.compression == archive.CompressionNone {
+		return summary.addDocuments(data)
+	}
+	if summary.frames == nil {
+		var err error
+		summary.frames, err = archive.NewFrameDecoder(scanner.compression)
+		if err != nil {
+			return err
+		}
+	}
+	docs, complete, err := summary.frames.AddChunk(data)
+	if err != nil || !complete {
+		return err
+	}
+	return summary.addDocuments(docs)
+}
+
+// End is part of the ParserConsumer interface.
+func (scanner *archiveScanner) End() error {
+	return nil
+}
+
+// scan reads the whole target archive and summarizes its namespaces.
+func (ma *MongoArchive) scan() (*archive.Prelude, *archiveScanner, error) {
+	in, prelude, err := ma.openArchive()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Close()
+
+	scanner := newArchiveScanner(prelude)
+	if ma.verifyKey != nil {
+		scanner.verifier, err = archive.NewSignatureVerifier(ma.verifyKey, prelude)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	parser := archive.Parser{In: in}
+	err = parser.ReadAllBlocks(scanner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading archive: %v", err)
+	}
+	return prelude, scanner, nil
+}
+
+// List prints the archive's header and a summary of every namespace in it.
+func (ma *MongoArchive) List() error {
+	prelude, scanner, err := ma.scan()
+	if err != nil {
+		return err
+	}
+
+	header := prelude.Header
+	compression := header.Compression
+	if compression == archive.CompressionNone {
+		compression = "none"
+	}
+	gw := &text.GridWriter{ColumnPadding: 2}
+	gw.WriteCells("archive version:", header.FormatVersion)
+	gw.EndRow()
+	gw.WriteCells("server version:", header.ServerVersion)
+	gw.EndRow()
+	gw.WriteCells("tool version:", header.ToolVersion)
+	gw.EndRow()
+	gw.WriteCells("concurrent collections:", strconv.Itoa(int(header.ConcurrentCollections)))
+	gw.EndRow()
+	gw.WriteCells("indexed:", strconv.FormatBool(header.MayHaveIndex()))
+	gw.EndRow()
+	gw.WriteCells("compression:", compression)
+	gw.EndRow()
+	gw.WriteCells("signed:", strconv.FormatBool(header.Signed))
+	gw.EndRow()
+	gw.Flush(ma.Stdout)
+	fmt.Fprintln(ma.Stdout)
+
+	gw.Reset()
+	gw.WriteCells("NAMESPACE", "TYPE", "DOCUMENTS", "SIZE", "CRC")
+	gw.EndRow()
+	for _, namespace := range scanner.order {
+		summary := scanner.summaries[namespace]
+		collType := summary.Type
+		if collType == "" {
+			collType = "collection"
+		}
+		crc := "-"
+		if summary.Complete {
+			crc = fmt.Sprintf("%016x", uint64(summary.CRC))
+		}
+		gw.WriteCells(
+			namespace,
+			collType,
+			strconv.FormatInt(summary.Documents, 10),
+			strconv.FormatInt(summary.Size, 10),
+			crc,
+		)
+		gw.EndRow()
+	}
+	gw.Flush(ma.Stdout)
+	return nil
+}
+
+// Verify recomputes the CRC of every namespace in the archive and compares it
+// to the CRC stored in the archive. It reports every namespace that doesn't
+// match and returns an error if there were any. With --verifySignatureKey, it
+// also checks the signature of the archive.
+func (ma *MongoArchive) Verify() error {
+	_, scanner, err := ma.scan()
+	if err != nil {
+		return err
+	}
+	failures := printVerification(ma.Stdout, scanner)
+	if failures > 0 {
+		return fmt.Errorf("%v of %v namespaces failed verification", failures, len(scanner.order))
+	}
+	if scanner.verifier != nil {
+		err = scanner.verifier.End()
+		if err != nil {
+			fmt.Fprintf(ma.Stdout, "\nsignature: %v\n", err)
+			return fmt.Errorf("archive signature verification failed: %v", err)
+		}
+		fmt.Fprintln(ma.Stdout, "\nsignature: ok")
+	}
+	log.Logvf(log.Always, "all %v namespaces verified successfully", len(scanner.order))
+	return nil
+}
+
+func printVerification(out io.Writer, scanner *archiveScanner) int {
+	failures := 0
+	gw := &text.GridWriter{ColumnPadding: 2}
+	gw.WriteCells("NAMESPACE", "DOCUMENTS", "STATUS")
+	gw.EndRow()
+	for _, namespace := range scanner.order {
+		summary := scanner.summaries[namespace]
+		status := "ok"
+		switch {
+		case !summary.Complete:
+			status = "incomplete: the archive has no EOF block for this namespace"
+		case summary.ComputedCRC() != summary.CRC:
+			status = fmt.Sprintf(
+				"CRC mismatch: stored %016x, computed %016x",
+				uint64(summary.CRC),
+				uint64(summary.ComputedCRC()),
+			)
+		}
+		if status != "ok" {
+			failures++
+		}
+		gw.WriteCells(namespace, strconv.FormatInt(summary.Documents, 10), status)
+		gw.EndRow()
+	}
+	gw.Flush(out)
+	return failures
+}
@@ -11,6 +11,7 @@ import (
 	"bufio"
 	"compress/gzip"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -30,6 +31,8 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/signing"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -63,6 +66,8 @@ type MongoDump struct {
 	serverVersion   string
 	authVersion     int
 	archive         *archive.Writer
+	signingKey      ed25519.PrivateKey
+	maxFileSize     int64
 	// shutdownIntentsNotifier is provided to the multiplexer
 	// as well as the signal handler, and allows them to notify
 	// the intent dumpers that they should shutdown
@@ -121,6 +126,19 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("--db is required when --excludeCollectionsWithPrefix is specified")
 	case dump.OutputOptions.Out != "" && dump.OutputOptions.Archive != "":
 		return fmt.Errorf("--out not allowed when --archive is specified")
+	case dump.OutputOptions.ArchiveIndex && dump.OutputOptions.Archive == "":
+		return fmt.Errorf("--archiveIndex can only be used with --archive")
+	case dump.OutputOptions.ArchiveIndex && dump.OutputOptions.Gzip:
+		return fmt.Errorf("--archiveIndex can't be used with --gzip, " +
+			"since a compressed archive can't be read at arbitrary offsets")
+	case dump.OutputOptions.ArchiveCompression != "" && dump.OutputOptions.Archive == "":
+		return fmt.Errorf("--archiveCompression can only be used with --archive")
+	case dump.OutputOptions.ArchiveCompression != "" && dump.OutputOptions.Gzip:
+		return fmt.Errorf("--archiveCompression can't be used with --gzip")
+	case dump.OutputOptions.SigningKey != "" && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("--signingKey can't be used when dumping to standard output")
+	case dump.OutputOptions.MaxFileSize != "" && (dump.OutputOptions.Out == "-" || dump.OutputOptions.Archive == "-"):
+		return fmt.Errorf("--maxFileSize can't be used when dumping to standard output")
 	case dump.OutputOptions.Out == "-" && dump.OutputOptions.Gzip:
 		return fmt.Errorf(
 			"compression can't be used when dumping a single collection to standard output",
@@ -132,6 +150,9 @@ func (dump *MongoDump) ValidateOptions() error {
 			"can't dump from admin database when connecting to a MongoDB Atlas free or shared cluster",
 		)
 	}
+	if err := archive.ValidateCompression(dump.OutputOptions.ArchiveCompression); err != nil {
+		return fmt.Errorf("invalid --archiveCompression: %v", err)
+	}
 	return nil
 }
 
@@ -170,6 +191,21 @@ func (dump *MongoDump) Init() error {
 	if dump.OutputWriter == nil {
 		dump.OutputWriter = os.Stdout
 	}
+	if dump.OutputOptions.SigningKey != "" {
+		dump.signingKey, err = signing.LoadPrivateKey(dump.OutputOptions.SigningKey)
+		if err != nil {
+			return fmt.Errorf("error loading --signingKey: %v", err)
+		}
+	}
+	if dump.OutputOptions.MaxFileSize != "" {
+		dump.maxFileSize, err = text.ParseByteAmount(dump.OutputOptions.MaxFileSize)
+		if err != nil {
+			return fmt.Errorf("bad option: --maxFileSize: %v", err)
+		}
+		if dump.maxFileSize <= 0 {
+			return fmt.Errorf("bad option: --maxFileSize must be positive")
+		}
+	}
 
 	if dump.isMongos && dump.OutputOptions.Oplog {
 		return fmt.Errorf("can't use --oplog option when dumping from a mongos")
@@ -280,12 +316,29 @@ func (dump *MongoDump) Dump() (err error) {
 		if err != nil {
 			return err
 		}
+		if dump.OutputOptions.ArchiveIndex {
+			// The index records offsets from the start of the archive, so the
+			// prelude and the multiplexed data must be counted together.
+			archiveOut = archive.NewOffsetWriter(archiveOut)
+		}
 		dump.archive = &archive.Writer{
 			// The archive.Writer needs its own copy of archiveOut because things
 			// like the prelude are not written by the multiplexer.
 			Out: archiveOut,
 			Mux: archive.NewMultiplexer(archiveOut, dump.shutdownIntentsNotifier),
 		}
+		if dump.OutputOptions.ArchiveIndex {
+			err = dump.archive.Mux.EnableIndex()
+			if err != nil {
+				return err
+			}
+		}
+		if dump.OutputOptions.ArchiveCompression != "" {
+			err = dump.archive.Mux.EnableCompression(dump.OutputOptions.ArchiveCompression)
+			if err != nil {
+				return err
+			}
+		}
 		go dump.archive.Mux.Run()
 		defer func() {
 			// The Mux runs until its Control is closed
@@ -393,10 +446,21 @@ func (dump *MongoDump) Dump() (err error) {
 		if err != nil {
 			return fmt.Errorf("creating archive prelude: %v", err)
 		}
+		dump.archive.Prelude.Header.SetFeatures(
+			dump.OutputOptions.ArchiveIndex,
+			dump.OutputOptions.ArchiveCompression,
+			dump.signingKey != nil,
+		)
 		err = dump.archive.Prelude.Write(dump.archive.Out)
 		if err != nil {
 			return fmt.Errorf("error writing metadata into archive: %v", err)
 		}
+		if dump.signingKey != nil {
+			err = dump.archive.Mux.EnableSigning(dump.signingKey, dump.archive.Prelude)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	// Dump users and roles only if these settings are not configured to be skipped,
@@ -501,6 +565,12 @@ func (dump *MongoDump) Dump() (err error) {
 		if err != nil {
 			return fmt.Errorf("failed to dump top level metadata: %v", err)
 		}
+		if dump.signingKey != nil {
+			err = dump.signDumpDirectory()
+			if err != nil {
+				return fmt.Errorf("failed to sign dump: %v", err)
+			}
+		}
 	}
 
 	log.Logvf(log.DebugLow, "finishing dump")
@@ -770,6 +840,10 @@ func (dump *MongoDump) dumpValidatedQueryToIntent(
 		}()
 	}
 
+	if bsonFile, ok := intent.BSONFile.(*realBSONFile); ok && bsonFile.maxSize > 0 {
+		f = &splitBSONWriter{file: bsonFile, buffer: buffer}
+	}
+
 	cursor, err := query.Iter()
 	if err != nil {
 		return
@@ -940,6 +1014,20 @@ type PreludeData struct {
 	ToolVersion   string `json:"ToolVersion"`
 }
 
+// signDumpDirectory writes a signed manifest of the files of the dump directory.
+func (dump *MongoDump) signDumpDirectory() error {
+	root := dump.OutputOptions.Out
+	if root == "" {
+		root = "dump"
+	}
+	if _, err := os.Stat(root); errors.Is(err, os.ErrNotExist) {
+		log.Logvf(log.DebugLow, "dump directory %#q does not exist, not signing it", root)
+		return nil
+	}
+	log.Logvf(log.DebugLow, "dump phase V: signing the dump directory")
+	return signing.SignDirectory(root, dump.signingKey)
+}
+
 // DumpPreludeMetadata dumps information about the server and the dump in json format
 // Currently only writes the server version and tool version, but we can use this to write other metadata about the dump in the future.
 func (dump *MongoDump) DumpPreludeMetadata() error {
@@ -1013,12 +1101,12 @@ func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 			if dump.OutputOptions.Gzip {
 				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
 			}
-			out, err = os.Create(defaultArchiveFilePath)
+			out, err = dump.createArchiveFile(defaultArchiveFilePath)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			out, err = os.Create(dump.OutputOptions.Archive)
+			out, err = dump.createArchiveFile(dump.OutputOptions.Archive)
 			if err != nil {
 				return nil, err
 			}
@@ -1030,6 +1118,15 @@ func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 	return out, nil
 }
 
+// createArchiveFile creates the archive file at path, or its first part when
+// the archive is split with --maxFileSize.
+func (dump *MongoDump) createArchiveFile(path string) (io.WriteCloser, error) {
+	if dump.maxFileSize > 0 {
+		return util.NewPartWriter(path, dump.maxFileSize)
+	}
+	return os.Create(path)
+}
+
 // docPlural returns "document" or "documents" depending on the
 // count of documents passed in.
 func docPlural(count int64) string {
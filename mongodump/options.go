@@ -65,6 +65,10 @@ type OutputOptions struct {
 	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" value-name:"<collection-prefix>" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
 	NumParallelCollections     int      `long:"numParallelCollections" short:"j" description:"number of collections to dump in parallel" default:"4" default-mask:"-"`
 	ViewsAsCollections         bool     `long:"viewsAsCollections" description:"dump views as normal collections with their produced data, omitting standard collections"`
+	ArchiveCompression         string   `long:"archiveCompression" value-name:"<zstd|gzip>" description:"compress each segment of the archive independently with the given codec, so that it can be decompressed in parallel when restoring (archive format version 0.3; older versions of mongorestore can't read such archives, and restore the compressed segments as documents)"`
+	ArchiveIndex               bool     `long:"archiveIndex" description:"append a namespace index to the archive so that tools reading it from a file can skip directly to the namespaces they need (archive format version 0.2)"`
+	SigningKey                 string   `long:"signingKey" value-name:"<filename>" description:"sign the dump with the Ed25519 private key in the given PEM file. Archives end with a signature block (archive format version 0.4); dump directories get a signed manifest of the digests of their files"`
+	MaxFileSize                string   `long:"maxFileSize" value-name:"<size>" description:"split each .bson file, or the archive, into numbered parts of at most the given size, e.g. 500MB or 2GB. BSON files are split on document boundaries, and with --gzip the size applies to the uncompressed data"`
 }
 
 // Name returns a human-readable group name for output options.
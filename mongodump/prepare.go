@@ -9,8 +9,6 @@ package mongodump
 import (
 	"bytes"
 	"context"
-	"crypto/sha1"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"os"
@@ -51,6 +49,10 @@ type realBSONFile struct {
 	errorReader
 	intent *intents.Intent
 	NilPos
+	// maxSize is the size at which the file is split into parts, or 0 if it
+	// isn't split.
+	maxSize int64
+	part    int
 }
 
 // Open is part of the intents.file interface. realBSONFiles need to have Open called before
@@ -67,14 +69,75 @@ func (f *realBSONFile) Open() (err error) {
 			filepath.Dir(f.path), err)
 	}
 
-	f.WriteCloser, err = os.Create(f.path)
+	f.part = 0
+	f.WriteCloser, err = os.Create(f.currentPath())
 	if err != nil {
-		return fmt.Errorf("error creating BSON file %v: %v", f.path, err)
+		return fmt.Errorf("error creating BSON file %v: %v", f.currentPath(), err)
 	}
 
 	return nil
 }
 
+// currentPath returns the path of the part being written, or the path of the
+// file if it isn't split.
+func (f *realBSONFile) currentPath() string {
+	if f.maxSize > 0 {
+		return util.BSONPartPath(f.path, f.part)
+	}
+	return f.path
+}
+
+// nextPart closes the part being written and creates the next one.
+func (f *realBSONFile) nextPart() error {
+	err := f.WriteCloser.Close()
+	if err != nil {
+		return fmt.Errorf("error writing BSON file %v: %v", f.currentPath(), err)
+	}
+	f.part++
+	f.WriteCloser, err = os.Create(f.currentPath())
+	if err != nil {
+		return fmt.Errorf("error creating BSON file %v: %v", f.currentPath(), err)
+	}
+	return nil
+}
+
+// splitBSONWriter writes documents to the parts of a realBSONFile through an
+// output buffer, starting a new part before a document that would make the
+// current part larger than the file's maximum size. Since every part gets its
+// own buffer stream, gzipped parts can be decompressed on their own.
+type splitBSONWriter struct {
+	file    *realBSONFile
+	buffer  resettableOutputBuffer
+	written int64
+}
+
+// Write writes one BSON document.
+func (w *splitBSONWriter) Write(doc []byte) (int, error) {
+	if w.written > 0 && w.written+int64(len(doc)) > w.file.maxSize {
+		if w.buffer != nil {
+			err := w.buffer.Close()
+			if err != nil {
+				return 0, err
+			}
+		}
+		err := w.file.nextPart()
+		if err != nil {
+			return 0, err
+		}
+		if w.buffer != nil {
+			w.buffer.Reset(w.file)
+		}
+		w.written = 0
+	}
+	var out io.Writer = w.file
+	if w.buffer != nil {
+		out = w.buffer
+	}
+	n, err := out.Write(doc)
+	w.written += int64(n)
+	return n, err
+}
+
 // realMetadataFile implements intent.file, and corresponds to a Metadata file on disk.
 type realMetadataFile struct {
 	io.WriteCloser
@@ -200,20 +263,9 @@ func (dump *MongoDump) outputPath(dbName, colName string) string {
 		root = dump.OutputOptions.Out
 	}
 
-	// Encode a new output path for collection names that would result in a file name greater
-	// than 255 bytes long. This includes the longest possible file extension: .metadata.json.gz
-	// The new format is <truncated-url-encoded-collection-name>%24<collection-name-hash-base64>
-	// where %24 represents a $ symbol delimiter (e.g. aVeryVery...VeryLongName%24oPpXMQ...).
-	escapedColName := util.EscapeCollectionName(colName)
-	if len(escapedColName) > 238 {
-		colNameTruncated := escapedColName[:208]
-		// #nosec G401 -- we do not use this digest algorithm in a security-sensitive way.
-		colNameHashBytes := sha1.Sum([]byte(colName))
-		colNameHashBase64 := base64.RawURLEncoding.EncodeToString(colNameHashBytes[:])
-
-		// First 208 bytes of col name + 3 bytes delimiter + 27 bytes base64 hash = 238 bytes max.
-		escapedColName = colNameTruncated + "%24" + colNameHashBase64
-	}
+	// Collection names that would result in a file name greater than 255 bytes long are
+	// truncated and suffixed with a hash of the full name.
+	escapedColName := util.CollectionFileName(colName)
 
 	return filepath.Join(root, dbName, escapedColName)
 }
@@ -231,7 +283,11 @@ func (dump *MongoDump) CreateOplogIntents() error {
 	if dump.OutputOptions.Archive != "" {
 		oplogIntent.BSONFile = &archive.MuxIn{Mux: dump.archive.Mux, Intent: oplogIntent}
 	} else {
-		oplogIntent.BSONFile = &realBSONFile{path: dump.outputPath("oplog.bson", ""), intent: oplogIntent}
+		oplogIntent.BSONFile = &realBSONFile{
+			path:    dump.outputPath("oplog.bson", ""),
+			intent:  oplogIntent,
+			maxSize: dump.maxFileSize,
+		}
 	}
 	dump.manager.Put(oplogIntent)
 	return nil
@@ -261,9 +317,9 @@ func (dump *MongoDump) CreateUsersRolesVersionIntentsForDB(db string) error {
 		rolesIntent.BSONFile = &archive.MuxIn{Intent: rolesIntent, Mux: dump.archive.Mux}
 		versionIntent.BSONFile = &archive.MuxIn{Intent: versionIntent, Mux: dump.archive.Mux}
 	} else {
-		usersIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.users.bson")), intent: usersIntent}
-		rolesIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.roles.bson")), intent: rolesIntent}
-		versionIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.version.bson")), intent: versionIntent}
+		usersIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.users.bson")), intent: usersIntent, maxSize: dump.maxFileSize}
+		rolesIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.roles.bson")), intent: rolesIntent, maxSize: dump.maxFileSize}
+		versionIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.version.bson")), intent: versionIntent, maxSize: dump.maxFileSize}
 	}
 	dump.manager.Put(usersIntent)
 	dump.manager.Put(rolesIntent)
@@ -330,7 +386,7 @@ func (dump *MongoDump) NewIntentFromOptions(
 			}
 		} else if ci.IsTimeseries() {
 			path := nameGz(dump.OutputOptions.Gzip, dump.outputPath(dbName, "system.buckets."+ci.Name)+".bson")
-			intent.BSONFile = &realBSONFile{path: path, intent: intent}
+			intent.BSONFile = &realBSONFile{path: path, intent: intent, maxSize: dump.maxFileSize}
 			intent.Location = path
 		} else if ci.IsView() && !dump.OutputOptions.ViewsAsCollections {
 			log.Logvf(log.DebugLow, "not dumping data for %v.%v because it is a view", dbName, ci.Name)
@@ -338,7 +394,7 @@ func (dump *MongoDump) NewIntentFromOptions(
 			// otherwise, if it's either not a view or we're treating views as collections
 			// then create a standard filesystem path for this collection.
 			path := nameGz(dump.OutputOptions.Gzip, dump.outputPath(dbName, ci.Name)+".bson")
-			intent.BSONFile = &realBSONFile{path: path, intent: intent}
+			intent.BSONFile = &realBSONFile{path: path, intent: intent, maxSize: dump.maxFileSize}
 			intent.Location = path
 		}
 
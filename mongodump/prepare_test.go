@@ -7,11 +7,23 @@
 package mongodump
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mongodb/mongo-tools/common/dumprestore"
+	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 )
 
 func TestSkipCollection(t *testing.T) {
@@ -215,3 +227,64 @@ func TestShouldSkipSystemNamespace(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitBSONWriter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var docs [][]byte
+	for i := 0; i < 20; i++ {
+		doc, err := bson.Marshal(bson.D{{"_id", i}, {"pad", bytes.Repeat([]byte("x"), i*10)}})
+		require.NoError(t, err)
+		docs = append(docs, doc)
+	}
+
+	for _, gz := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "db", "c.bson")
+		var buffer resettableOutputBuffer = &closableBufioWriter{bufio.NewWriter(nil)}
+		if gz {
+			path += ".gz"
+			buffer = gzip.NewWriter(nil)
+		}
+		file := &realBSONFile{path: path, intent: &intents.Intent{DB: "db", C: "c"}, maxSize: 500}
+		require.NoError(t, file.Open())
+		buffer.Reset(file)
+		w := &splitBSONWriter{file: file, buffer: buffer}
+		for _, doc := range docs {
+			_, err := w.Write(doc)
+			require.NoError(t, err)
+		}
+		require.NoError(t, buffer.Close())
+		require.NoError(t, file.Close())
+
+		_, err := os.Stat(path)
+		assert.ErrorIs(t, err, os.ErrNotExist, "only parts are written")
+
+		var read [][]byte
+		for part := 0; ; part++ {
+			partFile, err := os.Open(util.BSONPartPath(path, part))
+			if os.IsNotExist(err) {
+				assert.Greater(t, part, 2, "gzip: %v", gz)
+				break
+			}
+			require.NoError(t, err)
+			var in io.Reader = partFile
+			if gz {
+				in, err = gzip.NewReader(partFile)
+				require.NoError(t, err)
+			}
+			data, err := io.ReadAll(in)
+			require.NoError(t, err)
+			require.NoError(t, partFile.Close())
+
+			// every part holds whole documents
+			assert.LessOrEqual(t, len(data), 500)
+			for len(data) > 0 {
+				doc, rest, ok := bsoncore.ReadDocument(data)
+				require.True(t, ok, "part %v has a partial document", part)
+				read = append(read, doc)
+				data = rest
+			}
+		}
+		assert.Equal(t, docs, read, "gzip: %v", gz)
+	}
+}
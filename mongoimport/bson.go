@@ -0,0 +1,236 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BSONInputReader is an implementation of InputReader that reads documents
+// from a stream of BSON documents, such as a .bson file written by mongodump,
+// or from one namespace of a mongodump archive.
+type BSONInputReader struct {
+	// source reads the documents of the input
+	source *db.BSONSource
+
+	// demux, if not nil, reads the archive that the documents of source come
+	// from, and must run while they're read
+	demux *archive.Demultiplexer
+
+	// numProcessed indicates the number of documents processed
+	numProcessed uint64
+
+	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
+	sizeTracker
+
+	// numDecoders is the number of concurrent goroutines to use for decoding
+	numDecoders int
+
+	// ignoreBlanks removes the fields whose value is an empty string
+	ignoreBlanks bool
+
+	// rejects is where rejected records are written with --rejectsFile
+	rejects *RejectsWriter
+}
+
+// BSONConverter implements the Converter interface for BSON input.
+type BSONConverter struct {
+	data         []byte
+	index        uint64
+	ignoreBlanks bool
+	rejects      *RejectsWriter
+}
+
+// NewBSONInputReader creates a new BSONInputReader that reads the BSON
+// documents of in.
+func NewBSONInputReader(in io.Reader, numDecoders int, ignoreBlanks bool) *BSONInputReader {
+	szCount := newSizeTrackingReader(in)
+	return &BSONInputReader{
+		// documents are decoded concurrently, so each needs its own buffer
+		source:       db.NewBufferlessBSONSource(io.NopCloser(szCount)),
+		sizeTracker:  szCount,
+		numDecoders:  numDecoders,
+		ignoreBlanks: ignoreBlanks,
+	}
+}
+
+// NewBSONArchiveInputReader creates a new BSONInputReader that reads the
+// documents of the given namespace from the mongodump archive read by in. The
+// documents of the other namespaces are skipped.
+func NewBSONArchiveInputReader(
+	in io.Reader,
+	namespace string,
+	numDecoders int,
+	ignoreBlanks bool,
+) (*BSONInputReader, error) {
+	szCount := newSizeTrackingReader(in)
+	prelude := &archive.Prelude{}
+	if err := prelude.Read(szCount); err != nil {
+		return nil, fmt.Errorf("error reading archive: %v", err)
+	}
+	var found bool
+	var namespaces []string
+	for _, cm := range prelude.NamespaceMetadatas {
+		ns := cm.DataNamespace()
+		namespaces = append(namespaces, ns)
+		found = found || ns == namespace
+	}
+	if !found {
+		return nil, fmt.Errorf("the archive has no namespace %v; it has %v",
+			namespace, strings.Join(namespaces, ", "))
+	}
+	compression := prelude.Header.Compression
+	if err := archive.ValidateCompression(compression); err != nil {
+		return nil, fmt.Errorf("error reading archive: %v", err)
+	}
+
+	demux := archive.CreateDemux(prelude.NamespaceMetadatas, szCount, false)
+	demux.Compression = compression
+	// the demultiplexer announces each namespace it finds, and every one but
+	// the imported namespace is skipped
+	demux.NamespaceChan = make(chan string)
+	demux.NamespaceErrorChan = make(chan error)
+	receiver := &archive.RegularCollectionReceiver{Origin: namespace, Demux: demux}
+	if err := receiver.Open(); err != nil {
+		return nil, fmt.Errorf("error reading archive: %v", err)
+	}
+	receiver.TakeIOBuffer(make([]byte, db.MaxBSONSize))
+	log.Logvf(log.Info, "importing %v from the archive", namespace)
+
+	return &BSONInputReader{
+		source:       db.NewBufferlessBSONSource(receiver),
+		demux:        demux,
+		sizeTracker:  szCount,
+		numDecoders:  numDecoders,
+		ignoreBlanks: ignoreBlanks,
+	}, nil
+}
+
+// ReadAndValidateHeader is a no-op for BSON imports; always returns nil.
+func (r *BSONInputReader) ReadAndValidateHeader() error {
+	return nil
+}
+
+// ReadAndValidateTypedHeader is a no-op for BSON imports; always returns nil.
+func (r *BSONInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) error {
+	return nil
+}
+
+// StreamDocument takes a boolean indicating if the documents should be streamed
+// in read order and a channel on which to stream the documents processed from
+// the underlying reader. Returns a non-nil error if encountered.
+func (r *BSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (retErr error) {
+	rawChan := make(chan Converter, r.numDecoders)
+	bsonErrChan := make(chan error)
+
+	// begin reading from source
+	go func() {
+		err := r.readDocuments(rawChan)
+		close(rawChan)
+		bsonErrChan <- err
+	}()
+
+	// begin processing read bytes
+	go func() {
+		bsonErrChan <- streamDocuments(ordered, r.numDecoders, rawChan, readChan)
+	}()
+
+	return channelQuorumError(bsonErrChan)
+}
+
+// readDocuments reads the documents of the source and sends them on rawChan.
+// When the documents come from an archive, the rest of the archive is read
+// too, so that it's checked to the end.
+func (r *BSONInputReader) readDocuments(rawChan chan Converter) error {
+	var demuxErr chan error
+	if r.demux != nil {
+		demuxErr = make(chan error, 1)
+		go func() {
+			for ns := range r.demux.NamespaceChan {
+				log.Logvf(log.DebugLow, "skipping %v in the archive", ns)
+				r.demux.Open(ns, &archive.MutedCollection{Demux: r.demux})
+				r.demux.NamespaceErrorChan <- nil
+			}
+		}()
+		go func() {
+			demuxErr <- r.demux.Run()
+		}()
+	}
+
+	var err error
+	for {
+		data := r.source.LoadNext()
+		if data == nil {
+			if err = r.source.Err(); err != nil {
+				r.numProcessed++
+				err = fmt.Errorf("error reading document #%v: %v", r.numProcessed, err)
+			}
+			break
+		}
+		rawChan <- BSONConverter{
+			data:         data,
+			index:        r.numProcessed,
+			ignoreBlanks: r.ignoreBlanks,
+			rejects:      r.rejects,
+		}
+		r.numProcessed++
+	}
+
+	if r.demux != nil {
+		// closing the source lets the demultiplexer go on to the end of the
+		// archive, and its error explains why the source failed, if it did
+		_ = r.source.Close()
+		if demuxErr := <-demuxErr; demuxErr != nil {
+			return fmt.Errorf("error reading archive: %v", demuxErr)
+		}
+	}
+	return err
+}
+
+// Convert implements the Converter interface for BSON input. It converts a
+// BSONConverter struct to a BSON document.
+func (c BSONConverter) Convert() (bson.D, error) {
+	var doc bson.D
+	record := inputRecord{index: c.index}
+	if err := bson.Unmarshal(c.data, &doc); err != nil {
+		if rejectErr := c.rejects.reject(record, rejectStageParse, err); rejectErr != nil {
+			return nil, rejectErr
+		}
+		return nil, fmt.Errorf("error decoding document #%v: %v", c.index+1, err)
+	}
+	if c.ignoreBlanks {
+		doc = removeBlanks(doc)
+	}
+	c.rejects.track(doc, record)
+	return doc, nil
+}
+
+// removeBlanks removes the fields whose value is an empty string from a
+// document and its subdocuments, as --ignoreBlanks does with the empty fields
+// of CSV and TSV input.
+func removeBlanks(doc bson.D) bson.D {
+	kept := doc[:0]
+	for _, elem := range doc {
+		switch v := elem.Value.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+		case bson.D:
+			elem.Value = removeBlanks(v)
+		}
+		kept = append(kept, elem)
+	}
+	return kept
+}
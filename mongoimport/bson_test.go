@@ -0,0 +1,172 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func marshalBSONStream(t *testing.T, docs ...bson.D) []byte {
+	var out []byte
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		out = append(out, data...)
+	}
+	return out
+}
+
+func testArchive(t *testing.T) []byte {
+	sa := archive.SimpleArchive{
+		CollectionMetadata: []archive.CollectionMetadata{
+			{Database: "shop", Collection: "orders"},
+			{Database: "shop", Collection: "users"},
+			{Database: "crm", Collection: "orders"},
+		},
+		Namespaces: []archive.SimpleNamespace{
+			{Database: "shop", Collection: "orders", Documents: []bson.D{
+				{{"_id", int32(1)}, {"item", "pen"}},
+				{{"_id", int32(2)}, {"item", "ink"}},
+			}},
+			{Database: "shop", Collection: "users", Documents: []bson.D{
+				{{"_id", int32(1)}, {"name", "Ann"}},
+			}},
+			{Database: "crm", Collection: "orders", Documents: []bson.D{
+				{{"_id", int32(3)}, {"item", "pad"}},
+			}},
+		},
+	}
+	data, err := sa.Marshal()
+	require.NoError(t, err)
+	return data
+}
+
+func TestBSONInputReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	t.Run("plain BSON", func(t *testing.T) {
+		input := marshalBSONStream(t,
+			bson.D{{"_id", int32(1)}, {"name", "Ann"}, {"address", bson.D{{"city", "Paris"}}}},
+			bson.D{{"_id", int32(2)}, {"tags", bson.A{"a", "b"}}},
+		)
+		r := NewBSONInputReader(bytes.NewReader(input), 1, false)
+		docs, err := streamAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, []bson.D{
+			{{"_id", int32(1)}, {"name", "Ann"}, {"address", bson.D{{"city", "Paris"}}}},
+			{{"_id", int32(2)}, {"tags", bson.A{"a", "b"}}},
+		}, docs)
+		assert.EqualValues(t, len(input), r.Size())
+	})
+
+	t.Run("blanks are ignored", func(t *testing.T) {
+		input := marshalBSONStream(t,
+			bson.D{{"_id", int32(1)}, {"name", ""}, {"address", bson.D{{"city", ""}, {"zip", "75001"}}}},
+		)
+		r := NewBSONInputReader(bytes.NewReader(input), 1, true)
+		docs, err := streamAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, []bson.D{{{"_id", int32(1)}, {"address", bson.D{{"zip", "75001"}}}}}, docs)
+	})
+
+	t.Run("truncated input", func(t *testing.T) {
+		input := marshalBSONStream(t, bson.D{{"_id", int32(1)}}, bson.D{{"_id", int32(2)}})
+		r := NewBSONInputReader(bytes.NewReader(input[:len(input)-3]), 1, false)
+		_, err := streamAll(r)
+		assert.EqualError(t, err, "error reading document #2: unexpected EOF")
+	})
+
+	t.Run("archive namespace", func(t *testing.T) {
+		input := testArchive(t)
+		r, err := NewBSONArchiveInputReader(bytes.NewReader(input), "crm.orders", 1, false)
+		require.NoError(t, err)
+		docs, err := streamAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, []bson.D{{{"_id", int32(3)}, {"item", "pad"}}}, docs)
+		// the whole archive is read
+		assert.EqualValues(t, len(input), r.Size())
+
+		r, err = NewBSONArchiveInputReader(bytes.NewReader(input), "shop.orders", 1, false)
+		require.NoError(t, err)
+		docs, err = streamAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, []bson.D{
+			{{"_id", int32(1)}, {"item", "pen"}},
+			{{"_id", int32(2)}, {"item", "ink"}},
+		}, docs)
+	})
+
+	t.Run("archive without the namespace", func(t *testing.T) {
+		_, err := NewBSONArchiveInputReader(bytes.NewReader(testArchive(t)), "shop.carts", 1, false)
+		assert.EqualError(t, err, "the archive has no namespace shop.carts; it has shop.orders, shop.users, crm.orders")
+
+		_, err = NewBSONArchiveInputReader(bytes.NewReader(marshalBSONStream(t, bson.D{{"a", 1}})), "shop.orders", 1, false)
+		assert.EqualError(t, err, "error reading archive: stream or file does not appear to be a mongodump archive")
+	})
+}
+
+func TestImportBSONFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	file := filepath.Join(t.TempDir(), "shop.archive")
+	require.NoError(t, os.WriteFile(file, testArchive(t), 0644))
+
+	imp := NewMockMongoImport()
+	imp.InputOptions.Type = BSON
+	imp.InputOptions.ArchiveNamespace = "shop.orders"
+	imp.InputOptions.Files = []string{file}
+	imp.IngestOptions.DryRun = true
+	require.NoError(t, imp.validateSettings())
+	processed, failed, err := imp.ImportDocuments()
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, processed)
+	assert.EqualValues(t, 0, failed)
+}
+
+func TestBSONSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	imp := NewMockMongoImport()
+	imp.InputOptions.Type = BSON
+	imp.IngestOptions.IgnoreBlanks = true
+	imp.InputOptions.ArchiveNamespace = "shop.orders"
+	imp.ToolOptions.Collection = ""
+	require.NoError(t, imp.validateSettings())
+	assert.Equal(t, "orders", imp.ToolOptions.Collection)
+
+	tests := []struct {
+		inputType  string
+		setOptions func(*MongoImport)
+		expected   string
+	}{
+		{BSON, func(imp *MongoImport) { imp.InputOptions.HeaderLine = true }, "cannot use --headerline when input type is BSON"},
+		{BSON, func(imp *MongoImport) { imp.InputOptions.JSONArray = true }, "cannot use --jsonArray when input type is BSON"},
+		{BSON, func(imp *MongoImport) { imp.InputOptions.Encoding = encodingLatin1 }, "cannot use --encoding when input type is BSON"},
+		{BSON, func(imp *MongoImport) { imp.InputOptions.ArchiveNamespace = "orders" }, "invalid --archiveNamespace 'orders': must be <database>.<collection>"},
+		{JSON, func(imp *MongoImport) { imp.InputOptions.ArchiveNamespace = "shop.orders" }, "cannot use --archiveNamespace when input type is not BSON"},
+		{JSON, func(imp *MongoImport) { imp.IngestOptions.IgnoreBlanks = true }, "cannot use --ignoreBlanks when input type is JSON"},
+		{BSON, func(imp *MongoImport) {
+			imp.InputOptions.Files = []string{"orders.bson"}
+			imp.IngestOptions.Resume = true
+		}, "cannot use --resume when input type is BSON"},
+	}
+	for _, test := range tests {
+		imp := NewMockMongoImport()
+		imp.InputOptions.Type = test.inputType
+		test.setOptions(imp)
+		assert.EqualError(t, imp.validateSettings(), test.expected)
+	}
+}
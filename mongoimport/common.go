@@ -99,6 +99,22 @@ func (str *sizeTrackingReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// seek moves the reader to an offset of its input, counting the bytes before
+// it as read. The reader must not have been read from. Offsets are after any
+// BOM discarded by a bomDiscardingReader, which is seeked if its input is
+// seekable.
+func (str *sizeTrackingReader) seek(offset int64) error {
+	if bd, ok := str.reader.(*bomDiscardingReader); ok {
+		if err := bd.seek(offset); err != nil {
+			return err
+		}
+	} else if _, err := io.CopyN(io.Discard, str.reader, offset); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&str.bytesRead, offset)
+	return nil
+}
+
 func newSizeTrackingReader(reader io.Reader) *sizeTrackingReader {
 	return &sizeTrackingReader{
 		reader:    reader,
@@ -112,26 +128,53 @@ var (
 
 // bomDiscardingReader implements and wraps io.Reader, discarding the UTF-8 BOM, if applicable.
 type bomDiscardingReader struct {
+	source  io.Reader
 	buf     *bufio.Reader
 	didRead bool
+	bomSize int64
 }
 
 func (bd *bomDiscardingReader) Read(p []byte) (int, error) {
+	if err := bd.discardBOM(); err != nil {
+		return 0, err
+	}
+	return bd.buf.Read(p)
+}
+
+func (bd *bomDiscardingReader) discardBOM() error {
 	if !bd.didRead {
 		bom, err := bd.buf.Peek(3)
 		if err == nil && bytes.Equal(bom, UTF8_BOM) {
 			_, err = bd.buf.Read(make([]byte, 3)) // discard BOM
 			if err != nil {
-				return 0, err
+				return err
 			}
+			bd.bomSize = int64(len(UTF8_BOM))
 		}
 		bd.didRead = true
 	}
-	return bd.buf.Read(p)
+	return nil
+}
+
+// seek moves the reader to an offset after the BOM. It seeks the source if
+// it's seekable, like a regular file, and reads up to the offset otherwise.
+func (bd *bomDiscardingReader) seek(offset int64) error {
+	if err := bd.discardBOM(); err != nil {
+		return err
+	}
+	if seeker, ok := bd.source.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset+bd.bomSize, io.SeekStart); err == nil {
+			bd.buf.Reset(bd.source)
+			return nil
+		}
+		// pipes can't be seeked, so they're read up to the offset
+	}
+	_, err := io.CopyN(io.Discard, bd.buf, offset)
+	return err
 }
 
 func newBomDiscardingReader(r io.Reader) *bomDiscardingReader {
-	return &bomDiscardingReader{buf: bufio.NewReader(r)}
+	return &bomDiscardingReader{source: r, buf: bufio.NewReader(r)}
 }
 
 const quorum = 2
@@ -503,9 +546,12 @@ func streamDocuments(
 
 // coercionError should only be used as a specific error type to check
 // whether tokensToBSON wants the row to print.
-type coercionError struct{}
+type coercionError struct {
+	// reason describes the token that couldn't be parsed
+	reason string
+}
 
-func (coercionError) Error() string { return "coercionError" }
+func (e coercionError) Error() string { return e.reason }
 
 // tokensToBSON reads in slice of records - along with ordered column names -
 // and returns a BSON document for the record.
@@ -526,9 +572,15 @@ func tokensToBSON(
 		if index < len(colSpecs) {
 			parsedValue, err := colSpecs[index].Parser.Parse(token)
 			if err != nil {
-				log.Logvf(log.DebugHigh, "parse failure in document #%d for column '%s',"+
-					"could not parse token '%s' to type %s",
-					numProcessed, colSpecs[index].Name, token, colSpecs[index].TypeName)
+				_, invalid := err.(validationError)
+				if invalid {
+					log.Logvf(log.DebugHigh, "validation failure in document #%d for column '%s': %v",
+						numProcessed, colSpecs[index].Name, err)
+				} else {
+					log.Logvf(log.DebugHigh, "parse failure in document #%d for column '%s',"+
+						"could not parse token '%s' to type %s",
+						numProcessed, colSpecs[index].Name, token, colSpecs[index].TypeName)
+				}
 				switch colSpecs[index].ParseGrace {
 				case pgAutoCast:
 					parsedValue = autoParse(token)
@@ -536,8 +588,28 @@ func tokensToBSON(
 					continue
 				case pgSkipRow:
 					log.Logvf(log.Always, "skipping row #%d: %v", numProcessed, tokens)
-					return nil, coercionError{}
+					if invalid {
+						return nil, coercionError{fmt.Sprintf(
+							"validation failure for column '%s': %v",
+							colSpecs[index].Name,
+							err,
+						)}
+					}
+					return nil, coercionError{fmt.Sprintf(
+						"type coercion failure for column '%s', could not parse token '%s' to type %s",
+						colSpecs[index].Name,
+						token,
+						colSpecs[index].TypeName,
+					)}
 				case pgStop:
+					if invalid {
+						return nil, fmt.Errorf(
+							"validation failure in document #%d for column '%s': %v",
+							numProcessed,
+							colSpecs[index].Name,
+							err,
+						)
+					}
 					return nil, fmt.Errorf(
 						"type coercion failure in document #%d for column '%s', "+
 							"could not parse token '%s' to type %s",
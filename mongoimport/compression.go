@@ -0,0 +1,173 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// Compression formats of input files that are decompressed while importing.
+const (
+	compressionNone  = ""
+	compressionGzip  = "gzip"
+	compressionZstd  = "zstd"
+	compressionBzip2 = "bzip2"
+)
+
+// compressionExtensions maps the file extensions of compressed files to their
+// compression format.
+var compressionExtensions = map[string]string{
+	".gz":   compressionGzip,
+	".gzip": compressionGzip,
+	".zst":  compressionZstd,
+	".zstd": compressionZstd,
+	".bz2":  compressionBzip2,
+}
+
+// compressionHeaderSize is the number of bytes at the start of a file needed
+// to recognize its compression format.
+const compressionHeaderSize = 10
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	// a bzip2 stream starts with a compressed block or, if it's empty, with
+	// its end of stream marker
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// detectCompression returns the compression format of a file from the magic
+// bytes at its start, or compressionNone if it isn't compressed.
+func detectCompression(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return compressionGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return compressionZstd
+	case len(header) >= compressionHeaderSize &&
+		bytes.HasPrefix(header, bzip2Magic) &&
+		header[3] >= '1' && header[3] <= '9' &&
+		(bytes.Equal(header[4:10], bzip2BlockMagic) || bytes.Equal(header[4:10], bzip2EndMagic)):
+		return compressionBzip2
+	}
+	return compressionNone
+}
+
+// trimCompressionExtension removes the extension of a compressed file name, so
+// that exports.json.gz becomes exports.json.
+func trimCompressionExtension(name string) string {
+	ext := filepath.Ext(name)
+	if _, ok := compressionExtensions[strings.ToLower(ext)]; ok {
+		return strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// decompressingReader decompresses a compressed input file. Its Size is the
+// number of compressed bytes read, so that progress is tracked against the
+// size of the file.
+type decompressingReader struct {
+	io.Reader
+	compressed *sizeTrackingReader
+	// decompressor is nil if the decompressor doesn't need to be closed
+	decompressor io.Closer
+	source       io.Closer
+}
+
+func (dr *decompressingReader) Size() int64 {
+	return dr.compressed.Size()
+}
+
+// Close closes the decompressor and the compressed source.
+func (dr *decompressingReader) Close() error {
+	var decompressorErr error
+	if dr.decompressor != nil {
+		decompressorErr = dr.decompressor.Close()
+	}
+	if err := dr.source.Close(); err != nil {
+		return err
+	}
+	return decompressorErr
+}
+
+// zstdCloser adapts a zstd.Decoder, whose Close doesn't return an error, to
+// io.Closer.
+type zstdCloser struct {
+	decoder *zstd.Decoder
+}
+
+func (zc zstdCloser) Close() error {
+	zc.decoder.Close()
+	return nil
+}
+
+// decompressFile returns a reader of the decompressed contents of the named
+// file if it's compressed with gzip, zstd or bzip2, which is detected from its
+// magic bytes. Otherwise it returns the file itself, if it's a regular file. A
+// file whose extension says that it's compressed must be.
+func decompressFile(name string, file *os.File) (io.ReadCloser, error) {
+	var header []byte
+	var source io.ReadCloser = file
+	if stat, err := file.Stat(); err == nil && stat.Mode().IsRegular() {
+		header = make([]byte, compressionHeaderSize)
+		n, err := file.ReadAt(header, 0)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading %v: %v", name, err)
+		}
+		header = header[:n]
+	} else {
+		// pipes can't be read ahead, so the start of the input is buffered
+		buffered := bufio.NewReader(file)
+		header, _ = buffered.Peek(compressionHeaderSize)
+		source = &util.WrappedReadCloser{ReadCloser: io.NopCloser(buffered), Inner: file}
+	}
+
+	compression := detectCompression(header)
+	if compression == compressionNone {
+		if expected, ok := compressionExtensions[strings.ToLower(filepath.Ext(name))]; ok {
+			return nil, fmt.Errorf("%v is not %v-compressed", name, expected)
+		}
+		return source, nil
+	}
+
+	dr := &decompressingReader{
+		compressed: newSizeTrackingReader(source),
+		source:     source,
+	}
+	switch compression {
+	case compressionGzip:
+		gzipReader, err := gzip.NewReader(dr.compressed)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing %v: %v", name, err)
+		}
+		dr.Reader, dr.decompressor = gzipReader, gzipReader
+	case compressionZstd:
+		zstdReader, err := zstd.NewReader(dr.compressed)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing %v: %v", name, err)
+		}
+		dr.Reader, dr.decompressor = zstdReader, zstdCloser{zstdReader}
+	case compressionBzip2:
+		dr.Reader = bzip2.NewReader(dr.compressed)
+	}
+	log.Logvf(log.Info, "decompressing %v input", compression)
+	return dr, nil
+}
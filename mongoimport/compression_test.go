@@ -0,0 +1,84 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecompressInput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	plain, err := os.ReadFile("testdata/test.csv")
+	require.NoError(t, err)
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err = gzipWriter.Write(plain)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+
+	zstdEncoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	zstded := zstdEncoder.EncodeAll(plain, nil)
+
+	bzipped, err := os.ReadFile("testdata/test.csv.bz2")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		// the magic bytes are detected whatever the extension
+		"test.csv.gz":     gzipped.Bytes(),
+		"test.zst":        zstded,
+		"test.csv.bz2":    bzipped,
+		"test.csv":        plain,
+		"not-gzip.csv.gz": plain,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	imp := NewMockMongoImport()
+	for _, name := range []string{"test.csv.gz", "test.zst", "test.csv.bz2", "test.csv"} {
+		t.Run(name, func(t *testing.T) {
+			source, size, err := imp.getSourceReader(filepath.Join(dir, name))
+			require.NoError(t, err)
+			defer source.Close()
+			data, err := io.ReadAll(source)
+			require.NoError(t, err)
+			assert.Equal(t, string(plain), string(data))
+
+			stat, err := os.Stat(filepath.Join(dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, stat.Size(), size)
+			if name == "test.csv" {
+				assert.IsType(t, &os.File{}, source)
+				return
+			}
+			// progress is tracked against the compressed size
+			tracker, ok := source.(sizeTracker)
+			require.True(t, ok)
+			assert.Equal(t, size, tracker.Size())
+		})
+	}
+
+	_, _, err = imp.getSourceReader(filepath.Join(dir, "not-gzip.csv.gz"))
+	assert.ErrorContains(t, err, "is not gzip-compressed")
+
+	assert.Equal(t, compressionNone, detectCompression([]byte("BZh,1,2\n")))
+	assert.Equal(t, "exports.json", trimCompressionExtension("exports.json.GZ"))
+	assert.Equal(t, "exports.json", trimCompressionExtension("exports.json"))
+}
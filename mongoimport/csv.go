@@ -43,6 +43,15 @@ type CSVInputReader struct {
 
 	// useArrayIndexFields is whether field names include array indexes
 	useArrayIndexFields bool
+
+	// rejects is where rejected records are written with --rejectsFile
+	rejects *RejectsWriter
+
+	// schema types the columns named by the header line with --schemaFile
+	schema *ColumnSchema
+
+	// resume records how far the import has got with --resume
+	resume *ResumeTracker
 }
 
 // CSVConverter implements the Converter interface for CSV input.
@@ -53,6 +62,9 @@ type CSVConverter struct {
 	ignoreBlanks        bool
 	useArrayIndexFields bool
 	rejectWriter        *gocsv.Writer
+	record              inputRecord
+	rejects             *RejectsWriter
+	resume              *ResumeTracker
 }
 
 // NewCSVInputReader returns a CSVInputReader configured to read data from the
@@ -90,7 +102,9 @@ func (r *CSVInputReader) ReadAndValidateHeader() (err error) {
 	if err != nil {
 		return err
 	}
-	r.colSpecs = ParseAutoHeaders(fields)
+	if r.colSpecs, err = r.schema.ColumnSpecs(fields); err != nil {
+		return err
+	}
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
@@ -108,6 +122,19 @@ func (r *CSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
+// resumeAt makes the reader read from source at the given position, as
+// recorded by --resume.
+func (r *CSVInputReader) resumeAt(source io.Reader, pos resumePosition) error {
+	szCount := newSizeTrackingReader(newBomDiscardingReader(source))
+	if err := szCount.seek(pos.Offset); err != nil {
+		return fmt.Errorf("error seeking to byte %v of the input: %v", pos.Offset, err)
+	}
+	r.sizeTracker = szCount
+	r.csvReader.Reset(szCount, pos.Offset, int(pos.Line))
+	r.numProcessed = pos.Records
+	return nil
+}
+
 // StreamDocument takes a boolean indicating if the documents should be streamed
 // in read order and a channel on which to stream the documents processed from
 // the underlying reader. Returns a non-nil error if streaming fails.
@@ -116,17 +143,29 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 	csvErrChan := make(chan error)
 
 	// begin reading from source
+	r.csvReader.KeepRaw = r.rejects != nil
 	go func() {
 		var err error
 		for {
 			r.csvRecord, err = r.csvReader.Read()
+			offset, line := r.csvReader.Position()
+			record := inputRecord{
+				index: r.numProcessed,
+				line:  uint64(r.csvReader.Line()),
+				data:  r.csvReader.Raw(),
+				end:   resumePosition{offset, uint64(line), r.numProcessed + 1},
+			}
 			if err != nil {
 				close(csvRecordChan)
 				if err == io.EOF {
 					csvErrChan <- nil
 				} else {
 					r.numProcessed++
-					csvErrChan <- fmt.Errorf("read error on entry #%v: %v", r.numProcessed, err)
+					err = fmt.Errorf("read error on entry #%v: %v", r.numProcessed, err)
+					if rejectErr := r.rejects.reject(record, rejectStageParse, err); rejectErr != nil {
+						err = rejectErr
+					}
+					csvErrChan <- err
 				}
 				return
 			}
@@ -137,6 +176,9 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				ignoreBlanks:        r.ignoreBlanks,
 				useArrayIndexFields: r.useArrayIndexFields,
 				rejectWriter:        r.csvRejectWriter,
+				record:              record,
+				rejects:             r.rejects,
+				resume:              r.resume,
 			}
 			r.numProcessed++
 		}
@@ -160,11 +202,22 @@ func (c CSVConverter) Convert() (b bson.D, err error) {
 		c.useArrayIndexFields,
 	)
 	if _, ok := err.(coercionError); ok {
+		c.resume.skip(c.record)
+		if c.rejects != nil {
+			return nil, c.rejects.reject(c.record, rejectStageCoercion, err)
+		}
 		if err = c.Print(); err != nil {
 			return
 		}
 		err = nil
+	} else if err != nil {
+		if rejectErr := c.rejects.reject(c.record, rejectStageParse, err); rejectErr != nil {
+			return nil, rejectErr
+		}
+		return
 	}
+	c.rejects.track(b, c.record)
+	c.resume.track(b, c.record)
 	return
 }
 
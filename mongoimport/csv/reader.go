@@ -60,6 +60,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"unicode"
 )
 
@@ -92,7 +93,13 @@ var (
 // Comma is the field delimiter.  It defaults to ','.
 //
 // Comment, if not 0, is the comment character. Lines beginning with the
-// Comment character are ignored.
+// Comment character are ignored. Lines beginning with CommentPrefix, if it's
+// not empty, are ignored too.
+//
+// Quote is the character that quotes fields.  It defaults to '"'.
+//
+// Escape, if not 0, is the escape character. The character after it is part
+// of the field, even if it's a delimiter, a quote or a newline.
 //
 // If FieldsPerRecord is positive, Read requires each record to
 // have the given number of fields.  If FieldsPerRecord is 0, Read sets it to
@@ -105,26 +112,80 @@ var (
 //
 // If TrimLeadingSpace is true, leading white space in a field is ignored.
 type Reader struct {
-	Comma            rune // field delimiter (set to ',' by NewReader)
-	Comment          rune // comment character for start of line
-	FieldsPerRecord  int  // number of expected fields per record
-	LazyQuotes       bool // allow lazy quotes
-	TrailingComma    bool // ignored; here for backwards compatibility
-	TrimLeadingSpace bool // trim leading space
+	Comma            rune   // field delimiter (set to ',' by NewReader)
+	Comment          rune   // comment character for start of line
+	CommentPrefix    string // comment prefix for start of line
+	Quote            rune   // quote character (set to '"' by NewReader)
+	Escape           rune   // escape character
+	FieldsPerRecord  int    // number of expected fields per record
+	LazyQuotes       bool   // allow lazy quotes
+	TrailingComma    bool   // ignored; here for backwards compatibility
+	TrimLeadingSpace bool   // trim leading space
+	KeepRaw          bool   // keep the text of the last record read, see Raw
 	line             int
+	recordLine       int
 	column           int
+	input            *countingReader
 	r                *bufio.Reader
 	field            bytes.Buffer
+	raw              bytes.Buffer
+}
+
+// countingReader counts the bytes read from an io.Reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
 }
 
 // NewReader returns a new Reader that reads from r.
 func NewReader(r io.Reader) *Reader {
+	input := &countingReader{r: r}
 	return &Reader{
 		Comma: ',',
-		r:     bufio.NewReader(r),
+		Quote: '"',
+		input: input,
+		r:     bufio.NewReader(input),
 	}
 }
 
+// SkipLines skips the next n lines of input, whatever they contain.
+func (r *Reader) SkipLines(n int) error {
+	for i := 0; i < n; i++ {
+		r.line++
+		r.column = -1
+		if err := r.skip('\n'); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Position returns the offset in the input just after the last record read
+// and the number of lines it has read, which includes all the lines of the
+// last record.
+func (r *Reader) Position() (offset int64, line int) {
+	return r.input.n - int64(r.r.Buffered()), r.line
+}
+
+// Reset makes the Reader read from r, which continues the input at the given
+// offset and after the given number of lines, as returned by Position.
+func (r *Reader) Reset(in io.Reader, offset int64, line int) {
+	r.input = &countingReader{r: in, n: offset}
+	r.r = bufio.NewReader(r.input)
+	r.line = line
+	r.recordLine = line
+	r.raw.Reset()
+}
+
 // error creates a new ParseError based on err.
 func (r *Reader) error(err error) error {
 	return &ParseError{
@@ -158,6 +219,20 @@ func (r *Reader) Read() (record []string, err error) {
 	return record, nil
 }
 
+// Line returns the line on which the last record read started. The first
+// line is 1.
+func (r *Reader) Line() int {
+	return r.recordLine
+}
+
+// Raw returns the text of the last record read, as it was in the input but
+// without its final newline, if KeepRaw is set. If reading the record failed,
+// it returns the text read up to the error.
+func (r *Reader) Raw() string {
+	raw := strings.TrimSuffix(r.raw.String(), "\n")
+	return strings.TrimSuffix(raw, "\r")
+}
+
 // ReadAll reads all the remaining records from r.
 // Each record is a slice of fields.
 // A successful call returns err == nil, not err == EOF. Because ReadAll is
@@ -193,9 +268,14 @@ func (r *Reader) readRune() (rune, error) {
 					return r1, err
 				}
 				r1 = '\r'
+			} else if r.KeepRaw {
+				r.raw.WriteRune('\r')
 			}
 		}
 	}
+	if err == nil && r.KeepRaw {
+		r.raw.WriteRune(r1)
+	}
 	r.column++
 	return r1, err
 }
@@ -219,7 +299,9 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 	// number (lines start at 1, not 0) and set column to -1
 	// so as we increment in readRune it points to the character we read.
 	r.line++
+	r.recordLine = r.line
 	r.column = -1
+	r.raw.Reset()
 
 	// Peek at the first rune.  If it is an error we are done.
 	// If we are support comments and it is the comment character
@@ -236,6 +318,12 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 	if err := r.r.UnreadRune(); err != nil {
 		return nil, err
 	}
+	if r.CommentPrefix != "" {
+		prefix, _ := r.r.Peek(len(r.CommentPrefix))
+		if string(prefix) == r.CommentPrefix {
+			return nil, r.skip('\n')
+		}
+	}
 
 	// At this point we have at least one field.
 	for {
@@ -258,7 +346,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 	r.field.Reset()
 
 	r1, err := r.readRune()
-	for err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
+	for err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
 		r1, err = r.readRune()
 	}
 
@@ -282,11 +370,23 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 		}
 		return true, r1, nil
 
-	case '"':
+	case r.Quote:
 		// quoted field
 	Quoted:
 		for {
 			r1, err = r.readRune()
+			if err == nil && r.isEscape(r1) {
+				// the escaped rune is part of the field
+				r1, err = r.readRune()
+				if err == nil {
+					if r1 == '\n' {
+						r.line++
+						r.column = -1
+					}
+					r.field.WriteRune(r1)
+					continue
+				}
+			}
 			if err != nil {
 				if err == io.EOF {
 					if r.LazyQuotes {
@@ -297,17 +397,17 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				return false, 0, err
 			}
 			switch r1 {
-			case '"':
+			case r.Quote:
 				r1, err = r.readRune()
-				if err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
-					for err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
+				if err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
+					for err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
 						r1, err = r.readRune()
 					}
 					// we don't want '"foo" "bar",' to look like '"foo""bar"'
 					// which evaluates to 'foo"bar'
 					// so we explicitly test for the case that the trimmed whitespace isn't
 					// followed by a '"'
-					if err == nil && r1 == '"' {
+					if err == nil && r1 == r.Quote {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
@@ -318,13 +418,13 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				if r1 == '\n' {
 					return true, r1, nil
 				}
-				if r1 != '"' {
+				if r1 != r.Quote {
 					if !r.LazyQuotes {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
 					// accept the bare quote
-					r.field.WriteRune('"')
+					r.field.WriteRune(r.Quote)
 				}
 			case '\n':
 				r.line++
@@ -336,8 +436,24 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 	default:
 		// unquoted field
 		for {
-			// only write sections of whitespace if it's followed by non-whitespace
-			if unicode.IsSpace(r1) {
+			if r.isEscape(r1) {
+				// the escaped rune is part of the field; an escape character at
+				// the end of the input is kept as it is
+				escaped, escErr := r.readRune()
+				if escErr == nil {
+					r1 = escaped
+					if r1 == '\n' {
+						r.line++
+						r.column = -1
+					}
+				} else if escErr != io.EOF {
+					return false, 0, escErr
+				}
+				r.field.WriteString(ws.String())
+				ws.Reset()
+				r.field.WriteRune(r1)
+			} else if unicode.IsSpace(r1) {
+				// only write sections of whitespace if it's followed by non-whitespace
 				ws.WriteRune(r1)
 			} else {
 				r.field.WriteString(ws.String())
@@ -351,7 +467,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 			if r1 == '\n' {
 				return true, r1, nil
 			}
-			if !r.LazyQuotes && r1 == '"' {
+			if !r.LazyQuotes && r1 == r.Quote {
 				return false, 0, r.error(ErrBareQuote)
 			}
 		}
@@ -370,3 +486,10 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 
 	return true, r1, nil
 }
+
+// isEscape reports whether r1 is the escape character. When the escape
+// character is the quote character, quotes are escaped by doubling them, as
+// they always are.
+func (r *Reader) isEscape(r1 rune) bool {
+	return r.Escape != 0 && r1 == r.Escape && r.Escape != r.Quote
+}
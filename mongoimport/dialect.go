@@ -0,0 +1,113 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// csvDialect describes how the records of CSV and TSV input are written, as
+// given by --delimiter, --quote, --escape, --commentPrefix and --skipLines.
+// Only CSV input has a delimiter, quote and escape character.
+type csvDialect struct {
+	// delimiter, quote and escape are 0 if they're not given
+	delimiter rune
+	quote     rune
+	escape    rune
+	// commentPrefix starts the lines that are ignored, if it's not empty
+	commentPrefix string
+	// skipLines is the number of lines skipped at the start of the input
+	skipLines int
+}
+
+// parseCSVDialect returns the dialect given by the input options.
+func parseCSVDialect(opts *InputOptions) (csvDialect, error) {
+	d := csvDialect{
+		commentPrefix: opts.CommentPrefix,
+		skipLines:     opts.SkipLines,
+	}
+	if d.skipLines < 0 {
+		return d, fmt.Errorf("--skipLines cannot be negative")
+	}
+	var err error
+	if d.delimiter, err = parseDialectRune("delimiter", opts.Delimiter); err != nil {
+		return d, err
+	}
+	if d.quote, err = parseDialectRune("quote", opts.Quote); err != nil {
+		return d, err
+	}
+	if d.escape, err = parseDialectRune("escape", opts.Escape); err != nil {
+		return d, err
+	}
+	delimiter, quote := d.delimiter, d.quote
+	if delimiter == 0 {
+		delimiter = ','
+	}
+	if quote == 0 {
+		quote = '"'
+	}
+	if delimiter == quote {
+		return d, fmt.Errorf("the delimiter and the quote character must be different")
+	}
+	if d.escape == delimiter {
+		return d, fmt.Errorf("the delimiter and the escape character must be different")
+	}
+	return d, nil
+}
+
+// parseDialectRune returns the single character given by an option, or 0 if
+// it's not given. A tab can be written as \t or tab.
+func parseDialectRune(option, value string) (rune, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == utf8.RuneError {
+		return 0, fmt.Errorf("--%v must be a single character, not '%v'", option, value)
+	}
+	if r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("--%v cannot be a newline", option)
+	}
+	return r, nil
+}
+
+// applyDialect makes the reader read input written in the given dialect, and
+// skips the lines at its start.
+func (r *CSVInputReader) applyDialect(d csvDialect) error {
+	if d.delimiter != 0 {
+		r.csvReader.Comma = d.delimiter
+	}
+	if d.quote != 0 {
+		r.csvReader.Quote = d.quote
+	}
+	r.csvReader.Escape = d.escape
+	r.csvReader.CommentPrefix = d.commentPrefix
+	return r.csvReader.SkipLines(d.skipLines)
+}
+
+// applyDialect makes the reader ignore comment lines, and skips the lines at
+// the start of the input.
+func (r *TSVInputReader) applyDialect(d csvDialect) error {
+	r.commentPrefix = d.commentPrefix
+	for i := 0; i < d.skipLines; i++ {
+		line, err := r.tsvReader.ReadString(entryDelimiter)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		r.line++
+		r.offset += int64(len(line))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// readWithDialect imports input with the given options set, and a header line.
+func readWithDialect(t *testing.T, inputType, input string, setOptions func(*InputOptions)) []bson.D {
+	imp := NewMockMongoImport()
+	imp.InputOptions.Type = inputType
+	imp.InputOptions.HeaderLine = true
+	setOptions(imp.InputOptions)
+	require.NoError(t, imp.validateSettings())
+	r, err := imp.getInputReader("", strings.NewReader(input))
+	require.NoError(t, err)
+	require.NoError(t, r.ReadAndValidateHeader())
+	docs, err := streamAll(r)
+	require.NoError(t, err)
+	return docs
+}
+
+func TestCSVDialect(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	t.Run("semicolons and comments", func(t *testing.T) {
+		input := "exported by partner\n\n// columns\nname;city\nAnn;\"Paris; France\"\n// skipped\nBob;Rome\n"
+		docs := readWithDialect(t, CSV, input, func(opts *InputOptions) {
+			opts.Delimiter = ";"
+			opts.CommentPrefix = "//"
+			opts.SkipLines = 2
+		})
+		assert.Equal(t, []bson.D{
+			{{"name", "Ann"}, {"city", "Paris; France"}},
+			{{"name", "Bob"}, {"city", "Rome"}},
+		}, docs)
+	})
+
+	t.Run("quote and escape characters", func(t *testing.T) {
+		input := "a|b\n'it''s'|'say \\'hi\\''\nx\\|y|multi\\\nline\n"
+		docs := readWithDialect(t, CSV, input, func(opts *InputOptions) {
+			opts.Delimiter = "|"
+			opts.Quote = "'"
+			opts.Escape = `\`
+		})
+		assert.Equal(t, []bson.D{
+			{{"a", "it's"}, {"b", "say 'hi'"}},
+			{{"a", "x|y"}, {"b", "multi\nline"}},
+		}, docs)
+	})
+
+	t.Run("tab delimiter with quotes", func(t *testing.T) {
+		docs := readWithDialect(t, CSV, "a\tb\n\"1\t2\"\t3\n", func(opts *InputOptions) {
+			opts.Delimiter = "tab"
+		})
+		assert.Equal(t, []bson.D{{{"a", "1\t2"}, {"b", int32(3)}}}, docs)
+	})
+
+	t.Run("TSV comments and skipped lines", func(t *testing.T) {
+		docs := readWithDialect(t, TSV, "title\n#\tcomment\na\tb\n1\t2\n#\t3\n", func(opts *InputOptions) {
+			opts.CommentPrefix = "#"
+			opts.SkipLines = 1
+		})
+		assert.Equal(t, []bson.D{{{"a", int32(1)}, {"b", int32(2)}}}, docs)
+	})
+}
+
+func TestCSVDialectSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	tests := []struct {
+		inputType  string
+		setOptions func(*InputOptions)
+		expected   string
+	}{
+		{CSV, func(opts *InputOptions) { opts.Delimiter = ";;" }, "--delimiter must be a single character, not ';;'"},
+		{CSV, func(opts *InputOptions) { opts.Quote = "\n" }, "--quote cannot be a newline"},
+		{CSV, func(opts *InputOptions) { opts.Delimiter = `"` }, "the delimiter and the quote character must be different"},
+		{CSV, func(opts *InputOptions) { opts.Escape = "," }, "the delimiter and the escape character must be different"},
+		{CSV, func(opts *InputOptions) { opts.SkipLines = -1 }, "--skipLines cannot be negative"},
+		{TSV, func(opts *InputOptions) { opts.Delimiter = ";" }, "cannot use --delimiter when input type is TSV"},
+		{TSV, func(opts *InputOptions) { opts.Escape = `\` }, "cannot use --escape when input type is TSV"},
+		{JSON, func(opts *InputOptions) { opts.CommentPrefix = "#" }, "cannot use --commentPrefix when input type is JSON"},
+		{JSON, func(opts *InputOptions) { opts.SkipLines = 1 }, "cannot use --skipLines when input type is JSON"},
+		{Parquet, func(opts *InputOptions) { opts.Quote = "'" }, "cannot use --quote when input type is Parquet"},
+	}
+	for _, test := range tests {
+		imp := NewMockMongoImport()
+		imp.InputOptions.Type = test.inputType
+		if test.inputType == CSV || test.inputType == TSV {
+			imp.InputOptions.HeaderLine = true
+		}
+		test.setOptions(imp.InputOptions)
+		assert.EqualError(t, imp.validateSettings(), test.expected)
+	}
+}
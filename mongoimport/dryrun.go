@@ -0,0 +1,269 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DryRunReport tallies the problems that --dryRun finds in the input: the
+// values of each CSV and TSV column that fail to parse as its type, duplicate
+// _ids within the input, documents over the maximum BSON document size, and
+// documents that fail the target collection's validator. It's safe for
+// concurrent use.
+type DryRunReport struct {
+	mutex sync.Mutex
+	// columns holds the names of the columns with coercion failures, in the
+	// order of their first failure
+	columns          []string
+	coercionFailures map[string]uint64
+	// stopsOnCoercion is whether --parseGrace=stop would stop the import at
+	// the first coercion failure, which the dry run reads past
+	stopsOnCoercion bool
+
+	// ids holds the _ids seen so far, if duplicates are checked
+	ids          map[string]struct{}
+	duplicateIDs uint64
+	oversized    uint64
+	invalid      uint64
+
+	// validator, if not nil, is the $jsonSchema of the target collection
+	validator *DocumentValidator
+}
+
+// NewDryRunReport returns an empty DryRunReport. Duplicate _ids are only
+// checked if checkIDs is true, as they only fail inserts.
+func NewDryRunReport(checkIDs bool) *DryRunReport {
+	dr := &DryRunReport{coercionFailures: map[string]uint64{}}
+	if checkIDs {
+		dr.ids = map[string]struct{}{}
+	}
+	return dr
+}
+
+// dryRunParser counts the values of a column that its parser fails to parse.
+type dryRunParser struct {
+	parser FieldParser
+	column string
+	report *DryRunReport
+	// stops, if not nil, is the failure count of the import, which counts
+	// the rows that --parseGrace=stop would stop the import at, as they're
+	// skipped instead
+	stops *uint64
+}
+
+func (dp *dryRunParser) Parse(in string) (interface{}, error) {
+	value, err := dp.parser.Parse(in)
+	if err != nil {
+		dp.report.coercionFailure(dp.column)
+		if dp.stops != nil {
+			atomic.AddUint64(dp.stops, 1)
+		}
+	}
+	return value, err
+}
+
+func (dr *DryRunReport) coercionFailure(column string) {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+	if _, ok := dr.coercionFailures[column]; !ok {
+		dr.columns = append(dr.columns, column)
+	}
+	dr.coercionFailures[column]++
+}
+
+// watchColumns makes the columns of a CSV or TSV input reader count their
+// coercion failures. Rows that would stop the import are skipped instead, so
+// that the whole input is checked, and are added to failureCount.
+func (dr *DryRunReport) watchColumns(inputReader InputReader, failureCount *uint64) {
+	if dr == nil {
+		return
+	}
+	switch r := inputReader.(type) {
+	case *CSVInputReader:
+		r.colSpecs = dr.watched(r.colSpecs, failureCount)
+	case *TSVInputReader:
+		r.colSpecs = dr.watched(r.colSpecs, failureCount)
+	}
+}
+
+func (dr *DryRunReport) watched(colSpecs []ColumnSpec, failureCount *uint64) []ColumnSpec {
+	watched := make([]ColumnSpec, len(colSpecs))
+	for i, spec := range colSpecs {
+		parser := &dryRunParser{parser: spec.Parser, column: spec.Name, report: dr}
+		if spec.ParseGrace == pgStop {
+			// a skipped row stops at its first coercion failure, so each
+			// row is counted once
+			spec.ParseGrace = pgSkipRow
+			parser.stops = failureCount
+			dr.mutex.Lock()
+			dr.stopsOnCoercion = true
+			dr.mutex.Unlock()
+		}
+		spec.Parser = parser
+		watched[i] = spec
+	}
+	return watched
+}
+
+// check returns an error describing why a document would fail to be written,
+// if it would.
+func (dr *DryRunReport) check(doc bson.D) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if len(raw) > db.MaxBSONSize {
+		dr.mutex.Lock()
+		dr.oversized++
+		dr.mutex.Unlock()
+		return fmt.Errorf("document is %v bytes, over the maximum of %v", len(raw), db.MaxBSONSize)
+	}
+	if dr.validator != nil {
+		if err = dr.validator.Validate(doc); err != nil {
+			dr.mutex.Lock()
+			dr.invalid++
+			dr.mutex.Unlock()
+			return validatorError{err}
+		}
+	}
+	if dr.ids != nil {
+		for _, elem := range doc {
+			if elem.Key != "_id" {
+				continue
+			}
+			key, err := idKey(elem.Value)
+			if err != nil {
+				return err
+			}
+			dr.mutex.Lock()
+			_, duplicate := dr.ids[key]
+			if duplicate {
+				dr.duplicateIDs++
+			} else {
+				dr.ids[key] = struct{}{}
+			}
+			dr.mutex.Unlock()
+			if duplicate {
+				return fmt.Errorf("duplicate _id %v", formatValue(elem.Value))
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// validatorError is the error of a document that fails the validator of the
+// collection.
+type validatorError struct {
+	err error
+}
+
+func (e validatorError) Error() string {
+	return fmt.Sprintf("document failed validation: %v", e.err)
+}
+
+// idKey returns a key that's the same for _ids that the server considers
+// equal. Numbers of different types are equal if their values are.
+func idKey(id interface{}) (string, error) {
+	switch v := id.(type) {
+	case int32:
+		return "n" + strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return "n" + strconv.FormatInt(v, 10), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return "n" + strconv.FormatInt(int64(v), 10), nil
+		}
+		return "n" + strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	t, data, err := bson.MarshalValue(id)
+	if err != nil {
+		return "", err
+	}
+	return string([]byte{byte(t)}) + string(data), nil
+}
+
+// runDryRunWorker is the counterpart of runInsertionWorker for --dryRun: it
+// transforms and checks the documents read, without writing them.
+func (imp *MongoImport) runDryRunWorker(readDocs chan bson.D) (err error) {
+	for {
+		select {
+		case document, alive := <-readDocs:
+			if !alive {
+				return nil
+			}
+			if imp.transformer != nil {
+				var ok bool
+				if document, ok, err = imp.transformDocument(document); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+			}
+			if err = imp.dryRun.check(document); err != nil {
+				log.Logvf(log.Info, "document would fail to import: %v", err)
+				atomic.AddUint64(&imp.failureCount, 1)
+				stage := rejectStageWrite
+				var invalid validatorError
+				if errors.As(err, &invalid) {
+					stage = rejectStageValidation
+				}
+				if rejectErr := imp.rejects.reject(imp.rejects.source(document), stage, err); rejectErr != nil {
+					return rejectErr
+				}
+				continue
+			}
+			imp.rejects.forget(document)
+			atomic.AddUint64(&imp.processedCount, 1)
+		case <-imp.Dying():
+			return nil
+		}
+	}
+}
+
+// logReport logs the problems the dry run found.
+func (dr *DryRunReport) logReport() {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+	if len(dr.columns) > 0 {
+		grid := &text.GridWriter{ColumnPadding: 2}
+		grid.WriteCells("column", "coercion failures")
+		grid.EndRow()
+		for _, column := range dr.columns {
+			grid.WriteCells(column, fmt.Sprint(dr.coercionFailures[column]))
+			grid.EndRow()
+		}
+		buf := &bytes.Buffer{}
+		grid.Flush(buf)
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			log.Logv(log.Always, line)
+		}
+		if dr.stopsOnCoercion {
+			log.Logv(log.Always, "with --parseGrace=stop, the import would stop at the first coercion failure")
+		}
+	}
+	if dr.ids != nil {
+		log.Logvf(log.Always, "duplicate _ids: %v", dr.duplicateIDs)
+	}
+	log.Logvf(log.Always, "documents over %v bytes: %v", db.MaxBSONSize, dr.oversized)
+	if dr.validator != nil {
+		log.Logvf(log.Always, "documents failing the validator: %v", dr.invalid)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDryRun(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "orders.csv")
+	input := "_id.int32(),qty.int32(),note.string()\n1,5,a\n2,many,b\n1,7,c\n3,x,d\n4,8,e\n"
+	require.NoError(t, os.WriteFile(file, []byte(input), 0644))
+
+	imp := NewMockMongoImport()
+	imp.InputOptions.Type = CSV
+	imp.InputOptions.HeaderLine = true
+	imp.InputOptions.ColumnsHaveTypes = true
+	imp.InputOptions.Files = []string{file}
+	imp.IngestOptions.DryRun = true
+	imp.IngestOptions.RejectsFile = filepath.Join(dir, "rejects.jsonl")
+	require.NoError(t, imp.validateSettings())
+	validator, err := NewDocumentValidator(bson.D{{"$jsonSchema", bson.D{
+		{"properties", bson.D{{"note", bson.D{{"pattern", "^[a-d]"}}}}},
+	}}})
+	require.NoError(t, err)
+	imp.dryRun.validator = validator
+
+	processed, failed, err := imp.ImportDocuments()
+	require.NoError(t, err)
+	// the two rows with a bad qty would stop the import, so they're skipped
+	// and counted as failures, the second _id 1 would fail to insert and the
+	// last row fails the validator
+	assert.EqualValues(t, 1, processed)
+	assert.EqualValues(t, 4, failed)
+	assert.Equal(t, []string{"qty"}, imp.dryRun.columns)
+	assert.EqualValues(t, 2, imp.dryRun.coercionFailures["qty"])
+	assert.True(t, imp.dryRun.stopsOnCoercion)
+	assert.EqualValues(t, 1, imp.dryRun.duplicateIDs)
+
+	rejects, err := os.ReadFile(imp.IngestOptions.RejectsFile)
+	require.NoError(t, err)
+	rejected := readRejects(t, bytes.NewBuffer(rejects))
+	require.Len(t, rejected, 4)
+	// coercion failures are rejected as they're read, so they can come
+	// before or after the other failures
+	var stages []string
+	for _, record := range rejected {
+		stages = append(stages, record.Stage)
+		switch record.Stage {
+		case rejectStageWrite:
+			assert.Equal(t, "duplicate _id 1", record.Error)
+			assert.EqualValues(t, 4, record.Line)
+		case rejectStageValidation:
+			assert.Contains(t, record.Error, "document failed validation")
+			assert.EqualValues(t, 6, record.Line)
+		}
+	}
+	assert.ElementsMatch(
+		t,
+		[]string{rejectStageCoercion, rejectStageCoercion, rejectStageWrite, rejectStageValidation},
+		stages,
+	)
+	// the input records of the documents that would be imported are forgotten
+	assert.Empty(t, imp.rejects.sources)
+}
+
+func TestDryRunReportCheck(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	t.Run("numeric _ids of different types are duplicates", func(t *testing.T) {
+		dr := NewDryRunReport(true)
+		require.NoError(t, dr.check(bson.D{{"_id", int32(1)}}))
+		assert.EqualError(t, dr.check(bson.D{{"_id", 1.0}}), "duplicate _id 1")
+		require.NoError(t, dr.check(bson.D{{"_id", "1"}}))
+		require.NoError(t, dr.check(bson.D{{"_id", bson.D{{"a", 1}}}}))
+		assert.Error(t, dr.check(bson.D{{"_id", bson.D{{"a", 1}}}}))
+		assert.EqualValues(t, 2, dr.duplicateIDs)
+	})
+
+	t.Run("duplicates are only checked for inserts", func(t *testing.T) {
+		dr := NewDryRunReport(false)
+		require.NoError(t, dr.check(bson.D{{"_id", 1}}))
+		require.NoError(t, dr.check(bson.D{{"_id", 1}}))
+	})
+
+	t.Run("oversized documents", func(t *testing.T) {
+		dr := NewDryRunReport(true)
+		big := strings.Repeat("x", db.MaxBSONSize)
+		assert.Error(t, dr.check(bson.D{{"_id", 1}, {"big", big}}))
+		assert.EqualValues(t, 1, dr.oversized)
+		// an oversized document doesn't claim its _id
+		require.NoError(t, dr.check(bson.D{{"_id", 1}}))
+	})
+
+	t.Run("validator", func(t *testing.T) {
+		dr := NewDryRunReport(true)
+		var err error
+		dr.validator, err = NewDocumentValidator(bson.D{{"$jsonSchema", bson.D{
+			{"required", bson.A{"qty"}},
+		}}})
+		require.NoError(t, err)
+		assert.EqualError(t, dr.check(bson.D{{"_id", 1}}),
+			"document failed validation: document is missing the required field 'qty'")
+		assert.EqualValues(t, 1, dr.invalid)
+	})
+}
+
+func TestDryRunSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	imp := NewMockMongoImport()
+	imp.IngestOptions.CheckValidator = true
+	assert.EqualError(t, imp.validateSettings(), "cannot use --checkValidator without --dryRun")
+
+	imp = NewMockMongoImport()
+	imp.InputOptions.Files = []string{"orders.json"}
+	imp.IngestOptions.DryRun = true
+	imp.IngestOptions.Resume = true
+	assert.EqualError(t, imp.validateSettings(), "incompatible options: --resume and --dryRun")
+
+	imp = NewMockMongoImport()
+	imp.IngestOptions.DryRun = true
+	imp.IngestOptions.Mode = modeUpsert
+	require.NoError(t, imp.validateSettings())
+	assert.Nil(t, imp.dryRun.ids)
+}
+
+func TestDocumentValidator(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	validator, err := NewDocumentValidator(bson.D{
+		{"$jsonSchema", bson.D{
+			{"bsonType", "object"},
+			{"required", bson.A{"name", "qty"}},
+			{"additionalProperties", false},
+			{"properties", bson.D{
+				{"_id", bson.D{{"bsonType", "objectId"}}},
+				{"name", bson.D{{"bsonType", "string"}, {"pattern", "^[A-Z]"}}},
+				{"qty", bson.D{{"bsonType", bson.A{"int", "long"}}, {"minimum", 0}}},
+				{"price", bson.D{{"bsonType", "number"}, {"maximum", 100}}},
+				{"status", bson.D{{"enum", bson.A{"new", "done"}}}},
+				{"tags", bson.D{
+					{"bsonType", "array"},
+					{"items", bson.D{{"type", "string"}}},
+				}},
+				{"address", bson.D{
+					{"bsonType", "object"},
+					{"required", bson.A{"city"}},
+				}},
+			}},
+		}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		doc      bson.D
+		expected string
+	}{
+		{bson.D{{"_id", primitive.NewObjectID()}, {"name", "Ann"}, {"qty", int64(3)}, {"price", 9.5}}, ""},
+		{bson.D{{"name", "Ann"}, {"qty", "3"}}, "field 'qty' is string, not int or long"},
+		{bson.D{{"name", "Ann"}}, "document is missing the required field 'qty'"},
+		{bson.D{{"name", "ann"}, {"qty", 1}}, "field 'name' does not match pattern ^[A-Z]"},
+		{bson.D{{"name", "Ann"}, {"qty", int32(-1)}}, "field 'qty' is less than the minimum of 0"},
+		{bson.D{{"name", "Ann"}, {"qty", 1}, {"price", int32(101)}}, "field 'price' is greater than the maximum of 100"},
+		{bson.D{{"name", "Ann"}, {"qty", 1}, {"status", "lost"}}, "field 'status' is not one of the allowed values"},
+		{bson.D{{"name", "Ann"}, {"qty", 1}, {"tags", bson.A{"a", 2}}}, "field 'tags.1' is int, not string"},
+		{bson.D{{"name", "Ann"}, {"qty", 1}, {"address", bson.D{{"zip", "1"}}}}, "field 'address' is missing the required field 'city'"},
+		{bson.D{{"name", "Ann"}, {"qty", 1}, {"color", "red"}}, "document has the field 'color', which is not allowed"},
+	}
+	for _, test := range tests {
+		err := validator.Validate(test.doc)
+		if test.expected == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, test.expected)
+			assert.IsType(t, validationError{}, err)
+		}
+	}
+
+	validator, err = NewDocumentValidator(bson.D{{"qty", bson.D{{"$gt", 0}}}})
+	require.NoError(t, err)
+	assert.Nil(t, validator)
+
+	// patterns that Go's regexp doesn't support aren't checked
+	validator, err = NewDocumentValidator(bson.D{{"$jsonSchema", bson.D{
+		{"properties", bson.D{
+			{"code", bson.D{{"pattern", "^(?=[A-Z])"}}},
+			{"name", bson.D{{"pattern", "^[A-Z]"}}},
+		}},
+	}}})
+	require.NoError(t, err)
+	assert.NoError(t, validator.Validate(bson.D{{"code", "a1"}, {"name", "Ann"}}))
+	assert.EqualError(
+		t,
+		validator.Validate(bson.D{{"code", "a1"}, {"name", "ann"}}),
+		"field 'name' does not match pattern ^[A-Z]",
+	)
+}
@@ -0,0 +1,163 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Character encodings of input files, which are decoded to UTF-8 while
+// importing.
+const (
+	encodingUTF8        = "utf-8"
+	encodingLatin1      = "latin1"
+	encodingWindows1252 = "windows-1252"
+	encodingUTF16LE     = "utf-16le"
+	encodingUTF16BE     = "utf-16be"
+)
+
+// windows1252Runes holds the characters of bytes 0x80 to 0x9F in
+// Windows-1252. The other bytes are the same as in Latin-1, and so are the
+// five bytes that Windows-1252 leaves undefined.
+var windows1252Runes = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// decodingReader decodes an input file in another character encoding to
+// UTF-8. A UTF-16 byte order mark is decoded to a UTF-8 one, which the input
+// readers discard. Its Size is the number of bytes read from the file, so
+// that progress is tracked against the size of the file.
+type decodingReader struct {
+	source  io.ReadCloser
+	counted *sizeTrackingReader
+	in      *bufio.Reader
+	decode  func() (rune, error)
+	// pending holds the UTF-8 bytes of a decoded rune that didn't fit in the
+	// last Read
+	pending []byte
+	buf     [utf8.UTFMax]byte
+}
+
+// newDecodingReader returns a reader that decodes source from the given
+// encoding, or source itself if it's already UTF-8.
+func newDecodingReader(source io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	if encoding == "" || encoding == encodingUTF8 {
+		return source, nil
+	}
+	dr := &decodingReader{
+		source:  source,
+		counted: newSizeTrackingReader(source),
+	}
+	dr.in = bufio.NewReader(dr.counted)
+	switch encoding {
+	case encodingLatin1:
+		dr.decode = dr.decodeLatin1
+	case encodingWindows1252:
+		dr.decode = dr.decodeWindows1252
+	case encodingUTF16LE:
+		dr.decode = func() (rune, error) { return dr.decodeUTF16(binary.LittleEndian) }
+	case encodingUTF16BE:
+		dr.decode = func() (rune, error) { return dr.decodeUTF16(binary.BigEndian) }
+	default:
+		return nil, fmt.Errorf("unknown encoding '%v'", encoding)
+	}
+	return dr, nil
+}
+
+func (dr *decodingReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(dr.pending) > 0 {
+			copied := copy(p[n:], dr.pending)
+			dr.pending = dr.pending[copied:]
+			n += copied
+			continue
+		}
+		// don't wait for more input once there's something to return
+		if n > 0 && dr.in.Buffered() == 0 {
+			break
+		}
+		r, err := dr.decode()
+		if err != nil {
+			if err == io.EOF && n > 0 {
+				break
+			}
+			return n, err
+		}
+		dr.pending = utf8.AppendRune(dr.buf[:0], r)
+	}
+	return n, nil
+}
+
+// Size returns the number of bytes read from the file, before any
+// decompression.
+func (dr *decodingReader) Size() int64 {
+	if tracker, ok := dr.source.(sizeTracker); ok {
+		return tracker.Size()
+	}
+	return dr.counted.Size()
+}
+
+func (dr *decodingReader) Close() error {
+	return dr.source.Close()
+}
+
+func (dr *decodingReader) decodeLatin1() (rune, error) {
+	b, err := dr.in.ReadByte()
+	return rune(b), err
+}
+
+func (dr *decodingReader) decodeWindows1252() (rune, error) {
+	b, err := dr.in.ReadByte()
+	if b >= 0x80 && b <= 0x9F {
+		return windows1252Runes[b-0x80], err
+	}
+	return rune(b), err
+}
+
+// decodeUTF16 decodes a character of one or two UTF-16 code units. An
+// unpaired surrogate is decoded to U+FFFD.
+func (dr *decodingReader) decodeUTF16(order binary.ByteOrder) (rune, error) {
+	r1, err := dr.readUTF16Unit(order)
+	if err != nil || !utf16.IsSurrogate(r1) {
+		return r1, err
+	}
+	next, err := dr.in.Peek(2)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if len(next) < 2 {
+		return utf8.RuneError, nil
+	}
+	r := utf16.DecodeRune(r1, rune(order.Uint16(next)))
+	if r != utf8.RuneError {
+		// the second unit completes the pair
+		if _, err = dr.in.Discard(2); err != nil {
+			return 0, err
+		}
+	}
+	return r, nil
+}
+
+func (dr *decodingReader) readUTF16Unit(order binary.ByteOrder) (rune, error) {
+	var unit [2]byte
+	if _, err := io.ReadFull(dr.in, unit[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("input ends in the middle of a UTF-16 character")
+		}
+		return 0, err
+	}
+	return rune(order.Uint16(unit[:])), nil
+}
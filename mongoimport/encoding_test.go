@@ -0,0 +1,121 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// encodeUTF16 encodes s to UTF-16 with a byte order mark.
+func encodeUTF16(s string, bigEndian bool) []byte {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune("\uFEFF" + s)) {
+		if bigEndian {
+			out = append(out, byte(unit>>8), byte(unit))
+		} else {
+			out = append(out, byte(unit), byte(unit>>8))
+		}
+	}
+	return out
+}
+
+func TestDecodingReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	const text = "name;note\nZoë;“€5” – naïve 𝄞\n"
+	tests := []struct {
+		encoding string
+		input    []byte
+		expected string
+	}{
+		{encodingUTF8, []byte(text), text},
+		{encodingLatin1, []byte("Zo\xEB na\xEFve \x80"), "Zoë naïve \u0080"},
+		{encodingWindows1252, []byte("\x93\x805\x94 \x96 Zo\xEB \x81"), "“€5” – Zoë \u0081"},
+		{encodingUTF16LE, encodeUTF16(text, false), "\uFEFF" + text},
+		{encodingUTF16BE, encodeUTF16(text, true), "\uFEFF" + text},
+		// an unpaired surrogate
+		{encodingUTF16LE, []byte{0x3D, 0xD8, 'a', 0}, "�a"},
+	}
+	for _, test := range tests {
+		t.Run(test.encoding, func(t *testing.T) {
+			source := io.NopCloser(bytes.NewReader(test.input))
+			decoded, err := newDecodingReader(source, test.encoding)
+			require.NoError(t, err)
+			// read a byte at a time, so that characters are split across reads
+			out, err := io.ReadAll(oneByteReader{decoded})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(out))
+			if tracker, ok := decoded.(sizeTracker); ok {
+				assert.EqualValues(t, len(test.input), tracker.Size())
+			}
+		})
+	}
+
+	decoded, err := newDecodingReader(io.NopCloser(bytes.NewReader([]byte{'a', 0, 'b'})), encodingUTF16LE)
+	require.NoError(t, err)
+	_, err = io.ReadAll(decoded)
+	assert.EqualError(t, err, "input ends in the middle of a UTF-16 character")
+
+	_, err = newDecodingReader(io.NopCloser(bytes.NewReader(nil)), "ebcdic")
+	assert.EqualError(t, err, "unknown encoding 'ebcdic'")
+}
+
+// oneByteReader reads a byte at a time.
+type oneByteReader struct {
+	io.Reader
+}
+
+func (r oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return r.Reader.Read(p[:1])
+}
+
+func TestImportEncodedFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	file := filepath.Join(t.TempDir(), "partner.csv")
+	require.NoError(t, os.WriteFile(file, encodeUTF16("name;city\nZoë;Zürich\n", false), 0644))
+
+	imp := NewMockMongoImport()
+	imp.InputOptions.Type = CSV
+	imp.InputOptions.HeaderLine = true
+	imp.InputOptions.Delimiter = ";"
+	imp.InputOptions.Encoding = "UTF-16LE"
+	require.NoError(t, imp.validateSettings())
+	source, size, err := imp.getSourceReader(file)
+	require.NoError(t, err)
+	defer source.Close()
+	r, err := imp.getInputReader("", source)
+	require.NoError(t, err)
+	require.NoError(t, r.ReadAndValidateHeader())
+	docs, err := streamAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []bson.D{{{"name", "Zoë"}, {"city", "Zürich"}}}, docs)
+	// progress is tracked against the size of the file
+	assert.Equal(t, size, newFileSizeProgressor(size, source, r).Size())
+
+	imp = NewMockMongoImport()
+	imp.InputOptions.Encoding = "ebcdic"
+	assert.EqualError(t, imp.validateSettings(), "unknown encoding ebcdic")
+
+	imp = NewMockMongoImport()
+	imp.InputOptions.Type = Parquet
+	imp.InputOptions.Encoding = encodingLatin1
+	assert.EqualError(t, imp.validateSettings(), "cannot use --encoding when input type is Parquet")
+}
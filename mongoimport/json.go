@@ -7,10 +7,12 @@
 package mongoimport
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/json"
@@ -52,6 +54,15 @@ type JSONInputReader struct {
 
 	// legacyExtJSON specifies whether or not the legacy extended JSON format should be used.
 	legacyExtJSON bool
+
+	// line is the number of newlines read so far
+	line uint64
+
+	// rejects is where rejected records are written with --rejectsFile
+	rejects *RejectsWriter
+
+	// resume records how far the import has got with --resume
+	resume *ResumeTracker
 }
 
 // JSONConverter implements the Converter interface for JSON input.
@@ -59,6 +70,9 @@ type JSONConverter struct {
 	data          []byte
 	index         uint64
 	legacyExtJSON bool
+	record        inputRecord
+	rejects       *RejectsWriter
+	resume        *ResumeTracker
 }
 
 var (
@@ -103,6 +117,23 @@ func (r *JSONInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) erro
 	return nil
 }
 
+// resumeAt makes the reader read from source at the given position, as
+// recorded by --resume. JSON arrays can't be resumed.
+func (r *JSONInputReader) resumeAt(source io.Reader, pos resumePosition) error {
+	if r.isArray {
+		return fmt.Errorf("cannot resume the import of a JSON array")
+	}
+	szCount := newSizeTrackingReader(newBomDiscardingReader(source))
+	if err := szCount.seek(pos.Offset); err != nil {
+		return fmt.Errorf("error seeking to byte %v of the input: %v", pos.Offset, err)
+	}
+	r.sizeTracker = szCount
+	r.decoder = json.NewDecoder(szCount)
+	r.line = pos.Line
+	r.numProcessed = pos.Records
+	return nil
+}
+
 // StreamDocument takes a boolean indicating if the documents should be streamed
 // in read order and a channel on which to stream the documents processed from
 // the underlying reader. Returns a non-nil error if encountered.
@@ -137,10 +168,22 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 				}
 				return
 			}
+			record := inputRecord{index: r.numProcessed}
+			if r.rejects != nil {
+				text := bytes.TrimLeftFunc(rawBytes, unicode.IsSpace)
+				record.line = r.line + 1 + uint64(bytes.Count(rawBytes[:len(rawBytes)-len(text)], []byte{'\n'}))
+				record.data = string(bytes.TrimRightFunc(text, unicode.IsSpace))
+			}
+			r.line += uint64(bytes.Count(rawBytes, []byte{'\n'}))
+			// the decoder buffers input beyond the document
+			record.end = resumePosition{r.Size() - int64(len(r.decoder.Buf)), r.line, r.numProcessed + 1}
 			rawChan <- JSONConverter{
 				data:          rawBytes,
 				index:         r.numProcessed,
 				legacyExtJSON: r.legacyExtJSON,
+				record:        record,
+				rejects:       r.rejects,
+				resume:        r.resume,
 			}
 			r.numProcessed++
 		}
@@ -157,15 +200,22 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 // Convert implements the Converter interface for JSON input. It converts a
 // JSONConverter struct to a BSON document.
 func (c JSONConverter) Convert() (bson.D, error) {
+	var doc bson.D
+	var err error
 	if c.legacyExtJSON {
-		return c.convertLegacyExtJSON()
+		doc, err = c.convertLegacyExtJSON()
+	} else {
+		err = bson.UnmarshalExtJSON(c.data, false, &doc)
 	}
-
-	var doc bson.D
-	if err := bson.UnmarshalExtJSON(c.data, false, &doc); err != nil {
+	if err != nil {
+		if rejectErr := c.rejects.reject(c.record, rejectStageParse, err); rejectErr != nil {
+			return nil, rejectErr
+		}
 		return nil, err
 	}
 
+	c.rejects.track(doc, c.record)
+	c.resume.track(doc, c.record)
 	return doc, nil
 }
 
@@ -218,6 +268,9 @@ func (r *JSONInputReader) readJSONArraySeparator() error {
 			return err
 		}
 		readByte = r.bytesFromReader[0]
+		if readByte == '\n' {
+			r.line++
+		}
 
 		if readByte == json.ArrayEnd {
 			// if we read the end of the JSON array, ensure we have no other
@@ -29,8 +29,6 @@ func main() {
 		os.Exit(util.ExitFailure)
 	}
 
-	signals.Handle()
-
 	// print help, if specified
 	if opts.PrintHelp(false) {
 		return
@@ -48,12 +46,22 @@ func main() {
 	}
 	defer m.Close()
 
+	finishedChan := signals.HandleWithInterrupt(m.HandleInterrupt)
+	defer close(finishedChan)
+
 	numDocs, numFailure, err := m.ImportDocuments()
 	if !opts.Quiet {
 		if err != nil {
 			log.Logvf(log.Always, "Failed: %v", err)
 		}
-		if m.ToolOptions.WriteConcern.Acknowledged() {
+		if opts.DryRun {
+			log.Logvf(
+				log.Always,
+				"dry run: %v document(s) would be imported. %v document(s) would fail to import.",
+				numDocs,
+				numFailure,
+			)
+		} else if m.ToolOptions.WriteConcern.Acknowledged() {
 			if opts.Mode == "delete" {
 				log.Logvf(
 					log.Always,
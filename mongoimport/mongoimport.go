@@ -4,10 +4,11 @@
 // not use this file except in compliance with the License. You may obtain
 // a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
 
-// Package mongoimport allows importing content from a JSON, CSV, or TSV into a MongoDB instance.
+// Package mongoimport allows importing content from a JSON, CSV, TSV, Parquet or BSON file into a MongoDB instance.
 package mongoimport
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -21,6 +22,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -29,9 +31,11 @@ import (
 
 // Input format types accepted by mongoimport.
 const (
-	CSV  = "csv"
-	TSV  = "tsv"
-	JSON = "json"
+	CSV     = "csv"
+	TSV     = "tsv"
+	JSON    = "json"
+	Parquet = "parquet"
+	BSON    = "bson"
 )
 
 // Modes accepted by mongoimport.
@@ -78,6 +82,30 @@ type MongoImport struct {
 	// fields to use for upsert operations
 	upsertFields []string
 
+	// rejects is where input records that can't be imported are written
+	// with --rejectsFile
+	rejects *RejectsWriter
+
+	// schema types the CSV and TSV columns with --schemaFile
+	schema *ColumnSchema
+
+	// dialect describes how the records of CSV and TSV input are written
+	dialect csvDialect
+
+	// transformer reshapes documents before they're written with --transform
+	transformer *Transformer
+
+	// resume records how far the import has got with --resume
+	resume *ResumeTracker
+
+	// dryRun tallies the problems found in the input with --dryRun, which
+	// checks the documents instead of writing them
+	dryRun *DryRunReport
+
+	// progressManager shows the progress of each file when importing
+	// several files
+	progressManager *progress.BarWriter
+
 	// type of node the SessionProvider is connected to
 	nodeType db.NodeType
 }
@@ -113,6 +141,10 @@ func New(opts Options) (*MongoImport, error) {
 	if err := mi.validateSettings(); err != nil {
 		return nil, fmt.Errorf("error validating settings: %v", err)
 	}
+	if mi.IngestOptions.DryRun && !mi.IngestOptions.CheckValidator {
+		// nothing is read from the server
+		return mi, nil
+	}
 
 	sessionProvider, err := db.NewSessionProvider(*opts.ToolOptions)
 	if err != nil {
@@ -125,7 +157,16 @@ func New(opts Options) (*MongoImport, error) {
 
 // Close disconnects the server.
 func (imp *MongoImport) Close() {
-	imp.SessionProvider.Close()
+	if imp.SessionProvider != nil {
+		imp.SessionProvider.Close()
+	}
+}
+
+// HandleInterrupt stops the import on the first termination signal. The
+// documents already acknowledged by the server are recorded in the resume
+// file, if any, before ImportDocuments returns.
+func (imp *MongoImport) HandleInterrupt() {
+	imp.Kill(util.ErrTerminated)
 }
 
 // validateSettings ensures that the tool specific options supplied for
@@ -147,7 +188,9 @@ func (imp *MongoImport) validateSettings() error {
 	} else {
 		if !(imp.InputOptions.Type == TSV ||
 			imp.InputOptions.Type == JSON ||
-			imp.InputOptions.Type == CSV) {
+			imp.InputOptions.Type == CSV ||
+			imp.InputOptions.Type == Parquet ||
+			imp.InputOptions.Type == BSON) {
 			return fmt.Errorf("unknown type %v", imp.InputOptions.Type)
 		}
 	}
@@ -185,25 +228,107 @@ func (imp *MongoImport) validateSettings() error {
 		if imp.InputOptions.Legacy {
 			return fmt.Errorf("cannot use --legacy if input type is not JSON")
 		}
+		if imp.InputOptions.SchemaFile != "" {
+			if imp.InputOptions.ColumnsHaveTypes {
+				return fmt.Errorf("incompatible options: --schemaFile and --columnsHaveTypes")
+			}
+			schema, err := LoadColumnSchema(
+				imp.InputOptions.SchemaFile,
+				ParsePG(imp.InputOptions.ParseGrace),
+			)
+			if err != nil {
+				return err
+			}
+			imp.schema = schema
+		}
+		if imp.InputOptions.Type == TSV {
+			if imp.InputOptions.Delimiter != "" {
+				return fmt.Errorf("cannot use --delimiter when input type is TSV")
+			}
+			if imp.InputOptions.Quote != "" {
+				return fmt.Errorf("cannot use --quote when input type is TSV")
+			}
+			if imp.InputOptions.Escape != "" {
+				return fmt.Errorf("cannot use --escape when input type is TSV")
+			}
+		}
+		if imp.dialect, err = parseCSVDialect(imp.InputOptions); err != nil {
+			return err
+		}
 	} else {
-		// input type is JSON
+		// input type is JSON, Parquet or BSON, whose documents have their own fields
+		inputType := "JSON"
+		switch imp.InputOptions.Type {
+		case Parquet:
+			inputType = "Parquet"
+		case BSON:
+			inputType = "BSON"
+		}
+		if imp.InputOptions.Type != JSON {
+			if imp.InputOptions.JSONArray {
+				return fmt.Errorf("cannot use --jsonArray when input type is %v", inputType)
+			}
+			if imp.InputOptions.Legacy {
+				return fmt.Errorf("cannot use --legacy when input type is %v", inputType)
+			}
+			if imp.InputOptions.Encoding != "" {
+				return fmt.Errorf("cannot use --encoding when input type is %v", inputType)
+			}
+		}
 		if imp.InputOptions.HeaderLine {
-			return fmt.Errorf("cannot use --headerline when input type is JSON")
+			return fmt.Errorf("cannot use --headerline when input type is %v", inputType)
 		}
 		if imp.InputOptions.Fields != nil {
-			return fmt.Errorf("cannot use --fields when input type is JSON")
+			return fmt.Errorf("cannot use --fields when input type is %v", inputType)
 		}
 		if imp.InputOptions.FieldFile != nil {
-			return fmt.Errorf("cannot use --fieldFile when input type is JSON")
+			return fmt.Errorf("cannot use --fieldFile when input type is %v", inputType)
 		}
-		if imp.IngestOptions.IgnoreBlanks {
-			return fmt.Errorf("cannot use --ignoreBlanks when input type is JSON")
+		// BSON fields can be empty strings, which --ignoreBlanks removes
+		if imp.IngestOptions.IgnoreBlanks && imp.InputOptions.Type != BSON {
+			return fmt.Errorf("cannot use --ignoreBlanks when input type is %v", inputType)
 		}
 		if imp.InputOptions.ColumnsHaveTypes {
-			return fmt.Errorf("cannot use --columnsHaveTypes when input type is JSON")
+			return fmt.Errorf("cannot use --columnsHaveTypes when input type is %v", inputType)
+		}
+		if imp.InputOptions.SchemaFile != "" {
+			return fmt.Errorf("cannot use --schemaFile when input type is %v", inputType)
+		}
+		if imp.InputOptions.Delimiter != "" {
+			return fmt.Errorf("cannot use --delimiter when input type is %v", inputType)
+		}
+		if imp.InputOptions.Quote != "" {
+			return fmt.Errorf("cannot use --quote when input type is %v", inputType)
+		}
+		if imp.InputOptions.Escape != "" {
+			return fmt.Errorf("cannot use --escape when input type is %v", inputType)
+		}
+		if imp.InputOptions.CommentPrefix != "" {
+			return fmt.Errorf("cannot use --commentPrefix when input type is %v", inputType)
+		}
+		if imp.InputOptions.SkipLines != 0 {
+			return fmt.Errorf("cannot use --skipLines when input type is %v", inputType)
 		}
 	}
 
+	if imp.InputOptions.ArchiveNamespace != "" {
+		if imp.InputOptions.Type != BSON {
+			return fmt.Errorf("cannot use --archiveNamespace when input type is not BSON")
+		}
+		dbName, collName := util.SplitNamespace(imp.InputOptions.ArchiveNamespace)
+		if dbName == "" || collName == "" {
+			return fmt.Errorf("invalid --archiveNamespace '%v': must be <database>.<collection>",
+				imp.InputOptions.ArchiveNamespace)
+		}
+	}
+
+	imp.InputOptions.Encoding = strings.ToLower(imp.InputOptions.Encoding)
+	switch imp.InputOptions.Encoding {
+	case "", encodingUTF8, encodingLatin1, encodingWindows1252, encodingUTF16LE, encodingUTF16BE:
+	default:
+		return fmt.Errorf("unknown encoding %v", imp.InputOptions.Encoding)
+	}
+
 	// deprecated
 	if imp.IngestOptions.Upsert == true {
 		imp.IngestOptions.Mode = modeUpsert
@@ -245,6 +370,7 @@ func (imp *MongoImport) validateSettings() error {
 	if imp.IngestOptions.MaintainInsertionOrder {
 		imp.IngestOptions.StopOnError = true
 		imp.IngestOptions.NumInsertionWorkers = 1
+		imp.InputOptions.NumReaders = 1
 	} else {
 		// set the number of decoding workers to use for imports
 		if imp.IngestOptions.NumDecodingWorkers <= 0 {
@@ -254,9 +380,57 @@ func (imp *MongoImport) validateSettings() error {
 		if imp.IngestOptions.NumInsertionWorkers <= 0 {
 			imp.IngestOptions.NumInsertionWorkers = 1
 		}
+		// set the number of files to read concurrently
+		if imp.InputOptions.NumReaders <= 0 {
+			imp.InputOptions.NumReaders = 1
+		}
 	}
 	log.Logvf(log.DebugLow, "using %v decoding workers", imp.IngestOptions.NumDecodingWorkers)
 	log.Logvf(log.DebugLow, "using %v insert workers", imp.IngestOptions.NumInsertionWorkers)
+	log.Logvf(log.DebugLow, "using %v file readers", imp.InputOptions.NumReaders)
+
+	// expand glob patterns into the files they match
+	if imp.InputOptions.File != "" {
+		imp.InputOptions.Files = append([]string{imp.InputOptions.File}, imp.InputOptions.Files...)
+	}
+	imp.InputOptions.Files, err = expandFiles(imp.InputOptions.Files)
+	if err != nil {
+		return err
+	}
+
+	if imp.IngestOptions.Resume {
+		if len(imp.InputOptions.Files) != 1 {
+			return fmt.Errorf("--resume needs a single input file")
+		}
+		if imp.InputOptions.Type == Parquet {
+			return fmt.Errorf("cannot use --resume when input type is Parquet")
+		}
+		if imp.InputOptions.Type == BSON {
+			return fmt.Errorf("cannot use --resume when input type is BSON")
+		}
+		if imp.InputOptions.JSONArray {
+			return fmt.Errorf("incompatible options: --resume and --jsonArray")
+		}
+		if imp.IngestOptions.DryRun {
+			return fmt.Errorf("incompatible options: --resume and --dryRun")
+		}
+	}
+
+	if imp.IngestOptions.CheckValidator && !imp.IngestOptions.DryRun {
+		return fmt.Errorf("cannot use --checkValidator without --dryRun")
+	}
+	if imp.IngestOptions.DryRun {
+		// duplicate _ids only fail inserts; the other modes write over them
+		imp.dryRun = NewDryRunReport(imp.IngestOptions.Mode == modeInsert)
+	}
+
+	// load the rules that reshape documents before they're written
+	if imp.IngestOptions.Transform != "" {
+		imp.transformer, err = LoadTransformer(imp.IngestOptions.Transform)
+		if err != nil {
+			return err
+		}
+	}
 
 	// get the number of documents per batch
 	if imp.IngestOptions.BulkBufferSize <= 0 || imp.IngestOptions.BulkBufferSize > 1000 {
@@ -264,9 +438,16 @@ func (imp *MongoImport) validateSettings() error {
 	}
 
 	// ensure we have a valid string to use for the collection
-	if imp.ToolOptions.Collection == "" {
+	if imp.ToolOptions.Collection == "" && imp.InputOptions.ArchiveNamespace != "" {
+		_, collName := util.SplitNamespace(imp.InputOptions.ArchiveNamespace)
+		log.Logvf(log.Always, "using '%v' from the archive namespace as collection", collName)
+		imp.ToolOptions.Collection = collName
+	} else if imp.ToolOptions.Collection == "" {
 		log.Logvf(log.Always, "no collection specified")
-		fileBaseName := filepath.Base(imp.InputOptions.File)
+		var fileBaseName string
+		if len(imp.InputOptions.Files) > 0 {
+			fileBaseName = filepath.Base(trimCompressionExtension(imp.InputOptions.Files[0]))
+		}
 		lastDotIndex := strings.LastIndex(fileBaseName, ".")
 		if lastDotIndex != -1 {
 			fileBaseName = fileBaseName[0:lastDotIndex]
@@ -281,27 +462,73 @@ func (imp *MongoImport) validateSettings() error {
 	return nil
 }
 
-// getSourceReader returns an io.Reader to read from the input source. Also
-// returns a progress.Progressor which can be used to track progress if the
-// reader supports it.
-func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
-	if imp.InputOptions.File != "" {
-		file, err := os.Open(util.ToUniversalPath(imp.InputOptions.File))
+// expandFiles replaces the glob patterns among the given file names with the
+// files they match, in lexical order. A pattern that matches no files is an
+// error. Names without glob characters are kept as they are, and a file named
+// more than once is only imported once.
+func expandFiles(names []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	add := func(file string) {
+		if seen[file] {
+			log.Logvf(log.Info, "skipping %v: already listed", file)
+			return
+		}
+		seen[file] = true
+		files = append(files, file)
+	}
+	for _, name := range names {
+		if !strings.ContainsAny(name, "*?[") {
+			add(name)
+			continue
+		}
+		matches, err := filepath.Glob(util.ToUniversalPath(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern '%v': %v", name, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match '%v'", name)
+		}
+		for _, match := range matches {
+			add(match)
+		}
+	}
+	return files, nil
+}
+
+// getSourceReader returns an io.Reader to read the given file, or stdin if the
+// file name is empty. Compressed files are decompressed. Also returns the size
+// of the file, or 0 for stdin, which can be used to track progress.
+func (imp *MongoImport) getSourceReader(fileName string) (io.ReadCloser, int64, error) {
+	if fileName != "" {
+		file, err := os.Open(util.ToUniversalPath(fileName))
 		if err != nil {
 			return nil, -1, err
 		}
 		fileStat, err := file.Stat()
 		if err != nil {
+			file.Close()
 			return nil, -1, err
 		}
 		log.Logvf(log.Info, "filesize: %v bytes", fileStat.Size())
-		return file, fileStat.Size(), err
+		source, err := decompressFile(fileName, file)
+		if err != nil {
+			file.Close()
+			return nil, -1, err
+		}
+		decoded, err := newDecodingReader(source, imp.InputOptions.Encoding)
+		if err != nil {
+			source.Close()
+			return nil, -1, err
+		}
+		return decoded, fileStat.Size(), nil
 	}
 
 	log.Logvf(log.Info, "reading from stdin")
 
 	// Stdin has undefined max size, so return 0
-	return os.Stdin, 0, nil
+	decoded, err := newDecodingReader(os.Stdin, imp.InputOptions.Encoding)
+	return decoded, 0, err
 }
 
 // fileSizeProgressor implements Progressor to allow a sizeTracker to hook up with a
@@ -315,53 +542,350 @@ func (fsp *fileSizeProgressor) Progress() (int64, int64) {
 	return fsp.sizeTracker.Size(), fsp.max
 }
 
+// newFileSizeProgressor returns a fileSizeProgressor for an input file of the
+// given size. The bytes read from the file are counted by the source if it
+// decompresses the file, or else by the input reader.
+func newFileSizeProgressor(fileSize int64, source io.Reader, inputReader InputReader) *fileSizeProgressor {
+	if tracker, ok := source.(sizeTracker); ok {
+		return &fileSizeProgressor{fileSize, tracker}
+	}
+	return &fileSizeProgressor{fileSize, inputReader}
+}
+
+// fileReport holds the outcome of reading one input file.
+type fileReport struct {
+	name    string
+	numRead uint64
+	// done is set once every document of the file has been read
+	done bool
+	err  error
+}
+
+// status describes the outcome of reading the file. A file that isn't done
+// and didn't fail was interrupted by the end of the import, before or while
+// it was read.
+func (report *fileReport) status() string {
+	if report.err != nil {
+		return "failed"
+	} else if !report.done {
+		return "interrupted"
+	}
+	return "done"
+}
+
 // ImportDocuments is used to write input data to the database. It returns the
 // number of documents successfully imported to the appropriate namespace,
 // the number of failures, and any error encountered in doing this.
 func (imp *MongoImport) ImportDocuments() (uint64, uint64, error) {
-	source, fileSize, err := imp.getSourceReader()
-	if err != nil {
-		return 0, 0, err
+	if imp.IngestOptions.RejectsFile != "" {
+		rejectsFile, err := os.Create(imp.IngestOptions.RejectsFile)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error creating rejects file: %v", err)
+		}
+		defer rejectsFile.Close()
+		imp.rejects = NewRejectsWriter(rejectsFile)
+		defer func() {
+			log.Logvf(log.Always, "%v rejected record(s) written to %v",
+				imp.rejects.Count(), imp.IngestOptions.RejectsFile)
+		}()
 	}
-	defer source.Close()
+	if imp.dryRun != nil {
+		defer imp.dryRun.logReport()
+	}
+
+	files := imp.InputOptions.Files
+	if len(files) == 0 {
+		return imp.importFile("")
+	} else if len(files) == 1 {
+		return imp.importFile(files[0])
+	}
+
+	imp.progressManager = progress.NewBarWriter(log.Writer(0), 0, progressBarLength, true)
+	imp.progressManager.Start()
+	defer imp.progressManager.Stop()
 
-	inputReader, err := imp.getInputReader(source)
+	reports := make([]fileReport, len(files))
+	for i, file := range files {
+		reports[i].name = file
+	}
+	processedCount, failureCount, err := imp.importDocuments(func(readDocs chan bson.D) error {
+		return imp.readFiles(reports, readDocs)
+	})
+	logFileReports(reports)
+	return processedCount, failureCount, err
+}
+
+// importFile imports a single input file, or stdin if the file name is empty,
+// with a progress bar for the namespace. The file and its header are read
+// before connecting, so that bad input fails early.
+func (imp *MongoImport) importFile(fileName string) (uint64, uint64, error) {
+	source, fileSize, err := imp.getSourceReader(fileName)
 	if err != nil {
 		return 0, 0, err
 	}
+	defer func() {
+		source.Close()
+	}()
 
-	if imp.InputOptions.HeaderLine {
-		if imp.InputOptions.ColumnsHaveTypes {
-			err = inputReader.ReadAndValidateTypedHeader(ParsePG(imp.InputOptions.ParseGrace))
-		} else {
-			err = inputReader.ReadAndValidateHeader()
-		}
+	if imp.IngestOptions.Resume {
+		imp.resume, err = LoadResumeTracker(fileName+resumeFileSuffix, resumeState{
+			File:      fileName,
+			Size:      fileSize,
+			Type:      imp.InputOptions.Type,
+			Namespace: fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection),
+		})
 		if err != nil {
 			return 0, 0, err
 		}
 	}
 
+	inputReader, err := imp.getInputReader(fileName, source)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = imp.readHeader(inputReader); err != nil {
+		return 0, 0, err
+	}
+	if source, err = imp.resumeInput(fileName, source, inputReader); err != nil {
+		return 0, 0, err
+	}
+
 	bar := &progress.Bar{
 		Name:      fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection),
-		Watching:  &fileSizeProgressor{fileSize, inputReader},
+		Watching:  newFileSizeProgressor(fileSize, source, inputReader),
 		Writer:    log.Writer(0),
 		BarLength: progressBarLength,
 		IsBytes:   true,
 	}
 	bar.Start()
 	defer bar.Stop()
-	return imp.importDocuments(inputReader)
+	processedCount, failureCount, err := imp.importDocuments(func(readDocs chan bson.D) error {
+		return inputReader.StreamDocument(imp.IngestOptions.MaintainInsertionOrder, readDocs)
+	})
+	if resumeErr := imp.resume.finish(err); resumeErr != nil && err == nil {
+		err = resumeErr
+	}
+	return processedCount, failureCount, err
+}
+
+// resumeInput moves the input reader to the position recorded by --resume, if
+// the import is resumed, by reopening the input file from its start. It
+// returns the source the input reader now reads from.
+func (imp *MongoImport) resumeInput(
+	fileName string,
+	source io.ReadCloser,
+	inputReader InputReader,
+) (io.ReadCloser, error) {
+	pos := imp.resume.position()
+	if pos.Records == 0 {
+		return source, nil
+	}
+	if imp.IngestOptions.Drop {
+		return source, fmt.Errorf("cannot use --drop when resuming an import")
+	}
+	resumable, ok := inputReader.(resumableReader)
+	if !ok {
+		return source, fmt.Errorf("cannot resume the import of %v input", imp.InputOptions.Type)
+	}
+	resumed, _, err := imp.getSourceReader(fileName)
+	if err != nil {
+		return source, err
+	}
+	source.Close()
+	if err = resumable.resumeAt(resumed, pos); err != nil {
+		return resumed, err
+	}
+	log.Logvf(log.Always, "resuming the import of %v from line %v, after %v records",
+		fileName, pos.Line+1, pos.Records)
+	return resumed, nil
+}
+
+// readHeader reads the header line of the input if --headerline is set.
+// With --dryRun, the columns are then watched for coercion failures.
+func (imp *MongoImport) readHeader(inputReader InputReader) error {
+	if imp.InputOptions.HeaderLine {
+		var err error
+		if imp.InputOptions.ColumnsHaveTypes {
+			err = inputReader.ReadAndValidateTypedHeader(ParsePG(imp.InputOptions.ParseGrace))
+		} else {
+			err = inputReader.ReadAndValidateHeader()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	imp.dryRun.watchColumns(inputReader, &imp.failureCount)
+	return nil
+}
+
+// readFiles streams the documents of the files in reports to readDocs, reading
+// up to --numReaders files concurrently, and closes readDocs when all files
+// are read. The outcome of reading each file is recorded in its report.
+func (imp *MongoImport) readFiles(reports []fileReport, readDocs chan bson.D) error {
+	defer close(readDocs)
+
+	numReaders := imp.InputOptions.NumReaders
+	if numReaders <= 0 {
+		numReaders = 1
+	}
+	if numReaders > len(reports) {
+		numReaders = len(reports)
+	}
+
+	fileIndexes := make(chan int, len(reports))
+	for i := range reports {
+		fileIndexes <- i
+	}
+	close(fileIndexes)
+
+	errChan := make(chan error, numReaders)
+	for i := 0; i < numReaders; i++ {
+		go func() {
+			for index := range fileIndexes {
+				report := &reports[index]
+				report.err = imp.readFile(report, readDocs)
+				if report.err != nil {
+					err := fmt.Errorf("error reading %v: %v", report.name, report.err)
+					// stop the other readers and the insertion workers
+					imp.Kill(err)
+					errChan <- err
+					return
+				}
+			}
+			errChan <- nil
+		}()
+	}
+
+	// readDocs can only be closed once all readers are done
+	var firstErr error
+	for i := 0; i < numReaders; i++ {
+		if err := <-errChan; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// readFile streams the documents of one input file to readDocs, counting them
+// in its report. The progress of the file is shown while it's read. When the
+// import is killed, it stops without an error and the file isn't marked as
+// done, so it's reported as interrupted.
+func (imp *MongoImport) readFile(report *fileReport, readDocs chan bson.D) error {
+	source, fileSize, err := imp.getSourceReader(report.name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	inputReader, err := imp.getInputReader(report.name, source)
+	if err != nil {
+		return err
+	}
+	if err = imp.readHeader(inputReader); err != nil {
+		return err
+	}
+
+	imp.progressManager.Attach(report.name, newFileSizeProgressor(fileSize, source, inputReader))
+	defer imp.progressManager.Detach(report.name)
+
+	// each input reader closes its channel when it's done, so the documents
+	// of a file go through their own channel to the shared one
+	fileDocs := make(chan bson.D, workerBufferSize)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- inputReader.StreamDocument(imp.IngestOptions.MaintainInsertionOrder, fileDocs)
+	}()
+	var streamDone bool
+	for {
+		select {
+		case document, alive := <-fileDocs:
+			if !alive {
+				if !streamDone {
+					if err := <-streamErr; err != nil {
+						return err
+					}
+				}
+				report.done = true
+				return nil
+			}
+			select {
+			case readDocs <- document:
+				atomic.AddUint64(&report.numRead, 1)
+			case <-imp.Dying():
+				return nil
+			}
+		case err := <-streamErr:
+			if err != nil {
+				return err
+			}
+			// the last documents may still be in the channel
+			streamDone = true
+			streamErr = nil
+		case <-imp.Dying():
+			return nil
+		}
+	}
+}
+
+// logFileReports logs how many documents were read from each input file.
+func logFileReports(reports []fileReport) {
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("file", "documents", "status")
+	grid.EndRow()
+	for i := range reports {
+		report := &reports[i]
+		grid.WriteCells(report.name, fmt.Sprint(atomic.LoadUint64(&report.numRead)), report.status())
+		grid.EndRow()
+	}
+	buf := &bytes.Buffer{}
+	grid.Flush(buf)
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		log.Logv(log.Always, line)
+	}
 }
 
 // importDocuments is a helper to ImportDocuments and does all the ingestion
-// work by taking data from the inputReader source and writing it to the
-// appropriate namespace. It returns the number of documents successfully
-// imported to the appropriate namespace, the number of failures, and any error
-// encountered in doing this.
-func (imp *MongoImport) importDocuments(inputReader InputReader) (uint64, uint64, error) {
+// work by taking the documents streamed by stream and writing them to the
+// appropriate namespace. stream must close the channel it's given when it
+// succeeds. It returns the number of documents successfully imported to the
+// appropriate namespace, the number of failures, and any error encountered in
+// doing this. With --dryRun, the documents are checked instead of written.
+func (imp *MongoImport) importDocuments(stream func(chan bson.D) error) (uint64, uint64, error) {
+	if imp.dryRun == nil {
+		if err := imp.prepareCollection(); err != nil {
+			return 0, 0, err
+		}
+	} else if imp.IngestOptions.CheckValidator {
+		if err := imp.loadValidator(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	readDocs := make(chan bson.D, workerBufferSize)
+	processingErrChan := make(chan error)
+
+	// read and process from the input
+	go func() {
+		processingErrChan <- stream(readDocs)
+	}()
+
+	// insert documents into the target database
+	go func() {
+		processingErrChan <- imp.ingestDocuments(readDocs)
+	}()
+
+	e1 := channelQuorumError(processingErrChan)
+	processedCount := atomic.LoadUint64(&imp.processedCount)
+	failureCount := atomic.LoadUint64(&imp.failureCount)
+	return processedCount, failureCount, e1
+}
+
+// prepareCollection connects to the server and drops the collection if --drop
+// is set.
+func (imp *MongoImport) prepareCollection() error {
 	session, err := imp.SessionProvider.GetSession()
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
 
 	log.Logvf(
@@ -377,7 +901,7 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (uint64, uint64
 	// check if the server is a replica set, mongos, or standalone
 	imp.nodeType, err = imp.SessionProvider.GetNodeType()
 	if err != nil {
-		return 0, 0, fmt.Errorf("error checking connected node type: %v", err)
+		return fmt.Errorf("error checking connected node type: %v", err)
 	}
 	log.Logvf(log.Info, "connected to node type: %v", imp.nodeType)
 
@@ -389,28 +913,45 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (uint64, uint64
 		collection := session.Database(imp.ToolOptions.DB).
 			Collection(imp.ToolOptions.Collection)
 		if err := collection.Drop(context.TODO()); err != nil {
-			return 0, 0, err
+			return err
 		}
 	}
+	return nil
+}
 
-	readDocs := make(chan bson.D, workerBufferSize)
-	processingErrChan := make(chan error)
-	ordered := imp.IngestOptions.MaintainInsertionOrder
-
-	// read and process from the input reader
-	go func() {
-		processingErrChan <- inputReader.StreamDocument(ordered, readDocs)
-	}()
-
-	// insert documents into the target database
-	go func() {
-		processingErrChan <- imp.ingestDocuments(readDocs)
-	}()
-
-	e1 := channelQuorumError(processingErrChan)
-	processedCount := atomic.LoadUint64(&imp.processedCount)
-	failureCount := atomic.LoadUint64(&imp.failureCount)
-	return processedCount, failureCount, e1
+// loadValidator fetches the validator of the target collection for --dryRun
+// to check documents against.
+func (imp *MongoImport) loadValidator() error {
+	session, err := imp.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	collection := session.Database(imp.ToolOptions.DB).Collection(imp.ToolOptions.Collection)
+	info, err := db.GetCollectionInfo(collection)
+	if err != nil {
+		return fmt.Errorf("error reading the options of %v.%v: %v",
+			imp.ToolOptions.DB, imp.ToolOptions.Collection, err)
+	}
+	if info == nil {
+		log.Logvf(log.Always, "%v.%v does not exist, so it has no validator to check",
+			imp.ToolOptions.DB, imp.ToolOptions.Collection)
+		return nil
+	}
+	var validator bson.D
+	for _, elem := range info.Options {
+		if elem.Key == "validator" {
+			validator, _ = elem.Value.(bson.D)
+		}
+	}
+	imp.dryRun.validator, err = NewDocumentValidator(validator)
+	if err != nil {
+		return err
+	}
+	if imp.dryRun.validator == nil {
+		log.Logvf(log.Always, "%v.%v has no $jsonSchema validator to check",
+			imp.ToolOptions.DB, imp.ToolOptions.Collection)
+	}
+	return nil
 }
 
 // ingestDocuments accepts a channel from which it reads documents to be inserted
@@ -436,7 +977,12 @@ func (imp *MongoImport) ingestDocuments(readDocs chan bson.D) (retErr error) {
 		go func() {
 			defer wg.Done()
 			// only set the first insertion error and cause sibling goroutines to terminate immediately
-			err := imp.runInsertionWorker(readDocs)
+			var err error
+			if imp.dryRun != nil {
+				err = imp.runDryRunWorker(readDocs)
+			} else {
+				err = imp.runInsertionWorker(readDocs)
+			}
 			if err != nil && retErr == nil {
 				retErr = err
 				imp.Kill(err)
@@ -444,6 +990,10 @@ func (imp *MongoImport) ingestDocuments(readDocs chan bson.D) (retErr error) {
 		}()
 	}
 	wg.Wait()
+	if retErr == nil && !imp.Alive() {
+		// the workers stopped because the import was killed
+		retErr = imp.Err()
+	}
 	return
 }
 
@@ -461,11 +1011,16 @@ func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D) (err error) {
 		return fmt.Errorf("failed to fetch server version: %w", err)
 	}
 
+	ordered := imp.IngestOptions.MaintainInsertionOrder
 	inserter := db.NewUnorderedBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize, serverVersion).
 		SetBypassDocumentValidation(imp.IngestOptions.BypassDocumentValidation).
-		SetOrdered(imp.IngestOptions.MaintainInsertionOrder).
+		SetOrdered(ordered).
 		SetUpsert(true)
 
+	// buffered holds the documents queued in the inserter, in the order of
+	// their writes, so that failed writes can be matched to their input records
+	var buffered []bson.D
+
 readLoop:
 	for {
 		select {
@@ -473,8 +1028,39 @@ readLoop:
 			if !alive {
 				break readLoop
 			}
-			err := imp.importDocument(inserter, document)
-			if db.FilterError(imp.IngestOptions.StopOnError, err) != nil {
+			if imp.transformer != nil {
+				var ok bool
+				if document, ok, err = imp.transformDocument(document); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+			}
+			queued, result, err := imp.importDocument(inserter, document)
+			if queued && (imp.rejects != nil || imp.resume != nil) {
+				buffered = append(buffered, document)
+			}
+			fatalErr := db.FilterError(imp.IngestOptions.StopOnError, err)
+			if result != nil {
+				// the inserter was flushed
+				if rejectErr := imp.rejects.rejectWrites(buffered, err, ordered); rejectErr != nil {
+					return rejectErr
+				}
+				if resumeErr := imp.resume.written(buffered, fatalErr, ordered); resumeErr != nil {
+					return resumeErr
+				}
+				buffered = buffered[:0]
+			} else if err != nil {
+				rejectErr := imp.rejects.reject(imp.rejects.source(document), rejectStageWrite, err)
+				if rejectErr != nil {
+					return rejectErr
+				}
+				imp.resume.done(document, fatalErr == nil)
+			} else if !queued {
+				imp.rejects.forget(document)
+				imp.resume.done(document, true)
+			}
+			if fatalErr != nil {
 				return err
 			}
 		case <-imp.Dying():
@@ -483,7 +1069,37 @@ readLoop:
 	}
 	result, err := inserter.Flush()
 	imp.updateCounts(result, err)
-	return db.FilterError(imp.IngestOptions.StopOnError, err)
+	if rejectErr := imp.rejects.rejectWrites(buffered, err, ordered); rejectErr != nil {
+		return rejectErr
+	}
+	fatalErr := db.FilterError(imp.IngestOptions.StopOnError, err)
+	if resumeErr := imp.resume.written(buffered, fatalErr, ordered); resumeErr != nil {
+		return resumeErr
+	}
+	return fatalErr
+}
+
+// transformDocument reshapes a document with the --transform rules. A
+// document that can't be transformed is rejected, and is skipped by returning
+// false unless --stopOnError is set.
+func (imp *MongoImport) transformDocument(document bson.D) (bson.D, bool, error) {
+	transformed, err := imp.transformer.Transform(document)
+	if err != nil {
+		rejectErr := imp.rejects.reject(imp.rejects.source(document), rejectStageTransform, err)
+		if rejectErr != nil {
+			return nil, false, rejectErr
+		}
+		if imp.IngestOptions.StopOnError {
+			return nil, false, err
+		}
+		log.Logvf(log.Always, "skipping document: %v", err)
+		atomic.AddUint64(&imp.failureCount, 1)
+		imp.resume.done(document, true)
+		return nil, false, nil
+	}
+	imp.rejects.retrack(document, transformed)
+	imp.resume.retrack(document, transformed)
+	return transformed, true, nil
 }
 
 func (imp *MongoImport) updateCounts(result *mongo.BulkWriteResult, err error) {
@@ -506,10 +1122,14 @@ func (imp *MongoImport) updateCounts(result *mongo.BulkWriteResult, err error) {
 	}
 }
 
-func (imp *MongoImport) importDocument(inserter *db.BufferedBulkInserter, document bson.D) error {
-	var result *mongo.BulkWriteResult
-	var err error
-
+// importDocument queues the write of a document in the inserter for the
+// import mode. It returns whether a write was queued, and the result and error
+// of the bulk write if the inserter was flushed.
+func (imp *MongoImport) importDocument(
+	inserter *db.BufferedBulkInserter,
+	document bson.D,
+) (queued bool, result *mongo.BulkWriteResult, err error) {
+	queued = true
 	selector := constructUpsertDocument(imp.upsertFields, document)
 
 	if imp.IngestOptions.Mode == modeInsert {
@@ -530,17 +1150,24 @@ func (imp *MongoImport) importDocument(inserter *db.BufferedBulkInserter, docume
 	} else if imp.IngestOptions.Mode == modeDelete {
 		if selector == nil {
 			log.Logvf(log.Info, "Could not construct selector from %v, skipping document", imp.upsertFields)
+			queued = false
 		} else {
 			result, err = inserter.Delete(selector, document)
 		}
 	} else {
 		err = fmt.Errorf("Invalid mode: %v", imp.IngestOptions.Mode)
+		queued = false
+	}
+
+	if result == nil && err != nil {
+		// the write couldn't be queued, e.g. because the document couldn't be encoded
+		queued = false
 	}
 
 	// Update success and failure counts
 	imp.updateCounts(result, err)
 
-	return err
+	return queued, result, err
 }
 
 func (imp *MongoImport) fallbackToInsert(
@@ -577,7 +1204,8 @@ func splitInlineHeader(header string) (headers []string) {
 }
 
 // getInputReader returns an implementation of InputReader based on the input type.
-func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
+// The records rejected by the reader are attributed to the named file.
+func (imp *MongoImport) getInputReader(fileName string, in io.Reader) (InputReader, error) {
 	var colSpecs []ColumnSpec
 	var headers []string
 	var err error
@@ -595,7 +1223,10 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 			return nil, err
 		}
 	} else {
-		colSpecs = ParseAutoHeaders(headers)
+		colSpecs, err = imp.schema.ColumnSpecs(headers)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// header fields validation can only happen once we have an input reader
@@ -606,24 +1237,67 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 	}
 
 	out := os.Stdout
-
-	ignoreBlanks := imp.IngestOptions.IgnoreBlanks && imp.InputOptions.Type != JSON
+	rejects := imp.rejects.forFile(fileName)
+
+	ignoreBlanks := imp.IngestOptions.IgnoreBlanks && imp.InputOptions.Type != JSON && imp.InputOptions.Type != Parquet
+	if imp.InputOptions.Type == BSON {
+		var r *BSONInputReader
+		if imp.InputOptions.ArchiveNamespace != "" {
+			r, err = NewBSONArchiveInputReader(
+				in,
+				imp.InputOptions.ArchiveNamespace,
+				imp.IngestOptions.NumDecodingWorkers,
+				ignoreBlanks,
+			)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			r = NewBSONInputReader(in, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks)
+		}
+		r.rejects = rejects
+		return r, nil
+	}
 	if imp.InputOptions.Type == CSV {
-		return NewCSVInputReader(
+		r := NewCSVInputReader(
 			colSpecs,
 			in,
 			out,
 			imp.IngestOptions.NumDecodingWorkers,
 			ignoreBlanks,
 			imp.InputOptions.UseArrayIndexFields,
-		), nil
+		)
+		r.rejects = rejects
+		r.schema = imp.schema
+		r.resume = imp.resume
+		if err = r.applyDialect(imp.dialect); err != nil {
+			return nil, err
+		}
+		return r, nil
 	} else if imp.InputOptions.Type == TSV {
-		return NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields), nil
+		r := NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields)
+		r.rejects = rejects
+		r.schema = imp.schema
+		r.resume = imp.resume
+		if err = r.applyDialect(imp.dialect); err != nil {
+			return nil, err
+		}
+		return r, nil
+	} else if imp.InputOptions.Type == Parquet {
+		r, err := NewParquetInputReader(in, imp.IngestOptions.NumDecodingWorkers)
+		if err != nil {
+			return nil, err
+		}
+		r.rejects = rejects
+		return r, nil
 	}
-	return NewJSONInputReader(
+	r := NewJSONInputReader(
 		imp.InputOptions.JSONArray,
 		imp.InputOptions.Legacy,
 		in,
 		imp.IngestOptions.NumDecodingWorkers,
-	), nil
+	)
+	r.rejects = rejects
+	r.resume = imp.resume
+	return r, nil
 }
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/testtype"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -237,7 +239,7 @@ func TestMongoImportValidateSettings(t *testing.T) {
 
 		Convey("no error should be thrown if --file is used with one positional argument", func() {
 			imp := NewMockMongoImport()
-			imp.InputOptions.File = "abc"
+			imp.InputOptions.Files = []string{"abc"}
 			So(imp.validateSettings(), ShouldBeNil)
 		})
 
@@ -396,19 +398,19 @@ func TestMongoImportValidateSettings(t *testing.T) {
 		Convey("no error should be thrown if --file is used (without -c) supplied "+
 			"- the file name should be used as the collection name", func() {
 			imp := NewMockMongoImport()
-			imp.InputOptions.File = "input"
+			imp.InputOptions.Files = []string{"input"}
 			imp.InputOptions.HeaderLine = true
 			imp.InputOptions.Type = CSV
 			imp.ToolOptions.Namespace.Collection = ""
 			So(imp.validateSettings(), ShouldBeNil)
 			So(imp.ToolOptions.Namespace.Collection, ShouldEqual,
-				imp.InputOptions.File)
+				imp.InputOptions.Files[0])
 		})
 
 		Convey("with no collection name and a file name the base name of the "+
 			"file (without the extension) should be used as the collection name", func() {
 			imp := NewMockMongoImport()
-			imp.InputOptions.File = "/path/to/input/file/dot/input.txt"
+			imp.InputOptions.Files = []string{"/path/to/input/file/dot/input.txt"}
 			imp.InputOptions.HeaderLine = true
 			imp.InputOptions.Type = CSV
 			imp.ToolOptions.Namespace.Collection = ""
@@ -416,6 +418,15 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(imp.ToolOptions.Namespace.Collection, ShouldEqual, "input")
 		})
 
+		Convey("the compression extension of the file name should not be part "+
+			"of the collection name", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Files = []string{"/path/to/input.json.gz"}
+			imp.ToolOptions.Namespace.Collection = ""
+			So(imp.validateSettings(), ShouldBeNil)
+			So(imp.ToolOptions.Namespace.Collection, ShouldEqual, "input")
+		})
+
 		Convey(
 			"error should be thrown if --legacy is specified and input type is not JSON",
 			func() {
@@ -427,6 +438,25 @@ func TestMongoImportValidateSettings(t *testing.T) {
 				So(imp.validateSettings(), ShouldNotBeNil)
 			},
 		)
+
+		Convey("no error should be thrown for a plain parquet import", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Type = "Parquet"
+			So(imp.validateSettings(), ShouldBeNil)
+			So(imp.InputOptions.Type, ShouldEqual, Parquet)
+		})
+
+		Convey("an error should be thrown if --jsonArray or --headerline is used "+
+			"with a parquet import", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Type = Parquet
+			imp.InputOptions.JSONArray = true
+			So(imp.validateSettings(), ShouldNotBeNil)
+			imp = NewMockMongoImport()
+			imp.InputOptions.Type = Parquet
+			imp.InputOptions.HeaderLine = true
+			So(imp.validateSettings(), ShouldNotBeNil)
+		})
 	})
 }
 
@@ -437,30 +467,117 @@ func TestGetSourceReader(t *testing.T) {
 			Convey("an error should be thrown if the given file referenced by "+
 				"the reader does not exist", func() {
 				imp := NewMockMongoImport()
-				imp.InputOptions.File = "/path/to/input/file/dot/input.txt"
 				imp.InputOptions.Type = CSV
 				imp.ToolOptions.Namespace.Collection = ""
-				_, _, err := imp.getSourceReader()
+				_, _, err := imp.getSourceReader("/path/to/input/file/dot/input.txt")
 				So(err, ShouldNotBeNil)
 			})
 
 			Convey("no error should be thrown if the file exists", func() {
 				imp := NewMockMongoImport()
-				imp.InputOptions.File = "testdata/test_array.json"
 				imp.InputOptions.Type = JSON
-				_, _, err := imp.getSourceReader()
+				_, _, err := imp.getSourceReader("testdata/test_array.json")
 				So(err, ShouldBeNil)
 			})
 
 			Convey("no error should be thrown if stdin is used", func() {
 				imp := NewMockMongoImport()
-				imp.InputOptions.File = ""
-				_, _, err := imp.getSourceReader()
+				_, _, err := imp.getSourceReader("")
 				So(err, ShouldBeNil)
 			})
 		})
 }
 
+func TestReadFiles(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	Convey("Given several input files", t, func() {
+		dir := t.TempDir()
+		contents := map[string]string{
+			"part-1.csv": "a,b\n1,2\n3,4\n",
+			"part-2.csv": "b,a\n5,6\n",
+			"other.csv":  "c\n7\n",
+		}
+		for name, data := range contents {
+			So(os.WriteFile(filepath.Join(dir, name), []byte(data), 0644), ShouldBeNil)
+		}
+
+		Convey("glob patterns should be expanded in order", func() {
+			files, err := expandFiles([]string{
+				filepath.Join(dir, "part-*.csv"),
+				"plain.csv",
+				filepath.Join(dir, "part-2.csv"),
+			})
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []string{
+				filepath.Join(dir, "part-1.csv"),
+				filepath.Join(dir, "part-2.csv"),
+				"plain.csv",
+			})
+			_, err = expandFiles([]string{filepath.Join(dir, "missing-*.csv")})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("File should be imported before Files", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.File = filepath.Join(dir, "other.csv")
+			imp.InputOptions.Files = []string{filepath.Join(dir, "part-*.csv")}
+			So(imp.validateSettings(), ShouldBeNil)
+			So(imp.InputOptions.Files, ShouldResemble, []string{
+				filepath.Join(dir, "other.csv"),
+				filepath.Join(dir, "part-1.csv"),
+				filepath.Join(dir, "part-2.csv"),
+			})
+		})
+
+		Convey("each file should be read with its own header", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.NumReaders = 2
+			imp.progressManager = progress.NewBarWriter(io.Discard, 0, progressBarLength, true)
+			reports := []fileReport{
+				{name: filepath.Join(dir, "part-1.csv")},
+				{name: filepath.Join(dir, "part-2.csv")},
+				{name: filepath.Join(dir, "other.csv")},
+			}
+			readDocs := make(chan bson.D, 10)
+			So(imp.readFiles(reports, readDocs), ShouldBeNil)
+			var docs []bson.D
+			for doc := range readDocs {
+				docs = append(docs, doc)
+			}
+			So(docs, ShouldHaveLength, 4)
+			So(docs, ShouldContain, bson.D{{"a", int32(3)}, {"b", int32(4)}})
+			So(docs, ShouldContain, bson.D{{"b", int32(5)}, {"a", int32(6)}})
+			So(docs, ShouldContain, bson.D{{"c", int32(7)}})
+			So(reports[0].numRead, ShouldEqual, 2)
+			So(reports[1].numRead, ShouldEqual, 1)
+			So(reports[2].numRead, ShouldEqual, 1)
+			for _, report := range reports {
+				So(report.status(), ShouldEqual, "done")
+			}
+		})
+
+		Convey("a file that can't be read should stop the import", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.progressManager = progress.NewBarWriter(io.Discard, 0, progressBarLength, true)
+			reports := []fileReport{
+				{name: filepath.Join(dir, "missing.csv")},
+				{name: filepath.Join(dir, "other.csv")},
+			}
+			readDocs := make(chan bson.D, 10)
+			err := imp.readFiles(reports, readDocs)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "missing.csv")
+			So(reports[0].status(), ShouldEqual, "failed")
+			So(reports[1].numRead, ShouldEqual, 0)
+			So(reports[1].status(), ShouldEqual, "interrupted")
+		})
+	})
+}
+
 func TestGetInputReader(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
 	Convey("Given a io.Reader on calling getInputReader", t, func() {
@@ -468,33 +585,33 @@ func TestGetInputReader(t *testing.T) {
 			imp := NewMockMongoImport()
 			imp.InputOptions.Fields = new(string)
 			*imp.InputOptions.Fields = "foo.auto(),bar.date(January 2, 2006)"
-			imp.InputOptions.File = "/path/to/input/file/dot/input.txt"
+			imp.InputOptions.Files = []string{"/path/to/input/file/dot/input.txt"}
 			imp.InputOptions.ColumnsHaveTypes = true
-			_, err := imp.getInputReader(&os.File{})
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("should complain about non-escaped new lines in --fields", func() {
 			imp := NewMockMongoImport()
 			imp.InputOptions.Fields = new(string)
 			*imp.InputOptions.Fields = "foo.auto(),\nblah.binary(hex),bar.date(January 2, 2006)"
-			imp.InputOptions.File = "/path/to/input/file/dot/input.txt"
+			imp.InputOptions.Files = []string{"/path/to/input/file/dot/input.txt"}
 			imp.InputOptions.ColumnsHaveTypes = true
-			_, err := imp.getInputReader(&os.File{})
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("no error should be thrown if neither --fields nor --fieldFile "+
 			"is used", func() {
 			imp := NewMockMongoImport()
-			imp.InputOptions.File = "/path/to/input/file/dot/input.txt"
-			_, err := imp.getInputReader(&os.File{})
+			imp.InputOptions.Files = []string{"/path/to/input/file/dot/input.txt"}
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("no error should be thrown if --fields is used", func() {
 			imp := NewMockMongoImport()
 			fields := "a,b,c"
 			imp.InputOptions.Fields = &fields
-			imp.InputOptions.File = "/path/to/input/file/dot/input.txt"
-			_, err := imp.getInputReader(&os.File{})
+			imp.InputOptions.Files = []string{"/path/to/input/file/dot/input.txt"}
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("no error should be thrown if --fieldFile is used and it "+
@@ -502,7 +619,7 @@ func TestGetInputReader(t *testing.T) {
 			imp := NewMockMongoImport()
 			fieldFile := "testdata/test.csv"
 			imp.InputOptions.FieldFile = &fieldFile
-			_, err := imp.getInputReader(&os.File{})
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("an error should be thrown if --fieldFile is used and it "+
@@ -510,25 +627,25 @@ func TestGetInputReader(t *testing.T) {
 			imp := NewMockMongoImport()
 			fieldFile := "/path/to/input/file/dot/input.txt"
 			imp.InputOptions.FieldFile = &fieldFile
-			_, err := imp.getInputReader(&os.File{})
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldNotBeNil)
 		})
 		Convey("no error should be thrown for CSV import inputs", func() {
 			imp := NewMockMongoImport()
 			imp.InputOptions.Type = CSV
-			_, err := imp.getInputReader(&os.File{})
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("no error should be thrown for TSV import inputs", func() {
 			imp := NewMockMongoImport()
 			imp.InputOptions.Type = TSV
-			_, err := imp.getInputReader(&os.File{})
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("no error should be thrown for JSON import inputs", func() {
 			imp := NewMockMongoImport()
 			imp.InputOptions.Type = JSON
-			_, err := imp.getInputReader(&os.File{})
+			_, err := imp.getInputReader("", &os.File{})
 			So(err, ShouldBeNil)
 		})
 		Convey("an error should be thrown if --fieldFile fields are invalid", func() {
@@ -537,7 +654,7 @@ func TestGetInputReader(t *testing.T) {
 			imp.InputOptions.FieldFile = &fieldFile
 			file, err := os.Open(fieldFile)
 			So(err, ShouldBeNil)
-			_, err = imp.getInputReader(file)
+			_, err = imp.getInputReader("", file)
 			So(err, ShouldNotBeNil)
 		})
 		Convey("no error should be thrown if --fieldFile fields are valid", func() {
@@ -546,7 +663,7 @@ func TestGetInputReader(t *testing.T) {
 			imp.InputOptions.FieldFile = &fieldFile
 			file, err := os.Open(fieldFile)
 			So(err, ShouldBeNil)
-			_, err = imp.getInputReader(file)
+			_, err = imp.getInputReader("", file)
 			So(err, ShouldBeNil)
 		})
 	})
@@ -577,7 +694,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "a,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.WriteConcern = "majority"
@@ -591,7 +708,7 @@ func TestImportDocuments(t *testing.T) {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
-			imp.InputOptions.File = "testdata/test_array.json"
+			imp.InputOptions.Files = []string{"testdata/test_array.json"}
 			imp.IngestOptions.WriteConcern = "majority"
 			numProcessed, _, err := imp.ImportDocuments()
 			So(err, ShouldNotBeNil)
@@ -602,7 +719,7 @@ func TestImportDocuments(t *testing.T) {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
-			imp.InputOptions.File = "testdata/test_plain2.json"
+			imp.InputOptions.Files = []string{"testdata/test_plain2.json"}
 			imp.IngestOptions.WriteConcern = "majority"
 			numProcessed, numFailed, err := imp.ImportDocuments()
 			So(err, ShouldBeNil)
@@ -614,7 +731,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_blanks.csv"
+			imp.InputOptions.Files = []string{"testdata/test_blanks.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.IgnoreBlanks = true
@@ -635,7 +752,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_blanks.csv"
+			imp.InputOptions.Files = []string{"testdata/test_blanks.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			numProcessed, numFailed, err := imp.ImportDocuments()
@@ -654,7 +771,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.UpsertFields = "b,c"
@@ -676,7 +793,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.StopOnError = true
@@ -700,7 +817,7 @@ func TestImportDocuments(t *testing.T) {
 				So(err, ShouldBeNil)
 				imp.IngestOptions.Mode = modeInsert
 				imp.InputOptions.Type = CSV
-				imp.InputOptions.File = "testdata/test_duplicate.csv"
+				imp.InputOptions.Files = []string{"testdata/test_duplicate.csv"}
 				fields := "_id,b,c"
 				imp.InputOptions.Fields = &fields
 				imp.IngestOptions.StopOnError = false
@@ -724,7 +841,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.Drop = true
@@ -746,7 +863,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.InputOptions.HeaderLine = true
@@ -764,7 +881,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = csvFile.Name()
+			imp.InputOptions.Files = []string{csvFile.Name()}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.InputOptions.HeaderLine = true
@@ -778,7 +895,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,c,b"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.UpsertFields = "_id"
@@ -800,7 +917,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,c,b"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.MaintainInsertionOrder = true
@@ -814,7 +931,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_delete.csv"
+			imp.InputOptions.Files = []string{"testdata/test_delete.csv"}
 			fields = "_id,c,b"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.Mode = modeDelete
@@ -837,7 +954,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,c,b"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.MaintainInsertionOrder = true
@@ -851,7 +968,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_delete.csv"
+			imp.InputOptions.Files = []string{"testdata/test_delete.csv"}
 			fields = "_id,c,b"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.Mode = modeDelete
@@ -876,7 +993,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test.csv"
+			imp.InputOptions.Files = []string{"testdata/test.csv"}
 			fields := "_id,c,b"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.MaintainInsertionOrder = true
@@ -890,7 +1007,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_delete_with_blanks.csv"
+			imp.InputOptions.Files = []string{"testdata/test_delete_with_blanks.csv"}
 			fields = "_id,c,b"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.Mode = modeDelete
@@ -914,7 +1031,7 @@ func TestImportDocuments(t *testing.T) {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_duplicate.csv"
+			imp.InputOptions.Files = []string{"testdata/test_duplicate.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.Mode = modeUpsert
@@ -938,7 +1055,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_duplicate.csv"
+			imp.InputOptions.Files = []string{"testdata/test_duplicate.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.StopOnError = true
@@ -960,7 +1077,7 @@ func TestImportDocuments(t *testing.T) {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
-			imp.InputOptions.File = "testdata/test_array.json"
+			imp.InputOptions.Files = []string{"testdata/test_array.json"}
 			imp.IngestOptions.WriteConcern = "1"
 			numInserted, _, err := imp.ImportDocuments()
 			So(err, ShouldNotBeNil)
@@ -978,7 +1095,7 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			imp.IngestOptions.Mode = modeInsert
 			imp.InputOptions.Type = CSV
-			imp.InputOptions.File = "testdata/test_bad.csv"
+			imp.InputOptions.Files = []string{"testdata/test_bad.csv"}
 			fields := "_id,b,c"
 			imp.InputOptions.Fields = &fields
 			imp.IngestOptions.StopOnError = true
@@ -994,7 +1111,7 @@ func TestImportDocuments(t *testing.T) {
 				imp, err := NewMongoImport()
 				So(err, ShouldBeNil)
 				imp.InputOptions.Type = CSV
-				imp.InputOptions.File = "testdata/test_nested_upsert.csv"
+				imp.InputOptions.Files = []string{"testdata/test_nested_upsert.csv"}
 				imp.InputOptions.HeaderLine = true
 				imp.IngestOptions.Mode = modeUpsert
 				imp.upsertFields = []string{"level1.level2.key1"}
@@ -1010,7 +1127,7 @@ func TestImportDocuments(t *testing.T) {
 				imp, err = NewMongoImport()
 				So(err, ShouldBeNil)
 				imp.InputOptions.Type = CSV
-				imp.InputOptions.File = "testdata/test_nested_upsert.csv"
+				imp.InputOptions.Files = []string{"testdata/test_nested_upsert.csv"}
 				imp.InputOptions.HeaderLine = true
 				imp.IngestOptions.Mode = modeUpsert
 				imp.upsertFields = []string{"level1.level2.key1"}
@@ -1324,7 +1441,7 @@ func nestedFieldsTestHelper(data string, expectedDocuments []bson.M, expectedErr
 		So(err, ShouldBeNil)
 
 		imp.InputOptions.Type = CSV
-		imp.InputOptions.File = "./temp_test_data.csv"
+		imp.InputOptions.Files = []string{"./temp_test_data.csv"}
 		imp.InputOptions.HeaderLine = true
 		imp.InputOptions.UseArrayIndexFields = true
 		imp.IngestOptions.Mode = modeInsert
@@ -16,7 +16,8 @@ import (
 
 var Usage = `<options> <connection-string> <file> 
 
-Import CSV, TSV or JSON data into MongoDB. If no file is provided, mongoimport reads from stdin.
+Import CSV, TSV, JSON, Parquet or BSON data into MongoDB. If no file is provided, mongoimport reads from stdin.
+Several files can be imported in one run by repeating --file or with a glob pattern such as --file 'exports/*.json'.
 
 Connection strings must begin with mongodb:// or mongodb+srv://.
 
@@ -30,8 +31,15 @@ type InputOptions struct {
 	// FieldFile is a filename that refers to a list of fields to import, 1 per line.
 	FieldFile *string `long:"fieldFile" value-name:"<filename>" description:"file with field names - 1 per line"`
 
-	// Specifies the location and name of a file containing the data to import.
-	File string `long:"file" value-name:"<filename>" description:"file to import from; if not specified, stdin is used"`
+	// File is a file to import from, read before the files in Files. It
+	// isn't a command line option: --file sets Files.
+	File string `no-flag:"true"`
+
+	// Specifies the locations and names of files containing the data to import. Each may be a glob pattern.
+	Files []string `long:"file" value-name:"<filename>" description:"file to import from; may be repeated, or a glob pattern such as 'exports/*.json' (quoted so the shell doesn't expand it); gzip, zstd and bzip2 compressed files are decompressed; if not specified, stdin is used"`
+
+	// Sets the number of files to read concurrently.
+	NumReaders int `long:"numReaders" value-name:"<number>" default:"1" default-mask:"-" description:"number of input files to read concurrently (default: 1)"`
 
 	// Treats the input source's first line as field list (csv and tsv only).
 	HeaderLine bool `long:"headerline" description:"use first line in input source as the field list (CSV and TSV only)"`
@@ -42,11 +50,35 @@ type InputOptions struct {
 	// Indicates how to handle type coercion failures
 	ParseGrace string `long:"parseGrace" value-name:"<grace>" default:"stop" description:"controls behavior when type coercion fails - one of: autoCast, skipField, skipRow, stop"`
 
-	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files.
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, or tsv"`
+	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV, TSV, Parquet and BSON files.
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, tsv, parquet, or bson"`
+
+	// Selects the namespace of a mongodump archive to import with --type=bson.
+	ArchiveNamespace string `long:"archiveNamespace" value-name:"<database>.<collection>" description:"read the BSON input as a mongodump archive, and import the documents of this namespace from it (BSON only)"`
 
 	// Indicates that field names include type descriptions
-	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicates that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: auto, binary, boolean, date, date_go, date_ms, date_oracle, decimal, double, int32, int64, string. For each of the date types, the argument is a datetime layout string. For the binary type, the argument can be one of: base32, base64, hex. All other types take an empty argument. Only valid for CSV and TSV imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
+	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicates that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: array, auto, binary, boolean, date, date_epoch, date_go, date_ms, date_oracle, decimal, double, int32, int64, json, null, objectId, regex, string, timestamp, uuid; adding _null to a type, as in int32_null(), parses empty and null cells as null. For each of the date types, the argument is a datetime layout string; for date_epoch, it is s or ms. For the binary type, the argument can be one of: base32, base64, hex. For the array type, the argument is the element type and a separator, e.g. array(int32,;), which defaults to a comma. For the regex type, the argument holds the options of cells that aren't written as /<pattern>/<options>. The json type parses Extended JSON values and documents, and the timestamp type parses <seconds>[:<increment>]. All other types take an empty argument. Only valid for CSV and TSV imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
+
+	// Specifies a JSON Schema file that gives the types of CSV and TSV columns.
+	SchemaFile string `long:"schemaFile" value-name:"<filename>" description:"JSON Schema file giving the types of CSV and TSV columns: each column name is a dotted path to a property, whose bsonType (or type) and format set how it's parsed. The enum, minimum, maximum and pattern of properties are checked for each row, and values that fail them are handled according to --parseGrace. Only valid for CSV and TSV imports, and incompatible with --columnsHaveTypes"`
+
+	// Specifies the character that separates the fields of CSV input.
+	Delimiter string `long:"delimiter" value-name:"<char>" description:"character that separates the fields of CSV input, e.g. ';', or tab (default: ,)"`
+
+	// Specifies the character that quotes the fields of CSV input.
+	Quote string `long:"quote" value-name:"<char>" description:"character that quotes the fields of CSV input, e.g. \"'\" (default: \")"`
+
+	// Specifies the character that escapes the next character of CSV input.
+	Escape string `long:"escape" value-name:"<char>" description:"character that makes the next character part of a CSV field, even if it's a delimiter, a quote, or a newline, e.g. '\\'; by default, quotes in quoted fields are escaped by doubling them"`
+
+	// Specifies the prefix of the lines of CSV and TSV input that are ignored.
+	CommentPrefix string `long:"commentPrefix" value-name:"<prefix>" description:"ignore the lines of CSV and TSV input that start with this prefix, e.g. '#'"`
+
+	// Sets the number of lines to skip at the start of CSV and TSV input.
+	SkipLines int `long:"skipLines" value-name:"<number>" description:"number of lines to skip at the start of CSV and TSV input, before the header line, if any"`
+
+	// Specifies the character encoding of the input, which is decoded to UTF-8.
+	Encoding string `long:"encoding" value-name:"<encoding>" description:"character encoding of CSV, TSV and JSON input - one of: utf-8, latin1, windows-1252, utf-16le, utf-16be (default: utf-8)"`
 
 	// Indicates that the legacy extended JSON format should be used to parse JSON documents. Defaults to false.
 	Legacy bool `long:"legacy" description:"use the legacy extended JSON format"`
@@ -65,7 +97,7 @@ type IngestOptions struct {
 	Drop bool `long:"drop" description:"drop collection before inserting documents"`
 
 	// Ignores fields with empty values in CSV and TSV imports.
-	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV"`
+	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV, and fields that are empty strings in BSON"`
 
 	// Indicates that documents will be inserted in the order of their appearance in the input source.
 	MaintainInsertionOrder bool `long:"maintainInsertionOrder" description:"insert the documents in the order of their appearance in the input source. By default the insertions will be performed in an arbitrary order. Setting this flag also enables the behavior of --stopOnError and restricts NumInsertionWorkers to 1."`
@@ -76,6 +108,21 @@ type IngestOptions struct {
 	// Forces mongoimport to halt the import operation at the first insert or upsert error.
 	StopOnError bool `long:"stopOnError" description:"halt after encountering any error during importing. By default, mongoimport will attempt to continue through document validation and DuplicateKey errors, but with this option enabled, the tool will stop instead. A small number of documents may be inserted after encountering an error even with this option enabled; use --maintainInsertionOrder to halt immediately after an error"`
 
+	// Writes input records that couldn't be imported to a file, one JSON document per line.
+	RejectsFile string `long:"rejectsFile" value-name:"<filename>" description:"write every input record that could not be imported to this file, one JSON document per line with the input file, record number, source line, the stage that failed (parse, coercion, transform, validation, or write), the error, and the record as it was read"`
+
+	// Reshapes each document with the rules of a file before it's written.
+	Transform string `long:"transform" value-name:"<filename>" description:"reshape each document before it's written with the rules of this file, a JSON array of rules applied in order; each rule has an op of rename, unset, set, cast, split, join or template. Documents that can't be transformed are skipped unless --stopOnError is set"`
+
+	// Records how far the import has got, to continue from there if it fails.
+	Resume bool `long:"resume" description:"record how far the import of the input file has got in a file named after it with a .resume suffix, and continue from there with plain inserts if the import is run again after failing. The resume file is removed when the import finishes. Only valid for a single CSV, TSV or JSON input file, and not with --jsonArray"`
+
+	// Reads and checks the input without writing to or dropping the collection.
+	DryRun bool `long:"dryRun" description:"read and convert the input without writing anything, and report the number of documents that would be imported, the type coercion failures of each CSV or TSV column, duplicate _ids in the input, and documents over the 16MB limit"`
+
+	// Checks documents against the collection's validator during a dry run.
+	CheckValidator bool `long:"checkValidator" description:"with --dryRun, check each document against the $jsonSchema validator of the target collection, as far as it can be checked without the server"`
+
 	// Modify the import process.
 	// For existing documents (match --upsertFields) in the database:
 	// "insert": Insert only, skip existing documents.
@@ -149,19 +196,17 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 	}
 	opts.WriteConcern = wc
 
-	// ensure either a positional argument is supplied or an argument is passed
+	// ensure either a positional argument is supplied or arguments are passed
 	// to the --file flag - and not both
-	if inputOpts.File != "" && len(extraArgs) != 0 {
+	if len(inputOpts.Files) != 0 && len(extraArgs) != 0 {
 		return Options{}, fmt.Errorf(
 			"error parsing positional arguments: cannot use both --file and a positional argument to set the input file",
 		)
 	}
 
-	if inputOpts.File == "" {
-		if len(extraArgs) != 0 {
-			// if --file is not supplied, use the positional argument supplied
-			inputOpts.File = extraArgs[0]
-		}
+	if len(inputOpts.Files) == 0 && len(extraArgs) != 0 {
+		// if --file is not supplied, use the positional argument supplied
+		inputOpts.Files = extraArgs
 	}
 
 	return Options{
@@ -123,7 +123,7 @@ func TestPositionalArgumentParsing(t *testing.T) {
 						},
 					},
 					InputOptions: &InputOptions{
-						File: "foo",
+						Files: []string{"foo"},
 					},
 				},
 			},
@@ -147,7 +147,7 @@ func TestPositionalArgumentParsing(t *testing.T) {
 						},
 					},
 					InputOptions: &InputOptions{
-						File: "foo",
+						Files: []string{"foo"},
 					},
 				},
 			},
@@ -160,7 +160,7 @@ func TestPositionalArgumentParsing(t *testing.T) {
 						},
 					},
 					InputOptions: &InputOptions{
-						File: "foo",
+						Files: []string{"foo"},
 					},
 				},
 			},
@@ -173,7 +173,7 @@ func TestPositionalArgumentParsing(t *testing.T) {
 						},
 					},
 					InputOptions: &InputOptions{
-						File: "foo",
+						Files: []string{"foo"},
 					},
 				},
 			},
@@ -186,7 +186,20 @@ func TestPositionalArgumentParsing(t *testing.T) {
 						},
 					},
 					InputOptions: &InputOptions{
-						File: "foo",
+						Files: []string{"foo"},
+					},
+				},
+			},
+			{
+				InputArgs: []string{"--file=foo", "--file", "bar*", "mongodb://foo"},
+				ExpectedOpts: Options{
+					ToolOptions: &options.ToolOptions{
+						URI: &options.URI{
+							ConnectionString: "mongodb://foo",
+						},
+					},
+					InputOptions: &InputOptions{
+						Files: []string{"foo", "bar*"},
 					},
 				},
 			},
@@ -282,7 +295,7 @@ func TestPositionalArgumentParsing(t *testing.T) {
 				So(err.Error(), ShouldEqual, tc.ExpectErr)
 			} else {
 				So(err, ShouldBeNil)
-				So(opts.File, ShouldEqual, tc.ExpectedOpts.File)
+				So(opts.Files, ShouldResemble, tc.ExpectedOpts.Files)
 				So(opts.ConnectionString, ShouldEqual, tc.ExpectedOpts.ConnectionString)
 			}
 			if tc.AuthType == "aws" {
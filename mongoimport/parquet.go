@@ -0,0 +1,519 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"sync/atomic"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// parquetReadBatchSize is the number of rows read from a row group at a time.
+	parquetReadBatchSize = 64
+
+	// julianDayOfUnixEpoch is the Julian day of 1970-01-01, used to decode
+	// the legacy INT96 timestamps.
+	julianDayOfUnixEpoch = 2440588
+
+	// parquetMaxBufferedSize is the size of the largest parquet input that's
+	// read into memory because it isn't a regular file.
+	parquetMaxBufferedSize = 2 << 30
+)
+
+// ParquetInputReader is an implementation of InputReader that reads documents
+// from an Apache Parquet file. Each row becomes a document, with nested groups
+// as subdocuments and repeated fields as arrays.
+type ParquetInputReader struct {
+	// file is the parquet file that is read
+	file *parquet.File
+
+	// numProcessed indicates the number of rows processed
+	numProcessed uint64
+
+	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
+	sizeTracker
+
+	// numDecoders is the number of concurrent goroutines to use for decoding
+	numDecoders int
+
+	// rejects is where rejected records are written with --rejectsFile
+	rejects *RejectsWriter
+}
+
+// ParquetConverter implements the Converter interface for Parquet input.
+type ParquetConverter struct {
+	root    *parquet.Column
+	row     parquet.Row
+	index   uint64
+	rejects *RejectsWriter
+}
+
+// sizeTrackingReaderAt counts the bytes read through an io.ReaderAt. The
+// parquet file is read out of order, and parts of it such as the footer are
+// read more than once, so the count is only an estimate of the progress
+// through the file, which never goes past its size.
+type sizeTrackingReaderAt struct {
+	readerAt  io.ReaderAt
+	size      int64
+	bytesRead int64
+}
+
+func (str *sizeTrackingReaderAt) Size() int64 {
+	bytesRead := atomic.LoadInt64(&str.bytesRead)
+	if bytesRead > str.size {
+		return str.size
+	}
+	return bytesRead
+}
+
+func (str *sizeTrackingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := str.readerAt.ReadAt(p, off)
+	atomic.AddInt64(&str.bytesRead, int64(n))
+	return n, err
+}
+
+// NewParquetInputReader opens the parquet file read by in. Parquet files can
+// only be read with random access, so unless in is a regular file, such as a
+// pipe or a compressed file, all of it is read into memory first, up to
+// parquetMaxBufferedSize bytes.
+func NewParquetInputReader(in io.Reader, numDecoders int) (*ParquetInputReader, error) {
+	var readerAt io.ReaderAt
+	var size int64
+	if file, ok := in.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			readerAt, size = file, info.Size()
+		}
+	}
+	if readerAt == nil {
+		data, err := bufferParquetInput(in, parquetMaxBufferedSize)
+		if err != nil {
+			return nil, err
+		}
+		readerAt, size = data, data.Size()
+	}
+
+	szCount := &sizeTrackingReaderAt{readerAt: readerAt, size: size}
+	file, err := parquet.OpenFile(
+		szCount,
+		size,
+		parquet.SkipPageIndex(true),
+		parquet.SkipBloomFilters(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error opening parquet file: %v", err)
+	}
+	log.Logvf(
+		log.Info,
+		"parquet file has %v rows in %v row groups",
+		file.NumRows(),
+		len(file.RowGroups()),
+	)
+	return &ParquetInputReader{
+		file:        file,
+		sizeTracker: szCount,
+		numDecoders: numDecoders,
+	}, nil
+}
+
+// bufferParquetInput reads parquet input that isn't a regular file into
+// memory. Input over limit bytes is refused.
+func bufferParquetInput(in io.Reader, limit int64) (*bytes.Reader, error) {
+	log.Logvf(log.Info, "reading parquet input into memory")
+	data, err := io.ReadAll(io.LimitReader(in, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading parquet input: %v", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf(
+			"parquet input that isn't an uncompressed file can't be over %v bytes; "+
+				"decompress it to a file first",
+			limit,
+		)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// ReadAndValidateHeader is a no-op for Parquet imports; always returns nil.
+func (r *ParquetInputReader) ReadAndValidateHeader() error {
+	return nil
+}
+
+// ReadAndValidateTypedHeader is a no-op for Parquet imports; always returns nil.
+func (r *ParquetInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) error {
+	return nil
+}
+
+// StreamDocument takes a boolean indicating if the documents should be streamed
+// in read order and a channel on which to stream the documents processed from
+// the underlying reader. Returns a non-nil error if encountered.
+func (r *ParquetInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
+	rowChan := make(chan Converter, r.numDecoders)
+	parquetErrChan := make(chan error)
+
+	// begin reading from source
+	go func() {
+		err := r.readRowGroups(rowChan)
+		close(rowChan)
+		parquetErrChan <- err
+	}()
+
+	go func() {
+		parquetErrChan <- streamDocuments(ordered, r.numDecoders, rowChan, readDocs)
+	}()
+
+	return channelQuorumError(parquetErrChan)
+}
+
+// readRowGroups reads the rows of each row group in turn and sends them on rowChan.
+func (r *ParquetInputReader) readRowGroups(rowChan chan Converter) error {
+	root := r.file.Root()
+	buf := make([]parquet.Row, parquetReadBatchSize)
+	for i, rowGroup := range r.file.RowGroups() {
+		log.Logvf(log.DebugLow, "reading parquet row group %v with %v rows", i, rowGroup.NumRows())
+		rows := rowGroup.Rows()
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				// the values of the rows are only valid until the next read
+				rowChan <- ParquetConverter{
+					root:    root,
+					row:     row.Clone(),
+					index:   r.numProcessed,
+					rejects: r.rejects,
+				}
+				r.numProcessed++
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("read error on entry #%v: %v", r.numProcessed+1, err)
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return fmt.Errorf("error closing parquet row group %v: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Convert implements the Converter interface for Parquet input. It converts a
+// ParquetConverter struct to a BSON document.
+func (c ParquetConverter) Convert() (bson.D, error) {
+	assembler := newParquetRowAssembler(c.root, c.row)
+	doc, err := assembler.readGroup(c.root)
+	record := inputRecord{index: c.index}
+	if err != nil {
+		if rejectErr := c.rejects.reject(record, rejectStageParse, err); rejectErr != nil {
+			return nil, rejectErr
+		}
+		return nil, fmt.Errorf("error converting row #%v: %v", c.index+1, err)
+	}
+	c.rejects.track(doc, record)
+	return doc, nil
+}
+
+// parquetRowAssembler rebuilds the document of a row from the values of its
+// leaf columns, using their repetition and definition levels to find where
+// lists start and end and which values are null.
+type parquetRowAssembler struct {
+	// columns holds the values of each leaf column of the row
+	columns [][]parquet.Value
+}
+
+func newParquetRowAssembler(root *parquet.Column, row parquet.Row) *parquetRowAssembler {
+	numLeaves := 0
+	forEachLeafColumn(root, func(*parquet.Column) { numLeaves++ })
+	a := &parquetRowAssembler{columns: make([][]parquet.Value, numLeaves)}
+	for _, value := range row {
+		a.columns[value.Column()] = append(a.columns[value.Column()], value)
+	}
+	return a
+}
+
+func forEachLeafColumn(col *parquet.Column, do func(*parquet.Column)) {
+	if col.Leaf() {
+		do(col)
+		return
+	}
+	for _, child := range col.Columns() {
+		forEachLeafColumn(child, do)
+	}
+}
+
+func firstLeafColumn(col *parquet.Column) *parquet.Column {
+	for !col.Leaf() {
+		col = col.Columns()[0]
+	}
+	return col
+}
+
+// peek returns the next value of a column without consuming it.
+func (a *parquetRowAssembler) peek(col *parquet.Column) (parquet.Value, bool) {
+	values := a.columns[firstLeafColumn(col).Index()]
+	if len(values) == 0 {
+		return parquet.Value{}, false
+	}
+	return values[0], true
+}
+
+// skip consumes the null or empty value of each leaf column under col.
+func (a *parquetRowAssembler) skip(col *parquet.Column) {
+	forEachLeafColumn(col, func(leaf *parquet.Column) {
+		if len(a.columns[leaf.Index()]) > 0 {
+			a.columns[leaf.Index()] = a.columns[leaf.Index()][1:]
+		}
+	})
+}
+
+// read returns the value of a field, or false if it's null. A repeated field
+// returns an array of its values.
+func (a *parquetRowAssembler) read(col *parquet.Column) (interface{}, bool, error) {
+	if col.Repeated() {
+		values := bson.A{}
+		err := a.readRepeated(col, func() error {
+			value, err := a.readInstance(col)
+			values = append(values, value)
+			return err
+		})
+		return values, true, err
+	}
+	next, ok := a.peek(col)
+	if !ok {
+		return nil, false, fmt.Errorf("missing value for column %v", col.Name())
+	}
+	if next.DefinitionLevel() < col.MaxDefinitionLevel() {
+		a.skip(col)
+		return nil, false, nil
+	}
+	value, err := a.readInstance(col)
+	return value, true, err
+}
+
+// readRepeated calls readElement for each element of the repeated field col.
+func (a *parquetRowAssembler) readRepeated(col *parquet.Column, readElement func() error) error {
+	next, ok := a.peek(col)
+	if !ok {
+		return fmt.Errorf("missing value for column %v", col.Name())
+	}
+	if next.DefinitionLevel() < col.MaxDefinitionLevel() {
+		// the list is empty
+		a.skip(col)
+		return nil
+	}
+	for {
+		if err := readElement(); err != nil {
+			return err
+		}
+		next, ok = a.peek(col)
+		if !ok || next.RepetitionLevel() < col.MaxRepetitionLevel() {
+			return nil
+		}
+	}
+}
+
+// readInstance returns one non-null value of col.
+func (a *parquetRowAssembler) readInstance(col *parquet.Column) (interface{}, error) {
+	if col.Leaf() {
+		value := a.columns[col.Index()][0]
+		a.columns[col.Index()] = a.columns[col.Index()][1:]
+		return convertParquetValue(col, value)
+	}
+	logicalType := col.Type().LogicalType()
+	switch {
+	case logicalType != nil && logicalType.List != nil:
+		return a.readList(col)
+	case logicalType != nil && logicalType.Map != nil:
+		return a.readMap(col)
+	}
+	return a.readGroup(col)
+}
+
+// readGroup returns the document of a group, without its null fields.
+func (a *parquetRowAssembler) readGroup(col *parquet.Column) (bson.D, error) {
+	doc := bson.D{}
+	for _, child := range col.Columns() {
+		value, ok, err := a.read(child)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			doc = append(doc, bson.E{Key: child.Name(), Value: value})
+		}
+	}
+	return doc, nil
+}
+
+// readList returns the array of a LIST group. The repeated group in the
+// middle of the standard three-level lists is left out, as are the
+// repeated groups of the older two-level lists.
+func (a *parquetRowAssembler) readList(col *parquet.Column) (bson.A, error) {
+	if len(col.Columns()) != 1 || !col.Columns()[0].Repeated() {
+		return nil, fmt.Errorf("LIST column %v must have a single repeated field", col.Name())
+	}
+	repeated := col.Columns()[0]
+	if repeated.Leaf() ||
+		len(repeated.Columns()) > 1 ||
+		repeated.Name() == "array" ||
+		repeated.Name() == col.Name()+"_tuple" {
+		values, _, err := a.read(repeated)
+		return values.(bson.A), err
+	}
+	element := repeated.Columns()[0]
+	values := bson.A{}
+	err := a.readRepeated(repeated, func() error {
+		value, _, err := a.read(element)
+		values = append(values, value)
+		return err
+	})
+	return values, err
+}
+
+// readMap returns the subdocument of a MAP group, whose keys must be strings.
+func (a *parquetRowAssembler) readMap(col *parquet.Column) (bson.D, error) {
+	if len(col.Columns()) != 1 || len(col.Columns()[0].Columns()) != 2 {
+		return nil, fmt.Errorf("MAP column %v must have a single repeated key_value group", col.Name())
+	}
+	keyValue := col.Columns()[0]
+	doc := bson.D{}
+	err := a.readRepeated(keyValue, func() error {
+		key, _, err := a.read(keyValue.Columns()[0])
+		if err != nil {
+			return err
+		}
+		value, _, err := a.read(keyValue.Columns()[1])
+		if err != nil {
+			return err
+		}
+		doc = append(doc, bson.E{Key: fmt.Sprint(key), Value: value})
+		return nil
+	})
+	return doc, err
+}
+
+// convertParquetValue converts the value of a leaf column to BSON, first
+// according to its logical type, and otherwise according to its physical type.
+func convertParquetValue(col *parquet.Column, value parquet.Value) (interface{}, error) {
+	if value.IsNull() {
+		return nil, nil
+	}
+	logicalType := col.Type().LogicalType()
+	if logicalType != nil {
+		switch {
+		case logicalType.UTF8 != nil, logicalType.Enum != nil, logicalType.Json != nil:
+			return string(value.ByteArray()), nil
+		case logicalType.Decimal != nil:
+			return parquetDecimal(value, int(logicalType.Decimal.Scale))
+		case logicalType.Date != nil:
+			return primitive.DateTime(int64(value.Int32()) * 24 * 60 * 60 * 1000), nil
+		case logicalType.Timestamp != nil:
+			unit := logicalType.Timestamp.Unit
+			switch {
+			case unit.Micros != nil:
+				return primitive.DateTime(floorDiv(value.Int64(), 1000)), nil
+			case unit.Nanos != nil:
+				return primitive.DateTime(floorDiv(value.Int64(), 1000*1000)), nil
+			}
+			return primitive.DateTime(value.Int64()), nil
+		case logicalType.Integer != nil:
+			if logicalType.Integer.BitWidth == 64 {
+				if !logicalType.Integer.IsSigned && value.Uint64() > math.MaxInt64 {
+					decimal, _ := primitive.ParseDecimal128FromBigInt(
+						new(big.Int).SetUint64(value.Uint64()),
+						0,
+					)
+					return decimal, nil
+				}
+				return value.Int64(), nil
+			}
+			if !logicalType.Integer.IsSigned && logicalType.Integer.BitWidth == 32 {
+				return int64(value.Uint32()), nil
+			}
+			return value.Int32(), nil
+		case logicalType.UUID != nil:
+			return primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: bytes.Clone(value.ByteArray())}, nil
+		case logicalType.Bson != nil:
+			doc := bson.Raw(bytes.Clone(value.ByteArray()))
+			if err := doc.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid BSON in column %v: %v", col.Name(), err)
+			}
+			return doc, nil
+		case logicalType.Unknown != nil:
+			return nil, nil
+		}
+	}
+
+	switch value.Kind() {
+	case parquet.Boolean:
+		return value.Boolean(), nil
+	case parquet.Int32:
+		return value.Int32(), nil
+	case parquet.Int64:
+		return value.Int64(), nil
+	case parquet.Int96:
+		return parquetInt96Date(value.Int96()), nil
+	case parquet.Float:
+		return float64(value.Float()), nil
+	case parquet.Double:
+		return value.Double(), nil
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return primitive.Binary{Subtype: bson.TypeBinaryGeneric, Data: bytes.Clone(value.ByteArray())}, nil
+	}
+	return nil, fmt.Errorf("unsupported parquet type %v in column %v", value.Kind(), col.Name())
+}
+
+// parquetDecimal converts a DECIMAL value, stored as an unscaled INT32, INT64
+// or big-endian two's complement byte array, to a Decimal128.
+func parquetDecimal(value parquet.Value, scale int) (primitive.Decimal128, error) {
+	unscaled := new(big.Int)
+	switch value.Kind() {
+	case parquet.Int32:
+		unscaled.SetInt64(int64(value.Int32()))
+	case parquet.Int64:
+		unscaled.SetInt64(value.Int64())
+	default:
+		data := value.ByteArray()
+		unscaled.SetBytes(data)
+		if len(data) > 0 && data[0]&0x80 != 0 {
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(data)*8)))
+		}
+	}
+	decimal, ok := primitive.ParseDecimal128FromBigInt(unscaled, -scale)
+	if !ok {
+		return primitive.Decimal128{}, fmt.Errorf("decimal %v with scale %v doesn't fit in a Decimal128", unscaled, scale)
+	}
+	return decimal, nil
+}
+
+// parquetInt96Date converts a legacy INT96 timestamp, made of the nanoseconds
+// within the day followed by the Julian day, to a date.
+func parquetInt96Date(value deprecated.Int96) primitive.DateTime {
+	nanos := int64(uint64(value[1])<<32 | uint64(value[0]))
+	days := int64(value[2]) - julianDayOfUnixEpoch
+	return primitive.DateTime(days*24*60*60*1000 + nanos/(1000*1000))
+}
+
+// floorDiv divides rounding down, so that times before 1970 keep their date.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
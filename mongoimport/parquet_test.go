@@ -0,0 +1,214 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type parquetTestItem struct {
+	SKU string `parquet:"sku"`
+	Qty int32  `parquet:"qty"`
+}
+
+type parquetTestAddress struct {
+	City string  `parquet:"city"`
+	Zip  *string `parquet:"zip,optional"`
+}
+
+type parquetTestRow struct {
+	ID      int64               `parquet:"_id"`
+	Name    string              `parquet:"name,dict"`
+	Price   int64               `parquet:"price,decimal(2:10)"`
+	Created int64               `parquet:"created,timestamp(microsecond)"`
+	Day     int32               `parquet:"day,date"`
+	Ratio   float32             `parquet:"ratio"`
+	Flag    bool                `parquet:"flag"`
+	Raw     []byte              `parquet:"raw"`
+	Tags    []string            `parquet:"tags,list"`
+	Scores  []int32             `parquet:"scores"`
+	Items   []parquetTestItem   `parquet:"items,list"`
+	Address *parquetTestAddress `parquet:"address,optional"`
+	Attrs   map[string]int32    `parquet:"attrs"`
+}
+
+func writeParquetTestFile(rows []parquetTestRow, options ...parquet.WriterOption) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := parquet.Write(buf, rows, options...)
+	return buf.Bytes(), err
+}
+
+func TestParquetStreamDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	Convey("With a Parquet input reader", t, func() {
+		zip := "10001"
+		created := time.Date(2024, 3, 1, 12, 30, 0, 123000000, time.UTC)
+		rows := []parquetTestRow{
+			{
+				ID:      1,
+				Name:    "first",
+				Price:   -1999,
+				Created: created.UnixMicro(),
+				Day:     19783,
+				Ratio:   0.5,
+				Flag:    true,
+				Raw:     []byte{1, 2},
+				Tags:    []string{"a", "b"},
+				Scores:  []int32{3, 4},
+				Items:   []parquetTestItem{{"x", 1}, {"y", 2}},
+				Address: &parquetTestAddress{City: "NYC", Zip: &zip},
+				Attrs:   map[string]int32{"k": 7},
+			},
+			{
+				ID:      2,
+				Name:    "second",
+				Created: -1,
+				Raw:     []byte{},
+				Address: &parquetTestAddress{City: "LA"},
+			},
+			{ID: 3, Name: "third"},
+		}
+		price, _ := primitive.ParseDecimal128("-19.99")
+		zero, _ := primitive.ParseDecimal128("0.00")
+		expected := []bson.D{
+			{
+				{"_id", int64(1)},
+				{"name", "first"},
+				{"price", price},
+				{"created", primitive.NewDateTimeFromTime(created)},
+				{"day", primitive.NewDateTimeFromTime(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))},
+				{"ratio", 0.5},
+				{"flag", true},
+				{"raw", primitive.Binary{Data: []byte{1, 2}}},
+				{"tags", bson.A{"a", "b"}},
+				{"scores", bson.A{int32(3), int32(4)}},
+				{"items", bson.A{
+					bson.D{{"sku", "x"}, {"qty", int32(1)}},
+					bson.D{{"sku", "y"}, {"qty", int32(2)}},
+				}},
+				{"address", bson.D{{"city", "NYC"}, {"zip", "10001"}}},
+				{"attrs", bson.D{{"k", int32(7)}}},
+			},
+			{
+				{"_id", int64(2)},
+				{"name", "second"},
+				{"price", zero},
+				{"created", primitive.DateTime(-1)},
+				{"day", primitive.DateTime(0)},
+				{"ratio", 0.0},
+				{"flag", false},
+				{"raw", primitive.Binary{Data: []byte{}}},
+				{"tags", bson.A{}},
+				{"scores", bson.A{}},
+				{"items", bson.A{}},
+				{"address", bson.D{{"city", "LA"}}},
+				{"attrs", bson.D{}},
+			},
+			{
+				{"_id", int64(3)},
+				{"name", "third"},
+				{"price", zero},
+				{"created", primitive.DateTime(0)},
+				{"day", primitive.DateTime(0)},
+				{"ratio", 0.0},
+				{"flag", false},
+				{"raw", primitive.Binary{Data: []byte{}}},
+				{"tags", bson.A{}},
+				{"scores", bson.A{}},
+				{"items", bson.A{}},
+				{"attrs", bson.D{}},
+			},
+		}
+
+		Convey("rows of all row groups should be converted in order", func() {
+			data, err := writeParquetTestFile(
+				rows,
+				parquet.MaxRowsPerRowGroup(2),
+				parquet.Compression(&parquet.Snappy),
+			)
+			So(err, ShouldBeNil)
+			r, err := NewParquetInputReader(bytes.NewReader(data), 2)
+			So(err, ShouldBeNil)
+			So(len(r.file.RowGroups()), ShouldEqual, 2)
+			docChan := make(chan bson.D, len(rows))
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			for _, doc := range expected {
+				So(<-docChan, ShouldResemble, doc)
+			}
+			So(r.numProcessed, ShouldEqual, len(rows))
+			So(r.Size(), ShouldBeGreaterThan, 0)
+			// the footer is read more than once, but the progress stops at
+			// the end of the file
+			So(r.Size(), ShouldBeLessThanOrEqualTo, len(data))
+		})
+
+		Convey("parquet files should be read in place", func() {
+			data, err := writeParquetTestFile(rows[2:])
+			So(err, ShouldBeNil)
+			path := filepath.Join(t.TempDir(), "test.parquet")
+			So(os.WriteFile(path, data, 0644), ShouldBeNil)
+			file, err := os.Open(path)
+			So(err, ShouldBeNil)
+			defer file.Close()
+			r, err := NewParquetInputReader(file, 1)
+			So(err, ShouldBeNil)
+			docChan := make(chan bson.D, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, expected[2])
+		})
+
+		Convey("input that isn't a file should only be read into memory up to a limit", func() {
+			data, err := writeParquetTestFile(rows)
+			So(err, ShouldBeNil)
+			buffered, err := bufferParquetInput(bytes.NewReader(data), int64(len(data)))
+			So(err, ShouldBeNil)
+			So(buffered.Size(), ShouldEqual, len(data))
+			_, err = bufferParquetInput(bytes.NewReader(data), int64(len(data)-1))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "decompress it to a file first")
+		})
+
+		Convey("input that isn't parquet should be rejected", func() {
+			_, err := NewParquetInputReader(bytes.NewReader([]byte(`{"a": 1}`)), 1)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParquetValues(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	Convey("With parquet values", t, func() {
+		Convey("INT96 timestamps should be converted to dates", func() {
+			date := time.Date(2001, 2, 3, 4, 5, 6, 7000000, time.UTC)
+			nanos := uint64(date.Sub(time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)))
+			value := deprecated.Int96{uint32(nanos), uint32(nanos >> 32), 2451944}
+			So(parquetInt96Date(value), ShouldEqual, primitive.NewDateTimeFromTime(date))
+		})
+
+		Convey("fixed length decimals should keep their sign", func() {
+			decimal, err := parquetDecimal(parquet.FixedLenByteArrayValue([]byte{0xff, 0x85}), 1)
+			So(err, ShouldBeNil)
+			So(decimal.String(), ShouldEqual, "-12.3")
+		})
+
+		Convey("times before 1970 should round down", func() {
+			So(floorDiv(-1, 1000), ShouldEqual, -1)
+			So(floorDiv(1999, 1000), ShouldEqual, 1)
+		})
+	})
+}
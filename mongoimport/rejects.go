@@ -0,0 +1,263 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Stages of the import at which an input record can be rejected.
+const (
+	// rejectStageParse is for records that can't be converted to a document.
+	rejectStageParse = "parse"
+	// rejectStageCoercion is for records with a field that doesn't parse as
+	// the type of its column, skipped with --parseGrace=skipRow.
+	rejectStageCoercion = "coercion"
+	// rejectStageTransform is for documents that fail a --transform rule.
+	rejectStageTransform = "transform"
+	// rejectStageValidation is for documents that fail the validator of the
+	// collection, checked with --dryRun --checkValidator.
+	rejectStageValidation = "validation"
+	// rejectStageWrite is for documents the server refused to write.
+	rejectStageWrite = "write"
+)
+
+// inputRecord identifies a record of the input source.
+type inputRecord struct {
+	// file is the input file the record was read from, or empty if it's read
+	// from standard input
+	file string
+
+	// index is the position of the record in the input, starting at 0
+	index uint64
+
+	// line is the line of the input on which the record starts, or 0 if the
+	// input isn't made of lines
+	line uint64
+
+	// data is the text of the record as it was read, or empty if the input
+	// isn't text
+	data string
+
+	// end is the position in the input just after the record, from which a
+	// --resume run continues once the record is imported
+	end resumePosition
+}
+
+// rejectedRecord is the JSON document written to the --rejectsFile for each
+// rejected input record.
+type rejectedRecord struct {
+	File   string `json:"file,omitempty"`
+	Record uint64 `json:"record,omitempty"`
+	Line   uint64 `json:"line,omitempty"`
+	Stage  string `json:"stage"`
+	Error  string `json:"error"`
+	Data   string `json:"data"`
+}
+
+// RejectsWriter writes the input records that couldn't be imported to the
+// --rejectsFile, one JSON document per line, along with where they are in the
+// input, the stage of the import that failed and why. It's safe for
+// concurrent use, and a nil *RejectsWriter discards everything.
+//
+// Documents go through the import pipeline as the same bson.D slice, so until
+// a document is written, the RejectsWriter can find the input record it was
+// converted from by the address of its first element.
+type RejectsWriter struct {
+	*rejectsLog
+	// file is the input file of the records rejected or tracked through this
+	// RejectsWriter, or empty if they are read from standard input
+	file string
+}
+
+// rejectsLog is the state shared by a RejectsWriter and the RejectsWriters
+// returned by its forFile method.
+type rejectsLog struct {
+	mutex   sync.Mutex
+	out     io.Writer
+	sources map[*bson.E]inputRecord
+	count   uint64
+}
+
+// NewRejectsWriter returns a RejectsWriter that writes to out.
+func NewRejectsWriter(out io.Writer) *RejectsWriter {
+	return &RejectsWriter{
+		rejectsLog: &rejectsLog{
+			out:     out,
+			sources: map[*bson.E]inputRecord{},
+		},
+	}
+}
+
+// forFile returns a RejectsWriter that writes to the same rejects file, for
+// the records read from the named input file.
+func (rw *RejectsWriter) forFile(name string) *RejectsWriter {
+	if rw == nil {
+		return nil
+	}
+	return &RejectsWriter{rejectsLog: rw.rejectsLog, file: name}
+}
+
+// Count returns the number of records rejected so far.
+func (rw *RejectsWriter) Count() uint64 {
+	if rw == nil {
+		return 0
+	}
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	return rw.count
+}
+
+// reject writes an input record that was rejected at the given stage.
+func (rw *RejectsWriter) reject(record inputRecord, stage string, reason error) error {
+	if rw == nil {
+		return nil
+	}
+	if record.file == "" {
+		record.file = rw.file
+	}
+	line, err := json.Marshal(rejectedRecord{
+		File:   record.file,
+		Record: record.index + 1,
+		Line:   record.line,
+		Stage:  stage,
+		Error:  reason.Error(),
+		Data:   record.data,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding rejected record #%v: %v", record.index+1, err)
+	}
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	rw.count++
+	if _, err = rw.out.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing to rejects file: %v", err)
+	}
+	return nil
+}
+
+// track remembers the input record a document was converted from.
+func (rw *RejectsWriter) track(doc bson.D, record inputRecord) {
+	if rw == nil || len(doc) == 0 {
+		return
+	}
+	if record.file == "" {
+		record.file = rw.file
+	}
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	rw.sources[&doc[0]] = record
+}
+
+// retrack moves the input record of a document, if it's known, to the
+// document it was transformed into.
+func (rw *RejectsWriter) retrack(from, to bson.D) {
+	if rw == nil || len(from) == 0 {
+		return
+	}
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	record, ok := rw.sources[&from[0]]
+	if !ok {
+		return
+	}
+	delete(rw.sources, &from[0])
+	if len(to) > 0 {
+		rw.sources[&to[0]] = record
+	}
+}
+
+// forget forgets the input record of a document that won't be rejected.
+func (rw *RejectsWriter) forget(doc bson.D) {
+	if rw == nil || len(doc) == 0 {
+		return
+	}
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	delete(rw.sources, &doc[0])
+}
+
+// source returns the input record a document was converted from and forgets
+// it. A document without a known record is described by its Extended JSON.
+func (rw *RejectsWriter) source(doc bson.D) inputRecord {
+	var record inputRecord
+	if rw == nil {
+		return record
+	}
+	var ok bool
+	if len(doc) > 0 {
+		rw.mutex.Lock()
+		record, ok = rw.sources[&doc[0]]
+		delete(rw.sources, &doc[0])
+		rw.mutex.Unlock()
+	}
+	if !ok {
+		// the record number is left out of the rejects file when it wraps to 0
+		record.index = ^uint64(0)
+	}
+	if record.data == "" {
+		if data, err := bsonutil.MarshalExtJSONReversible(doc, true, false); err == nil {
+			record.data = string(data)
+		}
+	}
+	return record
+}
+
+// rejectWrites rejects the input records of the documents of a bulk write
+// that the server didn't acknowledge, given the error of the bulk write, and
+// forgets the input records of the others. Documents whose writes failed are
+// rejected with their write errors. When the bulk write is ordered, the
+// documents after the first failure aren't written, and when it fails with
+// another error, none of them are. A bulk write with an unacknowledged write
+// concern is sent without knowing whether any write failed, so none of its
+// documents are rejected.
+func (rw *RejectsWriter) rejectWrites(docs []bson.D, err error, ordered bool) error {
+	if rw == nil {
+		return nil
+	}
+	if errors.Is(err, mongo.ErrUnacknowledgedWrite) {
+		err = nil
+	}
+	numWritten := len(docs)
+	failed := map[int]error{}
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) {
+		for _, writeErr := range bwe.WriteErrors {
+			failed[writeErr.Index] = writeErr
+			if ordered && writeErr.Index < numWritten {
+				numWritten = writeErr.Index
+			}
+		}
+	} else if err != nil {
+		numWritten = 0
+	}
+	for i, doc := range docs {
+		reason, ok := failed[i]
+		if !ok && i >= numWritten {
+			reason, ok = err, true
+			if len(failed) > 0 {
+				reason = errors.New("not written because an earlier write of the ordered bulk write failed")
+			}
+		}
+		if !ok {
+			rw.forget(doc)
+			continue
+		}
+		if err := rw.reject(rw.source(doc), rejectStageWrite, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
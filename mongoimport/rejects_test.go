@@ -0,0 +1,247 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func readRejects(t *testing.T, out *bytes.Buffer) []rejectedRecord {
+	var rejected []rejectedRecord
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var record rejectedRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		rejected = append(rejected, record)
+	}
+	return rejected
+}
+
+// streamAll returns the documents streamed by r, which must all fit in the
+// buffer of the channel. The channel is only closed if streaming succeeds.
+func streamAll(r InputReader) ([]bson.D, error) {
+	docChan := make(chan bson.D, 10)
+	err := r.StreamDocument(true, docChan)
+	var docs []bson.D
+	for {
+		select {
+		case doc, ok := <-docChan:
+			if !ok {
+				return docs, err
+			}
+			docs = append(docs, doc)
+		default:
+			return docs, err
+		}
+	}
+}
+
+func TestRejectsWriter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	t.Run("records are written as JSON lines", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		rw := NewRejectsWriter(out)
+		require.NoError(t, rw.reject(
+			inputRecord{index: 2, line: 4, data: "a,b"},
+			rejectStageParse,
+			errors.New("bad"),
+		))
+		assert.Equal(
+			t,
+			`{"record":3,"line":4,"stage":"parse","error":"bad","data":"a,b"}`+"\n",
+			out.String(),
+		)
+		assert.EqualValues(t, 1, rw.Count())
+	})
+
+	t.Run("a nil writer discards everything", func(t *testing.T) {
+		var rw *RejectsWriter
+		assert.NoError(t, rw.reject(inputRecord{}, rejectStageParse, errors.New("bad")))
+		rw.track(bson.D{{"a", 1}}, inputRecord{})
+		assert.NoError(t, rw.rejectWrites([]bson.D{{{"a", 1}}}, errors.New("bad"), true))
+		assert.EqualValues(t, 0, rw.Count())
+	})
+
+	t.Run("failed writes are matched to their input records", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		rw := NewRejectsWriter(out)
+		docs := []bson.D{{{"_id", 1}}, {{"_id", 2}}, {{"_id", 3}}}
+		for i, doc := range docs[:2] {
+			rw.track(doc, inputRecord{index: uint64(i), line: uint64(i + 1), data: "line"})
+		}
+		err := mongo.BulkWriteException{
+			WriteErrors: []mongo.BulkWriteError{
+				{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}},
+				{WriteError: mongo.WriteError{Index: 2, Code: 11000, Message: "duplicate key"}},
+			},
+		}
+		require.NoError(t, rw.rejectWrites(docs, err, false))
+		rejected := readRejects(t, out)
+		require.Len(t, rejected, 2)
+		assert.Equal(t, rejectedRecord{
+			Record: 2,
+			Line:   2,
+			Stage:  rejectStageWrite,
+			Error:  err.WriteErrors[0].Error(),
+			Data:   "line",
+		}, rejected[0])
+		// a document without a known record is written as Extended JSON
+		assert.Equal(t, rejectedRecord{
+			Stage: rejectStageWrite,
+			Error: err.WriteErrors[1].Error(),
+			Data:  `{"_id":{"$numberInt":"3"}}`,
+		}, rejected[1])
+		assert.Empty(t, rw.sources)
+	})
+
+	t.Run("writes after an ordered failure or a failed bulk write are rejected", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		rw := NewRejectsWriter(out).forFile("in.csv")
+		docs := []bson.D{{{"_id", 1}}, {{"_id", 2}}, {{"_id", 3}}}
+		for i, doc := range docs {
+			rw.track(doc, inputRecord{index: uint64(i), data: "line"})
+		}
+		err := mongo.BulkWriteException{
+			WriteErrors: []mongo.BulkWriteError{
+				{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}},
+			},
+		}
+		// the documents after the failure of an ordered bulk write aren't written
+		require.NoError(t, rw.rejectWrites(docs, err, true))
+		rejected := readRejects(t, out)
+		require.Len(t, rejected, 2)
+		assert.Equal(t, "in.csv", rejected[0].File)
+		assert.EqualValues(t, 2, rejected[0].Record)
+		assert.Equal(t, err.WriteErrors[0].Error(), rejected[0].Error)
+		assert.EqualValues(t, 3, rejected[1].Record)
+		assert.Contains(t, rejected[1].Error, "earlier write of the ordered bulk write failed")
+		assert.Empty(t, rw.sources)
+
+		// no document is written when the bulk write fails otherwise
+		out.Reset()
+		for i, doc := range docs {
+			rw.track(doc, inputRecord{index: uint64(i), data: "line"})
+		}
+		require.NoError(t, rw.rejectWrites(docs, io.ErrUnexpectedEOF, false))
+		rejected = readRejects(t, out)
+		require.Len(t, rejected, 3)
+		for _, record := range rejected {
+			assert.Equal(t, io.ErrUnexpectedEOF.Error(), record.Error)
+		}
+		assert.Empty(t, rw.sources)
+	})
+
+	t.Run("writes with an unacknowledged write concern aren't rejected", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		rw := NewRejectsWriter(out)
+		docs := []bson.D{{{"_id", 1}}, {{"_id", 2}}}
+		for i, doc := range docs {
+			rw.track(doc, inputRecord{index: uint64(i), data: "line"})
+		}
+		require.NoError(t, rw.rejectWrites(docs, mongo.ErrUnacknowledgedWrite, true))
+		assert.Empty(t, out.String())
+		assert.EqualValues(t, 0, rw.Count())
+		assert.Empty(t, rw.sources)
+	})
+}
+
+func TestRejectedRecords(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	colSpecs, err := ParseTypedHeaders([]string{"a.int32()", "b.string()"}, pgSkipRow)
+	require.NoError(t, err)
+
+	t.Run("CSV", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		contents := "1,x\r\nfoo,\"multi\nline\"\r\n3,z\r\n"
+		r := NewCSVInputReader(colSpecs, strings.NewReader(contents), os.Stdout, 1, false, false)
+		r.rejects = NewRejectsWriter(out)
+		docs, err := streamAll(r)
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, bson.D{{"a", int32(3)}, {"b", "z"}}, docs[1])
+		assert.Equal(t, []rejectedRecord{
+			{
+				Record: 2,
+				Line:   2,
+				Stage:  rejectStageCoercion,
+				Error:  "type coercion failure for column 'a', could not parse token 'foo' to type int32",
+				Data:   "foo,\"multi\nline\"",
+			},
+		}, readRejects(t, out))
+		assert.Len(t, r.rejects.sources, 2)
+	})
+
+	t.Run("badly encoded CSV", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		contents := "1,x\n2,\"bad\"quote\n"
+		r := NewCSVInputReader(colSpecs, strings.NewReader(contents), os.Stdout, 1, false, false)
+		r.rejects = NewRejectsWriter(out)
+		_, err := streamAll(r)
+		require.Error(t, err)
+		rejected := readRejects(t, out)
+		require.Len(t, rejected, 1)
+		assert.Equal(t, rejectedRecord{
+			Record: 2,
+			Line:   2,
+			Stage:  rejectStageParse,
+			Error:  rejected[0].Error,
+			Data:   `2,"bad"q`,
+		}, rejected[0])
+		assert.Contains(t, rejected[0].Error, "read error on entry #2")
+	})
+
+	t.Run("TSV", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		contents := "a.int32()\tb.string()\n1\tx\nfoo\ty\r\n"
+		r := NewTSVInputReader(colSpecs, strings.NewReader(contents), os.Stdout, 1, false, false)
+		r.rejects = NewRejectsWriter(out)
+		require.NoError(t, r.ReadAndValidateTypedHeader(pgSkipRow))
+		docs, err := streamAll(r)
+		require.NoError(t, err)
+		assert.Len(t, docs, 1)
+		assert.Equal(t, []rejectedRecord{
+			{
+				Record: 2,
+				Line:   3,
+				Stage:  rejectStageCoercion,
+				Error:  "type coercion failure for column 'a', could not parse token 'foo' to type int32",
+				Data:   "foo\ty",
+			},
+		}, readRejects(t, out))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		contents := "[\n  {\"a\": 1},\n\n  {\"a\": {\"$numberInt\": \"x\"}}\n]"
+		r := NewJSONInputReader(true, false, strings.NewReader(contents), 1)
+		r.rejects = NewRejectsWriter(out)
+		_, err := streamAll(r)
+		require.Error(t, err)
+		rejected := readRejects(t, out)
+		require.Len(t, rejected, 1)
+		assert.Equal(t, uint64(2), rejected[0].Record)
+		assert.Equal(t, uint64(4), rejected[0].Line)
+		assert.Equal(t, rejectStageParse, rejected[0].Stage)
+		assert.Equal(t, `{"a": {"$numberInt": "x"}}`, rejected[0].Data)
+	})
+}
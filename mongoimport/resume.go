@@ -0,0 +1,290 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// resumeFileSuffix is added to the name of the input file to name the file in
+// which --resume records how far the import has got.
+const resumeFileSuffix = ".resume"
+
+// resumePosition is a position in the input between two records.
+type resumePosition struct {
+	// Offset is the number of bytes of input before the position, after any
+	// BOM and after decompressing the input
+	Offset int64 `json:"offset"`
+	// Line is the number of lines before the position
+	Line uint64 `json:"line"`
+	// Records is the number of records before the position
+	Records uint64 `json:"records"`
+}
+
+// resumeState is what a resume file records: the import it belongs to, and the
+// position in the input before which every record has been imported.
+type resumeState struct {
+	File      string `json:"file"`
+	Size      int64  `json:"size"`
+	Type      string `json:"type"`
+	Namespace string `json:"ns"`
+	resumePosition
+}
+
+// resumableReader is an InputReader that can continue reading from a position
+// recorded by --resume.
+type resumableReader interface {
+	InputReader
+	// resumeAt makes the reader read from source, which is the input from its
+	// start, at the given position. The header, if any, must have been read.
+	resumeAt(source io.Reader, pos resumePosition) error
+}
+
+// ResumeTracker records the position in the input before which every record
+// has been imported, so that an import that fails can be continued from there
+// with --resume. Records are imported once their documents are acknowledged by
+// the server, or once they are skipped. As several workers import documents
+// concurrently, the position only moves past a record once all the records
+// before it are imported too. The position is saved after every acknowledged
+// batch of writes, and when the import stops. It's safe for concurrent use, and a nil
+// *ResumeTracker does nothing.
+//
+// Like the RejectsWriter, the ResumeTracker finds the input record of a
+// document by the address of its first element.
+type ResumeTracker struct {
+	mutex   sync.Mutex
+	path    string
+	state   resumeState
+	sources map[*bson.E]resumePosition
+	// pending holds the ends of the records imported after a record that
+	// isn't, by their number of records
+	pending map[uint64]resumePosition
+	// saved is the position in the resume file
+	saved resumePosition
+}
+
+// LoadResumeTracker returns a ResumeTracker that records the position of the
+// import described by state in the resume file at path. If the file exists,
+// the import continues from the position it records, and it must be for the
+// same import.
+func LoadResumeTracker(path string, state resumeState) (*ResumeTracker, error) {
+	rt := &ResumeTracker{
+		path:    path,
+		sources: map[*bson.E]resumePosition{},
+		pending: map[uint64]resumePosition{},
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		rt.state = state
+		return rt, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading resume file: %v", err)
+	}
+	var saved resumeState
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("error parsing resume file %v: %v", path, err)
+	}
+	if saved.File != state.File || saved.Size != state.Size ||
+		saved.Type != state.Type || saved.Namespace != state.Namespace {
+		return nil, fmt.Errorf(
+			"resume file %v is for the import of %v (%v bytes of %v) into %v, "+
+				"not of %v (%v bytes of %v) into %v; remove it to start the import over",
+			path, saved.File, saved.Size, saved.Type, saved.Namespace,
+			state.File, state.Size, state.Type, state.Namespace,
+		)
+	}
+	rt.state = saved
+	rt.saved = saved.resumePosition
+	return rt, nil
+}
+
+// position returns the position before which every record has been imported.
+func (rt *ResumeTracker) position() resumePosition {
+	if rt == nil {
+		return resumePosition{}
+	}
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	return rt.state.resumePosition
+}
+
+// track remembers the input record a document was converted from. An empty
+// document can't be tracked, so its record counts as imported right away.
+func (rt *ResumeTracker) track(doc bson.D, record inputRecord) {
+	if rt == nil {
+		return
+	}
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	if len(doc) == 0 {
+		rt.advance(record.end)
+		return
+	}
+	rt.sources[&doc[0]] = record.end
+}
+
+// retrack moves the input record of a document, if it's known, to the
+// document it was transformed into.
+func (rt *ResumeTracker) retrack(from, to bson.D) {
+	if rt == nil || len(from) == 0 {
+		return
+	}
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	end, ok := rt.sources[&from[0]]
+	if !ok {
+		return
+	}
+	delete(rt.sources, &from[0])
+	if len(to) > 0 {
+		rt.sources[&to[0]] = end
+	} else {
+		rt.advance(end)
+	}
+}
+
+// skip marks a record that has no document to write, for example because
+// it's rejected, as imported.
+func (rt *ResumeTracker) skip(record inputRecord) {
+	if rt == nil {
+		return
+	}
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	rt.advance(record.end)
+}
+
+// done records that the input record of a document is imported, if imported
+// is true, or else forgets it. The position is saved with the next batch of
+// writes.
+func (rt *ResumeTracker) done(doc bson.D, imported bool) {
+	if rt == nil || len(doc) == 0 {
+		return
+	}
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	end, ok := rt.sources[&doc[0]]
+	delete(rt.sources, &doc[0])
+	if ok && imported {
+		rt.advance(end)
+	}
+}
+
+// written records that the input records of the documents of a bulk write
+// are imported, given the error that stops the import, if any. When writes
+// fail, only the documents that were written before the first failure, if
+// the bulk write is ordered, or the documents that didn't fail, if it isn't,
+// are imported. Like a write that succeeded, a write with an unacknowledged
+// write concern is counted as imported. The new position is saved.
+func (rt *ResumeTracker) written(docs []bson.D, err error, ordered bool) error {
+	if rt == nil {
+		return nil
+	}
+	if errors.Is(err, mongo.ErrUnacknowledgedWrite) {
+		err = nil
+	}
+	numWritten := len(docs)
+	failed := map[int]bool{}
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) {
+		for _, writeErr := range bwe.WriteErrors {
+			failed[writeErr.Index] = true
+			if ordered && writeErr.Index < numWritten {
+				numWritten = writeErr.Index
+			}
+		}
+	} else if err != nil {
+		numWritten = 0
+	}
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	for i, doc := range docs {
+		if len(doc) == 0 {
+			continue
+		}
+		end, ok := rt.sources[&doc[0]]
+		delete(rt.sources, &doc[0])
+		if ok && i < numWritten && !failed[i] {
+			rt.advance(end)
+		}
+	}
+	return rt.saveIfMoved()
+}
+
+// advance records that the record ending at end is imported. The mutex must
+// be held.
+func (rt *ResumeTracker) advance(end resumePosition) {
+	rt.pending[end.Records] = end
+	for {
+		next, ok := rt.pending[rt.state.Records+1]
+		if !ok {
+			return
+		}
+		delete(rt.pending, next.Records)
+		rt.state.resumePosition = next
+	}
+}
+
+// saveIfMoved saves the position if it has moved since it was last saved.
+// The mutex must be held.
+func (rt *ResumeTracker) saveIfMoved() error {
+	if rt.state.resumePosition == rt.saved {
+		return nil
+	}
+	return rt.save()
+}
+
+// save writes the resume file. The mutex must be held.
+func (rt *ResumeTracker) save() error {
+	data, err := json.Marshal(rt.state)
+	if err != nil {
+		return fmt.Errorf("error encoding resume file: %v", err)
+	}
+	// the file is replaced at once, so that it's never left half-written
+	temp := rt.path + ".tmp"
+	if err = os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("error writing resume file: %v", err)
+	}
+	if err = os.Rename(temp, rt.path); err != nil {
+		return fmt.Errorf("error writing resume file: %v", err)
+	}
+	rt.saved = rt.state.resumePosition
+	return nil
+}
+
+// finish removes the resume file if the import succeeded, or else saves it so
+// that the import can be continued.
+func (rt *ResumeTracker) finish(importErr error) error {
+	if rt == nil {
+		return nil
+	}
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	if importErr == nil {
+		if err := os.Remove(rt.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing resume file: %v", err)
+		}
+		return nil
+	}
+	if err := rt.save(); err != nil {
+		return err
+	}
+	log.Logvf(log.Always, "all records before line %v of %v are imported; "+
+		"run mongoimport again with --resume to continue from there",
+		rt.state.Line+1, rt.state.File)
+	return nil
+}
@@ -0,0 +1,250 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newTestResumeTracker(t *testing.T) *ResumeTracker {
+	rt, err := LoadResumeTracker(filepath.Join(t.TempDir(), "in.csv.resume"), resumeState{File: "in.csv"})
+	require.NoError(t, err)
+	return rt
+}
+
+// endOf returns the input record of the nth record, whose end is at offset.
+func endOf(n uint64, offset int64) inputRecord {
+	return inputRecord{index: n - 1, end: resumePosition{offset, n, n}}
+}
+
+func TestResumeTracker(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	t.Run("the position only moves past records imported in order", func(t *testing.T) {
+		rt := newTestResumeTracker(t)
+		docs := []bson.D{{{"a", 1}}, {{"a", 2}}, {{"a", 3}}, {{"a", 4}}}
+		for i, doc := range docs {
+			rt.track(doc, endOf(uint64(i+1), int64(10*(i+1))))
+		}
+		require.NoError(t, rt.written(docs[1:2], nil, false))
+		rt.skip(endOf(5, 50))
+		assert.Equal(t, resumePosition{}, rt.position())
+		rt.done(docs[0], true)
+		assert.Equal(t, resumePosition{20, 2, 2}, rt.position())
+		require.NoError(t, rt.written(docs[2:], nil, false))
+		assert.Equal(t, resumePosition{50, 5, 5}, rt.position())
+		assert.Empty(t, rt.sources)
+		assert.Empty(t, rt.pending)
+	})
+
+	t.Run("failed writes", func(t *testing.T) {
+		failure := mongo.BulkWriteException{
+			WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 1}}},
+		}
+		for _, ordered := range []bool{true, false} {
+			rt := newTestResumeTracker(t)
+			docs := []bson.D{{{"a", 1}}, {{"a", 2}}, {{"a", 3}}}
+			for i, doc := range docs {
+				rt.track(doc, endOf(uint64(i+1), int64(10*(i+1))))
+			}
+			require.NoError(t, rt.written(docs, failure, ordered))
+			assert.Equal(t, resumePosition{10, 1, 1}, rt.position())
+			assert.Empty(t, rt.sources)
+			if ordered {
+				// the documents after the failure weren't written
+				assert.Empty(t, rt.pending)
+			} else {
+				assert.Len(t, rt.pending, 1)
+			}
+		}
+
+		rt := newTestResumeTracker(t)
+		doc := bson.D{{"a", 1}}
+		rt.track(doc, endOf(1, 10))
+		require.NoError(t, rt.written([]bson.D{doc}, io.ErrUnexpectedEOF, false))
+		assert.Equal(t, resumePosition{}, rt.position())
+
+		// writes with an unacknowledged write concern are counted as imported
+		rt = newTestResumeTracker(t)
+		rt.track(doc, endOf(1, 10))
+		require.NoError(t, rt.written([]bson.D{doc}, mongo.ErrUnacknowledgedWrite, true))
+		assert.Equal(t, resumePosition{10, 1, 1}, rt.position())
+	})
+
+	t.Run("empty and transformed documents", func(t *testing.T) {
+		rt := newTestResumeTracker(t)
+		rt.track(bson.D{}, endOf(1, 10))
+		doc := bson.D{{"a", 1}}
+		rt.track(doc, endOf(2, 20))
+		transformed := bson.D{{"b", 1}}
+		rt.retrack(doc, transformed)
+		assert.Equal(t, resumePosition{10, 1, 1}, rt.position())
+		rt.done(transformed, true)
+		assert.Equal(t, resumePosition{20, 2, 2}, rt.position())
+	})
+
+	t.Run("the resume file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "in.csv.resume")
+		state := resumeState{File: "in.csv", Size: 100, Type: CSV, Namespace: "db.c"}
+		rt, err := LoadResumeTracker(path, state)
+		require.NoError(t, err)
+		rt.skip(endOf(1, 10))
+		require.NoError(t, rt.finish(io.ErrUnexpectedEOF))
+
+		rt, err = LoadResumeTracker(path, state)
+		require.NoError(t, err)
+		assert.Equal(t, resumePosition{10, 1, 1}, rt.position())
+
+		state.Size = 200
+		_, err = LoadResumeTracker(path, state)
+		assert.ErrorContains(t, err, "remove it to start the import over")
+
+		require.NoError(t, rt.finish(nil))
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+
+		// the position is saved after every batch of writes
+		rt, err = LoadResumeTracker(path, state)
+		require.NoError(t, err)
+		docs := []bson.D{{{"a", 1}}, {{"a", 2}}}
+		rt.track(docs[0], endOf(1, 10))
+		rt.track(docs[1], endOf(2, 20))
+		require.NoError(t, rt.written(docs[:1], nil, true))
+		saved, err := LoadResumeTracker(path, state)
+		require.NoError(t, err)
+		assert.Equal(t, resumePosition{10, 1, 1}, saved.position())
+		require.NoError(t, rt.written(docs[1:], nil, true))
+		saved, err = LoadResumeTracker(path, state)
+		require.NoError(t, err)
+		assert.Equal(t, resumePosition{20, 2, 2}, saved.position())
+
+		var noTracker *ResumeTracker
+		noTracker.track(bson.D{{"a", 1}}, endOf(1, 10))
+		assert.NoError(t, noTracker.written([]bson.D{{{"a", 1}}}, nil, true))
+		assert.NoError(t, noTracker.finish(nil))
+	})
+}
+
+// onlyReader hides the Seek method of a reader, like a pipe or a decompressor.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestResumeReaders(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	colSpecs := ParseAutoHeaders([]string{"a", "b"})
+	tests := []struct {
+		name  string
+		input string
+		// trailing is the number of bytes after the end of the last record
+		trailing  int
+		newReader func(in io.Reader, rt *ResumeTracker) resumableReader
+	}{
+		{
+			name:  "CSV",
+			input: "\xEF\xBB\xBFa,b\r\n1,x\r\n2,\"multi\nline\"\r\n\r\n3,z\r\n4,w",
+			newReader: func(in io.Reader, rt *ResumeTracker) resumableReader {
+				r := NewCSVInputReader(nil, in, &bytes.Buffer{}, 1, false, false)
+				r.resume = rt
+				require.NoError(t, r.ReadAndValidateHeader())
+				return r
+			},
+		},
+		{
+			name:  "TSV",
+			input: "1\tx\n2\ty\r\n3\tz\n4\tw\n",
+			newReader: func(in io.Reader, rt *ResumeTracker) resumableReader {
+				r := NewTSVInputReader(colSpecs, in, &bytes.Buffer{}, 1, false, false)
+				r.resume = rt
+				return r
+			},
+		},
+		{
+			name:     "JSON",
+			input:    "{\"a\": 1}\n{\"a\":\n 2}\n\n{\"a\": 3}  {\"a\": 4}\n",
+			trailing: 1,
+			newReader: func(in io.Reader, rt *ResumeTracker) resumableReader {
+				r := NewJSONInputReader(false, false, in, 1)
+				r.resume = rt
+				return r
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := newTestResumeTracker(t)
+			docs, err := streamAll(test.newReader(strings.NewReader(test.input), rt))
+			require.NoError(t, err)
+			require.Len(t, docs, 4)
+			var positions []resumePosition
+			for _, doc := range docs {
+				positions = append(positions, rt.sources[&doc[0]])
+			}
+			assert.Equal(t, uint64(4), positions[3].Records)
+			input := strings.TrimPrefix(test.input, "\xEF\xBB\xBF")
+			assert.EqualValues(t, len(input)-test.trailing, positions[3].Offset)
+
+			for i, pos := range positions {
+				for _, seekable := range []bool{true, false} {
+					var source io.Reader = strings.NewReader(test.input)
+					if !seekable {
+						source = onlyReader{source}
+					}
+					resumed := newTestResumeTracker(t)
+					r := test.newReader(strings.NewReader(test.input), resumed)
+					require.NoError(t, r.resumeAt(source, pos))
+					assert.Equal(t, pos.Offset, r.Size())
+					rest, err := streamAll(r)
+					require.NoError(t, err)
+					assert.Equal(t, docs[i+1:], append([]bson.D{}, rest...))
+					for j, doc := range rest {
+						assert.Equal(t, positions[i+1+j], resumed.sources[&doc[0]])
+					}
+				}
+			}
+		})
+	}
+
+	jsonArray := NewJSONInputReader(true, false, strings.NewReader("[]"), 1)
+	assert.Error(t, jsonArray.resumeAt(strings.NewReader("[]"), resumePosition{Records: 1}))
+}
+
+func TestResumeSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "in.json")
+	require.NoError(t, os.WriteFile(file, []byte("{}"), 0644))
+
+	imp := NewMockMongoImport()
+	imp.IngestOptions.Resume = true
+	imp.InputOptions.Files = []string{file}
+	require.NoError(t, imp.validateSettings())
+
+	imp = NewMockMongoImport()
+	imp.IngestOptions.Resume = true
+	assert.EqualError(t, imp.validateSettings(), "--resume needs a single input file")
+
+	imp = NewMockMongoImport()
+	imp.IngestOptions.Resume = true
+	imp.InputOptions.Files = []string{file}
+	imp.InputOptions.JSONArray = true
+	assert.EqualError(t, imp.validateSettings(), "incompatible options: --resume and --jsonArray")
+}
@@ -0,0 +1,349 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// jsonSchema is the part of a JSON Schema, or of a MongoDB $jsonSchema
+// validator, that --schemaFile uses to type and validate CSV and TSV columns,
+// and that --dryRun uses to check documents against a collection's validator.
+type jsonSchema struct {
+	BSONType   schemaTypes            `json:"bsonType"`
+	Type       schemaTypes            `json:"type"`
+	Format     string                 `json:"format"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	Enum       []interface{}          `json:"enum"`
+	Minimum    *float64               `json:"minimum"`
+	Maximum    *float64               `json:"maximum"`
+	Pattern    *string                `json:"pattern"`
+	Required   []string               `json:"required"`
+	// AdditionalProperties is only checked if it's false
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+}
+
+// schemaTypes is the value of the type or bsonType keyword, which is either
+// a single type or an array of types.
+type schemaTypes []string
+
+func (st *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*st = schemaTypes{single}
+		return nil
+	}
+	var types []string
+	if err := json.Unmarshal(data, &types); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*st = types
+	return nil
+}
+
+// first returns the first type other than null, or "" if there is none.
+func (st schemaTypes) first() string {
+	for _, t := range st {
+		if t != "null" {
+			return t
+		}
+	}
+	return ""
+}
+
+// nullable reports whether null is one of several types.
+func (st schemaTypes) nullable() bool {
+	for _, t := range st {
+		if t == "null" {
+			return len(st) > 1
+		}
+	}
+	return false
+}
+
+// Layouts of the JSON Schema date formats.
+const (
+	schemaDateTimeLayout = time.RFC3339Nano
+	schemaDateLayout     = "2006-01-02"
+)
+
+// bsonTypeColumnTypes maps the BSON types of a $jsonSchema to the column
+// types they are parsed as.
+var bsonTypeColumnTypes = map[string]string{
+	"string":    "string",
+	"int":       "int32",
+	"long":      "int64",
+	"double":    "double",
+	"decimal":   "decimal",
+	"bool":      "boolean",
+	"date":      "date",
+	"binData":   "binary",
+	"objectId":  "objectId",
+	"timestamp": "timestamp",
+	"regex":     "regex",
+	"object":    "json",
+	"array":     "json",
+}
+
+// jsonTypeColumnTypes maps the JSON types of a JSON Schema to the column
+// types they are parsed as.
+var jsonTypeColumnTypes = map[string]string{
+	"string":  "string",
+	"integer": "int64",
+	"number":  "double",
+	"boolean": "boolean",
+	"object":  "json",
+	"array":   "json",
+}
+
+// ColumnSchema types and validates the columns of CSV and TSV input with a
+// JSON Schema. A nil *ColumnSchema gives every column an automatic parser.
+type ColumnSchema struct {
+	root       *jsonSchema
+	parseGrace ParseGrace
+}
+
+// LoadColumnSchema reads a JSON Schema from a file. The schema may be wrapped
+// in a $jsonSchema document, as in a collection validator. Values that fail
+// the type or validation keywords of their column are handled according to
+// parseGrace.
+func LoadColumnSchema(path string, parseGrace ParseGrace) (*ColumnSchema, error) {
+	data, err := os.ReadFile(util.ToUniversalPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema file: %v", err)
+	}
+	var wrapper struct {
+		JSONSchema *jsonSchema `json:"$jsonSchema"`
+	}
+	if err = json.Unmarshal(data, &wrapper); err != nil {
+		return nil, fmt.Errorf("error parsing schema file %v: %v", path, err)
+	}
+	root := wrapper.JSONSchema
+	if root == nil {
+		root = &jsonSchema{}
+		if err = json.Unmarshal(data, root); err != nil {
+			return nil, fmt.Errorf("error parsing schema file %v: %v", path, err)
+		}
+	}
+	return &ColumnSchema{root, parseGrace}, nil
+}
+
+// ColumnSpecs returns the ColumnSpec of each column name, typed by the schema
+// of the property at the column's dotted path. Columns that aren't in the
+// schema are parsed automatically.
+func (cs *ColumnSchema) ColumnSpecs(names []string) ([]ColumnSpec, error) {
+	if cs == nil {
+		return ParseAutoHeaders(names), nil
+	}
+	specs := make([]ColumnSpec, len(names))
+	for i, name := range names {
+		nameParts := strings.Split(name, ".")
+		property := cs.lookup(nameParts)
+		if property == nil {
+			specs[i] = ColumnSpec{name, new(FieldAutoParser), pgAutoCast, "auto", nameParts}
+			continue
+		}
+		typeName, parser, err := property.fieldParser()
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema for column '%v': %v", name, err)
+		}
+		specs[i] = ColumnSpec{name, parser, cs.parseGrace, typeName, nameParts}
+	}
+	return specs, nil
+}
+
+// lookup returns the schema of the property at a dotted path, going through
+// the items of arrays for array indexes, or nil if the schema doesn't
+// describe it.
+func (cs *ColumnSchema) lookup(path []string) *jsonSchema {
+	schema := cs.root
+	for _, part := range path {
+		if schema.Items != nil {
+			if _, err := strconv.Atoi(part); err == nil {
+				schema = schema.Items
+				continue
+			}
+		}
+		schema = schema.Properties[part]
+		if schema == nil {
+			return nil
+		}
+	}
+	return schema
+}
+
+// fieldParser returns the column type name and the FieldParser of a property
+// from its type and format, wrapped to check its validation keywords. Null
+// cells are parsed as null if null is one of the types of the property.
+func (s *jsonSchema) fieldParser() (string, FieldParser, error) {
+	typeName, parser, err := s.typedFieldParser()
+	if err != nil {
+		return "", nil, err
+	}
+	if typeName != "auto" && (s.BSONType.nullable() || s.Type.nullable()) {
+		parser = &FieldNullableParser{parser}
+	}
+	return typeName, parser, nil
+}
+
+// typedFieldParser returns the column type name and the FieldParser of a
+// property, as fieldParser does, except for null.
+func (s *jsonSchema) typedFieldParser() (string, FieldParser, error) {
+	typeName := "auto"
+	if bsonType := s.BSONType.first(); bsonType != "" {
+		var ok bool
+		if typeName, ok = bsonTypeColumnTypes[bsonType]; !ok {
+			return "", nil, fmt.Errorf("unsupported bsonType %v", bsonType)
+		}
+	} else if jsonType := s.Type.first(); jsonType != "" {
+		var ok bool
+		if typeName, ok = jsonTypeColumnTypes[jsonType]; !ok {
+			return "", nil, fmt.Errorf("unsupported type %v", jsonType)
+		}
+	}
+
+	var arg string
+	switch typeName {
+	case "auto", "string":
+		// strings can be dates in the formats of JSON Schema
+		switch s.Format {
+		case "date-time":
+			typeName, arg = "date", schemaDateTimeLayout
+		case "date":
+			typeName, arg = "date", schemaDateLayout
+		}
+	case "date":
+		switch s.Format {
+		case "", "date-time":
+			arg = schemaDateTimeLayout
+		case "date":
+			arg = schemaDateLayout
+		default:
+			return "", nil, fmt.Errorf("unsupported date format %v", s.Format)
+		}
+	case "binary":
+		arg = s.Format
+		if arg == "" {
+			arg = "base64"
+		}
+	}
+	parser, err := NewFieldParser(columnTypeNameMap[typeName], arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if s.Enum == nil && s.Minimum == nil && s.Maximum == nil && s.Pattern == nil {
+		return typeName, parser, nil
+	}
+	validating := &FieldValidatingParser{
+		parser:  parser,
+		enum:    s.Enum,
+		minimum: s.Minimum,
+		maximum: s.Maximum,
+	}
+	if s.Pattern != nil {
+		if validating.pattern, err = regexp.Compile(*s.Pattern); err != nil {
+			return "", nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+	return typeName, validating, nil
+}
+
+// validationError is returned by a FieldValidatingParser for a value that
+// parses but fails a validation keyword of its schema.
+type validationError struct {
+	reason string
+}
+
+func (e validationError) Error() string { return e.reason }
+
+// FieldValidatingParser parses a field with another parser and checks the
+// value against the enum, minimum, maximum and pattern keywords of its
+// schema. The pattern is matched against the field as it is in the input.
+type FieldValidatingParser struct {
+	parser  FieldParser
+	enum    []interface{}
+	minimum *float64
+	maximum *float64
+	pattern *regexp.Regexp
+}
+
+func (vp *FieldValidatingParser) Parse(in string) (interface{}, error) {
+	value, err := vp.parser.Parse(in)
+	if err != nil {
+		return nil, err
+	}
+	if vp.pattern != nil && !vp.pattern.MatchString(in) {
+		return nil, validationError{fmt.Sprintf("'%v' does not match pattern %v", in, vp.pattern)}
+	}
+	if vp.enum != nil && !enumContains(vp.enum, value) {
+		return nil, validationError{fmt.Sprintf("'%v' is not one of the allowed values", in)}
+	}
+	if vp.minimum != nil || vp.maximum != nil {
+		number, ok := numericValue(value)
+		if !ok {
+			return nil, validationError{fmt.Sprintf("'%v' is not a number", in)}
+		}
+		if vp.minimum != nil && number < *vp.minimum {
+			return nil, validationError{fmt.Sprintf("%v is less than the minimum of %v", in, *vp.minimum)}
+		}
+		if vp.maximum != nil && number > *vp.maximum {
+			return nil, validationError{fmt.Sprintf("%v is greater than the maximum of %v", in, *vp.maximum)}
+		}
+	}
+	return value, nil
+}
+
+// numericValue returns the value of a parsed number as a float64.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// enumContains returns whether a parsed value is equal to one of the values of
+// an enum, which are decoded from JSON. Only numbers, strings and booleans can
+// be compared.
+func enumContains(enum []interface{}, value interface{}) bool {
+	number, isNumber := numericValue(value)
+	for _, allowed := range enum {
+		switch a := allowed.(type) {
+		case float64:
+			if isNumber && number == a {
+				return true
+			}
+		case string:
+			if s, ok := value.(string); ok && s == a {
+				return true
+			}
+		case bool:
+			if b, ok := value.(bool); ok && b == a {
+				return true
+			}
+		}
+	}
+	return false
+}
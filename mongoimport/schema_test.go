@@ -0,0 +1,208 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSchema = `{
+	"bsonType": "object",
+	"properties": {
+		"name": {"bsonType": "string", "pattern": "^[A-Z]"},
+		"age": {"bsonType": "int", "minimum": 0, "maximum": 150},
+		"status": {"enum": ["active", "inactive"]},
+		"born": {"bsonType": "date", "format": "date"},
+		"seen": {"type": "string", "format": "date-time"},
+		"address": {
+			"bsonType": "object",
+			"properties": {"zip": {"bsonType": "string"}}
+		},
+		"scores": {"bsonType": "array", "items": {"bsonType": ["double", "null"]}}
+	}
+}`
+
+func writeSchema(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestLoadColumnSchema(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	names := []string{"name", "age", "status", "born", "seen", "address.zip", "scores.1", "other"}
+	for _, contents := range []string{testSchema, `{"$jsonSchema": ` + testSchema + `}`} {
+		schema, err := LoadColumnSchema(writeSchema(t, contents), pgSkipRow)
+		require.NoError(t, err)
+		specs, err := schema.ColumnSpecs(names)
+		require.NoError(t, err)
+		var typeNames []string
+		for _, spec := range specs {
+			typeNames = append(typeNames, spec.TypeName)
+		}
+		assert.Equal(
+			t,
+			[]string{"string", "int32", "auto", "date", "date", "string", "double", "auto"},
+			typeNames,
+		)
+		assert.Equal(t, []string{"address", "zip"}, specs[5].NameParts)
+		assert.Equal(t, pgSkipRow, specs[1].ParseGrace)
+		// columns that aren't in the schema are always cast automatically
+		assert.Equal(t, pgAutoCast, specs[7].ParseGrace)
+	}
+
+	_, err := LoadColumnSchema(writeSchema(t, "{"), pgStop)
+	assert.ErrorContains(t, err, "error parsing schema file")
+
+	schema, err := LoadColumnSchema(writeSchema(t, `{"properties": {"a": {"bsonType": "javascript"}}}`), pgStop)
+	require.NoError(t, err)
+	_, err = schema.ColumnSpecs([]string{"a"})
+	assert.ErrorContains(t, err, "invalid schema for column 'a': unsupported bsonType javascript")
+
+	var noSchema *ColumnSchema
+	specs, err := noSchema.ColumnSpecs([]string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, ParseAutoHeaders([]string{"a"}), specs)
+}
+
+func TestSchemaValidation(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	names := []string{"name", "age", "status", "born"}
+	load := func(pg ParseGrace) []ColumnSpec {
+		schema, err := LoadColumnSchema(writeSchema(t, testSchema), pg)
+		require.NoError(t, err)
+		specs, err := schema.ColumnSpecs(names)
+		require.NoError(t, err)
+		return specs
+	}
+
+	t.Run("valid values are parsed to their types", func(t *testing.T) {
+		doc, err := tokensToBSON(load(pgStop), []string{"Ann", "42", "active", "1980-05-01"}, 1, false, false)
+		require.NoError(t, err)
+		assert.Equal(t, bson.D{
+			{"name", "Ann"},
+			{"age", int32(42)},
+			{"status", "active"},
+			{"born", time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)},
+		}, doc)
+	})
+
+	invalid := []struct {
+		tokens []string
+		reason string
+	}{
+		{[]string{"ann", "42", "active", "1980-05-01"}, "column 'name': 'ann' does not match pattern ^[A-Z]"},
+		{[]string{"Ann", "-1", "active", "1980-05-01"}, "column 'age': -1 is less than the minimum of 0"},
+		{[]string{"Ann", "151", "active", "1980-05-01"}, "column 'age': 151 is greater than the maximum of 150"},
+		{[]string{"Ann", "42", "gone", "1980-05-01"}, "column 'status': 'gone' is not one of the allowed values"},
+	}
+
+	t.Run("invalid values skip the row with skipRow", func(t *testing.T) {
+		for _, test := range invalid {
+			_, err := tokensToBSON(load(pgSkipRow), test.tokens, 3, false, false)
+			require.IsType(t, coercionError{}, err)
+			assert.Equal(t, "validation failure for "+test.reason, err.Error())
+		}
+	})
+
+	t.Run("invalid values stop the import with stop", func(t *testing.T) {
+		for _, test := range invalid {
+			_, err := tokensToBSON(load(pgStop), test.tokens, 3, false, false)
+			require.Error(t, err)
+			assert.Equal(t, "validation failure in document #3 for "+test.reason, err.Error())
+		}
+	})
+
+	t.Run("invalid values are skipped with skipField", func(t *testing.T) {
+		doc, err := tokensToBSON(load(pgSkipField), []string{"Ann", "200", "gone", "1980-05-01"}, 1, false, false)
+		require.NoError(t, err)
+		assert.Equal(t, bson.D{
+			{"name", "Ann"},
+			{"born", time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)},
+		}, doc)
+	})
+
+	t.Run("invalid values are kept with autoCast", func(t *testing.T) {
+		doc, err := tokensToBSON(load(pgAutoCast), []string{"Ann", "200", "gone", "1980-05-01"}, 1, false, false)
+		require.NoError(t, err)
+		assert.Equal(t, int32(200), doc[1].Value)
+		assert.Equal(t, "gone", doc[2].Value)
+	})
+
+	t.Run("type coercion failures keep their message", func(t *testing.T) {
+		_, err := tokensToBSON(load(pgSkipRow), []string{"Ann", "old", "active", "1980-05-01"}, 1, false, false)
+		assert.EqualError(t, err, "type coercion failure for column 'age', could not parse token 'old' to type int32")
+	})
+
+	t.Run("more BSON types and null", func(t *testing.T) {
+		schema, err := LoadColumnSchema(writeSchema(t, `{"properties": {
+			"id": {"bsonType": "objectId"},
+			"n": {"bsonType": ["int", "null"]},
+			"meta": {"bsonType": "object"}
+		}}`), pgStop)
+		require.NoError(t, err)
+		specs, err := schema.ColumnSpecs([]string{"id", "n", "meta"})
+		require.NoError(t, err)
+		doc, err := tokensToBSON(specs, []string{"5f1e2d3c4b5a697887766554", "", `{"a": 1}`}, 1, false, false)
+		require.NoError(t, err)
+		assert.Equal(t, bson.D{
+			{"id", primitive.ObjectID{0x5f, 0x1e, 0x2d, 0x3c, 0x4b, 0x5a, 0x69, 0x78, 0x87, 0x76, 0x65, 0x54}},
+			{"n", nil},
+			{"meta", bson.D{{"a", int32(1)}}},
+		}, doc)
+	})
+
+	t.Run("the header line is typed by the schema", func(t *testing.T) {
+		schema, err := LoadColumnSchema(writeSchema(t, testSchema), pgSkipRow)
+		require.NoError(t, err)
+		contents := "name,age,other\nAnn,42,1\nBob,-3,2\n"
+		r := NewCSVInputReader(nil, strings.NewReader(contents), &bytes.Buffer{}, 1, false, false)
+		r.schema = schema
+		require.NoError(t, r.ReadAndValidateHeader())
+		docs, err := streamAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, []bson.D{{{"name", "Ann"}, {"age", int32(42)}, {"other", int32(1)}}}, docs)
+	})
+}
+
+func TestSchemaFileSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	path := writeSchema(t, testSchema)
+	fields := "name,age"
+
+	imp := NewMockMongoImport()
+	imp.InputOptions.Type = CSV
+	imp.InputOptions.Fields = &fields
+	imp.InputOptions.SchemaFile = path
+	require.NoError(t, imp.validateSettings())
+	assert.NotNil(t, imp.schema)
+
+	imp = NewMockMongoImport()
+	imp.InputOptions.Type = TSV
+	imp.InputOptions.HeaderLine = true
+	imp.InputOptions.ColumnsHaveTypes = true
+	imp.InputOptions.SchemaFile = path
+	assert.EqualError(t, imp.validateSettings(), "incompatible options: --schemaFile and --columnsHaveTypes")
+
+	imp = NewMockMongoImport()
+	imp.InputOptions.SchemaFile = path
+	assert.EqualError(t, imp.validateSettings(), "cannot use --schemaFile when input type is JSON")
+}
@@ -0,0 +1,574 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Transformation rule operations of a --transform file.
+const (
+	transformRename   = "rename"
+	transformUnset    = "unset"
+	transformSet      = "set"
+	transformCast     = "cast"
+	transformSplit    = "split"
+	transformJoin     = "join"
+	transformTemplate = "template"
+)
+
+// Formats of casts to dates from numbers of seconds or milliseconds since the
+// Unix epoch.
+const (
+	castEpochSeconds = "epochSeconds"
+	castEpochMillis  = "epochMillis"
+)
+
+// transformRule is a rule of a --transform file, as it's written. Which fields
+// are used depends on its operation.
+type transformRule struct {
+	Op        string          `json:"op"`
+	Field     string          `json:"field"`
+	Fields    []string        `json:"fields"`
+	To        string          `json:"to"`
+	Format    string          `json:"format"`
+	Separator *string         `json:"separator"`
+	Into      []string        `json:"into"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// transformStep applies a transformation rule to a document, returning the
+// transformed document.
+type transformStep interface {
+	apply(doc bson.D) (bson.D, error)
+}
+
+// Transformer reshapes documents with the rules of a --transform file after
+// they're converted from the input and before they're written. The rules are
+// applied in order, and rules that operate on a field the document doesn't
+// have leave it unchanged.
+type Transformer struct {
+	steps []transformStep
+	ops   []string
+}
+
+// LoadTransformer reads the transformation rules of a --transform file, a
+// JSON array of rules.
+func LoadTransformer(path string) (*Transformer, error) {
+	data, err := os.ReadFile(util.ToUniversalPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading transform file: %v", err)
+	}
+	var rules []transformRule
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing transform file %v: %v", path, err)
+	}
+	return NewTransformer(rules)
+}
+
+// NewTransformer returns a Transformer that applies the given rules.
+func NewTransformer(rules []transformRule) (*Transformer, error) {
+	t := &Transformer{}
+	for i, rule := range rules {
+		step, err := rule.compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform rule #%d (%v): %v", i+1, rule.Op, err)
+		}
+		t.steps = append(t.steps, step)
+		t.ops = append(t.ops, rule.Op)
+	}
+	return t, nil
+}
+
+// Transform applies the rules to a document.
+func (t *Transformer) Transform(doc bson.D) (bson.D, error) {
+	for i, step := range t.steps {
+		var err error
+		if doc, err = step.apply(doc); err != nil {
+			return nil, fmt.Errorf("transform rule #%d (%v) failed: %v", i+1, t.ops[i], err)
+		}
+	}
+	return doc, nil
+}
+
+// compile checks a rule and returns the step that applies it.
+func (rule transformRule) compile() (transformStep, error) {
+	switch rule.Op {
+	case transformRename:
+		if rule.Field == "" || rule.To == "" {
+			return nil, fmt.Errorf("rename needs a field and the field to rename it to")
+		}
+		return &renameStep{splitPath(rule.Field), splitPath(rule.To)}, nil
+	case transformUnset:
+		fields, err := rule.fieldPaths()
+		if err != nil {
+			return nil, err
+		}
+		return &unsetStep{fields}, nil
+	case transformSet, transformTemplate:
+		if rule.Field == "" || rule.Value == nil {
+			return nil, fmt.Errorf("%v needs a field and a value", rule.Op)
+		}
+		value, err := parseRuleValue(rule.Value)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Op == transformSet {
+			return &setStep{splitPath(rule.Field), value}, nil
+		}
+		return &templateStep{splitPath(rule.Field), value}, nil
+	case transformCast:
+		fields, err := rule.fieldPaths()
+		if err != nil {
+			return nil, err
+		}
+		return newCastStep(fields, rule.To, rule.Format)
+	case transformSplit:
+		if rule.Field == "" || rule.Separator == nil || *rule.Separator == "" {
+			return nil, fmt.Errorf("split needs a field and a separator")
+		}
+		step := &splitStep{field: splitPath(rule.Field), separator: *rule.Separator}
+		for _, into := range rule.Into {
+			step.into = append(step.into, splitPath(into))
+		}
+		return step, nil
+	case transformJoin:
+		if rule.Field == "" || rule.Separator == nil {
+			return nil, fmt.Errorf("join needs a field and a separator")
+		}
+		step := &joinStep{field: splitPath(rule.Field), separator: *rule.Separator}
+		for _, from := range rule.Fields {
+			step.from = append(step.from, splitPath(from))
+		}
+		return step, nil
+	case "":
+		return nil, fmt.Errorf("no op given")
+	}
+	return nil, fmt.Errorf("unknown op")
+}
+
+// fieldPaths returns the paths of the field or fields of a rule.
+func (rule transformRule) fieldPaths() ([][]string, error) {
+	var paths [][]string
+	if rule.Field != "" {
+		paths = append(paths, splitPath(rule.Field))
+	}
+	for _, field := range rule.Fields {
+		paths = append(paths, splitPath(field))
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%v needs a field", rule.Op)
+	}
+	return paths, nil
+}
+
+// parseRuleValue parses a value of a rule, written as Extended JSON.
+func parseRuleValue(raw json.RawMessage) (interface{}, error) {
+	var wrapper bson.D
+	data := append(append([]byte(`{"value":`), raw...), '}')
+	if err := bson.UnmarshalExtJSON(data, false, &wrapper); err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+	return wrapper[0].Value, nil
+}
+
+func splitPath(field string) []string {
+	return strings.Split(field, ".")
+}
+
+type renameStep struct {
+	from, to []string
+}
+
+func (s *renameStep) apply(doc bson.D) (bson.D, error) {
+	doc, value, ok := unsetPath(doc, s.from)
+	if !ok {
+		return doc, nil
+	}
+	return setPath(doc, s.to, value)
+}
+
+type unsetStep struct {
+	fields [][]string
+}
+
+func (s *unsetStep) apply(doc bson.D) (bson.D, error) {
+	for _, field := range s.fields {
+		doc, _, _ = unsetPath(doc, field)
+	}
+	return doc, nil
+}
+
+type setStep struct {
+	field []string
+	value interface{}
+}
+
+func (s *setStep) apply(doc bson.D) (bson.D, error) {
+	// each document gets its own copy, since later rules may change it
+	return setPath(doc, s.field, copyValue(s.value))
+}
+
+// copyValue returns a deep copy of the documents and arrays of a rule value.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		copied := make(bson.D, len(v))
+		for i, elem := range v {
+			copied[i] = bson.E{Key: elem.Key, Value: copyValue(elem.Value)}
+		}
+		return copied
+	case bson.A:
+		copied := make(bson.A, len(v))
+		for i, elem := range v {
+			copied[i] = copyValue(elem)
+		}
+		return copied
+	}
+	return value
+}
+
+// castStep converts the values of fields to a column type. Values that
+// aren't strings are formatted as strings to be parsed, except that numbers
+// can be cast to dates as seconds or milliseconds since the Unix epoch. The
+// elements of arrays are cast one by one.
+type castStep struct {
+	fields [][]string
+	parser FieldParser
+	epoch  time.Duration
+}
+
+func newCastStep(fields [][]string, to, format string) (*castStep, error) {
+	step := &castStep{fields: fields}
+	if to == "date" {
+		switch format {
+		case castEpochSeconds:
+			step.epoch = time.Second
+			return step, nil
+		case castEpochMillis:
+			step.epoch = time.Millisecond
+			return step, nil
+		case "":
+			format = time.RFC3339Nano
+		}
+	}
+	parser, ok, err := newTypedFieldParser(to, format)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown type '%v'", to)
+	}
+	step.parser = parser
+	return step, nil
+}
+
+func (s *castStep) apply(doc bson.D) (bson.D, error) {
+	for _, field := range s.fields {
+		value, ok := getPath(doc, field)
+		if !ok || value == nil {
+			continue
+		}
+		cast, err := s.cast(value)
+		if err != nil {
+			return nil, fmt.Errorf("could not cast field '%v': %v", strings.Join(field, "."), err)
+		}
+		if doc, err = setPath(doc, field, cast); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (s *castStep) cast(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bson.A:
+		return s.castElements(v)
+	case *bson.A:
+		return s.castElements(*v)
+	}
+	if s.epoch != 0 {
+		number, ok := numericValue(value)
+		if !ok {
+			var err error
+			if number, err = strconv.ParseFloat(formatValue(value), 64); err != nil {
+				return nil, fmt.Errorf("'%v' is not a number", formatValue(value))
+			}
+		}
+		return time.Unix(0, int64(number*float64(s.epoch))).UTC(), nil
+	}
+	return s.parser.Parse(formatValue(value))
+}
+
+func (s *castStep) castElements(values bson.A) (bson.A, error) {
+	cast := make(bson.A, len(values))
+	for i, value := range values {
+		var err error
+		if cast[i], err = s.cast(value); err != nil {
+			return nil, err
+		}
+	}
+	return cast, nil
+}
+
+// splitStep splits a string field by a separator, into an array of strings
+// in its place or into separate fields. The parts are trimmed of white space.
+type splitStep struct {
+	field     []string
+	separator string
+	into      [][]string
+}
+
+func (s *splitStep) apply(doc bson.D) (bson.D, error) {
+	value, ok := getPath(doc, s.field)
+	if !ok {
+		return doc, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("field '%v' is not a string", strings.Join(s.field, "."))
+	}
+	parts := strings.Split(str, s.separator)
+	if s.into == nil {
+		array := make(bson.A, len(parts))
+		for i, part := range parts {
+			array[i] = strings.TrimSpace(part)
+		}
+		return setPath(doc, s.field, array)
+	}
+	if len(parts) != len(s.into) {
+		return nil, fmt.Errorf(
+			"field '%v' has %d parts, but is split into %d fields",
+			strings.Join(s.field, "."), len(parts), len(s.into),
+		)
+	}
+	doc, _, _ = unsetPath(doc, s.field)
+	for i, part := range parts {
+		var err error
+		if doc, err = setPath(doc, s.into[i], strings.TrimSpace(part)); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// joinStep joins the values of fields, or the elements of an array field,
+// into a string with a separator. Missing fields are left out.
+type joinStep struct {
+	field     []string
+	from      [][]string
+	separator string
+}
+
+func (s *joinStep) apply(doc bson.D) (bson.D, error) {
+	var parts []string
+	if s.from == nil {
+		value, ok := getPath(doc, s.field)
+		if !ok {
+			return doc, nil
+		}
+		switch v := value.(type) {
+		case bson.A:
+			value = []interface{}(v)
+		case *bson.A:
+			value = []interface{}(*v)
+		}
+		elements, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field '%v' is not an array", strings.Join(s.field, "."))
+		}
+		for _, element := range elements {
+			parts = append(parts, formatValue(element))
+		}
+	} else {
+		for _, from := range s.from {
+			if value, ok := getPath(doc, from); ok {
+				parts = append(parts, formatValue(value))
+			}
+		}
+	}
+	return setPath(doc, s.field, strings.Join(parts, s.separator))
+}
+
+// templateStep sets a field to a value in which strings are templates. A
+// string that is only a "$field" reference is replaced by the value of the
+// field, and "${field}" references within strings are replaced by the value of
+// the field formatted as a string. A string that starts with "$$" is a string
+// starting with a literal "$". Missing fields are null, or empty in strings.
+type templateStep struct {
+	field    []string
+	template interface{}
+}
+
+var (
+	templateReference       = regexp.MustCompile(`^\$([A-Za-z_][\w.]*)$`)
+	templateStringReference = regexp.MustCompile(`\$\{([^}]+)\}`)
+)
+
+func (s *templateStep) apply(doc bson.D) (bson.D, error) {
+	return setPath(doc, s.field, expandTemplate(s.template, doc))
+}
+
+func expandTemplate(template interface{}, doc bson.D) interface{} {
+	switch t := template.(type) {
+	case string:
+		if strings.HasPrefix(t, "$$") {
+			return t[1:]
+		}
+		if match := templateReference.FindStringSubmatch(t); match != nil {
+			value, _ := getPath(doc, splitPath(match[1]))
+			return value
+		}
+		return templateStringReference.ReplaceAllStringFunc(t, func(reference string) string {
+			value, ok := getPath(doc, splitPath(reference[2:len(reference)-1]))
+			if !ok || value == nil {
+				return ""
+			}
+			return formatValue(value)
+		})
+	case bson.D:
+		expanded := make(bson.D, len(t))
+		for i, elem := range t {
+			expanded[i] = bson.E{Key: elem.Key, Value: expandTemplate(elem.Value, doc)}
+		}
+		return expanded
+	case bson.A:
+		expanded := make(bson.A, len(t))
+		for i, elem := range t {
+			expanded[i] = expandTemplate(elem, doc)
+		}
+		return expanded
+	}
+	return template
+}
+
+// formatValue formats a field value as a string for casts, joins and
+// templates.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// getPath returns the value of the field at a path in a document, going into
+// arrays for numeric parts, and whether the document has it.
+func getPath(doc bson.D, path []string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, part := range path {
+		switch v := value.(type) {
+		case *bson.D:
+			value = *v
+		case *bson.A:
+			value = *v
+		}
+		found := false
+		switch v := value.(type) {
+		case bson.D:
+			for _, elem := range v {
+				if elem.Key == part {
+					value, found = elem.Value, true
+					break
+				}
+			}
+		case bson.A:
+			if index, err := strconv.Atoi(part); err == nil && index >= 0 && index < len(v) {
+				value, found = v[index], true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setPath sets the field at a path in a document, replacing its value if the
+// document has it and adding it otherwise. Missing parent fields are added as
+// embedded documents.
+func setPath(doc bson.D, path []string, value interface{}) (bson.D, error) {
+	for i := range doc {
+		if doc[i].Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = value
+			return doc, nil
+		}
+		switch v := doc[i].Value.(type) {
+		case bson.D:
+			embedded, err := setPath(v, path[1:], value)
+			if err != nil {
+				return nil, err
+			}
+			doc[i].Value = embedded
+		case *bson.D:
+			embedded, err := setPath(*v, path[1:], value)
+			if err != nil {
+				return nil, err
+			}
+			*v = embedded
+		default:
+			return nil, fmt.Errorf("cannot set '%v' in field '%v', which is not a document",
+				strings.Join(path[1:], "."), path[0])
+		}
+		return doc, nil
+	}
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: value}), nil
+	}
+	embedded, err := setPath(bson.D{}, path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	return append(doc, bson.E{Key: path[0], Value: embedded}), nil
+}
+
+// unsetPath removes the field at a path in a document, returning its value
+// and whether the document had it.
+func unsetPath(doc bson.D, path []string) (bson.D, interface{}, bool) {
+	for i := range doc {
+		if doc[i].Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			value := doc[i].Value
+			return append(doc[:i:i], doc[i+1:]...), value, true
+		}
+		switch v := doc[i].Value.(type) {
+		case bson.D:
+			embedded, value, ok := unsetPath(v, path[1:])
+			doc[i].Value = embedded
+			return doc, value, ok
+		case *bson.D:
+			embedded, value, ok := unsetPath(*v, path[1:])
+			*v = embedded
+			return doc, value, ok
+		}
+		return doc, nil, false
+	}
+	return doc, nil, false
+}
@@ -0,0 +1,229 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func loadTestTransformer(t *testing.T, rules string) *Transformer {
+	path := filepath.Join(t.TempDir(), "transform.json")
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0644))
+	transformer, err := LoadTransformer(path)
+	require.NoError(t, err)
+	return transformer
+}
+
+func TestTransformer(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	tests := []struct {
+		name  string
+		rules string
+		in    bson.D
+		out   bson.D
+	}{
+		{
+			name:  "rename into an embedded document",
+			rules: `[{"op": "rename", "field": "zip", "to": "address.zip"}]`,
+			in:    bson.D{{"zip", "10001"}, {"address", &bson.D{{"city", "NYC"}}}},
+			out:   bson.D{{"address", &bson.D{{"city", "NYC"}, {"zip", "10001"}}}},
+		},
+		{
+			name:  "rename of a missing field",
+			rules: `[{"op": "rename", "field": "zip", "to": "postcode"}]`,
+			in:    bson.D{{"a", int32(1)}},
+			out:   bson.D{{"a", int32(1)}},
+		},
+		{
+			name:  "unset",
+			rules: `[{"op": "unset", "fields": ["a", "b.c", "missing"]}]`,
+			in:    bson.D{{"a", int32(1)}, {"b", bson.D{{"c", int32(2)}, {"d", int32(3)}}}},
+			out:   bson.D{{"b", bson.D{{"d", int32(3)}}}},
+		},
+		{
+			name:  "set a constant",
+			rules: `[{"op": "set", "field": "source", "value": {"name": "import", "at": {"$date": "2024-01-02T00:00:00Z"}}}]`,
+			in:    bson.D{{"a", int32(1)}},
+			out: bson.D{{"a", int32(1)}, {"source", bson.D{
+				{"name", "import"},
+				{"at", primitive.NewDateTimeFromTime(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))},
+			}}},
+		},
+		{
+			name:  "cast",
+			rules: `[{"op": "cast", "fields": ["a", "b", "c"], "to": "int32"}, {"op": "cast", "field": "d", "to": "string"}]`,
+			in:    bson.D{{"a", "42"}, {"b", bson.A{"1", "2"}}, {"d", 1.5}},
+			out:   bson.D{{"a", int32(42)}, {"b", bson.A{int32(1), int32(2)}}, {"d", "1.5"}},
+		},
+		{
+			name: "cast to dates",
+			rules: `[
+				{"op": "cast", "field": "s", "to": "date", "format": "epochSeconds"},
+				{"op": "cast", "field": "ms", "to": "date", "format": "epochMillis"},
+				{"op": "cast", "field": "iso", "to": "date"},
+				{"op": "cast", "field": "us", "to": "date_ms", "format": "MM/dd/yyyy"}
+			]`,
+			in: bson.D{{"s", int64(1700000000)}, {"ms", "1700000000500"}, {"iso", "2023-11-14T22:13:20Z"}, {"us", "11/14/2023"}},
+			out: bson.D{
+				{"s", time.Unix(1700000000, 0).UTC()},
+				{"ms", time.UnixMilli(1700000000500).UTC()},
+				{"iso", time.Unix(1700000000, 0).UTC()},
+				{"us", time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "split into an array",
+			rules: `[{"op": "split", "field": "tags", "separator": ";"}]`,
+			in:    bson.D{{"tags", "a; b;c"}},
+			out:   bson.D{{"tags", bson.A{"a", "b", "c"}}},
+		},
+		{
+			name:  "join fields",
+			rules: `[{"op": "join", "fields": ["first", "middle", "last"], "separator": " ", "field": "name"}]`,
+			in:    bson.D{{"first", "Ada"}, {"last", "Lovelace"}},
+			out:   bson.D{{"first", "Ada"}, {"last", "Lovelace"}, {"name", "Ada Lovelace"}},
+		},
+		{
+			name:  "join an array",
+			rules: `[{"op": "join", "field": "tags", "separator": ","}]`,
+			in:    bson.D{{"tags", bson.A{"a", int32(1), 2.5}}},
+			out:   bson.D{{"tags", "a,1,2.5"}},
+		},
+		{
+			name: "lat,lng to a GeoJSON point",
+			rules: `[
+				{"op": "split", "field": "latlng", "separator": ",", "into": ["lat", "lng"]},
+				{"op": "cast", "fields": ["lat", "lng"], "to": "double"},
+				{"op": "template", "field": "location", "value": {"type": "Point", "coordinates": ["$lng", "$lat"]}},
+				{"op": "unset", "fields": ["lat", "lng"]}
+			]`,
+			in: bson.D{{"name", "Statue"}, {"latlng", "40.6892, -74.0445"}},
+			out: bson.D{{"name", "Statue"}, {"location", bson.D{
+				{"type", "Point"},
+				{"coordinates", bson.A{-74.0445, 40.6892}},
+			}}},
+		},
+		{
+			name:  "string template",
+			rules: `[{"op": "template", "field": "label", "value": "${name} (${address.city}${missing}) $$5"}]`,
+			in:    bson.D{{"name", "Ada"}, {"address", bson.D{{"city", "London"}}}},
+			out: bson.D{
+				{"name", "Ada"},
+				{"address", bson.D{{"city", "London"}}},
+				{"label", "Ada (London) $$5"},
+			},
+		},
+		{
+			name:  "escaped template string",
+			rules: `[{"op": "template", "field": "price", "value": "$$5"}]`,
+			in:    bson.D{},
+			out:   bson.D{{"price", "$5"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transformer := loadTestTransformer(t, test.rules)
+			out, err := transformer.Transform(test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.out, out)
+		})
+	}
+
+	t.Run("constants are copied into each document", func(t *testing.T) {
+		transformer := loadTestTransformer(t, `[
+			{"op": "set", "field": "meta", "value": {"source": "import"}},
+			{"op": "rename", "field": "id", "to": "meta.id"}
+		]`)
+		first, err := transformer.Transform(bson.D{{"id", int32(1)}})
+		require.NoError(t, err)
+		second, err := transformer.Transform(bson.D{{"id", int32(2)}})
+		require.NoError(t, err)
+		assert.Equal(t, bson.D{{"meta", bson.D{{"source", "import"}, {"id", int32(1)}}}}, first)
+		assert.Equal(t, bson.D{{"meta", bson.D{{"source", "import"}, {"id", int32(2)}}}}, second)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		transformer := loadTestTransformer(t, `[
+			{"op": "cast", "field": "a", "to": "int32"},
+			{"op": "split", "field": "b", "separator": ",", "into": ["x", "y"]}
+		]`)
+		_, err := transformer.Transform(bson.D{{"a", "one"}})
+		assert.ErrorContains(t, err, "transform rule #1 (cast) failed: could not cast field 'a'")
+		_, err = transformer.Transform(bson.D{{"b", "1,2,3"}})
+		assert.EqualError(t, err, "transform rule #2 (split) failed: field 'b' has 3 parts, but is split into 2 fields")
+		_, err = transformer.Transform(bson.D{{"b", int32(1)}})
+		assert.EqualError(t, err, "transform rule #2 (split) failed: field 'b' is not a string")
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		for rules, expected := range map[string]string{
+			`[{"op": "move"}]`: "invalid transform rule #1 (move): unknown op",
+			`[{"field": "a"}]`: "invalid transform rule #1 (): no op given",
+			`[{"op": "cast", "field": "a", "to": "money"}]`:     "invalid transform rule #1 (cast): unknown type 'money'",
+			`[{"op": "split", "field": "a"}]`:                   "invalid transform rule #1 (split): split needs a field and a separator",
+			`[{"op": "set", "field": "a", "value": {"$date"}}]`: "error parsing transform file",
+		} {
+			path := filepath.Join(t.TempDir(), "transform.json")
+			require.NoError(t, os.WriteFile(path, []byte(rules), 0644))
+			_, err := LoadTransformer(path)
+			assert.ErrorContains(t, err, expected)
+		}
+	})
+}
+
+func TestTransformDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	out := &bytes.Buffer{}
+	imp := NewMockMongoImport()
+	imp.rejects = NewRejectsWriter(out)
+	imp.transformer = loadTestTransformer(t, `[
+		{"op": "unset", "field": "a"},
+		{"op": "cast", "field": "b", "to": "int32"}
+	]`)
+
+	good := bson.D{{"a", int32(1)}, {"b", "2"}}
+	imp.rejects.track(good, inputRecord{index: 0, line: 2, data: "1,2"})
+	transformed, ok, err := imp.transformDocument(good)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, bson.D{{"b", int32(2)}}, transformed)
+	// the input record follows the transformed document
+	assert.Equal(t, uint64(2), imp.rejects.source(transformed).line)
+
+	bad := bson.D{{"a", int32(1)}, {"b", "x"}}
+	imp.rejects.track(bad, inputRecord{index: 1, line: 3, data: "1,x"})
+	_, ok, err = imp.transformDocument(bad)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.EqualValues(t, 1, imp.failureCount)
+	rejected := readRejects(t, out)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, rejectedRecord{
+		Record: 2,
+		Line:   3,
+		Stage:  rejectStageTransform,
+		Error:  "transform rule #2 (cast) failed: could not cast field 'b': strconv.ParseInt: parsing \"x\": invalid syntax",
+		Data:   "1,x",
+	}, rejected[0])
+
+	imp.IngestOptions.StopOnError = true
+	_, _, err = imp.transformDocument(bson.D{{"b", "y"}})
+	assert.Error(t, err)
+}
@@ -50,6 +50,24 @@ type TSVInputReader struct {
 
 	// useArrayIndexFields is whether field names include array indexes
 	useArrayIndexFields bool
+
+	// line is the number of lines read so far
+	line uint64
+
+	// rejects is where rejected records are written with --rejectsFile
+	rejects *RejectsWriter
+
+	// schema types the columns named by the header line with --schemaFile
+	schema *ColumnSchema
+
+	// offset is the number of bytes read so far
+	offset int64
+
+	// resume records how far the import has got with --resume
+	resume *ResumeTracker
+
+	// commentPrefix starts the lines that are ignored, if it's not empty
+	commentPrefix string
 }
 
 // TSVConverter implements the Converter interface for TSV input.
@@ -60,6 +78,9 @@ type TSVConverter struct {
 	ignoreBlanks        bool
 	useArrayIndexFields bool
 	rejectWriter        io.Writer
+	record              inputRecord
+	rejects             *RejectsWriter
+	resume              *ResumeTracker
 }
 
 // NewTSVInputReader returns a TSVInputReader configured to read input from the
@@ -88,7 +109,7 @@ func NewTSVInputReader(
 // ReadAndValidateHeader reads the header from the underlying reader and validates
 // the header fields. It sets err if the read/validation fails.
 func (r *TSVInputReader) ReadAndValidateHeader() (err error) {
-	header, err := r.tsvReader.ReadString(entryDelimiter)
+	header, err := r.readLine()
 	if err != nil {
 		return err
 	}
@@ -96,14 +117,16 @@ func (r *TSVInputReader) ReadAndValidateHeader() (err error) {
 	for _, field := range strings.Split(header, tokenSeparator) {
 		headerFields = append(headerFields, strings.TrimRight(field, "\r\n"))
 	}
-	r.colSpecs = ParseAutoHeaders(headerFields)
+	if r.colSpecs, err = r.schema.ColumnSpecs(headerFields); err != nil {
+		return err
+	}
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
 // ReadAndValidateTypedHeader reads the header from the underlying reader and validates
 // the header fields. It sets err if the read/validation fails.
 func (r *TSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err error) {
-	header, err := r.tsvReader.ReadString(entryDelimiter)
+	header, err := r.readLine()
 	if err != nil {
 		return err
 	}
@@ -118,6 +141,33 @@ func (r *TSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
+// resumeAt makes the reader read from source at the given position, as
+// recorded by --resume.
+func (r *TSVInputReader) resumeAt(source io.Reader, pos resumePosition) error {
+	szCount := newSizeTrackingReader(newBomDiscardingReader(source))
+	if err := szCount.seek(pos.Offset); err != nil {
+		return fmt.Errorf("error seeking to byte %v of the input: %v", pos.Offset, err)
+	}
+	r.sizeTracker = szCount
+	r.tsvReader = bufio.NewReader(szCount)
+	r.offset = pos.Offset
+	r.line = pos.Line
+	r.numProcessed = pos.Records
+	return nil
+}
+
+// readLine reads the next line of input that isn't a comment.
+func (r *TSVInputReader) readLine() (string, error) {
+	for {
+		line, err := r.tsvReader.ReadString(entryDelimiter)
+		r.line++
+		r.offset += int64(len(line))
+		if err != nil || r.commentPrefix == "" || !strings.HasPrefix(line, r.commentPrefix) {
+			return line, err
+		}
+	}
+}
+
 // StreamDocument takes a boolean indicating if the documents should be streamed
 // in read order and a channel on which to stream the documents processed from
 // the underlying reader. Returns a non-nil error if streaming fails.
@@ -129,7 +179,7 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 	go func() {
 		var err error
 		for {
-			r.tsvRecord, err = r.tsvReader.ReadString(entryDelimiter)
+			r.tsvRecord, err = r.readLine()
 			if err != nil {
 				close(tsvRecordChan)
 				if err == io.EOF {
@@ -147,6 +197,14 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				ignoreBlanks:        r.ignoreBlanks,
 				useArrayIndexFields: r.useArrayIndexFields,
 				rejectWriter:        r.tsvRejectWriter,
+				record: inputRecord{
+					index: r.numProcessed,
+					line:  r.line,
+					data:  strings.TrimRight(r.tsvRecord, "\r\n"),
+					end:   resumePosition{r.offset, r.line, r.numProcessed + 1},
+				},
+				rejects: r.rejects,
+				resume:  r.resume,
 			}
 			r.numProcessed++
 		}
@@ -171,8 +229,19 @@ func (c TSVConverter) Convert() (b bson.D, err error) {
 		c.useArrayIndexFields,
 	)
 	if _, ok := err.(coercionError); ok {
+		c.resume.skip(c.record)
+		if c.rejects != nil {
+			return nil, c.rejects.reject(c.record, rejectStageCoercion, err)
+		}
 		err = c.Print()
+	} else if err != nil {
+		if rejectErr := c.rejects.reject(c.record, rejectStageParse, err); rejectErr != nil {
+			return nil, rejectErr
+		}
+		return
 	}
+	c.rejects.track(b, c.record)
+	c.resume.track(b, c.record)
 	return
 }
 
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/mongodb/mongo-tools/mongoimport/dateconv"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -37,8 +38,20 @@ const (
 	ctInt64
 	ctDecimal
 	ctString
+	ctObjectID
+	ctUUID
+	ctNull
+	ctJSON
+	ctArray
+	ctTimestamp
+	ctRegex
+	ctDateEpoch
 )
 
+// nullableSuffix makes a column type null-aware: a cell that's empty or null
+// is parsed as null instead of as the type, as in int32_null().
+const nullableSuffix = "_null"
+
 var (
 	columnTypeRE      = regexp.MustCompile(`(?s)^(.*)\.(\w+)\((.*)\)$`)
 	columnTypeNameMap = map[string]columnType{
@@ -54,7 +67,18 @@ var (
 		"int32":       ctInt32,
 		"int64":       ctInt64,
 		"string":      ctString,
+		"objectId":    ctObjectID,
+		"uuid":        ctUUID,
+		"null":        ctNull,
+		"json":        ctJSON,
+		"array":       ctArray,
+		"timestamp":   ctTimestamp,
+		"regex":       ctRegex,
+		"date_epoch":  ctDateEpoch,
 	}
+	// arrayTypeRE matches the element type of an array column, and its
+	// argument, if any
+	arrayTypeRE = regexp.MustCompile(`(?s)^(\w+)(?:\((.*)\))?$`)
 )
 
 type binaryEncoding int
@@ -96,13 +120,12 @@ func ParseTypedHeader(header string, parseGrace ParseGrace) (f ColumnSpec, err e
 		err = fmt.Errorf("could not parse type from header %s", header)
 		return
 	}
-	t, ok := columnTypeNameMap[match[2]]
-	if !ok {
-		err = fmt.Errorf("invalid type %s in header %s", match[2], header)
+	p, ok, err := newTypedFieldParser(match[2], match[3])
+	if err != nil {
 		return
 	}
-	p, err := NewFieldParser(t, match[3])
-	if err != nil {
+	if !ok {
+		err = fmt.Errorf("invalid type %s in header %s", match[2], header)
 		return
 	}
 	nameParts := strings.Split(match[1], ".")
@@ -133,6 +156,28 @@ func ParseAutoHeaders(headers []string) (fs []ColumnSpec) {
 	return
 }
 
+// newTypedFieldParser yields the FieldParser of a column type given by name,
+// which may have the nullable suffix, as NewFieldParser does. ok is false if
+// there's no such type.
+func newTypedFieldParser(typeName, arg string) (parser FieldParser, ok bool, err error) {
+	t, ok := columnTypeNameMap[typeName]
+	nullable := false
+	if !ok && strings.HasSuffix(typeName, nullableSuffix) {
+		t, ok = columnTypeNameMap[strings.TrimSuffix(typeName, nullableSuffix)]
+		nullable = true
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	if parser, err = NewFieldParser(t, arg); err != nil {
+		return nil, true, err
+	}
+	if nullable {
+		parser = &FieldNullableParser{parser}
+	}
+	return parser, true, nil
+}
+
 // FieldParser is the interface for any parser of a field item.
 type FieldParser interface {
 	Parse(in string) (interface{}, error)
@@ -161,6 +206,9 @@ func NewFieldParser(t columnType, arg string) (parser FieldParser, err error) {
 	case ctDateGo:
 	case ctDateMS:
 	case ctDateOracle:
+	case ctArray:
+	case ctRegex:
+	case ctDateEpoch:
 	default:
 		if arg != "" {
 			err = fmt.Errorf("type %v does not support arguments", t)
@@ -191,6 +239,22 @@ func NewFieldParser(t columnType, arg string) (parser FieldParser, err error) {
 		parser = new(FieldDecimalParser)
 	case ctString:
 		parser = new(FieldStringParser)
+	case ctObjectID:
+		parser = new(FieldObjectIDParser)
+	case ctUUID:
+		parser = new(FieldUUIDParser)
+	case ctNull:
+		parser = new(FieldNullParser)
+	case ctJSON:
+		parser = new(FieldJSONParser)
+	case ctArray:
+		parser, err = NewFieldArrayParser(arg)
+	case ctTimestamp:
+		parser = new(FieldTimestampParser)
+	case ctRegex:
+		parser, err = NewFieldRegexParser(arg)
+	case ctDateEpoch:
+		parser, err = NewFieldDateEpochParser(arg)
 	default: // ctAuto
 		parser = new(FieldAutoParser)
 	}
@@ -291,3 +355,214 @@ type FieldStringParser struct{}
 func (sp *FieldStringParser) Parse(in string) (interface{}, error) {
 	return in, nil
 }
+
+// FieldObjectIDParser parses an ObjectID written as 24 hexadecimal digits.
+type FieldObjectIDParser struct{}
+
+func (op *FieldObjectIDParser) Parse(in string) (interface{}, error) {
+	return primitive.ObjectIDFromHex(in)
+}
+
+// FieldUUIDParser parses a UUID, with or without hyphens and braces, to
+// binary data of the UUID subtype.
+type FieldUUIDParser struct{}
+
+func (up *FieldUUIDParser) Parse(in string) (interface{}, error) {
+	digits := strings.ReplaceAll(strings.Trim(in, "{}"), "-", "")
+	data, err := hex.DecodeString(digits)
+	if err != nil || len(data) != 16 {
+		return nil, fmt.Errorf("failed to parse UUID: %s", in)
+	}
+	return primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: data}, nil
+}
+
+// isNullToken reports whether a cell stands for null: it's empty, or null in
+// any case.
+func isNullToken(in string) bool {
+	return in == "" || strings.EqualFold(in, "null")
+}
+
+// FieldNullParser parses an empty cell or null, in any case, to null.
+type FieldNullParser struct{}
+
+func (np *FieldNullParser) Parse(in string) (interface{}, error) {
+	if isNullToken(in) {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("failed to parse null: %s", in)
+}
+
+// FieldNullableParser parses null cells to null, and the others with parser.
+type FieldNullableParser struct {
+	parser FieldParser
+}
+
+func (np *FieldNullableParser) Parse(in string) (interface{}, error) {
+	if isNullToken(in) {
+		return nil, nil
+	}
+	return np.parser.Parse(in)
+}
+
+// FieldJSONParser parses an Extended JSON value, which may be a document or
+// an array.
+type FieldJSONParser struct{}
+
+func (jp *FieldJSONParser) Parse(in string) (interface{}, error) {
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON([]byte(`{"v":`+in+`}`), false, &doc); err != nil || len(doc) != 1 {
+		return nil, fmt.Errorf("failed to parse Extended JSON: %s", in)
+	}
+	return doc[0].Value, nil
+}
+
+// FieldArrayParser splits a cell by a separator into an array, whose elements
+// are trimmed of white space and parsed with parser. An empty cell is an
+// empty array.
+type FieldArrayParser struct {
+	parser    FieldParser
+	separator string
+}
+
+func (ap *FieldArrayParser) Parse(in string) (interface{}, error) {
+	if in == "" {
+		return bson.A{}, nil
+	}
+	parts := strings.Split(in, ap.separator)
+	values := make(bson.A, len(parts))
+	for i, part := range parts {
+		value, err := ap.parser.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse array element %d: %v", i, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// NewFieldArrayParser returns a FieldArrayParser from an argument of the form
+// <type>[,<separator>], where the type may have its own argument, as in
+// date_go(2006-01-02). The separator defaults to a comma.
+func NewFieldArrayParser(arg string) (*FieldArrayParser, error) {
+	elemType, separator := arg, ","
+	if i := strings.LastIndex(arg, ","); i >= 0 && !strings.HasSuffix(arg, ")") {
+		elemType, separator = arg[:i], arg[i+1:]
+		if separator == "" && strings.HasSuffix(elemType, ",") {
+			// array(int32,,) splits by commas
+			elemType, separator = strings.TrimSuffix(elemType, ","), ","
+		}
+	}
+	if separator == "" {
+		return nil, fmt.Errorf("invalid array separator in: %s", arg)
+	}
+	match := arrayTypeRE.FindStringSubmatch(elemType)
+	if match == nil {
+		return nil, fmt.Errorf("invalid array element type: %s", elemType)
+	}
+	if strings.TrimSuffix(match[1], nullableSuffix) == "array" {
+		return nil, fmt.Errorf("arrays of arrays are not supported")
+	}
+	parser, ok, err := newTypedFieldParser(match[1], match[2])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid array element type: %s", match[1])
+	}
+	return &FieldArrayParser{parser, separator}, nil
+}
+
+// FieldTimestampParser parses a timestamp written as <seconds>:<increment>,
+// as just <seconds>, with an increment of 0, or as an Extended JSON
+// $timestamp, as mongoexport writes it.
+type FieldTimestampParser struct{}
+
+func (tp *FieldTimestampParser) Parse(in string) (interface{}, error) {
+	if strings.HasPrefix(strings.TrimSpace(in), "{") {
+		value, err := new(FieldJSONParser).Parse(in)
+		if ts, ok := value.(primitive.Timestamp); ok && err == nil {
+			return ts, nil
+		}
+		return nil, fmt.Errorf("failed to parse timestamp: %s", in)
+	}
+	seconds, increment, _ := strings.Cut(in, ":")
+	if increment == "" {
+		increment = "0"
+	}
+	t, err := strconv.ParseUint(seconds, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %s", in)
+	}
+	i, err := strconv.ParseUint(increment, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %s", in)
+	}
+	return primitive.Timestamp{T: uint32(t), I: uint32(i)}, nil
+}
+
+// FieldRegexParser parses a regular expression written as /<pattern>/<options>,
+// or as just its pattern, which has the options given as the argument.
+type FieldRegexParser struct {
+	options string
+}
+
+// validRegexOptions are the options of MongoDB regular expressions.
+const validRegexOptions = "ilmsux"
+
+func (rp *FieldRegexParser) Parse(in string) (interface{}, error) {
+	pattern, options := in, rp.options
+	if end := strings.LastIndex(in, "/"); strings.HasPrefix(in, "/") && end > 0 {
+		pattern, options = in[1:end], in[end+1:]
+		if strings.Trim(options, validRegexOptions) != "" {
+			return nil, fmt.Errorf("invalid regex options: %s", options)
+		}
+	}
+	return primitive.Regex{Pattern: pattern, Options: options}, nil
+}
+
+// NewFieldRegexParser returns a FieldRegexParser whose argument is the options
+// of the patterns written without them, such as i for case-insensitive ones.
+func NewFieldRegexParser(arg string) (*FieldRegexParser, error) {
+	if strings.Trim(arg, validRegexOptions) != "" {
+		return nil, fmt.Errorf("invalid regex options: %s", arg)
+	}
+	return &FieldRegexParser{arg}, nil
+}
+
+// FieldDateEpochParser parses a date written as the number of seconds or
+// milliseconds since the Unix epoch.
+type FieldDateEpochParser struct {
+	millis bool
+}
+
+func (ep *FieldDateEpochParser) Parse(in string) (interface{}, error) {
+	if n, err := strconv.ParseInt(in, 10, 64); err == nil {
+		if ep.millis {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	f, err := strconv.ParseFloat(in, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("failed to parse epoch date: %s", in)
+	}
+	// the fraction is rounded to the nanosecond separately, as it isn't exact
+	whole, fraction := math.Modf(f)
+	if ep.millis {
+		nanos := time.Duration(math.Round(fraction * float64(time.Millisecond)))
+		return time.UnixMilli(int64(whole)).Add(nanos).UTC(), nil
+	}
+	return time.Unix(int64(whole), int64(math.Round(fraction*float64(time.Second)))).UTC(), nil
+}
+
+// NewFieldDateEpochParser returns a FieldDateEpochParser whose argument is the
+// unit of the numbers: s for seconds or ms for milliseconds.
+func NewFieldDateEpochParser(arg string) (*FieldDateEpochParser, error) {
+	switch arg {
+	case "s":
+		return &FieldDateEpochParser{false}, nil
+	case "ms":
+		return &FieldDateEpochParser{true}, nil
+	}
+	return nil, fmt.Errorf("invalid epoch unit: %s, must be s or ms", arg)
+}
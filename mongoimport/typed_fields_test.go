@@ -14,6 +14,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testtype"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -94,6 +95,22 @@ func TestTypedHeaderParser(t *testing.T) {
 			_, err = ParseTypedHeader("zip.binary(decimal)", pgAutoCast)
 			So(err, ShouldNotBeNil)
 		})
+		Convey("with bad arguments for the array, regex and date_epoch types", func() {
+			_, err = ParseTypedHeader("tags.array(money,;)", pgAutoCast)
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("tags.array(array(int32),;)", pgAutoCast)
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("tags.array(int32(1),;)", pgAutoCast)
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("re.regex(q)", pgAutoCast)
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("at.date_epoch(ns)", pgAutoCast)
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("id.objectId(hex)", pgAutoCast)
+			So(err, ShouldNotBeNil)
+			_, err = ParseTypedHeader("id.money_null()", pgAutoCast)
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
 
@@ -447,4 +464,212 @@ func TestFieldParsers(t *testing.T) {
 		})
 	})
 
+	Convey("Using FieldObjectIDParser", t, func() {
+		var p, _ = NewFieldParser(ctObjectID, "")
+
+		Convey("parses hex object ids", func() {
+			value, err := p.Parse("5f1e2d3c4b5a697887766554")
+			So(err, ShouldBeNil)
+			So(cast[primitive.ObjectID](value).Hex(), ShouldEqual, "5f1e2d3c4b5a697887766554")
+		})
+		Convey("does not parse other values", func() {
+			for _, in := range []string{"", "5f1e2d3c", "zz1e2d3c4b5a697887766554"} {
+				_, err := p.Parse(in)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Using FieldUUIDParser", t, func() {
+		var p, _ = NewFieldParser(ctUUID, "")
+		data := []byte{
+			0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3,
+			0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00,
+		}
+
+		Convey("parses UUIDs with or without hyphens and braces", func() {
+			for _, in := range []string{
+				"123e4567-e89b-12d3-a456-426614174000",
+				"123E4567E89B12D3A456426614174000",
+				"{123e4567-e89b-12d3-a456-426614174000}",
+			} {
+				value, err := p.Parse(in)
+				So(err, ShouldBeNil)
+				So(value, ShouldResemble, primitive.Binary{Subtype: 4, Data: data})
+			}
+		})
+		Convey("does not parse other values", func() {
+			for _, in := range []string{"", "123e4567", "123e4567-e89b-12d3-a456-4266141740zz"} {
+				_, err := p.Parse(in)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Using FieldNullParser and null-aware types", t, func() {
+		null, _ := NewFieldParser(ctNull, "")
+		nullable, ok, err := newTypedFieldParser("int32_null", "")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+
+		Convey("parses empty and null cells as null", func() {
+			for _, in := range []string{"", "null", "NULL"} {
+				for _, p := range []FieldParser{null, nullable} {
+					value, err := p.Parse(in)
+					So(err, ShouldBeNil)
+					So(value, ShouldBeNil)
+				}
+			}
+		})
+		Convey("parses other cells as the type", func() {
+			_, err := null.Parse("0")
+			So(err, ShouldNotBeNil)
+			value, err := nullable.Parse("42")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, int32(42))
+			_, err = nullable.Parse("forty-two")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Using FieldJSONParser", t, func() {
+		var p, _ = NewFieldParser(ctJSON, "")
+
+		Convey("parses Extended JSON values and documents", func() {
+			value, err := p.Parse(`{"a": 1, "b": {"$date": "2024-01-02T00:00:00Z"}, "c": [1.5, "x"]}`)
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, bson.D{
+				{"a", int32(1)},
+				{"b", primitive.NewDateTimeFromTime(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))},
+				{"c", bson.A{1.5, "x"}},
+			})
+			value, err = p.Parse(`{"$numberLong": "7"}`)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, int64(7))
+			value, err = p.Parse(`"text"`)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "text")
+		})
+		Convey("does not parse other values", func() {
+			for _, in := range []string{"", "text", `{"a": 1`, `1, "w": 2`} {
+				_, err := p.Parse(in)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Using FieldArrayParser", t, func() {
+		Convey("splits cells into typed arrays", func() {
+			p, err := NewFieldParser(ctArray, "int32,;")
+			So(err, ShouldBeNil)
+			value, err := p.Parse("1; 2;3")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, bson.A{int32(1), int32(2), int32(3)})
+			value, err = p.Parse("")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, bson.A{})
+			_, err = p.Parse("1;two")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("splits by commas by default", func() {
+			for _, arg := range []string{"string", "string,,"} {
+				p, err := NewFieldParser(ctArray, arg)
+				So(err, ShouldBeNil)
+				value, err := p.Parse("a,b")
+				So(err, ShouldBeNil)
+				So(value, ShouldResemble, bson.A{"a", "b"})
+			}
+		})
+		Convey("parses elements with arguments and nulls", func() {
+			spec, err := ParseTypedHeader(`days.array(date_go(2006-01-02),|)`, pgStop)
+			So(err, ShouldBeNil)
+			value, err := spec.Parser.Parse("2024-01-02|2024-01-03")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, bson.A{
+				time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			})
+			p, err := NewFieldParser(ctArray, "double_null,/")
+			So(err, ShouldBeNil)
+			value, err = p.Parse("1.5/null/")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, bson.A{1.5, nil, nil})
+		})
+	})
+
+	Convey("Using FieldTimestampParser", t, func() {
+		var p, _ = NewFieldParser(ctTimestamp, "")
+
+		Convey("parses seconds, increments and Extended JSON", func() {
+			for in, expected := range map[string]primitive.Timestamp{
+				"1700000000":   {T: 1700000000},
+				"1700000000:7": {T: 1700000000, I: 7},
+				`{"$timestamp": {"t": 1700000000, "i": 7}}`: {T: 1700000000, I: 7},
+			} {
+				value, err := p.Parse(in)
+				So(err, ShouldBeNil)
+				So(value, ShouldResemble, expected)
+			}
+		})
+		Convey("does not parse other values", func() {
+			for _, in := range []string{"", "-1", "1:x", "4294967296", `{"a": 1}`} {
+				_, err := p.Parse(in)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Using FieldRegexParser", t, func() {
+		var p, _ = NewFieldParser(ctRegex, "i")
+
+		Convey("parses patterns with their options", func() {
+			value, err := p.Parse("/^a.*z$/mx")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, primitive.Regex{Pattern: "^a.*z$", Options: "mx"})
+			value, err = p.Parse("a/b")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, primitive.Regex{Pattern: "a/b", Options: "i"})
+			_, err = p.Parse("/a/q")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Using FieldDateEpochParser", t, func() {
+		seconds, _ := NewFieldParser(ctDateEpoch, "s")
+		millis, _ := NewFieldParser(ctDateEpoch, "ms")
+
+		Convey("parses seconds and milliseconds since the epoch", func() {
+			value, err := seconds.Parse("1700000000")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, time.Unix(1700000000, 0).UTC())
+			value, err = seconds.Parse("1700000000.25")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, time.Unix(1700000000, 250000000).UTC())
+			value, err = millis.Parse("1700000000500")
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, time.UnixMilli(1700000000500).UTC())
+		})
+		Convey("does not parse other values", func() {
+			for _, in := range []string{"", "yesterday", "NaN"} {
+				_, err := seconds.Parse(in)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Using the new types with --parseGrace", t, func() {
+		colSpecs, err := ParseTypedHeaders([]string{"id.objectId()", "tags.array(int32,;)"}, pgSkipField)
+		So(err, ShouldBeNil)
+		doc, err := tokensToBSON(colSpecs, []string{"not an id", "1;2"}, 1, false, false)
+		So(err, ShouldBeNil)
+		So(doc, ShouldResemble, bson.D{{"tags", bson.A{int32(1), int32(2)}}})
+
+		colSpecs, err = ParseTypedHeaders([]string{"id.objectId()", "tags.array(int32,;)"}, pgSkipRow)
+		So(err, ShouldBeNil)
+		_, err = tokensToBSON(colSpecs, []string{"5f1e2d3c4b5a697887766554", "1;x"}, 1, false, false)
+		So(err, ShouldResemble, coercionError{
+			"type coercion failure for column 'tags', could not parse token '1;x' to type array",
+		})
+	})
+
 }
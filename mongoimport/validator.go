@@ -0,0 +1,278 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DocumentValidator checks documents locally against the $jsonSchema of a
+// collection's validator, as --dryRun does with --checkValidator. It checks
+// the bsonType, type, properties, required, additionalProperties (when it's
+// false), items, enum, minimum, maximum and pattern keywords; the others,
+// patterns that Go's regexp can't compile, and any query operators of the
+// validator besides $jsonSchema, are ignored.
+type DocumentValidator struct {
+	root     *jsonSchema
+	patterns map[string]*regexp.Regexp
+}
+
+// NewDocumentValidator returns a DocumentValidator for the validator of a
+// collection, or nil if it has no $jsonSchema.
+func NewDocumentValidator(validator bson.D) (*DocumentValidator, error) {
+	var schema interface{}
+	for _, elem := range validator {
+		if elem.Key == "$jsonSchema" {
+			schema = elem.Value
+		} else {
+			log.Logvf(log.Always, "the %v part of the validator is not checked", elem.Key)
+		}
+	}
+	if schema == nil {
+		return nil, nil
+	}
+	data, err := bson.MarshalExtJSON(schema, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("error reading $jsonSchema validator: %v", err)
+	}
+	dv := &DocumentValidator{root: &jsonSchema{}, patterns: map[string]*regexp.Regexp{}}
+	if err = json.Unmarshal(data, dv.root); err != nil {
+		return nil, fmt.Errorf("error reading $jsonSchema validator: %v", err)
+	}
+	dv.compilePatterns(dv.root)
+	return dv, nil
+}
+
+// compilePatterns compiles the patterns of a schema and of its properties and
+// items ahead of time, so that the validator is safe for concurrent use. The
+// server's patterns are PCRE, so a pattern that Go's regexp can't compile,
+// such as one with a lookahead or a backreference, isn't checked.
+func (dv *DocumentValidator) compilePatterns(s *jsonSchema) {
+	if s.Pattern != nil {
+		pattern, err := regexp.Compile(*s.Pattern)
+		if err != nil {
+			log.Logvf(log.Always, "the pattern %v of the validator is not checked: %v", *s.Pattern, err)
+		} else {
+			dv.patterns[*s.Pattern] = pattern
+		}
+	}
+	for _, property := range s.Properties {
+		dv.compilePatterns(property)
+	}
+	if s.Items != nil {
+		dv.compilePatterns(s.Items)
+	}
+}
+
+// Validate returns a validationError for the first part of a document that
+// fails the validator.
+func (dv *DocumentValidator) Validate(doc bson.D) error {
+	return dv.check(dv.root, "", doc)
+}
+
+func (dv *DocumentValidator) check(s *jsonSchema, path string, value interface{}) error {
+	fail := func(format string, args ...interface{}) error {
+		reason := fmt.Sprintf(format, args...)
+		if path == "" {
+			return validationError{"document " + reason}
+		}
+		return validationError{fmt.Sprintf("field '%v' %v", path, reason)}
+	}
+
+	bsonType := bsonTypeName(value)
+	if len(s.BSONType) > 0 && !s.BSONType.allowBSON(bsonType) {
+		return fail("is %v, not %v", bsonType, strings.Join(s.BSONType, " or "))
+	}
+	if len(s.Type) > 0 && !s.Type.allowJSON(bsonType) {
+		return fail("is %v, not %v", bsonType, strings.Join(s.Type, " or "))
+	}
+	if s.Enum != nil && !enumContains(s.Enum, value) {
+		return fail("is not one of the allowed values")
+	}
+	if number, ok := numericValue(value); ok {
+		if s.Minimum != nil && number < *s.Minimum {
+			return fail("is less than the minimum of %v", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fail("is greater than the maximum of %v", *s.Maximum)
+		}
+	}
+	if str, ok := value.(string); ok && s.Pattern != nil {
+		pattern, ok := dv.patterns[*s.Pattern]
+		if ok && !pattern.MatchString(str) {
+			return fail("does not match pattern %v", pattern)
+		}
+	}
+
+	if doc, ok := documentValue(value); ok {
+		present := map[string]bool{}
+		for _, elem := range doc {
+			present[elem.Key] = true
+			property := s.Properties[elem.Key]
+			if property == nil {
+				if string(s.AdditionalProperties) == "false" {
+					return fail("has the field '%v', which is not allowed", elem.Key)
+				}
+				continue
+			}
+			if err := dv.check(property, joinPath(path, elem.Key), elem.Value); err != nil {
+				return err
+			}
+		}
+		for _, name := range s.Required {
+			if !present[name] {
+				return fail("is missing the required field '%v'", name)
+			}
+		}
+	}
+	if array, ok := arrayValue(value); ok && s.Items != nil {
+		for i, elem := range array {
+			if err := dv.check(s.Items, joinPath(path, fmt.Sprint(i)), elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// bsonTypeName returns the $jsonSchema bsonType of a value.
+func bsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case int32:
+		return "int"
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	case primitive.Decimal128:
+		return "decimal"
+	case bool:
+		return "bool"
+	case time.Time, primitive.DateTime:
+		return "date"
+	case primitive.ObjectID:
+		return "objectId"
+	case primitive.Binary, []byte:
+		return "binData"
+	case primitive.Timestamp:
+		return "timestamp"
+	case primitive.Regex:
+		return "regex"
+	}
+	if _, ok := documentValue(value); ok {
+		return "object"
+	}
+	if _, ok := arrayValue(value); ok {
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// allowBSON reports whether a value of the given bsonType is allowed.
+func (st schemaTypes) allowBSON(bsonType string) bool {
+	for _, t := range st {
+		if t == bsonType {
+			return true
+		}
+		if t == "number" && isNumberType(bsonType) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowJSON reports whether a value of the given bsonType has one of the
+// allowed JSON types.
+func (st schemaTypes) allowJSON(bsonType string) bool {
+	for _, t := range st {
+		switch t {
+		case "number":
+			if isNumberType(bsonType) {
+				return true
+			}
+		case "integer":
+			if bsonType == "int" || bsonType == "long" {
+				return true
+			}
+		case "boolean":
+			if bsonType == "bool" {
+				return true
+			}
+		default:
+			if t == bsonType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isNumberType(bsonType string) bool {
+	switch bsonType {
+	case "int", "long", "double", "decimal":
+		return true
+	}
+	return false
+}
+
+func documentValue(value interface{}) (bson.D, bool) {
+	switch v := value.(type) {
+	case bson.D:
+		return v, true
+	case *bson.D:
+		if v != nil {
+			return *v, true
+		}
+	case bson.M:
+		// map keys have no order, so sort them for the messages to be stable
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		doc := make(bson.D, len(keys))
+		for i, key := range keys {
+			doc[i] = bson.E{Key: key, Value: v[key]}
+		}
+		return doc, true
+	}
+	return nil, false
+}
+
+func arrayValue(value interface{}) (bson.A, bool) {
+	switch v := value.(type) {
+	case bson.A:
+		return v, true
+	case *bson.A:
+		if v != nil {
+			return *v, true
+		}
+	case []interface{}:
+		return v, true
+	}
+	return nil, false
+}
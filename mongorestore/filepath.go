@@ -18,6 +18,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/signing"
 	"github.com/mongodb/mongo-tools/common/util"
 )
 
@@ -97,6 +98,9 @@ type realBSONFile struct {
 	errorWriter
 	intent *intents.Intent
 	gzip   bool
+	// parts are the paths of the parts of a BSON file that mongodump split
+	// with --maxFileSize. They are read in order instead of path.
+	parts []string
 }
 
 // Open is part of the intents.file interface. realBSONFiles need to be Opened before Read
@@ -106,7 +110,12 @@ func (f *realBSONFile) Open() (err error) {
 		// this error shouldn't happen normally
 		return fmt.Errorf("error reading BSON file for %v", f.intent.Namespace())
 	}
-	file, err := os.Open(f.path)
+	var file io.ReadCloser
+	if len(f.parts) > 0 {
+		file, err = util.NewPartsReader(f.parts)
+	} else {
+		file, err = os.Open(f.path)
+	}
 	if err != nil {
 		return fmt.Errorf("error reading BSON file %v: %v", f.path, err)
 	}
@@ -372,9 +381,16 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike) error {
 						Demux:  restore.archive.Demux,
 					}
 				} else {
-					oplogIntent.BSONFile = &realBSONFile{path: entry.Path(), intent: oplogIntent, gzip: restore.InputOptions.Gzip}
+					oplogIntent.BSONFile = &realBSONFile{
+						path:   entry.Path(),
+						intent: oplogIntent,
+						gzip:   restore.InputOptions.Gzip,
+						parts:  bsonFileParts(entry),
+					}
 				}
 				restore.manager.Put(oplogIntent)
+			} else if signing.IsManifestFile(entry.Name()) {
+				log.Logvf(log.DebugLow, "found dump signature file %v", entry.Path())
 			} else {
 				log.Logvf(log.Always, `don't know what to do with file "%v", skipping...`, entry.Path())
 			}
@@ -509,7 +525,12 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, dir archive.DirLike)
 						continue
 					}
 					intent.Location = entry.Path()
-					intent.BSONFile = &realBSONFile{path: entry.Path(), intent: intent, gzip: restore.InputOptions.Gzip}
+					intent.BSONFile = &realBSONFile{
+						path:   entry.Path(),
+						intent: intent,
+						gzip:   restore.InputOptions.Gzip,
+						parts:  bsonFileParts(entry),
+					}
 				}
 				log.Logvf(log.Info, "found collection %v bson to restore to %v", sourceNS, destNS)
 				restore.manager.PutWithNamespace(checkSourceNS, intent)
@@ -796,7 +817,7 @@ func (ap actualPath) ReadDir() ([]archive.DirLike, error) {
 				parent:   &ap,
 			})
 	}
-	return returnFileInfo, nil
+	return groupBSONParts(returnFileInfo)
 }
 
 func (ap actualPath) Stat() (archive.DirLike, error) {
@@ -814,3 +835,101 @@ func (ap actualPath) IsDir() bool {
 	}
 	return stat.IsDir()
 }
+
+// bsonPartsPath stands for a BSON file that mongodump split into parts with
+// --maxFileSize, such as coll.000.bson and coll.001.bson for coll.bson. It has
+// the name of the whole file and the total size of its parts.
+type bsonPartsPath struct {
+	actualPath
+	name  string
+	size  int64
+	parts []string
+}
+
+func (bp bsonPartsPath) Name() string {
+	return bp.name
+}
+
+func (bp bsonPartsPath) Path() string {
+	return filepath.Join(bp.path, bp.name)
+}
+
+func (bp bsonPartsPath) Size() int64 {
+	return bp.size
+}
+
+func (bp bsonPartsPath) IsDir() bool {
+	return false
+}
+
+func (bp bsonPartsPath) Stat() (archive.DirLike, error) {
+	return bp, nil
+}
+
+// bsonFileParts returns the paths of the parts of a BSON file, or nil if the
+// file isn't split.
+func bsonFileParts(entry archive.DirLike) []string {
+	if bp, ok := entry.(bsonPartsPath); ok {
+		return bp.parts
+	}
+	return nil
+}
+
+// groupBSONParts replaces the parts of each split BSON file in a directory
+// listing with a single entry for the whole file. A file such as coll.000.bson
+// is a part unless it has its own coll.000.metadata.json, in which case it is
+// the dump of a collection named "coll.000". Parts must be numbered
+// consecutively from 000, and can't be mixed with an unsplit file of the same
+// name.
+func groupBSONParts(entries []archive.DirLike) ([]archive.DirLike, error) {
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	grouped := make([]archive.DirLike, 0, len(entries))
+	partsByName := map[string][]actualPath{}
+	positions := map[string]int{}
+	for _, entry := range entries {
+		part, ok := entry.(actualPath)
+		if !ok || entry.IsDir() {
+			grouped = append(grouped, entry)
+			continue
+		}
+		whole, number, ok := util.ParseBSONPartName(entry.Name())
+		base := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".gz"), ".bson")
+		if !ok || names[base+".metadata.json"] || names[base+".metadata.json.gz"] {
+			grouped = append(grouped, entry)
+			continue
+		}
+		if names[whole] {
+			return nil, fmt.Errorf("found both %v and its part %v", whole, entry.Name())
+		}
+		parts, found := partsByName[whole]
+		if !found {
+			// keep the entry for the whole file where its parts are listed
+			positions[whole] = len(grouped)
+			grouped = append(grouped, nil)
+		}
+		if len(parts) <= number {
+			parts = append(parts, make([]actualPath, number+1-len(parts))...)
+		}
+		parts[number] = part
+		partsByName[whole] = parts
+	}
+	for whole, parts := range partsByName {
+		bp := bsonPartsPath{actualPath: parts[0], name: whole}
+		for number, part := range parts {
+			if part.FileInfo == nil {
+				return nil, fmt.Errorf(
+					"part %v of %v is missing",
+					util.BSONPartPath(filepath.Join(parts[len(parts)-1].path, whole), number),
+					whole,
+				)
+			}
+			bp.size += part.Size()
+			bp.parts = append(bp.parts, part.Path())
+		}
+		grouped[positions[whole]] = bp
+	}
+	return grouped, nil
+}
@@ -8,6 +8,10 @@ package mongorestore
 
 import (
 	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -19,6 +23,8 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore/ns"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -625,3 +631,116 @@ func TestCreateIntentsForLongCollectionName(t *testing.T) {
 		)
 	})
 }
+
+func TestCreateIntentsForDBSplitBSON(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	writeParts := func(t *testing.T, dir, whole string, gz bool, parts ...string) {
+		for i, part := range parts {
+			file, err := os.Create(filepath.Join(dir, util.BSONPartPath(whole, i)))
+			require.NoError(t, err)
+			var out io.WriteCloser = file
+			if gz {
+				out = gzip.NewWriter(file)
+			}
+			_, err = out.Write([]byte(part))
+			require.NoError(t, err)
+			require.NoError(t, out.Close())
+			if gz {
+				require.NoError(t, file.Close())
+			}
+		}
+	}
+	readIntent := func(t *testing.T, intent *intents.Intent) string {
+		require.NoError(t, intent.BSONFile.Open())
+		data, err := io.ReadAll(intent.BSONFile)
+		require.NoError(t, err)
+		require.NoError(t, intent.BSONFile.Close())
+		return string(data)
+	}
+
+	for _, gz := range []bool{false, true} {
+		dir := t.TempDir()
+		ext := ".bson"
+		if gz {
+			ext = ".bson.gz"
+		}
+		writeParts(t, dir, "c1"+ext, gz, "part0", "part1", "part2")
+		writeParts(t, dir, "c2"+ext, gz, "only")
+		// a collection named "c3.000", with its own metadata, isn't a part
+		writeParts(t, dir, "c3"+ext, gz, "c3.000")
+		metadataName := "c3.000.metadata.json"
+		if gz {
+			metadataName += ".gz"
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, metadataName), nil, 0644))
+
+		mr := newMongoRestore()
+		mr.InputOptions.Gzip = gz
+		ddl, err := newActualPath(dir)
+		require.NoError(t, err)
+		require.NoError(t, mr.CreateIntentsForDB("myDB", ddl))
+		mr.manager.Finalize(intents.Legacy)
+
+		c1 := mr.manager.Pop()
+		require.NotNil(t, c1)
+		assert.Equal(t, "c1", c1.C)
+		assert.Equal(t, filepath.Join(dir, "c1"+ext), c1.Location)
+		assert.Equal(t, "part0part1part2", readIntent(t, c1))
+
+		c2 := mr.manager.Pop()
+		require.NotNil(t, c2)
+		assert.Equal(t, "c2", c2.C)
+		assert.Equal(t, "only", readIntent(t, c2))
+
+		c3 := mr.manager.Pop()
+		require.NotNil(t, c3)
+		assert.Equal(t, "c3.000", c3.C)
+		assert.Equal(t, "c3.000", readIntent(t, c3))
+		assert.Nil(t, mr.manager.Pop())
+	}
+
+	t.Run("missing part", func(t *testing.T) {
+		dir := t.TempDir()
+		writeParts(t, dir, "c1.bson", false, "part0", "part1", "part2")
+		require.NoError(t, os.Remove(filepath.Join(dir, "c1.001.bson")))
+		ddl, err := newActualPath(dir)
+		require.NoError(t, err)
+		err = newMongoRestore().CreateIntentsForDB("myDB", ddl)
+		assert.ErrorContains(t, err, "c1.001.bson of c1.bson is missing")
+	})
+
+	t.Run("parts and whole file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeParts(t, dir, "c1.bson", false, "part0")
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "c1.bson"), nil, 0644))
+		ddl, err := newActualPath(dir)
+		require.NoError(t, err)
+		err = newMongoRestore().CreateIntentsForDB("myDB", ddl)
+		assert.ErrorContains(t, err, "found both c1.bson and its part c1.000.bson")
+	})
+}
+
+func TestGetArchiveReaderParts(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	path := filepath.Join(t.TempDir(), "dump.archive")
+	w, err := util.NewPartWriter(path, 4)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a split archive"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	mr := newMongoRestore()
+	mr.InputOptions.Archive = path
+	in, err := mr.getArchiveReader()
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "a split archive", string(data))
+
+	mr.InputOptions.Archive = filepath.Join(t.TempDir(), "missing.archive")
+	_, err = mr.getArchiveReader()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,185 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/idx"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+)
+
+// indexBuildPool builds the indexes of collections whose data has already been
+// restored while other collections are still being loaded. Namespaces are
+// submitted as their data finishes loading and are handled by a fixed number of
+// workers so that index builds don't starve the insertion workers.
+type indexBuildPool struct {
+	build func(*options.Namespace) error
+	queue chan options.Namespace
+	wg    sync.WaitGroup
+
+	mu    sync.Mutex
+	built map[options.Namespace]bool
+	err   error
+}
+
+// newIndexBuildPool starts an index build pool with the given number of workers,
+// which build the indexes of a namespace with build. Up to maxNamespaces
+// namespaces can be submitted without blocking.
+func newIndexBuildPool(
+	build func(*options.Namespace) error,
+	numWorkers, maxNamespaces int,
+) *indexBuildPool {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	pool := &indexBuildPool{
+		build: build,
+		// Submitting a namespace must never hold up a restore routine, so the
+		// queue has room for every namespace being restored.
+		queue: make(chan options.Namespace, maxNamespaces),
+		built: make(map[options.Namespace]bool),
+	}
+
+	log.Logvf(log.DebugLow, "building indexes with up to %v workers while restoring data", numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		pool.wg.Add(1)
+		go pool.work(i)
+	}
+	return pool
+}
+
+func (pool *indexBuildPool) work(id int) {
+	defer pool.wg.Done()
+	log.Logvf(log.DebugHigh, "starting overlapping index build routine with id=%v", id)
+	for namespace := range pool.queue {
+		if pool.failed() {
+			// Don't start any new builds once one of them has failed; the
+			// remaining namespaces are reported by Wait's error.
+			continue
+		}
+		err := pool.build(&namespace)
+		pool.mu.Lock()
+		if err != nil && pool.err == nil {
+			pool.err = err
+		}
+		pool.built[namespace] = err == nil
+		pool.mu.Unlock()
+	}
+	log.Logvf(log.DebugHigh, "ending overlapping index build routine with id=%v", id)
+}
+
+func (pool *indexBuildPool) failed() bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.err != nil
+}
+
+// Submit queues the index builds for a namespace whose data has finished loading.
+func (pool *indexBuildPool) Submit(namespace options.Namespace) {
+	pool.queue <- namespace
+}
+
+// Wait blocks until all submitted index builds are done and returns the first
+// error encountered, if any.
+func (pool *indexBuildPool) Wait() error {
+	close(pool.queue)
+	pool.wg.Wait()
+	return pool.err
+}
+
+// Built reports whether the indexes for the namespace were already built by the pool.
+func (pool *indexBuildPool) Built(namespace options.Namespace) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.built[namespace]
+}
+
+// submitIndexBuilds hands a collection whose data has been fully restored to the
+// overlapping index build pool, if there is one.
+func (restore *MongoRestore) submitIndexBuilds(intent *intents.Intent) {
+	if restore.indexBuilds == nil {
+		return
+	}
+	if restore.indexCatalog.GetIndexes(intent.DB, intent.C) == nil {
+		return
+	}
+	restore.indexBuilds.Submit(options.Namespace{DB: intent.DB, Collection: intent.C})
+}
+
+// indexesAlreadyBuilt reports whether the indexes of a namespace were built
+// while data was still being restored.
+func (restore *MongoRestore) indexesAlreadyBuilt(namespace *options.Namespace) bool {
+	return restore.indexBuilds != nil && restore.indexBuilds.Built(*namespace)
+}
+
+// commitQuorum returns the commit quorum of the createIndexes command, or nil
+// if --commitQuorum isn't set or the server is a standalone, which refuses it.
+func (restore *MongoRestore) commitQuorum() interface{} {
+	if restore.OutputOptions.CommitQuorum == "" || restore.isStandalone {
+		return nil
+	}
+	return parseCommitQuorum(restore.OutputOptions.CommitQuorum)
+}
+
+// parseCommitQuorum converts the --commitQuorum value into the form expected by
+// the createIndexes command: either a number of voting members or a string such
+// as "majority", "votingMembers" or a replica set tag name.
+func parseCommitQuorum(value string) interface{} {
+	if n, err := strconv.ParseInt(value, 10, 32); err == nil {
+		return int32(n)
+	}
+	return value
+}
+
+// hideIndexes marks every index as hidden if the namespace matches --hideIndexes.
+func (restore *MongoRestore) hideIndexes(namespace *options.Namespace, indexes []*idx.IndexDocument) {
+	if restore.indexHider == nil || !restore.indexHider.Has(namespace.String()) {
+		return
+	}
+	for _, index := range indexes {
+		log.Logvf(
+			log.Info,
+			"building index %v on %v as hidden",
+			index.Options["name"],
+			namespace.String(),
+		)
+		index.Options["hidden"] = true
+	}
+}
+
+func (restore *MongoRestore) validateIndexBuildOptions() error {
+	opts := restore.OutputOptions
+	if opts.OverlapIndexBuilds {
+		if opts.NoIndexRestore {
+			return fmt.Errorf("cannot use %v with %v", OverlapIndexBuildsOption, NoIndexRestoreOption)
+		}
+		if restore.InputOptions.OplogReplay {
+			// oplog replay can modify the index catalog, so indexes can only be
+			// built once it is done
+			return fmt.Errorf("cannot use %v with %v", OverlapIndexBuildsOption, OplogReplayOption)
+		}
+		if opts.NumParallelIndexBuilds < 1 {
+			return fmt.Errorf("%v must be at least 1", NumParallelIndexBuildsOption)
+		}
+	}
+	if opts.CommitQuorum != "" && restore.serverVersion.LT(db.Version{4, 4, 0}) {
+		return fmt.Errorf("%v requires server version 4.4 or later", CommitQuorumOption)
+	}
+	if opts.CommitQuorum != "" && restore.isStandalone {
+		log.Logvf(log.Always, "ignoring %v, which doesn't apply to standalone servers", CommitQuorumOption)
+	}
+	if len(opts.HideIndexes) > 0 && restore.serverVersion.LT(db.Version{4, 4, 0}) {
+		return fmt.Errorf("%v requires server version 4.4 or later", HideIndexesOption)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/idx"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/mongorestore/ns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseCommitQuorum(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	assert.Equal(t, int32(2), parseCommitQuorum("2"))
+	assert.Equal(t, int32(0), parseCommitQuorum("0"))
+	assert.Equal(t, "majority", parseCommitQuorum("majority"))
+	assert.Equal(t, "votingMembers", parseCommitQuorum("votingMembers"))
+}
+
+func TestHideIndexes(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	hider, err := ns.NewMatcher([]string{"test.hidden*"})
+	require.NoError(t, err)
+	restore := &MongoRestore{indexHider: hider}
+
+	newIndexes := func() []*idx.IndexDocument {
+		return []*idx.IndexDocument{
+			{Key: bson.D{{"a", 1}}, Options: bson.M{"name": "a_1"}},
+			{Key: bson.D{{"b", -1}}, Options: bson.M{"name": "b_-1"}},
+		}
+	}
+
+	indexes := newIndexes()
+	restore.hideIndexes(&options.Namespace{DB: "test", Collection: "hiddenColl"}, indexes)
+	for _, index := range indexes {
+		assert.Equal(t, true, index.Options["hidden"], "index %v is hidden", index.Options["name"])
+	}
+
+	indexes = newIndexes()
+	restore.hideIndexes(&options.Namespace{DB: "test", Collection: "visible"}, indexes)
+	for _, index := range indexes {
+		assert.NotContains(t, index.Options, "hidden", "index %v is visible", index.Options["name"])
+	}
+}
+
+func TestValidateIndexBuildOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	cases := []struct {
+		label   string
+		input   InputOptions
+		output  OutputOptions
+		version db.Version
+		valid   bool
+	}{
+		{
+			label:   "overlapping builds",
+			output:  OutputOptions{OverlapIndexBuilds: true, NumParallelIndexBuilds: 2},
+			version: db.Version{4, 2, 0},
+			valid:   true,
+		},
+		{
+			label:   "overlapping builds without index restore",
+			output:  OutputOptions{OverlapIndexBuilds: true, NumParallelIndexBuilds: 2, NoIndexRestore: true},
+			version: db.Version{7, 0, 0},
+		},
+		{
+			label:   "overlapping builds with oplog replay",
+			input:   InputOptions{OplogReplay: true},
+			output:  OutputOptions{OverlapIndexBuilds: true, NumParallelIndexBuilds: 2},
+			version: db.Version{7, 0, 0},
+		},
+		{
+			label:   "overlapping builds without workers",
+			output:  OutputOptions{OverlapIndexBuilds: true},
+			version: db.Version{7, 0, 0},
+		},
+		{
+			label:   "commit quorum",
+			output:  OutputOptions{CommitQuorum: "majority"},
+			version: db.Version{4, 4, 0},
+			valid:   true,
+		},
+		{
+			label:   "commit quorum on an old server",
+			output:  OutputOptions{CommitQuorum: "majority"},
+			version: db.Version{4, 2, 0},
+		},
+		{
+			label:   "hidden indexes on an old server",
+			output:  OutputOptions{HideIndexes: []string{"*"}},
+			version: db.Version{4, 2, 0},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.label, func(t *testing.T) {
+			restore := &MongoRestore{
+				InputOptions:  &c.input,
+				OutputOptions: &c.output,
+				serverVersion: c.version,
+			}
+			err := restore.validateIndexBuildOptions()
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCommitQuorum(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	restore := &MongoRestore{OutputOptions: &OutputOptions{CommitQuorum: "majority"}}
+	assert.Equal(t, "majority", restore.commitQuorum(), "replica sets and mongos take a commit quorum")
+	restore.isStandalone = true
+	assert.Nil(t, restore.commitQuorum(), "standalone servers refuse a commit quorum")
+	restore.isStandalone = false
+	restore.OutputOptions.CommitQuorum = ""
+	assert.Nil(t, restore.commitQuorum())
+}
+
+func TestIndexBuildPool(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	namespaces := []options.Namespace{
+		{DB: "test", Collection: "a"},
+		{DB: "test", Collection: "b"},
+		{DB: "test", Collection: "c"},
+		{DB: "test", Collection: "d"},
+		{DB: "test", Collection: "e"},
+	}
+
+	t.Run("builds run concurrently on every worker", func(t *testing.T) {
+		const numWorkers = 3
+		var mu sync.Mutex
+		var running, maxRunning int
+		started := make(chan struct{}, len(namespaces))
+		release := make(chan struct{})
+		pool := newIndexBuildPool(func(*options.Namespace) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			started <- struct{}{}
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		}, numWorkers, len(namespaces))
+
+		for _, namespace := range namespaces {
+			pool.Submit(namespace)
+		}
+		// every worker is busy before any build finishes
+		for i := 0; i < numWorkers; i++ {
+			<-started
+		}
+		close(release)
+		require.NoError(t, pool.Wait())
+		assert.Equal(t, numWorkers, maxRunning)
+		for _, namespace := range namespaces {
+			assert.True(t, pool.Built(namespace), "indexes of %v are built", namespace)
+		}
+	})
+
+	t.Run("the first error stops new builds", func(t *testing.T) {
+		failure := errors.New("index build failed")
+		var built []string
+		pool := newIndexBuildPool(func(namespace *options.Namespace) error {
+			built = append(built, namespace.Collection)
+			if namespace.Collection == "b" {
+				return failure
+			}
+			return nil
+		}, 1, len(namespaces))
+
+		for _, namespace := range namespaces {
+			pool.Submit(namespace)
+		}
+		assert.Equal(t, failure, pool.Wait())
+		assert.Equal(t, []string{"a", "b"}, built)
+		assert.True(t, pool.Built(namespaces[0]))
+		for _, namespace := range namespaces[1:] {
+			assert.False(t, pool.Built(namespace), "indexes of %v aren't built", namespace)
+		}
+	})
+}
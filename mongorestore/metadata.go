@@ -213,6 +213,10 @@ func (restore *MongoRestore) CreateIndexes(
 		rawCommand = append(rawCommand, bson.E{"ignoreUnknownIndexOptions", true})
 	}
 
+	if commitQuorum := restore.commitQuorum(); commitQuorum != nil {
+		rawCommand = append(rawCommand, bson.E{"commitQuorum", commitQuorum})
+	}
+
 	err = session.Database(dbName).RunCommand(context.TODO(), rawCommand).Err()
 	if err == nil {
 		return nil
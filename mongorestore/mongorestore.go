@@ -9,10 +9,12 @@ package mongorestore
 
 import (
 	"compress/gzip"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,6 +31,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/signing"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore/ns"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -70,6 +73,7 @@ type MongoRestore struct {
 	objCheck     bool
 	oplogLimit   primitive.Timestamp
 	isMongos     bool
+	isStandalone bool
 	isAtlasProxy bool
 	authVersions authVersionPair
 
@@ -77,17 +81,24 @@ type MongoRestore struct {
 	knownCollections      map[string][]string
 	knownCollectionsMutex sync.Mutex
 
-	renamer  *ns.Renamer
-	includer *ns.Matcher
-	excluder *ns.Matcher
+	renamer    *ns.Renamer
+	includer   *ns.Matcher
+	excluder   *ns.Matcher
+	indexHider *ns.Matcher
 
 	// indexes belonging to dbs and collections
 	dbCollectionIndexes map[string]collectionIndexes
 
 	indexCatalog *idx.IndexCatalog
 
+	// builds indexes while data is still being restored, if --overlapIndexBuilds is set
+	indexBuilds *indexBuildPool
+
 	archive *archive.Reader
 
+	// verifyKey is the public key from --verifySignatureKey
+	verifyKey ed25519.PublicKey
+
 	// boolean set if termination signal received; false by default
 	terminate atomic.Bool
 
@@ -208,7 +219,7 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		if !restore.InputOptions.OplogReplay {
 			return fmt.Errorf("cannot use --oplogLimit without --oplogReplay enabled")
 		}
-		restore.oplogLimit, err = ParseTimestampFlag(restore.InputOptions.OplogLimit)
+		restore.oplogLimit, err = util.ParseTimestampFlag(restore.InputOptions.OplogLimit)
 		if err != nil {
 			return fmt.Errorf("error parsing timestamp argument to --oplogLimit: %v", err)
 		}
@@ -221,6 +232,22 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 			return fmt.Errorf("cannot use --oplogFile with --archive specified")
 		}
 	}
+	if restore.InputOptions.Salvage && restore.InputOptions.Archive == "" {
+		return fmt.Errorf("cannot use --salvage without --archive")
+	}
+	if restore.InputOptions.VerifySignatureKey != "" {
+		if restore.InputOptions.Salvage {
+			return fmt.Errorf("cannot use --salvage with --verifySignatureKey")
+		}
+		if restore.InputOptions.Archive == "" && restore.TargetDirectory == "-" {
+			return fmt.Errorf("cannot use --verifySignatureKey when restoring from standard input " +
+				"without --archive")
+		}
+		restore.verifyKey, err = signing.LoadPublicKey(restore.InputOptions.VerifySignatureKey)
+		if err != nil {
+			return fmt.Errorf("error loading --verifySignatureKey: %v", err)
+		}
+	}
 
 	// check if we are using a replica set and fall back to w=1 if we aren't (for <= 2.4)
 	nodeType, err := restore.SessionProvider.GetNodeType()
@@ -229,6 +256,7 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	}
 
 	log.Logvf(log.DebugLow, "connected to node type: %v", nodeType)
+	restore.isStandalone = nodeType == db.Standalone
 
 	// deprecations with --nsInclude --nsExclude
 	if restore.ToolOptions.Namespace.DB != "" || restore.ToolOptions.Namespace.Collection != "" {
@@ -315,6 +343,17 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		return fmt.Errorf("cannot specify --preserveUUID without --drop")
 	}
 
+	err = restore.validateIndexBuildOptions()
+	if err != nil {
+		return err
+	}
+	if len(restore.OutputOptions.HideIndexes) > 0 {
+		restore.indexHider, err = ns.NewMatcher(restore.OutputOptions.HideIndexes)
+		if err != nil {
+			return fmt.Errorf("invalid %v patterns: %v", HideIndexesOption, err)
+		}
+	}
+
 	// a single dash signals reading from stdin
 	if restore.TargetDirectory == "-" {
 		if restore.InputOptions.Archive != "" {
@@ -353,6 +392,16 @@ func (restore *MongoRestore) Restore() Result {
 			if err != nil {
 				return Result{Err: err}
 			}
+			if restore.verifyKey != nil {
+				archiveReader, err = restore.verifyArchive(archiveReader)
+				if err != nil {
+					return Result{Err: err}
+				}
+			}
+			if restore.InputOptions.Salvage {
+				// count the bytes read so that damage is reported at its offset in the archive
+				archiveReader = archive.NewOffsetReader(archiveReader)
+			}
 			restore.archive = &archive.Reader{
 				In:      archiveReader,
 				Prelude: &archive.Prelude{},
@@ -397,6 +446,12 @@ func (restore *MongoRestore) Restore() Result {
 			}
 			return Result{Err: fmt.Errorf("mongorestore target '%v' invalid: %v", restore.TargetDirectory, err)}
 		}
+		if restore.verifyKey != nil {
+			err = restore.verifyDumpFiles()
+			if err != nil {
+				return Result{Err: err}
+			}
+		}
 		preludeFileExists, err := restore.ReadPreludeMetadata(target)
 		if !preludeFileExists {
 			// don't error out here because mongodump versions before 100.12.0 will not include prelude.json
@@ -450,6 +505,15 @@ func (restore *MongoRestore) Restore() Result {
 			restore.archive.In,
 			restore.isAtlasProxy,
 		)
+		compression := restore.archive.Prelude.Header.Compression
+		if err = archive.ValidateCompression(compression); err != nil {
+			return Result{Err: err}
+		}
+		if compression != archive.CompressionNone {
+			log.Logvf(log.DebugLow, "archive segments are compressed with %v", compression)
+		}
+		restore.archive.Demux.Compression = compression
+		restore.archive.Demux.Salvage = restore.InputOptions.Salvage
 	}
 
 	switch {
@@ -529,6 +593,13 @@ func (restore *MongoRestore) Restore() Result {
 		return Result{Err: fmt.Errorf("cannot restore with conflicting namespace destinations")}
 	}
 
+	if restore.InputOptions.Archive != "" {
+		err = restore.seekArchiveWithIndex()
+		if err != nil {
+			return Result{Err: fmt.Errorf("error reading archive index: %v", err)}
+		}
+	}
+
 	if restore.OutputOptions.DryRun {
 		log.Logvf(log.Always, "dry run completed")
 		return Result{}
@@ -635,7 +706,21 @@ func (restore *MongoRestore) Restore() Result {
 		restore.manager.Finalize(intents.Legacy)
 	}
 
+	if restore.OutputOptions.OverlapIndexBuilds {
+		restore.indexBuilds = newIndexBuildPool(
+			restore.RestoreIndexesForNamespace,
+			restore.OutputOptions.NumParallelIndexBuilds,
+			len(restore.manager.NormalIntents()),
+		)
+	}
+
 	result := restore.RestoreIntents()
+	if restore.indexBuilds != nil {
+		err = restore.indexBuilds.Wait()
+		if err != nil && result.Err == nil {
+			result = result.withErr(err)
+		}
+	}
 	if result.Err != nil {
 		return result
 	}
@@ -665,6 +750,9 @@ func (restore *MongoRestore) Restore() Result {
 
 	if restore.InputOptions.Archive != "" {
 		<-demuxFinished
+		if restore.InputOptions.Salvage {
+			restore.archive.Demux.SalvageReport.Log()
+		}
 		return result.withErr(demuxErr)
 	}
 
@@ -815,20 +903,17 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 		rc = io.NopCloser(restore.InputReader)
 	} else {
 		targetStat, err := os.Stat(restore.InputOptions.Archive)
-		if err != nil {
-			return nil, err
-		}
-		if targetStat.IsDir() {
+		if err == nil && targetStat.IsDir() {
 			defaultArchiveFilePath := filepath.Join(restore.InputOptions.Archive, "archive")
 			if restore.InputOptions.Gzip {
 				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
 			}
-			rc, err = os.Open(defaultArchiveFilePath)
+			rc, err = openArchiveFile(defaultArchiveFilePath)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			rc, err = os.Open(restore.InputOptions.Archive)
+			rc, err = openArchiveFile(restore.InputOptions.Archive)
 			if err != nil {
 				return nil, err
 			}
@@ -844,6 +929,96 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 	return rc, nil
 }
 
+// openArchiveFile opens the archive file at path. If there is no such file but
+// the archive was split into parts with mongodump's --maxFileSize, the parts
+// are read in order as a single archive.
+func openArchiveFile(path string) (io.ReadCloser, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		parts, partsErr := util.ArchiveParts(path)
+		if partsErr != nil {
+			return nil, partsErr
+		}
+		if len(parts) > 0 {
+			log.Logvf(log.DebugLow, "reading archive %v from %v parts", path, len(parts))
+			return util.NewPartsReader(parts)
+		}
+	}
+	return os.Open(path)
+}
+
+// verifyArchive checks the signature of the archive read by in before anything
+// is restored from it, and returns a reader of a verified copy of the archive
+// that the restore reads instead, so that the bytes that are restored are the
+// ones that were verified. It closes in.
+func (restore *MongoRestore) verifyArchive(in io.ReadCloser) (io.ReadCloser, error) {
+	defer in.Close()
+	log.Logvf(log.Always, "verifying the signature of archive '%v'", restore.InputOptions.Archive)
+	verified, err := archive.VerifiedCopy(in, restore.verifyKey)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to restore: %w", err)
+	}
+	log.Logv(log.Always, "archive signature verified")
+	return verified, nil
+}
+
+// verifyDumpFiles checks the files to restore against the signed manifest of
+// their dump directory before anything is restored from them.
+func (restore *MongoRestore) verifyDumpFiles() error {
+	paths := []string{restore.TargetDirectory}
+	if restore.InputOptions.OplogFile != "" {
+		paths = append(paths, restore.InputOptions.OplogFile)
+	}
+	for _, path := range paths {
+		log.Logvf(log.Always, "verifying %v against its signed manifest", path)
+		err := signing.VerifyPath(path, restore.verifyKey)
+		if err != nil {
+			return fmt.Errorf("refusing to restore: %w", err)
+		}
+	}
+	log.Logv(log.Always, "dump signature verified")
+	return nil
+}
+
+// seekArchiveWithIndex lets the demultiplexer skip the namespaces that are not
+// being restored when the archive is a regular file with a namespace index.
+func (restore *MongoRestore) seekArchiveWithIndex() error {
+	if !restore.archive.Prelude.Header.MayHaveIndex() {
+		return nil
+	}
+	if restore.InputOptions.Salvage {
+		log.Logv(log.DebugLow, "salvaging the archive, reading it sequentially")
+		return nil
+	}
+	if restore.verifyKey != nil {
+		// the index isn't covered by the signature
+		log.Logv(log.DebugLow, "archive is signed, reading it sequentially")
+		return nil
+	}
+	file, ok := restore.archive.In.(*os.File)
+	if !ok || restore.InputOptions.Archive == "-" {
+		log.Logv(log.DebugLow, "archive is not a regular file, reading it sequentially")
+		return nil
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !stat.Mode().IsRegular() {
+		log.Logv(log.DebugLow, "archive is not a regular file, reading it sequentially")
+		return nil
+	}
+	index, err := archive.ReadIndex(file, stat.Size())
+	if err == archive.ErrNoIndex {
+		log.Logv(log.Always, "archive does not have a complete namespace index, reading it sequentially")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return restore.archive.Demux.SeekWithIndex(file, index)
+}
+
 func (restore *MongoRestore) HandleInterrupt() {
 	restore.terminate.Store(true)
 }
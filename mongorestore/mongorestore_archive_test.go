@@ -7,7 +7,12 @@
 package mongorestore
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
 	"io"
 	"os"
 	"path/filepath"
@@ -16,6 +21,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/signing"
 	"github.com/mongodb/mongo-tools/common/testtype"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/mongodb/mongo-tools/mongodump"
@@ -452,3 +458,147 @@ func GetArchiveMongoRestore(input io.ReadCloser) (*MongoRestore, error) {
 
 	return restore, nil
 }
+
+func TestMongorestoreSalvageArchive(t *testing.T) {
+	require := require.New(t)
+
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	session, err := testutil.GetBareSession()
+	require.NoError(err, "can connect to server")
+
+	dbName := uniqueDBName()
+	testDB := session.Database(dbName)
+	defer func() {
+		err = testDB.Drop(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to drop test database: %v", err)
+		}
+	}()
+
+	simple := archive.SimpleArchive{}
+	for _, collName := range []string{"damaged", "intact"} {
+		simple.CollectionMetadata = append(simple.CollectionMetadata, archive.CollectionMetadata{
+			Database:   dbName,
+			Collection: collName,
+			Metadata:   `{"options":{},"indexes":[]}`,
+		})
+		namespace := archive.SimpleNamespace{Database: dbName, Collection: collName}
+		for i := 0; i < 10; i++ {
+			namespace.Documents = append(namespace.Documents, bson.D{{"_id", int32(i)}})
+		}
+		simple.Namespaces = append(simple.Namespaces, namespace)
+	}
+	data, err := simple.Marshal()
+	require.NoError(err)
+
+	// make the length of the fifth document of the damaged collection invalid
+	fifthDoc, err := bson.Marshal(bson.D{{"_id", int32(4)}})
+	require.NoError(err)
+	damagedAt := bytes.Index(data, fifthDoc)
+	require.Positive(damagedAt)
+	binary.LittleEndian.PutUint32(data[damagedAt:], 3)
+
+	archivePath := filepath.Join(t.TempDir(), "damaged.archive")
+	require.NoError(os.WriteFile(archivePath, data, 0o644))
+
+	restore, err := getRestoreWithArgs(DropOption, ArchiveOption+"="+archivePath)
+	require.NoError(err)
+	result := restore.Restore()
+	restore.Close()
+	require.Error(result.Err, "damage is fatal without --salvage")
+
+	restore, err = getRestoreWithArgs(DropOption, SalvageOption, ArchiveOption+"="+archivePath)
+	require.NoError(err)
+	defer restore.Close()
+	result = restore.Restore()
+	require.NoError(result.Err, "can run mongorestore with --salvage")
+
+	report := restore.archive.Demux.SalvageReport
+	require.Len(report.Skipped, 1)
+	require.Equal(dbName+".damaged", report.Skipped[0].Namespace)
+	require.Equal(int64(damagedAt), report.Skipped[0].Offset)
+	require.Equal([]string{dbName + ".damaged"}, report.CRCMismatches)
+
+	count, err := testDB.Collection("damaged").CountDocuments(context.Background(), bson.D{})
+	require.NoError(err)
+	require.EqualValues(4, count, "documents before the damage are restored")
+	count, err = testDB.Collection("intact").CountDocuments(context.Background(), bson.D{})
+	require.NoError(err)
+	require.EqualValues(10, count, "collections after the damage are restored")
+}
+
+func TestMongorestoreVerifySignature(t *testing.T) {
+	require := require.New(t)
+
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	session, err := testutil.GetBareSession()
+	require.NoError(err, "can connect to server")
+
+	dbName := uniqueDBName()
+	testDB := session.Database(dbName)
+	defer func() {
+		err = testDB.Drop(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to drop test database: %v", err)
+		}
+	}()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(err)
+	keyPath := filepath.Join(t.TempDir(), "key.pub.pem")
+	require.NoError(os.WriteFile(
+		keyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		0o644,
+	))
+
+	dumpDir := t.TempDir()
+	bsonPath := filepath.Join(dumpDir, dbName, "signed.bson")
+	require.NoError(os.MkdirAll(filepath.Dir(bsonPath), 0o755))
+	var data []byte
+	for i := 0; i < 10; i++ {
+		doc, err := bson.Marshal(bson.D{{"_id", int32(i)}})
+		require.NoError(err)
+		data = append(data, doc...)
+	}
+	require.NoError(os.WriteFile(bsonPath, data, 0o644))
+
+	restore, err := getRestoreWithArgs(DropOption, VerifySignatureKeyOption, keyPath, dumpDir)
+	require.NoError(err)
+	result := restore.Restore()
+	restore.Close()
+	require.ErrorIs(result.Err, signing.ErrNoManifest, "unsigned dumps are refused")
+
+	require.NoError(signing.SignDirectory(dumpDir, private))
+	restore, err = getRestoreWithArgs(DropOption, VerifySignatureKeyOption, keyPath, dumpDir)
+	require.NoError(err)
+	result = restore.Restore()
+	restore.Close()
+	require.NoError(result.Err, "signed dumps are restored")
+	count, err := testDB.Collection("signed").CountDocuments(context.Background(), bson.D{})
+	require.NoError(err)
+	require.EqualValues(10, count)
+
+	data[len(data)-2] ^= 0x01
+	require.NoError(os.WriteFile(bsonPath, data, 0o644))
+	restore, err = getRestoreWithArgs(DropOption, VerifySignatureKeyOption, keyPath, dumpDir)
+	require.NoError(err)
+	result = restore.Restore()
+	restore.Close()
+	require.ErrorContains(result.Err, "does not match its digest", "tampered dumps are refused")
+
+	restore, err = getRestoreWithArgs(
+		DropOption,
+		VerifySignatureKeyOption,
+		keyPath,
+		ArchiveOption+"="+testArchive,
+	)
+	require.NoError(err)
+	result = restore.Restore()
+	restore.Close()
+	require.ErrorIs(result.Err, archive.ErrNotSigned, "unsigned archives are refused")
+}
@@ -25,61 +25,6 @@ import (
 	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 )
 
-func TestTimestampStringParsing(t *testing.T) {
-
-	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
-
-	Convey("Testing some possible timestamp strings:", t, func() {
-		Convey("123:456 [should pass]", func() {
-			ts, err := ParseTimestampFlag("123:456")
-			So(err, ShouldBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{T: 123, I: 456})
-		})
-
-		Convey("123 [should pass]", func() {
-			ts, err := ParseTimestampFlag("123")
-			So(err, ShouldBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{T: 123, I: 0})
-		})
-
-		Convey("123: [should pass]", func() {
-			ts, err := ParseTimestampFlag("123:")
-			So(err, ShouldBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{T: 123, I: 0})
-		})
-
-		Convey("123.123 [should fail]", func() {
-			ts, err := ParseTimestampFlag("123.123")
-			So(err, ShouldNotBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{})
-		})
-
-		Convey(": [should fail]", func() {
-			ts, err := ParseTimestampFlag(":")
-			So(err, ShouldNotBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{})
-		})
-
-		Convey("1:1:1 [should fail]", func() {
-			ts, err := ParseTimestampFlag("1:1:1")
-			So(err, ShouldNotBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{})
-		})
-
-		Convey("cats [should fail]", func() {
-			ts, err := ParseTimestampFlag("cats")
-			So(err, ShouldNotBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{})
-		})
-
-		Convey("[empty string] [should fail]", func() {
-			ts, err := ParseTimestampFlag("")
-			So(err, ShouldNotBeNil)
-			So(ts, ShouldResemble, primitive.Timestamp{})
-		})
-	})
-}
-
 func TestValidOplogLimitChecking(t *testing.T) {
 
 	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
@@ -46,6 +46,8 @@ const (
 	RestoreDBUsersAndRolesOption = "--restoreDbUsersAndRoles"
 	DirectoryOption              = "--dir"
 	GzipOption                   = "--gzip"
+	SalvageOption                = "--salvage"
+	VerifySignatureKeyOption     = "--verifySignatureKey"
 )
 
 // InputOptions defines the set of options to use in configuring the restore process.
@@ -58,6 +60,8 @@ type InputOptions struct {
 	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
 	Directory              string `long:"dir" value-name:"<directory-name>" description:"input directory, use '-' for stdin"`
 	Gzip                   bool   `long:"gzip" description:"decompress gzipped input"`
+	Salvage                bool   `long:"salvage" description:"skip the damaged parts of an archive and restore the rest, then report which namespaces lost data"`
+	VerifySignatureKey     string `long:"verifySignatureKey" value-name:"<filename>" description:"refuse to restore a dump or archive that isn't signed with the private key matching the Ed25519 public key in the given PEM file, or that was changed after it was signed; an archive is first copied in full to the directory for temporary files, which needs as much free space as the archive, and verified; it's then restored from the copy from start to end, without using its namespace index to skip namespaces"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -84,6 +88,10 @@ const (
 	TempRolesCollOption            = "--tempRolesColl"
 	BulkBufferSizeOption           = "--batchSize"
 	FixDottedHashedIndexesOption   = "--fixDottedHashIndex"
+	OverlapIndexBuildsOption       = "--overlapIndexBuilds"
+	NumParallelIndexBuildsOption   = "--numParallelIndexBuilds"
+	CommitQuorumOption             = "--commitQuorum"
+	HideIndexesOption              = "--hideIndexes"
 )
 
 // OutputOptions defines the set of options for restoring dump data.
@@ -92,21 +100,25 @@ type OutputOptions struct {
 	DryRun bool `long:"dryRun" description:"view summary without importing anything. recommended with verbosity"`
 
 	// By default mongorestore uses a write concern of 'majority'.
-	WriteConcern             string `long:"writeConcern" value-name:"<write-concern>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
-	NoIndexRestore           bool   `long:"noIndexRestore" description:"don't restore indexes"`
-	ConvertLegacyIndexes     bool   `long:"convertLegacyIndexes" description:"Removes invalid index options and rewrites legacy option values (e.g. true becomes 1)."`
-	NoOptionsRestore         bool   `long:"noOptionsRestore" description:"don't restore collection options"`
-	KeepIndexVersion         bool   `long:"keepIndexVersion" description:"don't update index version"`
-	MaintainInsertionOrder   bool   `long:"maintainInsertionOrder" description:"restore the documents in the order of their appearance in the input source. By default the insertions will be performed in an arbitrary order. Setting this flag also enables the behavior of --stopOnError and restricts NumInsertionWorkersPerCollection to 1."`
-	NumParallelCollections   int    `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel" default:"4" default-mask:"-"`
-	NumInsertionWorkers      int    `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection" default:"1" default-mask:"-"`
-	StopOnError              bool   `long:"stopOnError" description:"halt after encountering any error during insertion. By default, mongorestore will attempt to continue through document validation and DuplicateKey errors, but with this option enabled, the tool will stop instead. A small number of documents may be inserted after encountering an error even with this option enabled; use --maintainInsertionOrder to halt immediately after an error"`
-	BypassDocumentValidation bool   `long:"bypassDocumentValidation" description:"bypass document validation"`
-	PreserveUUID             bool   `long:"preserveUUID" description:"preserve original collection UUIDs (off by default, requires drop)"`
-	TempUsersColl            string `long:"tempUsersColl" default:"tempusers" hidden:"true"`
-	TempRolesColl            string `long:"tempRolesColl" default:"temproles" hidden:"true"`
-	BulkBufferSize           int    `long:"batchSize" default:"1000" hidden:"true"`
-	FixDottedHashedIndexes   bool   `long:"fixDottedHashIndex" description:"when enabled, all the hashed indexes on dotted fields will be created as single field ascending indexes on the destination"`
+	WriteConcern             string   `long:"writeConcern" value-name:"<write-concern>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
+	NoIndexRestore           bool     `long:"noIndexRestore" description:"don't restore indexes"`
+	ConvertLegacyIndexes     bool     `long:"convertLegacyIndexes" description:"Removes invalid index options and rewrites legacy option values (e.g. true becomes 1)."`
+	NoOptionsRestore         bool     `long:"noOptionsRestore" description:"don't restore collection options"`
+	KeepIndexVersion         bool     `long:"keepIndexVersion" description:"don't update index version"`
+	MaintainInsertionOrder   bool     `long:"maintainInsertionOrder" description:"restore the documents in the order of their appearance in the input source. By default the insertions will be performed in an arbitrary order. Setting this flag also enables the behavior of --stopOnError and restricts NumInsertionWorkersPerCollection to 1."`
+	NumParallelCollections   int      `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel" default:"4" default-mask:"-"`
+	NumInsertionWorkers      int      `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection" default:"1" default-mask:"-"`
+	StopOnError              bool     `long:"stopOnError" description:"halt after encountering any error during insertion. By default, mongorestore will attempt to continue through document validation and DuplicateKey errors, but with this option enabled, the tool will stop instead. A small number of documents may be inserted after encountering an error even with this option enabled; use --maintainInsertionOrder to halt immediately after an error"`
+	BypassDocumentValidation bool     `long:"bypassDocumentValidation" description:"bypass document validation"`
+	PreserveUUID             bool     `long:"preserveUUID" description:"preserve original collection UUIDs (off by default, requires drop)"`
+	TempUsersColl            string   `long:"tempUsersColl" default:"tempusers" hidden:"true"`
+	TempRolesColl            string   `long:"tempRolesColl" default:"temproles" hidden:"true"`
+	BulkBufferSize           int      `long:"batchSize" default:"1000" hidden:"true"`
+	FixDottedHashedIndexes   bool     `long:"fixDottedHashIndex" description:"when enabled, all the hashed indexes on dotted fields will be created as single field ascending indexes on the destination"`
+	OverlapIndexBuilds       bool     `long:"overlapIndexBuilds" description:"build the indexes of each collection as soon as its data has been restored, while other collections are still being restored. Cannot be used with --oplogReplay"`
+	NumParallelIndexBuilds   int      `long:"numParallelIndexBuilds" description:"number of collections to build indexes for in parallel while data is still being restored; only used with --overlapIndexBuilds" default:"2" default-mask:"-"`
+	CommitQuorum             string   `long:"commitQuorum" value-name:"<quorum>" description:"commit quorum to use for index builds, e.g. --commitQuorum majority, --commitQuorum votingMembers, --commitQuorum 2 (requires server 4.4+, ignored when restoring to a standalone server)"`
+	HideIndexes              []string `long:"hideIndexes" value-name:"<namespace-pattern>" description:"build the restored indexes of matching namespaces as hidden indexes (may be specified multiple times; requires server 4.4+)"`
 }
 
 // Name returns a human-readable group name for output options.
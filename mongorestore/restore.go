@@ -103,6 +103,9 @@ func (restore *MongoRestore) RestoreIndexes() error {
 						errChan <- nil // done
 						return
 					}
+					if restore.indexesAlreadyBuilt(namespace) {
+						continue
+					}
 					err := restore.RestoreIndexesForNamespace(namespace)
 					if err != nil {
 						errChan <- err
@@ -129,6 +132,9 @@ func (restore *MongoRestore) RestoreIndexes() error {
 		if namespace == nil {
 			break
 		}
+		if restore.indexesAlreadyBuilt(namespace) {
+			continue
+		}
 		err := restore.RestoreIndexesForNamespace(namespace)
 		if err != nil {
 			return err
@@ -180,6 +186,7 @@ func (restore *MongoRestore) RestoreIndexesForNamespace(namespace *options.Names
 		if restore.OutputOptions.FixDottedHashedIndexes {
 			fixDottedHashedIndexes(indexes)
 		}
+		restore.hideIndexes(namespace, indexes)
 		for _, index := range indexes {
 			log.Logvf(log.Always, "index: %#v", index)
 		}
@@ -318,6 +325,7 @@ func (restore *MongoRestore) RestoreIntents() Result {
 						return
 					}
 					restore.manager.Finish(intent)
+					restore.submitIndexBuilds(intent)
 					if fileNeedsIOBuffer, ok := intent.BSONFile.(intents.FileNeedsIOBuffer); ok {
 						fileNeedsIOBuffer.ReleaseIOBuffer()
 					}
@@ -352,6 +360,7 @@ func (restore *MongoRestore) RestoreIntents() Result {
 			return totalResult.withErr(fmt.Errorf("%v: %v", intent.Namespace(), result.Err))
 		}
 		restore.manager.Finish(intent)
+		restore.submitIndexBuilds(intent)
 	}
 	return totalResult
 }
@@ -41,6 +41,7 @@ import (
 // to the location of this go file.
 var binaries = []string{
 	"bsondump",
+	"mongoarchive",
 	"mongodump",
 	"mongoexport",
 	"mongofiles",